@@ -0,0 +1,42 @@
+package assisted_installer_controller
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// isAPINotReady tells whether the error is one the API server returns, or the connection fails with,
+// while it isn't serving yet, e.g. during the pivot of the bootstrap host
+func isAPINotReady(err error) bool {
+	if apierrors.IsServiceUnavailable(err) || apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err) ||
+		apierrors.IsTooManyRequests(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// logListNodesError logs failing to list the nodes at debug level during the API warm up period,
+// afterwards an API server that isn't ready is a warning and any other failure an error
+func (c controller) logListNodesError(err error, warmingUp bool) {
+	log := c.log.WithError(err)
+	switch {
+	case warmingUp:
+		log.Debugf("Failed to list nodes, API server may not be ready yet")
+	case isAPINotReady(err):
+		log.Warnf("Failed to list nodes, API server is not ready")
+	default:
+		log.Errorf("Failed to list nodes")
+	}
+}
+
+// logNoNodes logs listing no nodes while hosts are still pending, it is expected during the API warm up period
+func (c controller) logNoNodes(pending int, warmingUp bool) {
+	if warmingUp {
+		c.log.Debugf("No nodes were listed yet while %d hosts are pending", pending)
+		return
+	}
+	c.log.Warnf("No nodes were listed while %d hosts are pending", pending)
+}
@@ -1,7 +1,15 @@
 package assisted_installer_controller
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,145 +18,969 @@ import (
 	"github.com/openshift/assisted-installer/src/inventory_client"
 	"github.com/openshift/assisted-installer/src/k8s_client"
 	"github.com/openshift/assisted-installer/src/ops"
+	"github.com/openshift/assisted-installer/src/utils"
+	"github.com/openshift/assisted-installer/src/version"
 	"github.com/openshift/assisted-service/models"
 
 	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/pkg/apis/metal3/v1alpha1"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/certificates/v1beta1"
 	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/util/flowcontrol"
 )
 
 const (
-	generalWaitTimeoutInt = 30
+	generalWaitTimeoutInt  = 30
+	ingressCMName          = "default-ingress-cert"
+	ingressCMNamespace     = "openshift-config-managed"
+	unpatchEtcdMaxAttempts = 10
+	listBMHsMaxAttempts    = 3
+	// defaultWaitInterval is used when WAIT_INTERVAL is not set
+	defaultWaitInterval = generalWaitTimeoutInt * time.Second
+	// retryMaxDelayFactor bounds the backoff between retries to this many times the wait interval
+	retryMaxDelayFactor = 4
+	// podLogsTimeout bounds fetching the logs of a pod, so a slow stream can't stall the polling
+	podLogsTimeout = 30 * time.Second
+	// malformedStatusAnnotationMaxAttempts is the number of polls a malformed BMH status annotation gets
+	// to be fixed before it is removed
+	malformedStatusAnnotationMaxAttempts = 3
 )
 
-var GeneralWaitTimeout = generalWaitTimeoutInt * time.Second
+const (
+	defaultMcsNamespace     = "openshift-machine-config-operator"
+	defaultConsoleNamespace = "openshift-console"
+)
+
+var (
+	defaultMcsLabels     = map[string]string{"k8s-app": "machine-config-server"}
+	defaultConsoleLabels = map[string]string{"app": "console", "component": "ui"}
+	// hosts in error are not ignored by default, so the ones that fail while waiting are reported
+	defaultIgnoredHostStatuses = []string{models.HostStatusDisabled, models.HostStatusInstalled}
+)
+
+var (
+	// ErrNodesJoinTimeout is returned by WaitAndUpdateNodesStatus once the hosts didn't join within NodeJoinTimeout
+	ErrNodesJoinTimeout = errors.New("timed out waiting for the hosts to join the cluster")
+	// ErrTooManyErroredHosts is returned by WaitAndUpdateNodesStatus once more than MaxErroredHosts hosts moved to error
+	ErrTooManyErroredHosts = errors.New("too many hosts moved to error")
+)
 
 // assisted installer controller is added to control installation process after  bootstrap pivot
 // assisted installer will deploy it on installation process
 // as a first step it will wait till nodes are added to cluster and update their status to Done
 
 type ControllerConfig struct {
-	ClusterID            string `envconfig:"CLUSTER_ID" required:"true" `
-	URL                  string `envconfig:"INVENTORY_URL" required:"true"`
-	PullSecretToken      string `envconfig:"PULL_SECRET_TOKEN" required:"true"`
-	SkipCertVerification bool   `envconfig:"SKIP_CERT_VERIFICATION" required:"false" default:"false"`
-	CACertPath           string `envconfig:"CA_CERT_PATH" required:"false" default:""`
+	ClusterID            string        `envconfig:"CLUSTER_ID" required:"true" `
+	URL                  string        `envconfig:"INVENTORY_URL" required:"true"`
+	PullSecretToken      string        `envconfig:"PULL_SECRET_TOKEN" required:"false"`
+	SkipCertVerification bool          `envconfig:"SKIP_CERT_VERIFICATION" required:"false" default:"false"`
+	CACertPath           string        `envconfig:"CA_CERT_PATH" required:"false" default:""`
+	NodeJoinTimeout      time.Duration `envconfig:"NODE_JOIN_TIMEOUT" required:"false" default:"60m"`
+	// CompleteInstallation retries are delayed with exponential backoff between the min and max delays,
+	// non positive max retries means retrying until success
+	CompleteInstallationRetryMinDelay time.Duration `envconfig:"COMPLETE_INSTALLATION_RETRY_MIN_DELAY" required:"false" default:"1s"`
+	CompleteInstallationRetryMaxDelay time.Duration `envconfig:"COMPLETE_INSTALLATION_RETRY_MAX_DELAY" required:"false" default:"30s"`
+	CompleteInstallationMaxRetries    int           `envconfig:"COMPLETE_INSTALLATION_MAX_RETRIES" required:"false" default:"20"`
+	MetricsAddress                    string        `envconfig:"METRICS_ADDRESS" required:"false" default:""`
+	ConsoleWaitTimeout                time.Duration `envconfig:"CONSOLE_WAIT_TIMEOUT" required:"false" default:"20m"`
+	IngressCATimeout                  time.Duration `envconfig:"INGRESS_CA_TIMEOUT" required:"false" default:"20m"`
+	UnpatchEtcdTimeout                time.Duration `envconfig:"UNPATCH_ETCD_TIMEOUT" required:"false" default:"10m"`
+	// IngressCARotationWindow is the time to keep uploading the ingress ca whenever it changes, 0 disables it
+	IngressCARotationWindow time.Duration `envconfig:"INGRESS_CA_ROTATION_WINDOW" required:"false" default:"0"`
+	// ReadinessChecks are evaluated before completing the installation, failed checks are reported as warnings
+	ReadinessChecks        ReadinessChecks `envconfig:"READINESS_CHECKS" required:"false" default:"[]"`
+	ReadinessChecksTimeout time.Duration   `envconfig:"READINESS_CHECKS_TIMEOUT" required:"false" default:"20m"`
+	// CsrApprovalGracePeriod is the time to keep approving csrs after all the nodes joined
+	CsrApprovalGracePeriod time.Duration `envconfig:"CSR_APPROVAL_GRACE_PERIOD" required:"false" default:"10m"`
+	// LogFormat is either text or json
+	LogFormat string `envconfig:"LOG_FORMAT" required:"false" default:"text"`
+	// DryRun only logs the changes that would have been done to the cluster and to the inventory
+	DryRun bool `envconfig:"DRY_RUN" required:"false" default:"false"`
+	// PollJitterFactor spreads every poll interval randomly by up to ±factor of it, so controllers of
+	// clusters that install at the same time don't hit assisted-service in lockstep
+	PollJitterFactor float64 `envconfig:"POLL_JITTER_FACTOR" required:"false" default:"0.2"`
+	// Proxy settings of the inventory client, when not set the cluster wide proxy is used
+	HTTPProxy  string `envconfig:"INVENTORY_HTTP_PROXY" required:"false" default:""`
+	HTTPSProxy string `envconfig:"INVENTORY_HTTPS_PROXY" required:"false" default:""`
+	NoProxy    string `envconfig:"INVENTORY_NO_PROXY" required:"false" default:""`
+	// StrictHostMatching requires the node system uuid to match the inventory host id and not only its name
+	StrictHostMatching bool `envconfig:"STRICT_HOST_MATCHING" required:"false" default:"false"`
+	// Eligible csrs are approved concurrently, rate limited to CsrApprovalQPS approvals per second with bursts
+	// of up to CsrApprovalBurst, non positive qps means no rate limit
+	CsrApprovalConcurrency int     `envconfig:"CSR_APPROVAL_CONCURRENCY" required:"false" default:"5"`
+	CsrApprovalQPS         float32 `envconfig:"CSR_APPROVAL_QPS" required:"false" default:"10"`
+	CsrApprovalBurst       int     `envconfig:"CSR_APPROVAL_BURST" required:"false" default:"10"`
+	// BootstrapCompleteTimeout bounds the wait for bootstrap to complete before tracking nodes status
+	BootstrapCompleteTimeout time.Duration `envconfig:"BOOTSTRAP_COMPLETE_TIMEOUT" required:"false" default:"30m"`
+	// DisableCSRApproval leaves csrs to an external approver or to manual approval
+	DisableCSRApproval bool `envconfig:"DISABLE_CSR_APPROVAL" required:"false" default:"false"`
+	// Namespaces and label selectors, formatted as key1:value1,key2:value2, of the mcs and console pods.
+	// Empty values fall back to the defaults of the current OpenShift versions
+	McsNamespace     string            `envconfig:"MCS_NAMESPACE" required:"false" default:"openshift-machine-config-operator"`
+	McsLabels        map[string]string `envconfig:"MCS_LABELS" required:"false" default:"k8s-app:machine-config-server"`
+	ConsoleNamespace string            `envconfig:"CONSOLE_NAMESPACE" required:"false" default:"openshift-console"`
+	ConsoleLabels    map[string]string `envconfig:"CONSOLE_LABELS" required:"false" default:"app:console,component:ui"`
+	// CheckpointPath is a file the progress is saved to, so a restarted controller resumes from it, empty disables it
+	CheckpointPath string `envconfig:"CHECKPOINT_PATH" required:"false" default:""`
+	// MaxErroredHosts fails the installation once more hosts than it moved to error while waiting for the nodes
+	// to join, non positive means waiting for the other hosts anyway
+	MaxErroredHosts int `envconfig:"MAX_ERRORED_HOSTS" required:"false" default:"0"`
+	// BootstrapHostname identifies the bootstrap host that pivots to a master, empty identifies it by its inventory role
+	BootstrapHostname string `envconfig:"BOOTSTRAP_HOSTNAME" required:"false" default:""`
+	// CACertReloadInterval is how often CACertPath is checked for changes, non positive means it is loaded only once
+	CACertReloadInterval time.Duration `envconfig:"CA_CERT_RELOAD_INTERVAL" required:"false" default:"0"`
+	// ClusterOperators must be available and not degraded before completing the installation, empty doesn't wait for them
+	ClusterOperators        []string      `envconfig:"CLUSTER_OPERATORS" required:"false" default:"authentication,console,dns,etcd,ingress,kube-apiserver,kube-controller-manager,kube-scheduler,network,openshift-apiserver"`
+	ClusterOperatorsTimeout time.Duration `envconfig:"CLUSTER_OPERATORS_TIMEOUT" required:"false" default:"60m"`
+	// MaxGoRoutineRestarts is the number of times a controller go routine is restarted after a panic
+	MaxGoRoutineRestarts int `envconfig:"MAX_GOROUTINE_RESTARTS" required:"false" default:"3"`
+	// IgnoredHostStatuses are the statuses of the hosts that are not waited for to join, empty falls back to disabled and installed
+	IgnoredHostStatuses []string `envconfig:"IGNORED_HOST_STATUSES" required:"false" default:"disabled,installed"`
+	// IngressCAConfigMaps are the namespace/name of the configmaps whose ca bundles are combined into the
+	// uploaded ingress ca, empty falls back to the default ingress cert configmap
+	IngressCAConfigMaps []string `envconfig:"INGRESS_CA_CONFIGMAPS" required:"false" default:"openshift-config-managed/default-ingress-cert"`
+	// APIWarmupPeriod is the time after starting to wait for the nodes in which failing to list them is expected
+	// while the API server stabilizes, so it is logged at debug level
+	APIWarmupPeriod time.Duration `envconfig:"API_WARMUP_PERIOD" required:"false" default:"5m"`
+	// InstallMode is either Full or AddHosts, where the hosts are added to an installed cluster and only
+	// their nodes and csrs are tracked, empty falls back to Full
+	InstallMode string `envconfig:"INSTALL_MODE" required:"false" default:"Full"`
+	// NonCriticalPostInstallStages are the post install stages whose failure completes the installation
+	// successfully with a warning, empty makes all the stages critical
+	NonCriticalPostInstallStages []string `envconfig:"NON_CRITICAL_POST_INSTALL_STAGES" required:"false" default:""`
+	// ParallelPostInstallStages runs the post install stages concurrently instead of one after the other
+	ParallelPostInstallStages bool `envconfig:"PARALLEL_POST_INSTALL_STAGES" required:"false" default:"false"`
+	// EtcdExpectedMembers overrides the number of healthy etcd members to wait for before unpatching etcd,
+	// zero waits for the control plane replicas of the cluster
+	EtcdExpectedMembers int `envconfig:"ETCD_EXPECTED_MEMBERS" required:"false" default:"0"`
+	// ExpectedNodeCount is the total number of nodes of the cluster, zero infers it from the hosts that are pending
+	ExpectedNodeCount int `envconfig:"EXPECTED_NODE_COUNT" required:"false" default:"0"`
+	// NodeJoinStallWindow reports the nodes join as stalled once no node joined within it, zero disables it
+	NodeJoinStallWindow time.Duration `envconfig:"NODE_JOIN_STALL_WINDOW" required:"false" default:"20m"`
+	// NotifyWebhookURL is posted a json notification once the installation completes, empty disables it
+	NotifyWebhookURL string `envconfig:"NOTIFY_WEBHOOK_URL" required:"false" default:""`
+	// KubeconfigPath runs the controller outside the cluster with this kubeconfig, empty uses the in-cluster config
+	KubeconfigPath string `envconfig:"KUBECONFIG_PATH" required:"false" default:""`
+	// WaitInterval is the interval between the polls of all the loops, zero uses the default
+	WaitInterval time.Duration `envconfig:"WAIT_INTERVAL" required:"false" default:"30s"`
+	// CordonErroredNodes cordons the node of a joined host that moved to error, so no workloads are scheduled on it
+	CordonErroredNodes bool `envconfig:"CORDON_ERRORED_NODES" required:"false" default:"false"`
+	// BMHUpdateConcurrency is the number of BMHs updated at a time, non positive updates them one by one
+	BMHUpdateConcurrency int `envconfig:"BMH_UPDATE_CONCURRENCY" required:"false" default:"5"`
+	// LogsUploadInterval is how often the last LogsTailLines lines of the controller logs are uploaded to
+	// assisted-service, non positive disables it
+	LogsUploadInterval time.Duration `envconfig:"LOGS_UPLOAD_INTERVAL" required:"false" default:"0"`
+	LogsTailLines      int           `envconfig:"LOGS_TAIL_LINES" required:"false" default:"1000"`
+	// MinReadyMasters is the number of ready master nodes required before running the post install configs when
+	// the master hosts of the cluster are unknown, their number is required otherwise. Non positive relies on the
+	// cluster finalizing status only
+	MinReadyMasters int `envconfig:"MIN_READY_MASTERS" required:"false" default:"3"`
+	// AnnotateNodes annotates every node with the id of its assisted-service host once it joins
+	AnnotateNodes bool `envconfig:"ANNOTATE_NODES" required:"false" default:"true"`
+	// Poll intervals of the csrs approval, the nodes status, the BMHs update and the wait for the cluster to be
+	// finalizing before the post install configs, zero falls back to WaitInterval
+	CSRPollInterval         time.Duration `envconfig:"CSR_POLL_INTERVAL" required:"false" default:"30s"`
+	NodeStatusPollInterval  time.Duration `envconfig:"NODE_STATUS_POLL_INTERVAL" required:"false" default:"30s"`
+	BMHPollInterval         time.Duration `envconfig:"BMH_POLL_INTERVAL" required:"false" default:"30s"`
+	PostInstallPollInterval time.Duration `envconfig:"POST_INSTALL_POLL_INTERVAL" required:"false" default:"30s"`
+	// ForceCompleteConfigMap is the namespace/name of a configmap an operator annotates to force the installation
+	// completion of a stuck installation, empty disables it
+	ForceCompleteConfigMap string `envconfig:"FORCE_COMPLETE_CONFIGMAP" required:"false" default:""`
+	// PullSecretTokenPath is a mounted file the pull secret token is read from when PULL_SECRET_TOKEN isn't set,
+	// keeping the token out of the process environment
+	PullSecretTokenPath string `envconfig:"PULL_SECRET_TOKEN_PATH" required:"false" default:""`
+	// UncordonNodes uncordons the nodes left unschedulable by an earlier phase before completing the installation
+	UncordonNodes bool `envconfig:"UNCORDON_NODES" required:"false" default:"false"`
+	// McsCandidates is a json list of {"namespace": ..., "labels": {...}} the mcs pods are looked for in when none
+	// is found with the mcs namespace and labels, the first candidate that has pods is used
+	McsCandidates PodSelectors `envconfig:"MCS_CANDIDATES" required:"false" default:"[]"`
+	// InstallDeadline fails the installation once it didn't complete that long after the controller started,
+	// 0 disables it
+	InstallDeadline time.Duration `envconfig:"INSTALL_DEADLINE" required:"false" default:"0"`
+	// NotReadyNodeStage is the host stage reported once its node joined and ReadyNodeStage once its kubelet is ready,
+	// the host is reported Done on the following poll. Empty ReadyNodeStage reports Done once the node is ready
+	NotReadyNodeStage models.HostStage `envconfig:"NOT_READY_NODE_STAGE" required:"false" default:"Joined"`
+	ReadyNodeStage    models.HostStage `envconfig:"READY_NODE_STAGE" required:"false" default:"Configuring"`
+	// PreflightTimeout bounds the checks that assisted-service and the cluster API are reachable before starting,
+	// 0 skips them
+	PreflightTimeout time.Duration `envconfig:"PREFLIGHT_TIMEOUT" required:"false" default:"1m"`
+	// CSRApprovalMinAge leaves csrs younger than it pending till a later poll, 0 approves them right away
+	CSRApprovalMinAge time.Duration `envconfig:"CSR_APPROVAL_MIN_AGE" required:"false" default:"0"`
+	// InventorySlowRequestThreshold logs assisted-service requests that took at least that long, 0 disables it
+	InventorySlowRequestThreshold time.Duration `envconfig:"INVENTORY_SLOW_REQUEST_THRESHOLD" required:"false" default:"10s"`
+	// ClockSkewThreshold warns once the clock of a node, as seen in its conditions heartbeats, is skewed by more
+	// than it from the controller clock. It must exceed the node status update interval, 0 disables it
+	ClockSkewThreshold time.Duration `envconfig:"CLOCK_SKEW_THRESHOLD" required:"false" default:"10m"`
+	// DiagnosticNamespaces are the namespaces whose recent pod logs are added to the failure diagnostics, empty
+	// falls back to assisted-installer, openshift-machine-api, openshift-cluster-version, the mcs and console namespaces
+	DiagnosticNamespaces []string `envconfig:"DIAGNOSTIC_NAMESPACES" required:"false" default:""`
+	// AllClusterOperatorsTimeout is how long to wait before completing the installation for all the cluster operators
+	// to be available and not progressing, the ones that didn't settle are reported in the completion error info.
+	// 0 doesn't wait for them
+	AllClusterOperatorsTimeout time.Duration `envconfig:"ALL_CLUSTER_OPERATORS_TIMEOUT" required:"false" default:"0"`
+	// AdditionalCAPaths are PEM files of additional trusted cas that are uploaded along with the ingress ca
+	AdditionalCAPaths []string `envconfig:"ADDITIONAL_CA_PATHS" required:"false" default:""`
+	// ClientCertPath and ClientKeyPath are the PEM files of the client certificate presented to assisted-service
+	// for mutual TLS, both or neither must be set
+	ClientCertPath string `envconfig:"CLIENT_CERT_PATH" required:"false" default:""`
+	ClientKeyPath  string `envconfig:"CLIENT_KEY_PATH" required:"false" default:""`
+	// FinalizingTimeout is how long a finalizing cluster waits for its masters to be ready before the post install
+	// configs run anyway, the controller advances the cluster out of finalizing itself. 0 waits forever
+	FinalizingTimeout time.Duration `envconfig:"FINALIZING_TIMEOUT" required:"false" default:"30m"`
+	// HostJoinTimeout flags once every host that is pending for longer than it while the other hosts keep joining,
+	// unlike NodeJoinTimeout it doesn't fail the installation. 0 disables it
+	HostJoinTimeout time.Duration `envconfig:"HOST_JOIN_TIMEOUT" required:"false" default:"0"`
+	// PauseAddress serves the unauthenticated POST /pause and /resume requests, it must be a localhost address.
+	// Empty disables them, the controller is still paused by SIGUSR1 and resumed by SIGUSR2
+	PauseAddress string `envconfig:"PAUSE_ADDRESS" required:"false" default:""`
 }
 
 type Controller interface {
-	WaitAndUpdateNodesStatus()
+	Run(ctx context.Context) error
+	WaitForBootstrapComplete(ctx context.Context) error
+	WaitAndUpdateNodesStatus(ctx context.Context) (NodesJoinSummary, error)
+	ApproveCsrs(ctx context.Context, wg *sync.WaitGroup)
+	PostInstallConfigs(ctx context.Context, wg *sync.WaitGroup)
+	UpdateBMHs(ctx context.Context, wg *sync.WaitGroup)
+	Pause()
+	Resume()
 }
 
 type controller struct {
 	ControllerConfig
-	log *logrus.Logger
+	log *logrus.Entry
 	ops ops.Ops
 	ic  inventory_client.InventoryClient
 	kc  k8s_client.K8SClient
+
+	metrics    *controllerMetrics
+	mcsLogs    *mcsLogsTracker
+	stuckCsrs  *stuckCsrsTracker
+	progress   *progressTracker
+	checkpoint *checkpointTracker
+	pause      *pauseSwitch
+
+	csrRateLimiter flowcontrol.RateLimiter
+	// malformedStatusAnnotations counts the attempts to parse the malformed status annotation of every BMH
+	malformedStatusAnnotations map[types.UID]int
+	// clock drives the polling loops, tests replace it with a fake clock
+	clock clock.Clock
+	// notifier is told about the installation completion, nil when no notifier is configured
+	notifier completionNotifier
+	started  time.Time
+	// waitInterval is the interval between polls and the initial delay between retries
+	waitInterval time.Duration
+	// logsTail keeps the tail of the controller logs that is uploaded, nil when uploading it is disabled
+	logsTail *logsTailHook
+	// diagnosticsUploaded is set once the failure diagnostics bundle was uploaded, the logs tail must not replace it
+	diagnosticsUploaded *completionSwitch
+	// annotatedNodes maps the nodes that were annotated to their host id, it is used by the nodes status loop only
+	annotatedNodes map[string]string
+	// readyStageReported are the hosts whose ready node was reported with ReadyNodeStage, used by the nodes status loop only
+	readyStageReported map[string]bool
+	// matchedNodes maps the hosts to the name of the node they were matched to, used by the nodes status loop only
+	matchedNodes map[string]string
+	// clockSkewReported is set once a skewed node clock was reported, used by the nodes status loop only
+	clockSkewReported bool
+	forceComplete     *completionSwitch
+	// completed is set once assisted-service recorded the installation completion
+	completed *completionSwitch
+	// hostsProgressUnsupported is set once assisted-service failed updating several hosts at once as unsupported,
+	// used by the nodes status loop only
+	hostsProgressUnsupported bool
+	// serviceEventsUnsupported is set once assisted-service failed adding an event as unsupported
+	serviceEventsUnsupported *completionSwitch
 }
 
 func NewController(log *logrus.Logger, cfg ControllerConfig, ops ops.Ops, ic inventory_client.InventoryClient, kc k8s_client.K8SClient) *controller {
-	return &controller{
-		log:              log,
-		ControllerConfig: cfg,
-		ops:              ops,
-		ic:               ic,
-		kc:               kc,
+	var csrRateLimiter flowcontrol.RateLimiter
+	if cfg.CsrApprovalQPS > 0 {
+		burst := cfg.CsrApprovalBurst
+		if burst < 1 {
+			burst = 1
+		}
+		csrRateLimiter = flowcontrol.NewTokenBucketRateLimiter(cfg.CsrApprovalQPS, burst)
+	}
+	c := &controller{
+		log: log.WithFields(logrus.Fields{
+			"cluster_id": cfg.ClusterID,
+			"component":  "assisted-installer-controller",
+		}),
+		ControllerConfig:           cfg,
+		ops:                        ops,
+		ic:                         ic,
+		kc:                         kc,
+		metrics:                    newControllerMetrics(),
+		mcsLogs:                    newMCSLogsTracker(),
+		stuckCsrs:                  newStuckCsrsTracker(),
+		progress:                   newProgressTracker(),
+		pause:                      newPauseSwitch(),
+		csrRateLimiter:             csrRateLimiter,
+		malformedStatusAnnotations: make(map[types.UID]int),
+		annotatedNodes:             make(map[string]string),
+		readyStageReported:         make(map[string]bool),
+		matchedNodes:               make(map[string]string),
+		forceComplete:              &completionSwitch{},
+		completed:                  &completionSwitch{},
+		diagnosticsUploaded:        &completionSwitch{},
+		serviceEventsUnsupported:   &completionSwitch{},
+		clock:                      clock.RealClock{},
+		waitInterval:               cfg.WaitInterval,
+	}
+	c.started = c.clock.Now()
+	if c.waitInterval <= 0 {
+		c.waitInterval = defaultWaitInterval
+	}
+	c.ic = newInstrumentedInventoryClient(ic, c.log, c.metrics, clock.RealClock{}, cfg.InventorySlowRequestThreshold)
+	if cfg.NotifyWebhookURL != "" {
+		c.notifier = newWebhookNotifier(cfg.NotifyWebhookURL)
+	}
+	if cfg.LogsUploadInterval > 0 {
+		c.logsTail = newLogsTailHook(cfg.LogsTailLines)
+		log.AddHook(c.logsTail)
+	}
+	c.log.Infof("Assisted installer controller %s", version.String())
+	state := c.loadCheckpoint()
+	c.checkpoint = newCheckpointTracker(c.CheckpointPath, state)
+	c.progress.restore(state)
+	c.progress.setExpectedNodes(cfg.ExpectedNodeCount)
+	return c
+}
+
+// Run starts all the controller go routines and returns once all of them are done or ctx is cancelled
+func (c *controller) Run(ctx context.Context) error {
+	// the installation duration is measured with the clock of the controller from the start of Run
+	c.started = c.clock.Now()
+	if err := c.preflight(ctx); err != nil {
+		return errors.Wrap(err, "pre-flight checks failed")
+	}
+	// a forced completion or the install deadline stop the controller like a cancellation, but it isn't reported as one
+	parentCtx := ctx
+	ctx, forceStop := context.WithCancel(ctx)
+	defer forceStop()
+	// the forced completion is sent after stopping, so the watcher is cancelled with parentCtx only
+	forceCtx, forceCancel := context.WithCancel(parentCtx)
+	defer forceCancel()
+	forceDone := make(chan struct{})
+	go func() {
+		defer close(forceDone)
+		c.WatchForceComplete(forceCtx, forceStop)
+	}()
+	deadlinePassed := c.watchInstallDeadline(ctx, forceStop)
+
+	// metrics and pause requests are served till all the other go routines are done
+	metricsCtx, metricsCancel := context.WithCancel(ctx)
+	defer metricsCancel()
+	metricsDone := make(chan struct{})
+	go func() {
+		defer close(metricsDone)
+		c.ServeMetrics(metricsCtx)
+	}()
+	pauseDone := make(chan struct{})
+	go func() {
+		defer close(pauseDone)
+		c.ServePause(metricsCtx)
+	}()
+	// the logs tail is uploaded till all the other go routines are done
+	logsStop := make(chan struct{})
+	logsDone := make(chan struct{})
+	go func() {
+		defer close(logsDone)
+		c.UploadLogsTail(parentCtx, logsStop)
+	}()
+
+	// go routines are started by goWithRestarts that adds them to wg
+	var wg sync.WaitGroup
+	approveCtx, approveCancel := context.WithCancel(ctx)
+	defer approveCancel()
+	if c.DisableCSRApproval {
+		c.log.Infof("CSR approval is disabled, csrs must be approved by an external approver")
+	} else {
+		c.goWithRestarts(approveCtx, &wg, "ApproveCsrs", c.ApproveCsrs)
+	}
+	// the post install configs wait for a cluster that won't be finalizing once the installation was reported as failed
+	postInstallCtx, postInstallCancel := context.WithCancel(ctx)
+	defer postInstallCancel()
+	addHosts := c.isAddHostsMode()
+	if addHosts {
+		c.log.Infof("Adding hosts to an installed cluster, skipping bootstrap and post install configs")
+	} else {
+		c.goWithRestarts(postInstallCtx, &wg, "PostInstallConfigs", c.PostInstallConfigs)
+		c.goWithRestarts(postInstallCtx, &wg, "UpdateBMHs", c.UpdateBMHs)
+
+		if err := c.WaitForBootstrapComplete(ctx); err != nil {
+			c.log.WithError(err).Warnf("Bootstrap didn't complete, tracking nodes status anyway")
+		}
 	}
+	var summary NodesJoinSummary
+	c.runWithRestarts(ctx, "WaitAndUpdateNodesStatus", func() {
+		var err error
+		if summary, err = c.WaitAndUpdateNodesStatus(ctx); err != nil {
+			c.log.WithError(err).Warnf("Not all the hosts joined the cluster")
+		}
+		if errors.Is(err, ErrNodesJoinTimeout) || errors.Is(err, ErrTooManyErroredHosts) {
+			c.log.Infof("Installation was reported as failed, stopping the post install configs")
+			postInstallCancel()
+		}
+	})
+	if !c.DisableCSRApproval {
+		c.log.Infof("Waiting %s to give a chance to approve all csrs", c.CsrApprovalGracePeriod)
+		select {
+		case <-ctx.Done():
+		case <-c.clock.After(c.CsrApprovalGracePeriod):
+		}
+	}
+	approveCancel()
+	c.log.Infof("Waiting for all go routines to finish")
+	wg.Wait()
+	select {
+	case <-deadlinePassed:
+		// the completion may have been recorded while the loops were stopping
+		if c.completed.isSet() {
+			c.log.Infof("Installation was completed meanwhile, not failing it on the install deadline")
+		} else {
+			c.failInstallDeadline(parentCtx)
+		}
+	default:
+	}
+	// without post install configs the installation is completed once all the added hosts are done
+	if addHosts && summary.AllJoined {
+		c.sendCompleteInstallation(ctx, true, "")
+	}
+	close(logsStop)
+	<-logsDone
+	forceCancel()
+	<-forceDone
+	metricsCancel()
+	<-metricsDone
+	<-pauseDone
+	if err := parentCtx.Err(); err != nil {
+		return errors.Wrap(err, "assisted-installer-controller was cancelled")
+	}
+	return nil
+}
+
+// WaitForBootstrapComplete waits till the bootstrap node is done, so nodes of the bootstrap era
+// are not marked as done prematurely. It returns an error after BootstrapCompleteTimeout or once ctx is cancelled
+func (c *controller) WaitForBootstrapComplete(ctx context.Context) error {
+	c.log.Infof("Waiting for bootstrap to complete")
+	deadline := c.clock.Now().Add(c.BootstrapCompleteTimeout)
+	for {
+		complete, err := c.kc.IsBootstrapComplete()
+		if err != nil {
+			c.log.WithError(err).Warnf("Failed to check whether bootstrap is complete")
+		}
+		if complete {
+			c.log.Infof("Bootstrap is complete")
+			return nil
+		}
+		if c.BootstrapCompleteTimeout > 0 && c.clock.Now().After(deadline) {
+			return errors.Errorf("bootstrap didn't complete after %s", c.BootstrapCompleteTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "WaitForBootstrapComplete was cancelled")
+		case <-c.clock.After(c.pollInterval()):
+		}
+	}
+}
+
+// WaitAndUpdateNodesStatus updates the status of the hosts as their nodes join and become ready,
+// it logs and returns a summary of the run. The error is nil once all the hosts joined, it is
+// ErrNodesJoinTimeout or ErrTooManyErroredHosts once the installation was reported as failed
+func (c *controller) WaitAndUpdateNodesStatus(ctx context.Context) (NodesJoinSummary, error) {
+	started := c.clock.Now()
+	notReadyNodes := make(map[string]bool)
+	err := c.waitAndUpdateNodesStatus(ctx, notReadyNodes)
+	summary := c.nodesJoinSummary(err == nil, c.clock.Since(started), notReadyNodes)
+	summary.log(c.log)
+	return summary, err
 }
 
-func (c *controller) WaitAndUpdateNodesStatus() {
+// waitAndUpdateNodesStatus returns once all the nodes joined, once cancelled or after reporting the installation
+// as failed. The nodes that were found not ready are added to notReadyNodes
+func (c *controller) waitAndUpdateNodesStatus(ctx context.Context, notReadyNodes map[string]bool) error {
 	c.log.Infof("Waiting till all nodes will join and update status to assisted installer")
-	ignoreStatuses := []string{models.HostStatusDisabled,
-		models.HostStatusError, models.HostStatusInstalled}
+	ignoreStatuses := c.ignoredHostStatuses()
+	erroredHosts := make(map[string]bool)
+	bootstrap := &bootstrapTracker{}
+	// the nodes of the last poll explain the hosts that are still pending on timeout
+	var lastNodes *v1.NodeList
+	started := c.clock.Now()
+	deadline := started.Add(c.NodeJoinTimeout)
+	stall := newJoinStallDetector(c.NodeJoinStallWindow, started)
+	lateHosts := newHostJoinTracker(c.HostJoinTimeout)
 	for {
-		time.Sleep(GeneralWaitTimeout)
-		assistedInstallerNodesMap, err := c.ic.GetHosts(ignoreStatuses)
+		select {
+		case <-ctx.Done():
+			c.log.Infof("WaitAndUpdateNodesStatus was cancelled")
+			return errors.Wrap(ctx.Err(), "WaitAndUpdateNodesStatus was cancelled")
+		case <-c.clock.After(c.pollIntervalOf(c.NodeStatusPollInterval)):
+		}
+		hosts, err := c.ic.GetHosts(ctx, ignoreStatuses)
 		if err != nil {
+			// an empty map on error doesn't mean that all the nodes joined, retry on the next tick
 			c.log.WithError(err).Error("Failed to get node map from inventory")
+			continue
 		}
+		assistedInstallerNodesMap := c.filterErroredHosts(ctx, hosts, erroredHosts)
+		if c.MaxErroredHosts > 0 && len(erroredHosts) > c.MaxErroredHosts {
+			c.handleErroredHosts(ctx, erroredHosts)
+			return errors.Wrapf(ErrTooManyErroredHosts, "%d hosts moved to error, more than the allowed %d",
+				len(erroredHosts), c.MaxErroredHosts)
+		}
+		c.metrics.nodesPending.Set(float64(len(assistedInstallerNodesMap)))
+		c.checkpointExpectedNodes(c.progress.setPendingNodes(len(assistedInstallerNodesMap)))
+		c.reportProgress(ctx)
+		joined, expected := c.progress.joinedNodes()
+		c.log.Infof("Joined %d of %d nodes", joined, expected)
+		if stall.update(c.clock.Now(), joined) {
+			c.handleNodeJoinStall(ctx, joined, expected, assistedInstallerNodesMap)
+		}
+		c.handleLateHosts(ctx, lateHosts.update(c.clock.Now(), assistedInstallerNodesMap), assistedInstallerNodesMap)
 		if len(assistedInstallerNodesMap) == 0 {
 			break
 		}
+		if c.NodeJoinTimeout > 0 && c.clock.Now().After(deadline) {
+			c.handleNodeJoinTimeout(ctx, assistedInstallerNodesMap, lastNodes)
+			return errors.Wrapf(ErrNodesJoinTimeout, "%d hosts didn't join after %s", len(assistedInstallerNodesMap),
+				c.NodeJoinTimeout)
+		}
 		c.log.Infof("Searching for host to change status")
 		nodes, err := c.kc.ListNodes()
+		warmingUp := c.clock.Since(started) < c.APIWarmupPeriod
 		if err != nil {
+			c.logListNodesError(err, warmingUp)
 			continue
 		}
+		if len(nodes.Items) == 0 {
+			c.logNoNodes(len(assistedInstallerNodesMap), warmingUp)
+		}
+		lastNodes = nodes
+		c.checkClockSkew(nodes.Items)
+		c.forgetDeletedNodes(nodes, assistedInstallerNodesMap)
+		checkpoint := c.checkpoint.snapshot()
+		bootstrapName, bootstrapHost, bootstrapNodeName := c.trackBootstrapNode(bootstrap, assistedInstallerNodesMap, nodes)
+		var updates []hostProgressUpdate
 		for _, node := range nodes.Items {
 			host, ok := assistedInstallerNodesMap[node.Name]
+			if !ok && bootstrapNodeName != "" && node.Name == bootstrapNodeName {
+				// the bootstrap node may join under another name than its inventory hostname
+				hostLog := c.log.WithField("host_id", bootstrapHost.Host.ID.String())
+				hostLog.Infof("Node %s is the bootstrap host %s", node.Name, bootstrapName)
+				host, ok = bootstrapHost, true
+			}
 			if !ok {
 				continue
 			}
 
-			c.log.Infof("Found new joined node %s with inventory id %s, kubernetes id %s, updating its status to %s",
-				node.Name, host.Host.ID.String(), node.Status.NodeInfo.SystemUUID, models.HostStageDone)
-			if err := c.ic.UpdateHostInstallProgress(host.Host.ID.String(), models.HostStageDone, ""); err != nil {
-				c.log.Errorf("Failed to update node %s installation status, %s", node.Name, err)
+			hostLog := c.log.WithField("host_id", host.Host.ID.String())
+			if !c.isHostMatchingNode(host, &node) {
+				hostLog.Warnf("Node %s system uuid %s doesn't match inventory host %s, skipping it",
+					node.Name, node.Status.NodeInfo.SystemUUID, host.Host.ID.String())
+				continue
+			}
+			c.matchedNodes[host.Host.ID.String()] = node.Name
+			c.annotateNodeHostID(&node, host.Host.ID.String())
+			// a host that was set to done is still listed till assisted-service reflects it, or after a restart
+			if checkpoint.isHostDone(host.Host.ID.String()) {
+				hostLog.Debugf("Host %s was already marked as done, skipping it", host.Host.ID.String())
+				continue
+			}
+			// node is marked as done only after its kubelet is ready
+			hostId := host.Host.ID.String()
+			stage := c.nodeStage(hostId, &node)
+			ready := isNodeReady(&node)
+			if !ready {
+				notReadyNodes[node.Name] = true
+			}
+			if stage != models.HostStageDone && host.Host.Progress != nil && host.Host.Progress.CurrentStage == stage {
+				// the ready stage was already reported, e.g. before a restart, so the host is done on the next poll
+				if ready {
+					c.readyStageReported[hostId] = true
+				}
+				continue
+			}
+			hostLog.Infof("Found new joined node %s with inventory id %s, kubernetes id %s, updating its status to %s",
+				node.Name, host.Host.ID.String(), node.Status.NodeInfo.SystemUUID, stage)
+			if c.DryRun {
+				hostLog.Infof("Dry run: skipping update of host %s status to %s", host.Host.ID.String(), stage)
+				continue
+			}
+			if c.isPaused() {
+				hostLog.Infof("Paused: skipping update of host %s status to %s", host.Host.ID.String(), stage)
 				continue
 			}
+			updates = append(updates, hostProgressUpdate{
+				HostProgressUpdate: inventory_client.HostProgressUpdate{HostID: hostId, Stage: stage},
+				nodeName:           node.Name,
+				ready:              ready,
+				log:                hostLog,
+			})
 		}
-		c.updateConfiguringStatusIfNeeded(assistedInstallerNodesMap)
+		c.updateHostsProgress(ctx, updates)
+		c.updateConfiguringStatusIfNeeded(ctx, assistedInstallerNodesMap)
 
 	}
 	c.log.Infof("All nodes were found. WaitAndUpdateNodesStatus - Done")
+	c.recordEvent(ctx, clusterObjectReference, v1.EventTypeNormal, eventReasonAllNodesJoined,
+		fmt.Sprintf("All hosts of cluster %s joined the cluster", c.ClusterID))
+	return nil
 }
 
+// hostProgressUpdate is the progress of a joined node host that is updated with the other hosts of the poll
+type hostProgressUpdate struct {
+	inventory_client.HostProgressUpdate
+	nodeName string
+	ready    bool
+	log      *logrus.Entry
+}
+
+// updateHostsProgress updates the progress of the hosts of a poll in one request, every host is updated on its own
+// once assisted-service turned out not to support it. The hosts whose update failed are updated on the next poll
+func (c *controller) updateHostsProgress(ctx context.Context, updates []hostProgressUpdate) {
+	if len(updates) == 0 {
+		return
+	}
+	if !c.hostsProgressUnsupported {
+		batch := make([]inventory_client.HostProgressUpdate, 0, len(updates))
+		for _, update := range updates {
+			batch = append(batch, update.HostProgressUpdate)
+		}
+		err := c.ic.UpdateHostsInstallProgress(ctx, batch)
+		if err == nil {
+			for _, update := range updates {
+				c.hostProgressUpdated(update)
+			}
+			return
+		}
+		if !inventory_client.IsUnsupported(err) {
+			c.log.Errorf("Failed to update the installation status of %d hosts, %s", len(updates), err)
+			return
+		}
+		c.log.Infof("Updating the installation status of every host on its own, assisted-service doesn't support updating several hosts at once: %s", err)
+		c.hostsProgressUnsupported = true
+	}
+	for _, update := range updates {
+		if err := c.ic.UpdateHostInstallProgress(ctx, update.HostID, update.Stage, update.Info); err != nil {
+			update.log.Errorf("Failed to update node %s installation status, %s", update.nodeName, err)
+			continue
+		}
+		c.hostProgressUpdated(update)
+	}
+}
+
+// hostProgressUpdated records the progress update of the host, the ready stage is reported again on the next poll
+// till it was updated
+func (c *controller) hostProgressUpdated(update hostProgressUpdate) {
+	if update.Stage != models.HostStageDone && update.ready {
+		c.readyStageReported[update.HostID] = true
+	}
+	if update.Stage == models.HostStageDone {
+		c.checkpointHostDone(update.HostID)
+	}
+}
+
+// pollInterval returns the wait interval spread by PollJitterFactor
+func (c controller) pollInterval() time.Duration {
+	return c.pollIntervalOf(0)
+}
+
+// pollIntervalOf returns the poll interval of a loop spread by PollJitterFactor, non positive falls back to the wait interval
+func (c controller) pollIntervalOf(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		interval = c.waitInterval
+	}
+	return utils.Jitter(interval, c.PollJitterFactor)
+}
+
+// isHostMatchingNode verifies the node runs on the inventory host hardware when StrictHostMatching is set,
+// the agent uses the host system uuid as the host id
+func (c *controller) isHostMatchingNode(host inventory_client.HostData, node *v1.Node) bool {
+	if !c.StrictHostMatching {
+		return true
+	}
+	return strings.EqualFold(host.Host.ID.String(), node.Status.NodeInfo.SystemUUID)
+}
+
+func isNodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// filterErroredHosts returns the hosts that are not in error, the hosts that moved to error are added to erroredHosts
+// and reported once
+func (c *controller) filterErroredHosts(ctx context.Context, hosts map[string]inventory_client.HostData, erroredHosts map[string]bool) map[string]inventory_client.HostData {
+	notErrored := make(map[string]inventory_client.HostData, len(hosts))
+	for name, host := range hosts {
+		if host.Host.Status == nil || *host.Host.Status != models.HostStatusError {
+			notErrored[name] = host
+			continue
+		}
+		hostId := host.Host.ID.String()
+		if erroredHosts[hostId] {
+			continue
+		}
+		erroredHosts[hostId] = true
+		c.metrics.hostsErrored.Inc()
+		statusInfo := ""
+		if host.Host.StatusInfo != nil {
+			statusInfo = *host.Host.StatusInfo
+		}
+		c.log.WithField("host_id", hostId).Errorf("Host %s (%s) moved to error while waiting for it to join: %s",
+			hostId, name, statusInfo)
+		if c.CordonErroredNodes && host.Host.Progress != nil && host.Host.Progress.CurrentStage == models.HostStageJoined {
+			c.cordonErroredNode(hostId, name)
+		}
+	}
+	return notErrored
+}
+
+// cordonErroredNode cordons the node of a host that moved to error after it joined, the inventory hostname is
+// the node name. It is attempted once, a failure is only logged
+func (c *controller) cordonErroredNode(hostId string, nodeName string) {
+	hostLog := c.log.WithField("host_id", hostId)
+	if c.DryRun {
+		hostLog.Infof("Dry run: skipping cordon of node %s", nodeName)
+		return
+	}
+	if c.isPaused() {
+		hostLog.Infof("Paused: skipping cordon of node %s", nodeName)
+		return
+	}
+	if err := c.kc.CordonNode(nodeName); err != nil {
+		hostLog.WithError(err).Errorf("Failed to cordon node %s of errored host %s", nodeName, hostId)
+		return
+	}
+	hostLog.Infof("Cordoned node %s of errored host %s", nodeName, hostId)
+}
+
+func (c *controller) handleErroredHosts(ctx context.Context, erroredHosts map[string]bool) {
+	var hostIds []string
+	for hostId := range erroredHosts {
+		hostIds = append(hostIds, hostId)
+	}
+	sort.Strings(hostIds)
+	c.log.Errorf("%d hosts moved to error, more than the allowed %d: %s", len(hostIds), c.MaxErroredHosts, strings.Join(hostIds, ", "))
+	errorInfo := fmt.Sprintf("%d hosts moved to error while waiting for the nodes to join, more than the allowed %d",
+		len(hostIds), c.MaxErroredHosts)
+	c.GatherFailureDiagnostics(ctx)
+	c.sendCompleteInstallation(ctx, false, errorInfo)
+}
+
+func (c *controller) handleNodeJoinTimeout(ctx context.Context, assistedInstallerNodesMap map[string]inventory_client.HostData, nodes *v1.NodeList) {
+	summaries := summarizePendingHosts(assistedInstallerNodesMap, nodes)
+	pendingHosts := make([]string, 0, len(summaries))
+	for _, summary := range summaries {
+		c.log.WithFields(logrus.Fields{
+			"host_id": summary.HostID,
+			"status":  summary.Status,
+			"stage":   summary.Stage,
+			"node":    summary.Node,
+		}).Errorf("Host %s didn't join: %s", summary.Name, summary)
+		pendingHosts = append(pendingHosts, summary.String())
+	}
+	c.log.Errorf("Timed out after %s waiting for %d hosts to join", c.NodeJoinTimeout, len(pendingHosts))
+	errorInfo := fmt.Sprintf("Timed out after %s waiting for %d hosts to join the cluster: %s", c.NodeJoinTimeout,
+		len(pendingHosts), strings.Join(pendingHosts, "; "))
+	c.GatherFailureDiagnostics(ctx)
+	c.sendCompleteInstallation(ctx, false, errorInfo)
+}
+
+// getMCSLogs fetches only the logs that were written since the previous fetch of each mcs pod
+// and returns them together with the retained tail of the previously fetched logs
 func (c *controller) getMCSLogs() (string, error) {
-	logs := ""
-	namespace := "openshift-machine-config-operator"
-	pods, err := c.kc.GetPods(namespace, map[string]string{"k8s-app": "machine-config-server"})
-	if err != nil {
-		c.log.WithError(err).Warnf("Failed to get mcs pods")
-		return "", nil
+	selector, pods, found := c.discoverMCSPods()
+	if !found {
+		c.log.Debugf("No mcs pods were found with any of the mcs candidates")
+		return c.mcsLogs.logs, nil
 	}
 	for _, pod := range pods {
-		podLogs, err := c.kc.GetPodLogs(namespace, pod.Name, generalWaitTimeoutInt*10)
+		// the logs of a terminating pod were fetched on the previous polls, its replacement is followed instead
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		opts := k8s_client.PodLogsOptions{
+			SinceSeconds: mcsLogsInitialSinceSeconds,
+			TailLines:    mcsLogsTailLines,
+			Timeout:      podLogsTimeout,
+		}
+		if lastFetch, ok := c.mcsLogs.lastFetch[pod.Name]; ok {
+			// one more second to not miss lines, the overlapping lines are dropped while appending
+			opts.SinceSeconds = int64(c.clock.Since(lastFetch).Seconds()) + 1
+		}
+		fetchTime := c.clock.Now()
+		podLogs, err := c.kc.GetPodLogs(selector.Namespace, pod.Name, opts)
 		if err != nil {
 			c.log.WithError(err).Warnf("Failed to get logs of pod %s", pod.Name)
-			return "", nil
+			return c.mcsLogs.logs, nil
 		}
-		logs += podLogs
+		c.mcsLogs.lastFetch[pod.Name] = fetchTime
+		c.mcsLogs.append(pod.Name, podLogs)
 	}
-	return logs, nil
+	return c.mcsLogs.logs, nil
 }
 
-func (c *controller) updateConfiguringStatusIfNeeded(hosts map[string]inventory_client.HostData) {
+func (c *controller) updateConfiguringStatusIfNeeded(ctx context.Context, hosts map[string]inventory_client.HostData) {
 	logs, err := c.getMCSLogs()
 	if err != nil {
 		return
 	}
-	common.SetConfiguringStatusForHosts(c.ic, hosts, logs, true, c.log)
+	if c.DryRun {
+		c.log.Infof("Dry run: skipping update of hosts configuring status")
+		return
+	}
+	if c.isPaused() {
+		c.log.Infof("Paused: skipping update of hosts configuring status")
+		return
+	}
+	common.SetConfiguringStatusForHosts(ctx, c.ic, hosts, logs, true, c.log)
 }
 
-func (c *controller) ApproveCsrs(done <-chan bool, wg *sync.WaitGroup) {
+func (c *controller) ApproveCsrs(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 	c.log.Infof("Start approving csrs")
-	ticker := time.NewTicker(GeneralWaitTimeout)
+	// approve the csrs that are already pending right away, nodes can't join before that
+	c.listAndApproveCsrs(ctx)
 	for {
 		select {
-		case <-done:
+		case <-ctx.Done():
+			c.log.Infof("ApproveCsrs was cancelled")
 			return
-		case <-ticker.C:
-			csrs, err := c.kc.ListCsrs()
-			if err != nil {
-				continue
-			}
-			c.approveCsrs(csrs)
+		case <-c.clock.After(c.pollIntervalOf(c.CSRPollInterval)):
+			c.listAndApproveCsrs(ctx)
 		}
 	}
 }
 
-func (c controller) approveCsrs(csrs *v1beta1.CertificateSigningRequestList) {
+func (c *controller) listAndApproveCsrs(ctx context.Context) {
+	csrs, err := c.kc.ListCsrs()
+	if err != nil {
+		return
+	}
+	c.approveCsrs(ctx, csrs)
+}
+
+func (c controller) approveCsrs(ctx context.Context, csrs *v1beta1.CertificateSigningRequestList) {
+	var pendingCsrs []v1beta1.CertificateSigningRequest
+	var pendingNames []string
 	for i := range csrs.Items {
-		csr := csrs.Items[i]
-		if !isCsrApproved(&csr) {
-			c.log.Infof("Approving csr %s", csr.Name)
-			// We can fail and it is ok, we will retry on the next time
-			_ = c.kc.ApproveCsr(&csr)
+		if !isCsrApproved(&csrs.Items[i]) {
+			pendingCsrs = append(pendingCsrs, csrs.Items[i])
+			pendingNames = append(pendingNames, csrs.Items[i].Name)
+		}
+	}
+	for _, name := range c.stuckCsrs.update(pendingNames) {
+		c.log.Warnf("Csr %s is still pending after it was approved %d polls ago, the cluster may fail to approve csrs",
+			name, stuckCsrMaxPendingPolls+1)
+	}
+	if len(pendingCsrs) == 0 {
+		return
+	}
+	hosts, err := c.ic.GetEnabledHostsNamesHosts(ctx)
+	if err != nil {
+		c.log.WithError(err).Errorf("Failed to get hosts from inventory, skipping csrs approval")
+		return
+	}
+	nodes := c.csrsNodes(pendingCsrs, hosts)
+	var eligibleCsrs []v1beta1.CertificateSigningRequest
+	for i := range pendingCsrs {
+		csr := pendingCsrs[i]
+		if age := c.clock.Since(csr.CreationTimestamp.Time); age < c.CSRApprovalMinAge {
+			c.log.Infof("Csr %s is %s old, waiting till it is %s old before approving it",
+				csr.Name, age.Round(time.Second), c.CSRApprovalMinAge)
+			continue
+		}
+		if err := validateNodeCsr(&csr, hosts, nodes, c.isBootstrapHost); err != nil {
+			c.log.WithError(err).Warnf("Csr %s doesn't belong to a cluster node, skipping it", csr.Name)
+			continue
+		}
+		if c.DryRun {
+			c.log.Infof("Dry run: skipping approval of csr %s", csr.Name)
+			continue
+		}
+		if c.isPaused() {
+			c.log.Infof("Paused: skipping approval of csr %s", csr.Name)
+			continue
+		}
+		eligibleCsrs = append(eligibleCsrs, csr)
+	}
+	c.approveCsrsConcurrently(ctx, eligibleCsrs)
+}
+
+// csrsNodes returns the nodes when there are serving csrs to validate or csrs of nodes that aren't named after
+// an inventory host, failing to list the nodes leaves only the inventory hostnames and addresses for the validation
+func (c controller) csrsNodes(csrs []v1beta1.CertificateSigningRequest, hosts map[string]inventory_client.HostData) *v1.NodeList {
+	for i := range csrs {
+		if !isServingCsr(&csrs[i]) && isInventoryNodeCsr(&csrs[i], hosts) {
+			continue
+		}
+		nodes, err := c.kc.ListNodes()
+		if err != nil {
+			c.log.WithError(err).Warnf("Failed to list nodes, validating csrs with the inventory hostnames and addresses only")
+			return nil
 		}
+		return nodes
+	}
+	return nil
+}
+
+// approveCsrsConcurrently approves up to CsrApprovalConcurrency csrs at a time, honoring the csr rate limit.
+// Failures don't stop the others, they are retried on the next round
+func (c controller) approveCsrsConcurrently(ctx context.Context, csrs []v1beta1.CertificateSigningRequest) {
+	concurrency := c.CsrApprovalConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg     sync.WaitGroup
+		lock   sync.Mutex
+		failed []string
+	)
+	sem := make(chan struct{}, concurrency)
+	for i := range csrs {
+		csr := csrs[i]
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			// a csr that was skipped while waiting for the rate limit is approved on the next round
+			if c.csrRateLimiter != nil {
+				if err := c.csrRateLimiter.Wait(ctx); err != nil {
+					c.log.Infof("Not approving csr %s, %s", csr.Name, err)
+					return
+				}
+			}
+			c.log.WithFields(csrAuditFields(&csr)).Infof("Approving csr %s of user %s", csr.Name, csr.Spec.Username)
+			if err := c.kc.ApproveCsr(&csr); err != nil {
+				lock.Lock()
+				failed = append(failed, fmt.Sprintf("%s: %s", csr.Name, err))
+				lock.Unlock()
+				return
+			}
+			c.metrics.csrsApproved.Inc()
+			c.stuckCsrs.setApproved(csr.Name)
+			c.recordEvent(ctx, v1.ObjectReference{APIVersion: c.kc.CsrGroupVersion(), Kind: "CertificateSigningRequest",
+				Name: csr.Name, UID: csr.UID}, v1.EventTypeNormal, eventReasonCsrApproved,
+				fmt.Sprintf("Csr %s of user %s was approved", csr.Name, csr.Spec.Username))
+		}()
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		c.log.Warnf("Failed to approve %d csrs, they will be retried on the next round: %s", len(failed), strings.Join(failed, "; "))
 	}
 }
 
@@ -161,91 +993,393 @@ func isCsrApproved(csr *certificatesv1beta1.CertificateSigningRequest) bool {
 	return false
 }
 
-func (c controller) PostInstallConfigs(wg *sync.WaitGroup) {
+func (c controller) PostInstallConfigs(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
+	var finalizingSince time.Time
+	var finalizingCluster *models.Cluster
 	for {
-		time.Sleep(GeneralWaitTimeout)
-		cluster, err := c.ic.GetCluster()
+		select {
+		case <-ctx.Done():
+			c.log.Infof("PostInstallConfigs was cancelled")
+			return
+		case <-c.clock.After(c.pollIntervalOf(c.PostInstallPollInterval)):
+		}
+		cluster, err := c.ic.GetCluster(ctx)
+		if inventory_client.IsNotFound(err) {
+			c.log.WithError(err).Errorf("Cluster %s doesn't exist in assisted-service, skipping post install configs", c.ClusterID)
+			return
+		}
 		if err != nil {
 			c.log.WithError(err).Errorf("Failed to get cluster %s from assisted-service", c.ClusterID)
 			continue
 		}
-		// waiting till cluster will be installed(3 masters must be installed)
+		// controller was restarted after the installation was completed, all the steps were already done
+		if *cluster.Status == models.ClusterStatusInstalled {
+			c.log.Infof("Cluster %s is already installed, skipping post install configs", c.ClusterID)
+			return
+		}
+		// cluster in error won't reach finalizing, the installation is reported as failed instead of waiting forever
+		if *cluster.Status == models.ClusterStatusError {
+			statusInfo := ""
+			if cluster.StatusInfo != nil {
+				statusInfo = *cluster.StatusInfo
+			}
+			c.log.Errorf("Cluster %s moved to error while waiting for it to be finalizing: %s", c.ClusterID, statusInfo)
+			c.sendCompleteInstallation(ctx, false, fmt.Sprintf("Cluster moved to error before post install configs: %s", statusInfo))
+			return
+		}
+		// waiting till cluster will be installed(all its control plane replicas must be installed)
 		if *cluster.Status != models.ClusterStatusFinalizing {
+			finalizingSince = time.Time{}
 			continue
 		}
+		if finalizingSince.IsZero() {
+			finalizingSince = c.clock.Now()
+		}
+		if !c.enoughMastersReady(cluster) {
+			// the post install configs are what moves the cluster out of finalizing, waiting forever would deadlock it
+			if c.FinalizingTimeout <= 0 || c.clock.Since(finalizingSince) < c.FinalizingTimeout {
+				continue
+			}
+			c.log.Warnf("Cluster %s is finalizing for %s without enough ready masters, running the post install configs anyway",
+				c.ClusterID, c.FinalizingTimeout)
+		}
+		finalizingCluster = cluster
 		break
 	}
-	c.addRouterCAToClusterCA()
-	c.unpatchEtcd()
-	c.waitForConsole()
-	c.sendCompleteInstallation(true, "")
+	// the installation succeeds only if all the critical stages succeeded, the failed stages are reported in the completion error info
+	var failures, warnings []string
+	checkpoint := c.checkpoint.snapshot()
+	caHash := checkpoint.IngressCAHash
+	etcdHealth := &etcdHealthStatus{}
+	etcdExpectedMembers := c.expectedEtcdMembers(finalizingCluster)
+	stages := []postInstallStage{
+		{name: "add_router_ca", timeout: c.IngressCATimeout, run: func(ctx context.Context) error {
+			hash, err := c.addRouterCAToClusterCA(ctx)
+			if err == nil {
+				caHash = hash
+				c.checkpointIngressCAHash(hash)
+			}
+			return err
+		}},
+		{name: "unpatch_etcd", timeout: c.UnpatchEtcdTimeout, run: func(ctx context.Context) error {
+			if err := c.waitForEtcdHealthy(ctx, etcdExpectedMembers, etcdHealth); err != nil {
+				return err
+			}
+			return c.unpatchEtcd(ctx)
+		}, details: etcdHealth.String},
+		{name: "wait_for_console", timeout: c.ConsoleWaitTimeout, run: c.waitForConsole},
+	}
+	if len(c.ClusterOperators) > 0 {
+		operators := &clusterOperatorsStatus{}
+		stages = append(stages, postInstallStage{name: "wait_for_cluster_operators", timeout: c.ClusterOperatorsTimeout,
+			run: func(ctx context.Context) error {
+				return c.waitForClusterOperators(ctx, operators)
+			}, details: operators.String})
+	}
+	if c.UncordonNodes {
+		stages = append(stages, postInstallStage{name: "uncordon_nodes", run: c.uncordonNodes})
+	}
+	// runStage returns why the stage failed, the ingress ca is watched once it was added
+	runStage := func(stage postInstallStage) string {
+		if checkpoint.isStageDone(stage.name) {
+			c.log.Infof("Post install stage %s was already done before restart", stage.name)
+		} else if err := c.runPostInstallStage(ctx, stage.name, stage.timeout, stage.run); err != nil {
+			failure := err.Error()
+			if stage.details != nil && stage.details() != "" {
+				failure = fmt.Sprintf("%s: %s", failure, stage.details())
+			}
+			return failure
+		} else {
+			c.postInstallStageDone(ctx, stage.name)
+		}
+		if stage.name == "add_router_ca" && c.IngressCARotationWindow > 0 {
+			wg.Add(1)
+			go c.watchIngressCA(ctx, wg, caHash)
+		}
+		return ""
+	}
+	stageFailures := make([]string, len(stages))
+	if c.ParallelPostInstallStages {
+		if err := c.waitWhilePaused(ctx); err != nil {
+			c.log.WithError(err).Warnf("Not running post install stages")
+			return
+		}
+		var stagesWg sync.WaitGroup
+		for i := range stages {
+			stagesWg.Add(1)
+			go func(i int) {
+				defer stagesWg.Done()
+				err := c.runRecoveringError(stages[i].name, func() error {
+					stageFailures[i] = runStage(stages[i])
+					return nil
+				})
+				if err != nil {
+					stageFailures[i] = fmt.Sprintf("%s: %s", stages[i].name, err)
+				}
+			}(i)
+		}
+		stagesWg.Wait()
+	} else {
+		for i, stage := range stages {
+			if err := c.waitWhilePaused(ctx); err != nil {
+				c.log.WithError(err).Warnf("Not running post install stage %s", stage.name)
+				return
+			}
+			stageFailures[i] = runStage(stage)
+		}
+	}
+	// the failures are reported in the order of the stages, also when they ran in parallel
+	for i, failure := range stageFailures {
+		switch {
+		case failure == "":
+		case c.isNonCriticalStage(stages[i].name):
+			c.log.Warnf("Non critical post install stage %s failed, not failing the installation: %s", stages[i].name, failure)
+			warnings = append(warnings, fmt.Sprintf("warning: %s", failure))
+		default:
+			failures = append(failures, failure)
+		}
+	}
+	succeeded := len(failures) == 0
+	failures = append(failures, warnings...)
+	// failed readiness checks don't fail the installation but are reported in the completion error info
+	start := c.clock.Now()
+	failures = append(failures, c.waitForReadinessChecks(ctx)...)
+	c.metrics.observePostInstallStage("readiness_checks", c.clock.Since(start))
+	// neither do the cluster operators that didn't settle
+	if c.AllClusterOperatorsTimeout > 0 {
+		start = c.clock.Now()
+		failures = append(failures, c.waitForAllClusterOperators(ctx)...)
+		c.metrics.observePostInstallStage("all_cluster_operators", c.clock.Since(start))
+	}
+	c.sendCompleteInstallation(ctx, succeeded, strings.Join(failures, "; "))
 }
 
-func (c controller) UpdateBMHs(wg *sync.WaitGroup) {
+func (c controller) isNonCriticalStage(name string) bool {
+	return containsString(c.NonCriticalPostInstallStages, name)
+}
+
+// postInstallStage is a step of PostInstallConfigs bounded by its timeout, details describe why it didn't succeed
+type postInstallStage struct {
+	name    string
+	timeout time.Duration
+	run     func(ctx context.Context) error
+	details func() string
+}
+
+// runPostInstallStage runs a post install stage bounded by its timeout, a stage that didn't return by then is abandoned.
+// The returned error is prefixed by the stage name, so assisted-service gets the precise failure reason
+func (c controller) runPostInstallStage(ctx context.Context, stage string, timeout time.Duration, run func(ctx context.Context) error) error {
+	start := c.clock.Now()
+	defer func() {
+		c.metrics.observePostInstallStage(stage, c.clock.Since(start))
+	}()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	done := make(chan error, 1)
+	go func() {
+		// a panicking stage fails like any other stage instead of crashing the controller
+		done <- c.runRecoveringError(stage, func() error {
+			return run(ctx)
+		})
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		err = fmt.Errorf("%s: timed out after %s", stage, timeout)
+	default:
+		err = fmt.Errorf("%s: %s", stage, err)
+	}
+	c.log.WithError(err).Errorf("Post install stage %s failed", stage)
+	return err
+}
+
+func (c controller) UpdateBMHs(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
+	statusUpdated := make(map[types.UID]bool)
+	for _, uid := range c.checkpoint.snapshot().UpdatedBMHs {
+		statusUpdated[uid] = true
+	}
 	for {
-		time.Sleep(GeneralWaitTimeout)
+		select {
+		case <-ctx.Done():
+			c.log.Infof("UpdateBMHs was cancelled")
+			return
+		case <-c.clock.After(c.pollIntervalOf(c.BMHPollInterval)):
+		}
 		exists, err := c.kc.IsMetalProvisioningExists()
 		if err != nil {
+			c.log.WithError(err).Warnf("Failed to check whether the provisioning CR exists, retrying")
 			continue
 		}
-		if err == nil && exists {
+		if exists {
 			c.log.Infof("Provisioning CR exists, no need to update BMHs")
 			return
 		}
 
-		bmhs, err := c.kc.ListBMHs()
+		bmhs, err := c.listBMHs(ctx)
+		if errors.Is(err, k8s_client.ErrBMHCRDNotInstalled) {
+			c.log.Infof("BareMetalHost CRD is not installed, no BMHs to update")
+			return
+		}
 		if err != nil {
-			c.log.WithError(err).Errorf("Failed to BMH hosts")
+			c.log.WithError(err).Errorf("Failed to list BMHs")
 			continue
 		}
 
-		allUpdated := c.updateBMHStatus(bmhs)
+		allUpdated := c.updateBMHStatus(bmhs, statusUpdated)
+		updated := countUpdatedBMHs(bmhs, statusUpdated)
+		c.metrics.bmhsPending.Set(float64(len(bmhs.Items) - updated))
+		c.log.Infof("Updated %d of %d BMHs", updated, len(bmhs.Items))
 		if allUpdated {
 			c.log.Infof("Updated all the BMH CRs, finished successfully")
+			if len(bmhs.Items) > 0 {
+				c.recordEvent(ctx, clusterObjectReference, v1.EventTypeNormal, eventReasonBMHsUpdated,
+					fmt.Sprintf("The status of all the %d BMHs of cluster %s was updated", len(bmhs.Items), c.ClusterID))
+			}
 			return
 		}
 	}
 }
 
-func (c controller) updateBMHStatus(bmhList metal3v1alpha1.BareMetalHostList) bool {
+// listBMHs retries listing the BMHs on transient errors, the BareMetalHost CRD not being installed isn't retried
+func (c controller) listBMHs(ctx context.Context) (metal3v1alpha1.BareMetalHostList, error) {
+	var bmhs metal3v1alpha1.BareMetalHostList
+	err := c.retryWithBackoff(ctx, listBMHsMaxAttempts, func() error {
+		var err error
+		bmhs, err = c.kc.ListBMHs()
+		if errors.Is(err, k8s_client.ErrBMHCRDNotInstalled) {
+			return common.PermanentError(err)
+		}
+		return err
+	})
+	return bmhs, err
+}
+
+// updateBMHStatus sets the status of every BMH from its status annotation and removes the annotation, up to
+// BMHUpdateConcurrency BMHs at a time. BMHs whose status was already updated, as recorded in statusUpdated,
+// only get their annotation removed. Failures don't stop the others, they are retried on the next poll
+func (c controller) updateBMHStatus(bmhList metal3v1alpha1.BareMetalHostList, statusUpdated map[types.UID]bool) bool {
+	concurrency := c.BMHUpdateConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+	)
+	sem := make(chan struct{}, concurrency)
 	allUpdated := true
 	for i := range bmhList.Items {
 		bmh := bmhList.Items[i]
 		c.log.Infof("Checking bmh %s", bmh.Name)
-		annotations := bmh.GetAnnotations()
-		content := []byte(annotations[metal3v1alpha1.StatusAnnotation])
-		if annotations[metal3v1alpha1.StatusAnnotation] == "" {
+		if bmh.GetAnnotations()[metal3v1alpha1.StatusAnnotation] == "" {
 			c.log.Infof("Skipping setting status of BMH host %s, status annotation not present", bmh.Name)
 			continue
 		}
 		allUpdated = false
-		objStatus, err := c.unmarshalStatusAnnotation(content)
-		if err != nil {
-			c.log.WithError(err).Errorf("Failed to unmarshal status annotation of %s", bmh.Name)
+		if c.DryRun {
+			c.log.Infof("Dry run: skipping status update of BMH %s and removal of its status annotation", bmh.Name)
 			continue
 		}
-		bmh.Status = *objStatus
-		if bmh.Status.LastUpdated.IsZero() {
-			// Ensure the LastUpdated timestamp in set to avoid
-			// infinite loops if the annotation only contained
-			// part of the status information.
-			t := metav1.Now()
-			bmh.Status.LastUpdated = &t
+		if c.isPaused() {
+			c.log.Infof("Paused: skipping status update of BMH %s and removal of its status annotation", bmh.Name)
+			continue
 		}
-		err = c.kc.UpdateBMHStatus(&bmh)
-		if err != nil {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			c.updateBMHFromAnnotation(&bmh, statusUpdated, &lock)
+		}()
+	}
+	wg.Wait()
+	return allUpdated
+}
+
+// countUpdatedBMHs returns the number of BMHs whose status was updated or that have no status annotation to update
+// it from, it must not run concurrently with updateBMHStatus
+func countUpdatedBMHs(bmhList metal3v1alpha1.BareMetalHostList, statusUpdated map[types.UID]bool) int {
+	updated := 0
+	for _, bmh := range bmhList.Items {
+		if statusUpdated[bmh.UID] || bmh.GetAnnotations()[metal3v1alpha1.StatusAnnotation] == "" {
+			updated++
+		}
+	}
+	return updated
+}
+
+// updateBMHFromAnnotation updates the status of a single BMH and removes its status annotation,
+// lock guards statusUpdated and the malformed annotations attempts that are shared by the concurrent updates
+func (c controller) updateBMHFromAnnotation(bmh *metal3v1alpha1.BareMetalHost, statusUpdated map[types.UID]bool, lock *sync.Mutex) {
+	lock.Lock()
+	updated := statusUpdated[bmh.UID]
+	lock.Unlock()
+	if updated {
+		c.log.Infof("Status of BMH %s was already updated", bmh.Name)
+	} else if err := c.updateBMHStatusFromAnnotation(bmh); err != nil {
+		if !isMalformedJSON(err) {
 			c.log.WithError(err).Errorf("Failed to update status of BMH %s", bmh.Name)
-			continue
+			return
 		}
-		delete(annotations, metal3v1alpha1.StatusAnnotation)
-		err = c.kc.UpdateBMH(&bmh)
-		if err != nil {
-			c.log.WithError(err).Errorf("Failed to remove status annotation from BMH %s", bmh.Name)
+		lock.Lock()
+		c.malformedStatusAnnotations[bmh.UID]++
+		attempts := c.malformedStatusAnnotations[bmh.UID]
+		lock.Unlock()
+		if attempts < malformedStatusAnnotationMaxAttempts {
+			c.log.WithError(err).Errorf("Status annotation of BMH %s is malformed, attempt %d/%d",
+				bmh.Name, attempts, malformedStatusAnnotationMaxAttempts)
+			return
 		}
+		// the annotation won't fix itself, removing it lets UpdateBMHs finish
+		c.log.WithError(err).Errorf("WARNING: status annotation of BMH %s is still malformed after %d attempts, "+
+			"removing it without updating the BMH status, the status must be fixed manually", bmh.Name, malformedStatusAnnotationMaxAttempts)
+	} else {
+		lock.Lock()
+		statusUpdated[bmh.UID] = true
+		lock.Unlock()
+		c.checkpointBMHUpdated(bmh.UID)
+		c.metrics.bmhsUpdated.Inc()
 	}
-	return allUpdated
+	delete(bmh.GetAnnotations(), metal3v1alpha1.StatusAnnotation)
+	if err := c.kc.UpdateBMH(bmh); err != nil {
+		c.log.WithError(err).Errorf("Failed to remove status annotation from BMH %s", bmh.Name)
+	}
+}
+
+func (c controller) updateBMHStatusFromAnnotation(bmh *metal3v1alpha1.BareMetalHost) error {
+	objStatus, err := c.unmarshalStatusAnnotation([]byte(bmh.GetAnnotations()[metal3v1alpha1.StatusAnnotation]))
+	if err != nil {
+		return errors.Wrapf(err, "failed to unmarshal status annotation of %s", bmh.Name)
+	}
+	bmh.Status = *objStatus
+	if bmh.Status.LastUpdated.IsZero() {
+		// Ensure the LastUpdated timestamp in set to avoid
+		// infinite loops if the annotation only contained
+		// part of the status information.
+		t := metav1.Now()
+		bmh.Status.LastUpdated = &t
+	}
+	return c.kc.UpdateBMHStatus(bmh)
+}
+
+func isMalformedJSON(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
 }
 
 func (c controller) unmarshalStatusAnnotation(content []byte) (*metal3v1alpha1.BareMetalHostStatus, error) {
@@ -257,69 +1391,354 @@ func (c controller) unmarshalStatusAnnotation(content []byte) (*metal3v1alpha1.B
 	return bmhStatus, nil
 }
 
-func (c controller) unpatchEtcd() {
+// unpatchEtcd retries transient failures up to unpatchEtcdMaxAttempts times,
+// permanent failures are returned right away
+func (c controller) unpatchEtcd(ctx context.Context) error {
 	c.log.Infof("Unpatching etcd")
-	for {
-		if err := c.kc.UnPatchEtcd(); err != nil {
-			c.log.Error(err)
-			continue
+	if c.DryRun {
+		c.log.Infof("Dry run: skipping etcd unpatch")
+		return nil
+	}
+	attempt := 0
+	var result k8s_client.EtcdUnpatchResult
+	errorsLog := newRepeatedErrorsLogger(c.log, c.clock, repeatedErrorsSummaryInterval)
+	err := c.retryWithBackoff(ctx, unpatchEtcdMaxAttempts, func() error {
+		attempt++
+		var err error
+		result, err = c.kc.UnPatchEtcd()
+		switch result {
+		case k8s_client.EtcdAlreadyUnpatched, k8s_client.EtcdUnpatched:
+			return nil
+		case k8s_client.EtcdUnpatchPermanentError:
+			return common.PermanentError(err)
 		}
-		break
+		errorsLog.logf(logrus.WarnLevel, err, "Failed to unpatch etcd, attempt %d/%d", attempt, unpatchEtcdMaxAttempts)
+		return err
+	})
+	errorsLog.flush()
+	switch {
+	case err != nil && result == k8s_client.EtcdUnpatchPermanentError:
+		c.log.WithError(err).Errorf("Failed to unpatch etcd, not retrying")
+		return errors.Wrap(err, "failed to unpatch etcd")
+	case err != nil:
+		c.log.WithError(err).Errorf("Failed to unpatch etcd after %d attempts", attempt)
+		return errors.Wrapf(err, "failed to unpatch etcd after %d attempts", attempt)
+	case result == k8s_client.EtcdAlreadyUnpatched:
+		c.log.Infof("Etcd is already unpatched")
+	default:
+		c.recordEvent(ctx, v1.ObjectReference{APIVersion: "operator.openshift.io/v1", Kind: "Etcd", Name: "cluster"},
+			v1.EventTypeNormal, eventReasonEtcdUnpatched, "Etcd unsupported config overrides were removed")
 	}
-
+	return nil
 }
 
 // AddRouterCAToClusterCA adds router CA to cluster CA in kubeconfig
-func (c controller) addRouterCAToClusterCA() {
-	cmName := "default-ingress-cert"
-	cmNamespace := "openshift-config-managed"
+// returns the hash of the uploaded ca bundle or an error in case it didn't succeed till ctx is done
+func (c controller) addRouterCAToClusterCA(ctx context.Context) (string, error) {
 	c.log.Infof("Start adding ingress ca to cluster")
-	for {
-		caConfigMap, err := c.kc.GetConfigMap(cmNamespace, cmName)
-
+	var caBundle string
+	errorsLog := newRepeatedErrorsLogger(c.log, c.clock, repeatedErrorsSummaryInterval)
+	err := c.retryWithBackoff(ctx, 0, func() error {
+		var err error
+		caBundle, err = c.getIngressCaBundle()
 		if err != nil {
-			c.log.WithError(err).Errorf("fetching %s configmap from %s namespace", cmName, cmNamespace)
-			continue
+			// the cluster API is retried until the bundle is available
+			errorsLog.logf(logrus.ErrorLevel, err, "Failed to add ingress ca to cluster")
+			return err
+		}
+		if err = c.uploadIngressCa(ctx, caBundle); err == nil {
+			return nil
 		}
+		errorsLog.logf(logrus.ErrorLevel, err, "Failed to add ingress ca to cluster")
+		if !inventory_client.IsTransient(err) {
+			return common.PermanentError(err)
+		}
+		return err
+	})
+	errorsLog.flush()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to add ingress ca")
+	}
+	c.log.Infof("Ingress ca successfully sent to inventory")
+	c.recordIngressCAUploadedEvent(ctx)
+	return hashCaBundle(caBundle), nil
+}
 
-		c.log.Infof("Sending ingress certificate to inventory service. Certificate data %s", caConfigMap.Data["ca-bundle.crt"])
-		err = c.ic.UploadIngressCa(caConfigMap.Data["ca-bundle.crt"], c.ClusterID)
+// retryWithBackoff retries fn starting with the wait interval between attempts
+func (c controller) retryWithBackoff(ctx context.Context, attempts int, fn func() error) error {
+	return common.RetryWithBackoff(ctx, c.clock, attempts, c.waitInterval, c.waitInterval*retryMaxDelayFactor, fn)
+}
+
+// watchIngressCA uploads the ingress ca again whenever it changes during IngressCARotationWindow
+func (c controller) watchIngressCA(ctx context.Context, wg *sync.WaitGroup, lastHash string) {
+	defer wg.Done()
+	c.log.Infof("Watching ingress ca for changes during %s", c.IngressCARotationWindow)
+	windowEnd := c.clock.After(c.IngressCARotationWindow)
+	for {
+		select {
+		case <-ctx.Done():
+			c.log.Infof("watchIngressCA was cancelled")
+			return
+		case <-windowEnd:
+			c.log.Infof("Done watching ingress ca for changes")
+			return
+		case <-c.clock.After(c.pollInterval()):
+		}
+		caBundle, err := c.getIngressCaBundle()
 		if err != nil {
-			c.log.WithError(err).Errorf("Failed to upload ingress ca to assisted-service")
+			c.log.WithError(err).Warnf("Failed to get ingress ca")
 			continue
 		}
-		c.log.Infof("Ingress ca successfully sent to inventory")
-		return
+		hash := hashCaBundle(caBundle)
+		if hash == lastHash {
+			continue
+		}
+		c.log.Infof("Ingress ca was changed, sending it to inventory again")
+		if err = c.uploadIngressCa(ctx, caBundle); err != nil {
+			c.log.WithError(err).Errorf("Failed to upload changed ingress ca")
+			continue
+		}
+		c.recordIngressCAUploadedEvent(ctx)
+		lastHash = hash
 	}
 }
 
-func (c controller) waitForConsole() {
-	c.log.Infof("Waiting for console pod")
+func (c controller) recordIngressCAUploadedEvent(ctx context.Context) {
+	cm := c.ingressCAConfigMaps()[0]
+	c.recordEvent(ctx, v1.ObjectReference{APIVersion: "v1", Kind: "ConfigMap", Namespace: cm.Namespace, Name: cm.Name},
+		v1.EventTypeNormal, eventReasonIngressCAUploaded, "Ingress ca was sent to assisted-service")
+}
 
-	// TODO maybe need some timeout?
-	for {
-		pods, err := c.kc.GetPods("openshift-console", map[string]string{"app": "console", "component": "ui"})
+// ingressCAConfigMaps returns the configmaps the ingress ca is collected from
+func (c controller) ingressCAConfigMaps() []types.NamespacedName {
+	var configMaps []types.NamespacedName
+	for _, cm := range c.IngressCAConfigMaps {
+		if namespacedName, err := parseNamespacedName(cm); err == nil {
+			configMaps = append(configMaps, namespacedName)
+		}
+	}
+	if len(configMaps) == 0 {
+		configMaps = append(configMaps, types.NamespacedName{Namespace: ingressCMNamespace, Name: ingressCMName})
+	}
+	return configMaps
+}
+
+func parseNamespacedName(value string) (types.NamespacedName, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, fmt.Errorf("%q is not formatted as namespace/name", value)
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+// getIngressCaBundle combines the ca bundles of all the ingress ca configmaps and the additional cas, it fails if
+// any of them can't be read so a partial bundle isn't uploaded
+func (c controller) getIngressCaBundle() (string, error) {
+	var caBundles []string
+	for _, cm := range c.ingressCAConfigMaps() {
+		caConfigMap, err := c.kc.GetConfigMap(cm.Namespace, cm.Name)
 		if err != nil {
-			c.log.WithError(err).Warnf("Failed to get console pods")
-			continue
+			return "", errors.Wrapf(err, "fetching %s configmap from %s namespace", cm.Name, cm.Namespace)
 		}
-		for _, pod := range pods {
-			if pod.Status.Phase == "Running" {
-				c.log.Infof("Found running console pod")
-				return
+		if caBundle := caConfigMap.Data["ca-bundle.crt"]; caBundle != "" {
+			caBundles = append(caBundles, caBundle)
+		} else {
+			c.log.Warnf("ca-bundle.crt is empty in %s configmap", cm)
+		}
+	}
+	if len(caBundles) == 0 {
+		return "", fmt.Errorf("ca-bundle.crt is empty in all of the ingress ca configmaps")
+	}
+	for _, path := range c.AdditionalCAPaths {
+		caBundle, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", errors.Wrapf(err, "reading additional ca %s", path)
+		}
+		caBundles = append(caBundles, string(caBundle))
+	}
+	return combineCaBundles(caBundles), nil
+}
+
+// combineCaBundles concatenates the unique PEM blocks of the bundles in their order,
+// bundles without PEM blocks are kept as they are
+func combineCaBundles(caBundles []string) string {
+	var combined strings.Builder
+	seen := make(map[string]bool)
+	for _, caBundle := range caBundles {
+		rest := []byte(caBundle)
+		foundBlock := false
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
 			}
+			foundBlock = true
+			encoded := string(pem.EncodeToMemory(block))
+			if seen[encoded] {
+				continue
+			}
+			seen[encoded] = true
+			combined.WriteString(encoded)
+		}
+		if !foundBlock && !seen[caBundle] {
+			seen[caBundle] = true
+			combined.WriteString(caBundle)
 		}
 	}
+	return combined.String()
 }
 
-func (c controller) sendCompleteInstallation(isSuccess bool, errorInfo string) {
-	c.log.Infof("Start complete installation step")
+func (c controller) uploadIngressCa(ctx context.Context, caBundle string) error {
+	if c.DryRun {
+		c.log.Infof("Dry run: skipping upload of ingress certificate to inventory service. Certificate data %s", caBundle)
+		return nil
+	}
+	c.log.Infof("Sending ingress certificate to inventory service. Certificate data %s", caBundle)
+	err := c.ic.UploadIngressCa(ctx, caBundle, c.ClusterID)
+	// the ingress ca was already uploaded, e.g. before a restart
+	if inventory_client.IsConflict(err) {
+		c.log.WithError(err).Infof("Ingress certificate was already uploaded to inventory service")
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to upload ingress ca to assisted-service")
+	}
+	return nil
+}
+
+func hashCaBundle(caBundle string) string {
+	sum := sha256.Sum256([]byte(caBundle))
+	return hex.EncodeToString(sum[:])
+}
+
+// ignoredHostStatuses returns the statuses of the hosts that are not waited for
+func (c controller) ignoredHostStatuses() []string {
+	if len(c.IgnoredHostStatuses) == 0 {
+		return defaultIgnoredHostStatuses
+	}
+	return c.IgnoredHostStatuses
+}
+
+// mcsPodSelector returns the namespace and labels of the mcs pods
+func (c controller) mcsPodSelector() (string, map[string]string) {
+	return podSelector(c.McsNamespace, c.McsLabels, defaultMcsNamespace, defaultMcsLabels)
+}
+
+// consolePodSelector returns the namespace and labels of the console pods
+func (c controller) consolePodSelector() (string, map[string]string) {
+	return podSelector(c.ConsoleNamespace, c.ConsoleLabels, defaultConsoleNamespace, defaultConsoleLabels)
+}
+
+func podSelector(namespace string, labels map[string]string, defaultNamespace string, defaultLabels map[string]string) (string, map[string]string) {
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	if len(labels) == 0 {
+		labels = defaultLabels
+	}
+	return namespace, labels
+}
+
+// isPodServing tells whether the pod is running with all its containers ready, a terminating pod may still be
+// running during a rollout but it is about to disappear
+func isPodServing(pod *v1.Pod) bool {
+	if pod.Status.Phase != v1.PodRunning || pod.DeletionTimestamp != nil || len(pod.Status.ContainerStatuses) == 0 {
+		return false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if !status.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForConsole returns an error in case console pod is not running till ctx is done
+func (c controller) waitForConsole(ctx context.Context) error {
+	c.log.Infof("Waiting for console pod")
 	for {
-		if err := c.ic.CompleteInstallation(c.ClusterID, isSuccess, errorInfo); err != nil {
-			c.log.Error(err)
-			continue
+		pods, err := c.kc.GetPods(c.consolePodSelector())
+		switch {
+		case apierrors.IsNotFound(err):
+			c.log.Infof("Console namespace doesn't exist yet")
+		case err != nil:
+			c.log.WithError(err).Warnf("Failed to get console pods")
+		default:
+			for i := range pods {
+				pod := pods[i]
+				if isPodServing(&pod) {
+					c.log.Infof("Found running console pod")
+					c.recordEvent(ctx, v1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID},
+						v1.EventTypeNormal, eventReasonConsoleReady, "Console pod is running")
+					return nil
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			c.log.Warnf("Console pod is not running, not waiting for it anymore")
+			return errors.Wrap(ctx.Err(), "console pod is not running")
+		case <-c.clock.After(c.pollInterval()):
 		}
-		break
 	}
+}
+
+// sendCompleteInstallation reports the installation completion unless it was already completed, it can't be
+// force completed meanwhile
+func (c controller) sendCompleteInstallation(ctx context.Context, isSuccess bool, errorInfo string) {
+	sent := c.forceComplete.unlessSet(func() {
+		if c.completed.isSet() {
+			c.log.Infof("Installation was already completed, not completing it with success %t and error info %q", isSuccess, errorInfo)
+			return
+		}
+		c.completeInstallation(ctx, isSuccess, errorInfo)
+	})
+	if !sent {
+		c.log.Infof("Installation was already force completed, not completing it with success %t and error info %q", isSuccess, errorInfo)
+	}
+}
+
+func (c controller) completeInstallation(ctx context.Context, isSuccess bool, errorInfo string) {
+	c.log.Infof("Start complete installation step")
+	if c.DryRun {
+		c.log.Infof("Dry run: skipping complete installation with success %t and error info %q", isSuccess, errorInfo)
+		return
+	}
+	// the installation result is reported once resumed, the request is aborted once ctx is cancelled
+	if err := c.waitWhilePaused(ctx); err != nil {
+		c.log.WithError(err).Warnf("Not completing installation with success %t", isSuccess)
+		return
+	}
+	attempt := 0
+	errorsLog := newRepeatedErrorsLogger(c.log, c.clock, repeatedErrorsSummaryInterval)
+	err := common.RetryWithBackoff(ctx, c.clock, c.CompleteInstallationMaxRetries,
+		c.CompleteInstallationRetryMinDelay, c.CompleteInstallationRetryMaxDelay, func() error {
+			attempt++
+			err := c.ic.CompleteInstallation(ctx, c.ClusterID, isSuccess, errorInfo)
+			if err == nil {
+				return nil
+			}
+			errorsLog.logf(logrus.ErrorLevel, err, "Failed to complete installation, attempt %d", attempt)
+			if !inventory_client.IsTransient(err) {
+				return common.PermanentError(err)
+			}
+			return err
+		})
+	errorsLog.flush()
+	if err != nil {
+		c.log.WithError(err).Logf(logrus.FatalLevel, "Failed to complete installation after %d attempts, giving up", attempt)
+		return
+	}
+	c.completed.set()
 	c.log.Infof("Done complete installation step")
+	// only a completion assisted-service recorded is announced
+	c.notifyCompletion(ctx, isSuccess, errorInfo)
+	if isSuccess {
+		c.recordEvent(ctx, clusterObjectReference, v1.EventTypeNormal, eventReasonInstallationCompleted,
+			fmt.Sprintf("Installation of cluster %s was completed", c.ClusterID))
+	} else {
+		c.recordEvent(ctx, clusterObjectReference, v1.EventTypeWarning, eventReasonInstallationFailed,
+			fmt.Sprintf("Installation of cluster %s failed: %s", c.ClusterID, errorInfo))
+	}
 }
@@ -1,9 +1,26 @@
 package assisted_installer_controller
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -12,6 +29,8 @@ import (
 
 	"github.com/openshift/assisted-service/models"
 
+	configv1 "github.com/openshift/api/config/v1"
+
 	"k8s.io/api/certificates/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -20,12 +39,21 @@ import (
 	"github.com/openshift/assisted-installer/src/k8s_client"
 
 	"github.com/golang/mock/gomock"
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/pkg/apis/metal3/v1alpha1"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/openshift/assisted-installer/src/inventory_client"
 	"github.com/openshift/assisted-installer/src/ops"
+	"github.com/openshift/assisted-installer/src/version"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
 	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
 )
 
 func TestValidator(t *testing.T) {
@@ -45,6 +73,15 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		kubeNamesIds      map[string]string
 		wg                sync.WaitGroup
 		defaultStages     []models.HostStage
+		events            []*v1.Event
+		csrGroupVersion   string
+		eventsLock        sync.Mutex
+		progressReports   []int
+		// hostsProgress answers the UpdateHostsInstallProgress calls, the service doesn't support them by default
+		hostsProgress        func(updates []inventory_client.HostProgressUpdate) error
+		hostsProgressUpdates [][]inventory_client.HostProgressUpdate
+		serviceEvents        []serviceEvent
+		serviceEventsErr     error
 	)
 	kubeNamesIds = map[string]string{"node0": "6d6f00e8-70dd-48a5-859a-0f1459485ad9",
 		"node1": "2834ff2e-8965-48a5-859a-0f1459485a77",
@@ -56,6 +93,36 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		mockops = ops.NewMockOps(ctrl)
 		mockbmclient = inventory_client.NewMockInventoryClient(ctrl)
 		mockk8sclient = k8s_client.NewMockK8SClient(ctrl)
+		events = nil
+		mockk8sclient.EXPECT().CreateEvent(gomock.Any()).DoAndReturn(func(event *v1.Event) error {
+			eventsLock.Lock()
+			defer eventsLock.Unlock()
+			events = append(events, event)
+			return nil
+		}).AnyTimes()
+		csrGroupVersion = "certificates.k8s.io/v1beta1"
+		mockk8sclient.EXPECT().CsrGroupVersion().DoAndReturn(func() string { return csrGroupVersion }).AnyTimes()
+		progressReports = nil
+		mockbmclient.EXPECT().UpdateClusterProgress(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, clusterId string, percentage int) error {
+			progressReports = append(progressReports, percentage)
+			return nil
+		}).AnyTimes()
+		serviceEvents = nil
+		serviceEventsErr = nil
+		mockbmclient.EXPECT().AddEvent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, clusterId, hostId, severity, message string) error {
+			eventsLock.Lock()
+			defer eventsLock.Unlock()
+			serviceEvents = append(serviceEvents, serviceEvent{clusterId: clusterId, hostId: hostId, severity: severity, message: message})
+			return serviceEventsErr
+		}).AnyTimes()
+		hostsProgressUpdates = nil
+		hostsProgress = func(updates []inventory_client.HostProgressUpdate) error {
+			return &inventory_client.InventoryError{StatusCode: http.StatusNotFound, Err: fmt.Errorf("not found")}
+		}
+		mockbmclient.EXPECT().UpdateHostsInstallProgress(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, updates []inventory_client.HostProgressUpdate) error {
+			hostsProgressUpdates = append(hostsProgressUpdates, updates)
+			return hostsProgress(updates)
+		}).AnyTimes()
 		node0Id := strfmt.UUID("7916fa89-ea7a-443e-a862-b3e930309f65")
 		node1Id := strfmt.UUID("eb82821f-bf21-4614-9a3b-ecb07929f238")
 		node2Id := strfmt.UUID("b898d516-3e16-49d0-86a5-0ad5bd04e3ed")
@@ -66,7 +133,6 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		kubeNamesIds = map[string]string{"node0": "6d6f00e8-70dd-48a5-859a-0f1459485ad9",
 			"node1": "2834ff2e-8965-48a5-859a-0f1459485a77",
 			"node2": "57df89ee-3546-48a5-859a-0f1459485a66"}
-		GeneralWaitTimeout = 100 * time.Millisecond
 
 		defaultStages = []models.HostStage{models.HostStageDone,
 			models.HostStageDone,
@@ -78,16 +144,16 @@ var _ = Describe("installer HostRoleMaster role", func() {
 
 	getInventoryNodes := func(numOfFullListReturn int) map[string]inventory_client.HostData {
 		for i := 0; i < numOfFullListReturn; i++ {
-			mockbmclient.EXPECT().GetHosts([]string{models.HostStatusDisabled,
-				models.HostStatusError, models.HostStatusInstalled}).Return(inventoryNamesIds, nil).Times(1)
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), []string{models.HostStatusDisabled,
+				models.HostStatusInstalled}).Return(inventoryNamesIds, nil).Times(1)
 		}
-		mockbmclient.EXPECT().GetHosts([]string{models.HostStatusDisabled,
-			models.HostStatusError, models.HostStatusInstalled}).Return(map[string]inventory_client.HostData{}, nil).Times(1)
+		mockbmclient.EXPECT().GetHosts(gomock.Any(), []string{models.HostStatusDisabled,
+			models.HostStatusInstalled}).Return(map[string]inventory_client.HostData{}, nil).Times(1)
 		return inventoryNamesIds
 	}
 	configuringSuccess := func() {
 		mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
-		mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+		mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 	}
 
 	updateProgressSuccess := func(stages []models.HostStage, inventoryNamesIds map[string]inventory_client.HostData) {
@@ -97,7 +163,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		}
 
 		for i, stage := range stages {
-			mockbmclient.EXPECT().UpdateHostInstallProgress(hostIds[i], stage, "").Return(nil).Times(1)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostIds[i], stage, "").Return(nil).Times(1)
 		}
 	}
 
@@ -111,15 +177,114 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			URL:       "https://assisted-service.com:80",
 		}
 		BeforeEach(func() {
-			c = NewController(l, conf, mockops, mockbmclient, mockk8sclient)
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("updates a host to done only once across polls", func() {
+			updateProgressSuccess(defaultStages, inventoryNamesIds)
+			// assisted-service doesn't reflect the done hosts for a few polls
+			getInventoryNodes(3)
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(kubeNamesIds), nil).Times(3)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			c.WaitAndUpdateNodesStatus(context.Background())
 		})
 		It("WaitAndUpdateNodesStatus happy flow", func() {
 			updateProgressSuccess(defaultStages, inventoryNamesIds)
 			getInventoryNodes(1)
 			configuringSuccess()
 			listNodes()
-			c.WaitAndUpdateNodesStatus()
+			summary, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(summary.AllJoined).To(BeTrue())
+			Expect(testutil.ToFloat64(c.metrics.nodesPending)).To(Equal(float64(0)))
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Reason).To(Equal(eventReasonAllNodesJoined))
+			Expect(events[0].Namespace).To(Equal("assisted-installer"))
+			Expect(events[0].InvolvedObject).To(Equal(clusterObjectReference))
+			Expect(progressReports).To(Equal([]int{0, nodesProgressWeight}))
+		})
+	})
+	Context("updating the hosts progress", func() {
+		var doneUpdates []inventory_client.HostProgressUpdate
+		BeforeEach(func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id"}, mockops, mockbmclient, mockk8sclient)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			doneUpdates = nil
+			for _, host := range inventoryNamesIds {
+				doneUpdates = append(doneUpdates, inventory_client.HostProgressUpdate{HostID: host.Host.ID.String(), Stage: models.HostStageDone})
+			}
+		})
+		It("updates all the hosts of a poll in one request", func() {
+			hostsProgress = func(updates []inventory_client.HostProgressUpdate) error { return nil }
+			getInventoryNodes(1)
+			listNodes()
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			summary, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(summary.AllJoined).To(BeTrue())
+			Expect(hostsProgressUpdates).To(HaveLen(1))
+			Expect(hostsProgressUpdates[0]).To(ConsistOf(doneUpdates))
+			Expect(c.checkpoint.snapshot().isHostDone(doneUpdates[0].HostID)).To(BeTrue())
+		})
+		It("updates the hosts again on the next poll once the request failed", func() {
+			failed := false
+			hostsProgress = func(updates []inventory_client.HostProgressUpdate) error {
+				if !failed {
+					failed = true
+					return &inventory_client.InventoryError{StatusCode: http.StatusServiceUnavailable, Err: fmt.Errorf("unavailable")}
+				}
+				return nil
+			}
+			getInventoryNodes(2)
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(kubeNamesIds), nil).Times(2)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			_, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hostsProgressUpdates).To(HaveLen(2))
+			Expect(hostsProgressUpdates[0]).To(ConsistOf(doneUpdates))
+			Expect(hostsProgressUpdates[1]).To(ConsistOf(doneUpdates))
+		})
+		It("updates every host on its own once the service doesn't support updating them at once", func() {
+			getInventoryNodes(2)
+			// node0 joins on the first poll, the others on the second one
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]}), nil).Times(1),
+				mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(kubeNamesIds), nil).Times(1),
+			)
+			for _, update := range doneUpdates {
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), update.HostID, models.HostStageDone, "").Return(nil).Times(1)
+			}
+			_, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			// the unsupported request isn't sent again
+			Expect(hostsProgressUpdates).To(HaveLen(1))
+			Expect(hostsProgressUpdates[0]).To(HaveLen(1))
+			Expect(hostsProgressUpdates[0][0].HostID).To(Equal(inventoryNamesIds["node0"].Host.ID.String()))
+		})
+	})
+	Context("structured logging", func() {
+		It("logs cluster and host ids as json fields", func() {
+			buf := &bytes.Buffer{}
+			jsonLogger := logrus.New()
+			jsonLogger.SetFormatter(&logrus.JSONFormatter{})
+			jsonLogger.SetOutput(buf)
+			c = newTestController(jsonLogger, ControllerConfig{ClusterID: "cluster-id"}, mockops, mockbmclient, mockk8sclient)
+			updateProgressSuccess(defaultStages, inventoryNamesIds)
+			getInventoryNodes(1)
+			configuringSuccess()
+			listNodes()
+			c.WaitAndUpdateNodesStatus(context.Background())
 
+			hostIds := map[string]bool{}
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				fields := map[string]interface{}{}
+				Expect(json.Unmarshal([]byte(line), &fields)).To(Succeed())
+				Expect(fields["cluster_id"]).To(Equal("cluster-id"))
+				Expect(fields["component"]).To(Equal("assisted-installer-controller"))
+				if hostId, ok := fields["host_id"]; ok {
+					hostIds[hostId.(string)] = true
+				}
+			}
+			Expect(hostIds).To(HaveLen(3))
 		})
 	})
 	Context("Waiting for 3 nodes, will appear one by one", func() {
@@ -128,7 +293,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			URL:       "https://assisted-service.com:80",
 		}
 		BeforeEach(func() {
-			c = NewController(l, conf, mockops, mockbmclient, mockk8sclient)
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
 
 			updateProgressSuccess = func(stages []models.HostStage, inventoryNamesIds map[string]inventory_client.HostData) {
 				var hostIds []string
@@ -136,7 +301,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 					hostIds = append(hostIds, host.Host.ID.String())
 				}
 				for i, stage := range stages {
-					mockbmclient.EXPECT().UpdateHostInstallProgress(hostIds[i], stage, "").Return(nil).Times(1)
+					mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostIds[i], stage, "").Return(nil).Times(1)
 				}
 			}
 			kubeNamesIds = map[string]string{"node0": "6d6f00e8-70dd-48a5-859a-0f1459485ad9",
@@ -154,18 +319,18 @@ var _ = Describe("installer HostRoleMaster role", func() {
 					for key, value := range inventoryNamesIds {
 						targetMap[key] = value
 					}
-					mockbmclient.EXPECT().GetHosts([]string{models.HostStatusDisabled,
-						models.HostStatusError, models.HostStatusInstalled}).Return(targetMap, nil).Times(1)
+					mockbmclient.EXPECT().GetHosts(gomock.Any(), []string{models.HostStatusDisabled,
+						models.HostStatusInstalled}).Return(targetMap, nil).Times(1)
 					delete(inventoryNamesIds, name)
 				}
-				mockbmclient.EXPECT().GetHosts([]string{models.HostStatusDisabled,
-					models.HostStatusError, models.HostStatusInstalled}).Return(inventoryNamesIds, nil).Times(1)
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), []string{models.HostStatusDisabled,
+					models.HostStatusInstalled}).Return(inventoryNamesIds, nil).Times(1)
 			}
 
 			updateProgressSuccess(defaultStages, inventoryNamesIds)
 			listNodes()
 			configuringSuccess()
-			c.WaitAndUpdateNodesStatus()
+			c.WaitAndUpdateNodesStatus(context.Background())
 
 		})
 	})
@@ -175,7 +340,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			URL:       "https://assisted-service.com:80",
 		}
 		BeforeEach(func() {
-			c = NewController(l, conf, mockops, mockbmclient, mockk8sclient)
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
 		})
 		It("UpdateStatus fails and then succeeds", func() {
 			updateProgressSuccessFailureTest := func(stages []models.HostStage, inventoryNamesIds map[string]inventory_client.HostData) {
@@ -184,15 +349,15 @@ var _ = Describe("installer HostRoleMaster role", func() {
 					hostIds = append(hostIds, host.Host.ID.String())
 				}
 				for i, stage := range stages {
-					mockbmclient.EXPECT().UpdateHostInstallProgress(hostIds[i], stage, "").Return(fmt.Errorf("dummy")).Times(1)
-					mockbmclient.EXPECT().UpdateHostInstallProgress(hostIds[i], stage, "").Return(nil).Times(1)
+					mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostIds[i], stage, "").Return(fmt.Errorf("dummy")).Times(1)
+					mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostIds[i], stage, "").Return(nil).Times(1)
 				}
 			}
 			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(kubeNamesIds), nil).Times(2)
 			updateProgressSuccessFailureTest(defaultStages, inventoryNamesIds)
 			getInventoryNodes(2)
 			configuringSuccess()
-			c.WaitAndUpdateNodesStatus()
+			c.WaitAndUpdateNodesStatus(context.Background())
 
 		})
 	})
@@ -202,7 +367,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			URL:       "https://assisted-service.com:80",
 		}
 		BeforeEach(func() {
-			c = NewController(l, conf, mockops, mockbmclient, mockk8sclient)
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
 		})
 		It("ListNodes fails and then succeeds", func() {
 			listNodes := func() {
@@ -213,8 +378,827 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			getInventoryNodes(2)
 			listNodes()
 			configuringSuccess()
-			c.WaitAndUpdateNodesStatus()
+			c.WaitAndUpdateNodesStatus(context.Background())
+
+		})
+	})
+	Context("ListNodes fails while the API server warms up", func() {
+		var hook *logrustest.Hook
+		newController := func(warmup time.Duration) {
+			logger, h := logrustest.NewNullLogger()
+			logger.SetLevel(logrus.DebugLevel)
+			hook = h
+			c = newTestController(logger, ControllerConfig{ClusterID: "cluster-id", APIWarmupPeriod: warmup},
+				mockops, mockbmclient, mockk8sclient)
+		}
+		listNodesEntries := func() []logrus.Level {
+			var levels []logrus.Level
+			for _, entry := range hook.AllEntries() {
+				if strings.Contains(entry.Message, "list nodes") || strings.Contains(entry.Message, "No nodes") {
+					levels = append(levels, entry.Level)
+				}
+			}
+			return levels
+		}
+		transientListNodes := func() {
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListNodes().Return(nil,
+					&net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}).Times(1),
+				mockk8sclient.EXPECT().ListNodes().Return(nil, apierrors.NewServiceUnavailable("dummy")).Times(1),
+				mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{}, nil).Times(1),
+				mockk8sclient.EXPECT().ListNodes().Return(nil, fmt.Errorf("dummy")).Times(1),
+				mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(kubeNamesIds), nil).Times(1),
+			)
+		}
+
+		It("logs the early failures at debug level during the warm up period", func() {
+			newController(time.Hour)
+			transientListNodes()
+			updateProgressSuccess(defaultStages, inventoryNamesIds)
+			getInventoryNodes(5)
+			configuringSuccess()
+			c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(listNodesEntries()).To(Equal([]logrus.Level{
+				logrus.DebugLevel, logrus.DebugLevel, logrus.DebugLevel, logrus.DebugLevel}))
+		})
+		It("logs the failures as warnings and errors after the warm up period", func() {
+			newController(0)
+			transientListNodes()
+			updateProgressSuccess(defaultStages, inventoryNamesIds)
+			getInventoryNodes(5)
+			configuringSuccess()
+			c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(listNodesEntries()).To(Equal([]logrus.Level{
+				logrus.WarnLevel, logrus.WarnLevel, logrus.WarnLevel, logrus.ErrorLevel}))
+		})
+		It("identifies the API server not being ready", func() {
+			Expect(isAPINotReady(apierrors.NewServiceUnavailable("dummy"))).To(BeTrue())
+			Expect(isAPINotReady(apierrors.NewTooManyRequests("dummy", 1))).To(BeTrue())
+			Expect(isAPINotReady(&net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")})).To(BeTrue())
+			Expect(isAPINotReady(apierrors.NewForbidden(schema.GroupResource{Resource: "nodes"}, "", fmt.Errorf("dummy")))).To(BeFalse())
+			Expect(isAPINotReady(fmt.Errorf("dummy"))).To(BeFalse())
+		})
+	})
+	Context("detecting a stalled nodes join", func() {
+		BeforeEach(func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", ExpectedNodeCount: 5,
+				NodeJoinStallWindow: 250 * time.Millisecond}, mockops, mockbmclient, mockk8sclient)
+		})
+		It("reports the stall once when no node joins within the window", func() {
+			getInventoryNodes(4)
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{}), nil).Times(4)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			c.WaitAndUpdateNodesStatus(context.Background())
+			var stalled []string
+			for _, event := range events {
+				if event.Reason == eventReasonNodesJoinStalled {
+					stalled = append(stalled, event.Message)
+				}
+			}
+			Expect(stalled).To(Equal([]string{"No node joined in the last 250ms, joined 2 of 5 nodes"}))
+		})
+	})
+	Context("flagging a host that didn't join within the host join timeout", func() {
+		BeforeEach(func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", HostJoinTimeout: 250 * time.Millisecond},
+				mockops, mockbmclient, mockk8sclient)
+		})
+		It("flags only the lagging host and keeps waiting for it", func() {
+			ignoreStatuses := []string{models.HostStatusDisabled, models.HostStatusInstalled}
+			lagging := map[string]inventory_client.HostData{"node2": inventoryNamesIds["node2"]}
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(inventoryNamesIds, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(lagging, nil).Times(5),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"],
+				"node1": kubeNamesIds["node1"]}), nil).AnyTimes()
+			configuringSuccess()
+			_, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			var timedOut []string
+			for _, event := range events {
+				if event.Reason == eventReasonHostJoinTimedOut {
+					timedOut = append(timedOut, event.Message)
+				}
+			}
+			Expect(timedOut).To(Equal([]string{"Host node2 didn't join the cluster within 250ms"}))
+			Expect(testutil.ToFloat64(c.metrics.hostsJoinTimedOut)).To(Equal(float64(1)))
+		})
+		It("doesn't flag hosts that join in time", func() {
+			getInventoryNodes(2)
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(kubeNamesIds), nil).AnyTimes()
+			configuringSuccess()
+			_, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			for _, event := range events {
+				Expect(event.Reason).NotTo(Equal(eventReasonHostJoinTimedOut))
+			}
+			Expect(testutil.ToFloat64(c.metrics.hostsJoinTimedOut)).To(BeZero())
+		})
+	})
+	Context("GetHosts fails and then succeeds", func() {
+		conf := ControllerConfig{
+			ClusterID: "cluster-id",
+			URL:       "https://assisted-service.com:80",
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("doesn't consider all nodes as joined when GetHosts fails", func() {
+			ignoreStatuses := []string{models.HostStatusDisabled, models.HostStatusInstalled}
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(nil, fmt.Errorf("dummy")).Times(2),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(inventoryNamesIds, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			listNodes()
+			updateProgressSuccess(defaultStages, inventoryNamesIds)
+			configuringSuccess()
+			c.WaitAndUpdateNodesStatus(context.Background())
+		})
+	})
+	Context("bootstrap host pivoting to a master", func() {
+		ignoreStatuses := []string{models.HostStatusDisabled, models.HostStatusInstalled}
+		bootstrapNodes := func(name string, ready bool) *v1.NodeList {
+			nodes := GetKubeNodes(map[string]string{name: inventoryNamesIds["node0"].Host.ID.String()})
+			if !ready {
+				nodes.Items[0].Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+			}
+			return nodes
+		}
+		It("reports the bootstrap node that joined under another name", func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", URL: "https://assisted-service.com:80"},
+				mockops, mockbmclient, mockk8sclient)
+			host := *inventoryNamesIds["node0"].Host
+			host.Bootstrap = true
+			Expect(c.isBootstrapHost("node0", inventory_client.HostData{Host: &host})).To(BeTrue())
+			Expect(c.isBootstrapHost("node1", inventoryNamesIds["node1"])).To(BeFalse())
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).
+					Return(map[string]inventory_client.HostData{"node0": {Host: &host}}, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			mockk8sclient.EXPECT().ListNodes().Return(bootstrapNodes("node0.example.com", true), nil).Times(1)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), host.ID.String(), models.HostStageDone, "").Return(nil).Times(1)
+			c.WaitAndUpdateNodesStatus(context.Background())
+		})
+		It("reports the bootstrap node that left the cluster and rejoined as a master", func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", URL: "https://assisted-service.com:80",
+				BootstrapHostname: "node0"}, mockops, mockbmclient, mockk8sclient)
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"]}
+			Expect(c.isBootstrapHost("NODE0", inventoryNamesIds["node0"])).To(BeTrue())
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(hosts, nil).Times(3),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListNodes().Return(bootstrapNodes("node0", false), nil).Times(1),
+				mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{}, nil).Times(1),
+				mockk8sclient.EXPECT().ListNodes().Return(bootstrapNodes("node0", true), nil).Times(1),
+			)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			hostId := inventoryNamesIds["node0"].Host.ID.String()
+			gomock.InOrder(
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageJoined, "").Return(nil).Times(1),
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageDone, "").Return(nil).Times(1),
+			)
+			c.WaitAndUpdateNodesStatus(context.Background())
+		})
+	})
+	Context("custom ignored host statuses", func() {
+		It("passes the ignored statuses to GetHosts", func() {
+			ignoreStatuses := []string{models.HostStatusDisabled, models.HostStatusInstalled, models.HostStatusCancelled}
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", URL: "https://assisted-service.com:80",
+				IgnoredHostStatuses: ignoreStatuses}, mockops, mockbmclient, mockk8sclient)
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(inventoryNamesIds, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			listNodes()
+			updateProgressSuccess(defaultStages, inventoryNamesIds)
+			configuringSuccess()
+			c.WaitAndUpdateNodesStatus(context.Background())
+		})
+	})
+	Context("hosts moving to error", func() {
+		conf := ControllerConfig{
+			ClusterID: "cluster-id",
+			URL:       "https://assisted-service.com:80",
+		}
+		ignoreStatuses := []string{models.HostStatusDisabled, models.HostStatusInstalled}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		erroredHost := func(name string) inventory_client.HostData {
+			host := *inventoryNamesIds[name].Host
+			status := models.HostStatusError
+			statusInfo := "Host failed to install"
+			host.Status = &status
+			host.StatusInfo = &statusInfo
+			return inventory_client.HostData{Host: &host}
+		}
+		It("reports hosts that moved to error once and doesn't wait for them", func() {
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"],
+				"node1": inventoryNamesIds["node1"], "node2": erroredHost("node2")}
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(hosts, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).
+					Return(map[string]inventory_client.HostData{"node2": erroredHost("node2")}, nil).Times(1),
+			)
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"],
+				"node1": kubeNamesIds["node1"]}), nil).Times(1)
+			for _, name := range []string{"node0", "node1"} {
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), inventoryNamesIds[name].Host.ID.String(), models.HostStageDone, "").
+					Return(nil).Times(1)
+			}
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(testutil.ToFloat64(c.metrics.hostsErrored)).To(Equal(float64(1)))
+		})
+		It("fails the installation once more hosts than allowed moved to error", func() {
+			c.MaxErroredHosts = 1
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"],
+				"node1": erroredHost("node1"), "node2": erroredHost("node2")}
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(hosts, nil).Times(1)
+			mockk8sclient.EXPECT().ListNodes().Times(0)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			mockk8sclient.EXPECT().ListCsrs().Return(&certificatesv1beta1.CertificateSigningRequestList{}, nil).Times(1)
+			mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, nil).Times(1)
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), "cluster-id", diagnosticsLogsType, gomock.Any()).Return(nil).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false,
+				"2 hosts moved to error while waiting for the nodes to join, more than the allowed 1").Return(nil).Times(1)
+			_, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(errors.Is(err, ErrTooManyErroredHosts)).To(BeTrue())
+			Expect(testutil.ToFloat64(c.metrics.hostsErrored)).To(Equal(float64(2)))
+		})
+		It("cordons the nodes of joined hosts that moved to error", func() {
+			c.CordonErroredNodes = true
+			joinedErroredHost := erroredHost("node2")
+			joinedErroredHost.Host.Progress = &models.HostProgressInfo{CurrentStage: models.HostStageJoined}
+			erroredHosts := map[string]inventory_client.HostData{"node1": erroredHost("node1"), "node2": joinedErroredHost}
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"],
+				"node1": erroredHosts["node1"], "node2": erroredHosts["node2"]}
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(hosts, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(erroredHosts, nil).Times(1),
+			)
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"],
+				"node2": kubeNamesIds["node2"]}), nil).Times(1)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), inventoryNamesIds["node0"].Host.ID.String(), models.HostStageDone, "").
+				Return(nil).Times(1)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			// node1 moved to error before it joined, node2 is cordoned once
+			mockk8sclient.EXPECT().CordonNode("node2").Return(nil).Times(1)
+			c.WaitAndUpdateNodesStatus(context.Background())
+		})
+		It("doesn't cordon the nodes of errored hosts unless configured", func() {
+			joinedErroredHost := erroredHost("node2")
+			joinedErroredHost.Host.Progress = &models.HostProgressInfo{CurrentStage: models.HostStageJoined}
+			hosts := map[string]inventory_client.HostData{"node2": joinedErroredHost}
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), ignoreStatuses).Return(hosts, nil).Times(1)
+			mockk8sclient.EXPECT().CordonNode(gomock.Any()).Times(0)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			c.WaitAndUpdateNodesStatus(context.Background())
+		})
+	})
+	Context("Waiting for nodes to become ready", func() {
+		conf := ControllerConfig{
+			ClusterID: "cluster-id",
+			URL:       "https://assisted-service.com:80",
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("reports joined for not ready node and done once it is ready", func() {
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"]}
+			hostId := hosts["node0"].Host.ID.String()
+			notReadyNodes := GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]})
+			notReadyNodes.Items[0].Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+			readyNodes := GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]})
+
+			joinedProgress := models.HostProgressInfo{CurrentStage: models.HostStageJoined}
+			joinedHosts := map[string]inventory_client.HostData{"node0": {Host: &models.Host{ID: hosts["node0"].Host.ID, Progress: &joinedProgress}}}
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(hosts, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(joinedHosts, nil).Times(2),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListNodes().Return(notReadyNodes, nil).Times(2),
+				mockk8sclient.EXPECT().ListNodes().Return(readyNodes, nil).Times(1),
+			)
+			gomock.InOrder(
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageJoined, "").Return(nil).Times(1),
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageDone, "").Return(nil).Times(1),
+			)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			summary, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(summary.AllJoined).To(BeTrue())
+			Expect(summary.Joined).To(Equal(1))
+			Expect(summary.Expected).To(Equal(1))
+			Expect(summary.NotReadyNodes).To(Equal([]string{"node0"}))
+		})
+		It("reports the ready node stage before done", func() {
+			c.ReadyNodeStage = models.HostStageConfiguring
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"]}
+			hostId := hosts["node0"].Host.ID.String()
+			notReadyNodes := GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]})
+			notReadyNodes.Items[0].Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+			readyNodes := GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]})
+
+			joinedProgress := models.HostProgressInfo{CurrentStage: models.HostStageJoined}
+			joinedHosts := map[string]inventory_client.HostData{"node0": {Host: &models.Host{ID: hosts["node0"].Host.ID, Progress: &joinedProgress}}}
+			configuringProgress := models.HostProgressInfo{CurrentStage: models.HostStageConfiguring}
+			configuringHosts := map[string]inventory_client.HostData{"node0": {Host: &models.Host{ID: hosts["node0"].Host.ID, Progress: &configuringProgress}}}
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(hosts, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(joinedHosts, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(configuringHosts, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListNodes().Return(notReadyNodes, nil).Times(1),
+				mockk8sclient.EXPECT().ListNodes().Return(readyNodes, nil).Times(2),
+			)
+			gomock.InOrder(
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageJoined, "").Return(nil).Times(1),
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageConfiguring, "").Return(nil).Times(1),
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageDone, "").Return(nil).Times(1),
+			)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			_, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("reports the ready node stage again once its update failed", func() {
+			c.ReadyNodeStage = models.HostStageConfiguring
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"]}
+			hostId := hosts["node0"].Host.ID.String()
+			readyNodes := GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]})
+
+			configuringProgress := models.HostProgressInfo{CurrentStage: models.HostStageConfiguring}
+			configuringHosts := map[string]inventory_client.HostData{"node0": {Host: &models.Host{ID: hosts["node0"].Host.ID, Progress: &configuringProgress}}}
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(hosts, nil).Times(2),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(configuringHosts, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			mockk8sclient.EXPECT().ListNodes().Return(readyNodes, nil).Times(3)
+			gomock.InOrder(
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageConfiguring, "").Return(fmt.Errorf("dummy")).Times(1),
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageConfiguring, "").Return(nil).Times(1),
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageDone, "").Return(nil).Times(1),
+			)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			_, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("evaluates again the node of a host that was deleted after it was matched", func() {
+			c.ReadyNodeStage = models.HostStageConfiguring
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"]}
+			hostId := hosts["node0"].Host.ID.String()
+			notReadyNodes := GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]})
+			notReadyNodes.Items[0].Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+			readyNodes := GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]})
+
+			joinedProgress := models.HostProgressInfo{CurrentStage: models.HostStageJoined}
+			joinedHosts := map[string]inventory_client.HostData{"node0": {Host: &models.Host{ID: hosts["node0"].Host.ID, Progress: &joinedProgress}}}
+			configuringProgress := models.HostProgressInfo{CurrentStage: models.HostStageConfiguring}
+			configuringHosts := map[string]inventory_client.HostData{"node0": {Host: &models.Host{ID: hosts["node0"].Host.ID, Progress: &configuringProgress}}}
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(joinedHosts, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(configuringHosts, nil).Times(2),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(joinedHosts, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(configuringHosts, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			// the node is deleted after it was reported ready and joins again once its host was reprovisioned
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListNodes().Return(readyNodes, nil).Times(1),
+				mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{}, nil).Times(1),
+				mockk8sclient.EXPECT().ListNodes().Return(notReadyNodes, nil).Times(1),
+				mockk8sclient.EXPECT().ListNodes().Return(readyNodes, nil).Times(2),
+			)
+			gomock.InOrder(
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageConfiguring, "").Return(nil).Times(1),
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageJoined, "").Return(nil).Times(1),
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageConfiguring, "").Return(nil).Times(1),
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageDone, "").Return(nil).Times(1),
+			)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			_, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("forgets the annotation of a deleted node", func() {
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"]}
+			hostId := hosts["node0"].Host.ID.String()
+			c.matchedNodes[hostId] = "node0"
+			c.readyStageReported[hostId] = true
+			c.annotatedNodes["node0"] = hostId
+			c.forgetDeletedNodes(GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]}), hosts)
+			Expect(c.matchedNodes).To(HaveKey(hostId))
+			c.forgetDeletedNodes(&v1.NodeList{}, hosts)
+			Expect(c.matchedNodes).To(BeEmpty())
+			Expect(c.readyStageReported).To(BeEmpty())
+			Expect(c.annotatedNodes).To(BeEmpty())
+		})
+		It("reports done once a host already reported the ready node stage", func() {
+			c.ReadyNodeStage = models.HostStageConfiguring
+			// the hosts are configuring already
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"]}
+			hostId := hosts["node0"].Host.ID.String()
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(hosts, nil).Times(2),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]}), nil).Times(2)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageDone, "").Return(nil).Times(1)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			_, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("reports the configured not ready node stage", func() {
+			c.NotReadyNodeStage = models.HostStageRebooting
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"]}
+			hostId := hosts["node0"].Host.ID.String()
+			notReadyNodes := GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]})
+			notReadyNodes.Items[0].Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(hosts, nil).Times(2),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListNodes().Return(notReadyNodes, nil).Times(1),
+				mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]}), nil).Times(1),
+			)
+			gomock.InOrder(
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageRebooting, "").Return(nil).Times(1),
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageDone, "").Return(nil).Times(1),
+			)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			_, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("annotates the node with its host id once", func() {
+			c.AnnotateNodes = true
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"]}
+			hostId := hosts["node0"].Host.ID.String()
+			notReadyNodes := GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]})
+			notReadyNodes.Items[0].Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(hosts, nil).Times(2),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListNodes().Return(notReadyNodes, nil).Times(1),
+				mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]}), nil).Times(1),
+			)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, gomock.Any(), "").Return(nil).Times(2)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			mockk8sclient.EXPECT().AnnotateNode("node0", map[string]string{hostIDAnnotation: hostId}).Return(nil).Times(1)
+			_, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("doesn't annotate a node that already has its host id", func() {
+			c.AnnotateNodes = true
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"]}
+			hostId := hosts["node0"].Host.ID.String()
+			nodes := GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]})
+			nodes.Items[0].Annotations = map[string]string{hostIDAnnotation: hostId}
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(hosts, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			mockk8sclient.EXPECT().ListNodes().Return(nodes, nil).Times(1)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageDone, "").Return(nil).Times(1)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			mockk8sclient.EXPECT().AnnotateNode(gomock.Any(), gomock.Any()).Times(0)
+			_, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+	Context("validating WaitForBootstrapComplete", func() {
+		conf := ControllerConfig{
+			ClusterID:                "cluster-id",
+			URL:                      "https://assisted-service.com:80",
+			BootstrapCompleteTimeout: 350 * time.Millisecond,
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("returns once bootstrap is complete", func() {
+			gomock.InOrder(
+				mockk8sclient.EXPECT().IsBootstrapComplete().Return(false, fmt.Errorf("dummy")).Times(1),
+				mockk8sclient.EXPECT().IsBootstrapComplete().Return(false, nil).Times(1),
+				mockk8sclient.EXPECT().IsBootstrapComplete().Return(true, nil).Times(1),
+			)
+			Expect(c.WaitForBootstrapComplete(context.Background())).To(Succeed())
+		})
+		It("doesn't wait when bootstrap is already complete", func() {
+			mockk8sclient.EXPECT().IsBootstrapComplete().Return(true, nil).Times(1)
+			start := time.Now()
+			Expect(c.WaitForBootstrapComplete(context.Background())).To(Succeed())
+			Expect(time.Since(start)).To(BeNumerically("<", c.waitInterval))
+		})
+		It("gives up after timeout", func() {
+			mockk8sclient.EXPECT().IsBootstrapComplete().Return(false, nil).MinTimes(2)
+			Expect(c.WaitForBootstrapComplete(context.Background())).To(MatchError(ContainSubstring("didn't complete")))
+		})
+		It("times out exactly after BootstrapCompleteTimeout", func() {
+			c.waitInterval = time.Minute
+			c.BootstrapCompleteTimeout = 10 * time.Minute
+			fakeClock := clock.NewFakeClock(time.Now())
+			c.clock = fakeClock
+			// a check every minute, the 11th is past the deadline
+			mockk8sclient.EXPECT().IsBootstrapComplete().Return(false, nil).Times(12)
+			done := make(chan error)
+			go func() {
+				done <- c.WaitForBootstrapComplete(context.Background())
+			}()
+			for i := 0; i < 11; i++ {
+				Eventually(fakeClock.HasWaiters).Should(BeTrue())
+				fakeClock.Step(time.Minute)
+			}
+			Eventually(done).Should(Receive(MatchError(ContainSubstring("didn't complete after 10m0s"))))
+		})
+		It("returns when cancelled", func() {
+			mockk8sclient.EXPECT().IsBootstrapComplete().Return(false, nil).Times(1)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			Expect(c.WaitForBootstrapComplete(ctx)).To(MatchError(ContainSubstring("cancelled")))
+		})
+	})
+	Context("strict host matching", func() {
+		conf := ControllerConfig{
+			ClusterID:          "cluster-id",
+			URL:                "https://assisted-service.com:80",
+			StrictHostMatching: true,
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("updates hosts whose id matches the node system uuid", func() {
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"]}
+			hostId := hosts["node0"].Host.ID.String()
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(hosts, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			// system uuid is reported in upper case on some platforms
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{"node0": strings.ToUpper(hostId)}), nil).Times(1)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hostId, models.HostStageDone, "").Return(nil).Times(1)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			c.WaitAndUpdateNodesStatus(context.Background())
+		})
+		It("skips nodes whose system uuid doesn't match the host id", func() {
+			hosts := map[string]inventory_client.HostData{"node0": inventoryNamesIds["node0"]}
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(hosts, nil).Times(1),
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(map[string]inventory_client.HostData{}, nil).Times(1),
+			)
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]}), nil).Times(1)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			c.WaitAndUpdateNodesStatus(context.Background())
+		})
+		It("matches by name only when disabled", func() {
+			c.StrictHostMatching = false
+			node := GetKubeNodes(map[string]string{"node0": kubeNamesIds["node0"]}).Items[0]
+			Expect(c.isHostMatchingNode(inventoryNamesIds["node0"], &node)).To(BeTrue())
+		})
+	})
+	Context("Node join timeout", func() {
+		conf := ControllerConfig{
+			ClusterID:       "cluster-id",
+			URL:             "https://assisted-service.com:80",
+			NodeJoinTimeout: 150 * time.Millisecond,
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("WaitAndUpdateNodesStatus fails installation when nodes never join", func() {
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), []string{models.HostStatusDisabled,
+				models.HostStatusInstalled}).Return(inventoryNamesIds, nil).MinTimes(2)
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{}), nil).MinTimes(1)
+			configuringSuccess()
+			mockk8sclient.EXPECT().ListCsrs().Return(&certificatesv1beta1.CertificateSigningRequestList{}, nil).Times(1)
+			mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, nil).Times(1)
+			uploadLogs := mockbmclient.EXPECT().UploadLogs(gomock.Any(), "cluster-id", diagnosticsLogsType, gomock.Any()).Return(nil).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false, gomock.Any()).Return(nil).Times(1).After(uploadLogs)
+			summary, err := c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(errors.Is(err, ErrNodesJoinTimeout)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring("3 hosts didn't join after 150ms")))
+			Expect(summary.AllJoined).To(BeFalse())
+		})
+		It("reports why the pending hosts didn't join", func() {
+			notReady := GetKubeNodes(map[string]string{"node1": "eb82821f-bf21-4614-9a3b-ecb07929f238"})
+			notReady.Items[0].Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse,
+				Reason: "KubeletNotReady"}}
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), []string{models.HostStatusDisabled,
+				models.HostStatusInstalled}).Return(inventoryNamesIds, nil).MinTimes(2)
+			mockk8sclient.EXPECT().ListNodes().Return(notReady, nil).MinTimes(1)
+			configuringSuccess()
+			mockk8sclient.EXPECT().ListCsrs().Return(&certificatesv1beta1.CertificateSigningRequestList{}, nil).Times(1)
+			mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, nil).Times(1)
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), "cluster-id", diagnosticsLogsType, gomock.Any()).Return(nil).Times(1)
+			var errorInfo string
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false, gomock.Any()).DoAndReturn(
+				func(_ context.Context, clusterId string, isSuccess bool, info string) error {
+					errorInfo = info
+					return nil
+				}).Times(1)
+			c.WaitAndUpdateNodesStatus(context.Background())
+			Expect(errorInfo).To(HavePrefix("Timed out after 150ms waiting for 3 hosts to join the cluster: "))
+			Expect(errorInfo).To(ContainSubstring("7916fa89-ea7a-443e-a862-b3e930309f65 (node0) status unknown stage Configuring, node never appeared"))
+			Expect(errorInfo).To(ContainSubstring("eb82821f-bf21-4614-9a3b-ecb07929f238 (node1) status unknown stage Configuring, " +
+				"node node1 is not ready: Ready is False, KubeletNotReady"))
+		})
+		It("WaitAndUpdateNodesStatus times out exactly after NodeJoinTimeout", func() {
+			c.waitInterval = time.Minute
+			c.NodeJoinTimeout = 10 * time.Minute
+			fakeClock := clock.NewFakeClock(time.Now())
+			c.clock = fakeClock
+			// a poll every minute, the 11th is past the deadline
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), []string{models.HostStatusDisabled,
+				models.HostStatusInstalled}).Return(inventoryNamesIds, nil).Times(11)
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{}), nil).Times(10)
+			configuringSuccess()
+			mockk8sclient.EXPECT().ListCsrs().Return(&certificatesv1beta1.CertificateSigningRequestList{}, nil).Times(1)
+			mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, nil).Times(1)
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), "cluster-id", diagnosticsLogsType, gomock.Any()).Return(nil).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false, gomock.Any()).Return(nil).Times(1)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				c.WaitAndUpdateNodesStatus(context.Background())
+			}()
+			for i := 0; i < 11; i++ {
+				Eventually(fakeClock.HasWaiters).Should(BeTrue())
+				Consistently(done, 10*time.Millisecond).ShouldNot(BeClosed())
+				fakeClock.Step(c.waitInterval)
+			}
+			Eventually(done).Should(BeClosed())
+		})
+	})
+	Context("validating GatherFailureDiagnostics", func() {
+		conf := ControllerConfig{
+			ClusterID: "cluster-id",
+			URL:       "https://assisted-service.com:80",
+		}
+		var bundle map[string]string
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+			bundle = nil
+		})
+		readBundle := func(_ context.Context, clusterId string, logsType string, upfile io.Reader) error {
+			bundle = make(map[string]string)
+			gr, err := gzip.NewReader(upfile)
+			Expect(err).NotTo(HaveOccurred())
+			tr := tar.NewReader(gr)
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).NotTo(HaveOccurred())
+				content, err := ioutil.ReadAll(tr)
+				Expect(err).NotTo(HaveOccurred())
+				bundle[header.Name] = string(content)
+			}
+			return nil
+		}
+		mockMcsPod := func() {
+			mockk8sclient.EXPECT().GetPods("openshift-machine-config-operator", map[string]string{"k8s-app": "machine-config-server"}).
+				Return([]v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "mcs-0"}}}, nil).Times(1)
+			mockk8sclient.EXPECT().GetPodLogs("openshift-machine-config-operator", "mcs-0", gomock.Any()).Return("mcs line\n", nil).Times(1)
+		}
+		It("uploads mcs logs, pending csrs, bmh statuses and pod logs", func() {
+			mockMcsPod()
+			approved := v1beta1.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: "approved"},
+				Status: v1beta1.CertificateSigningRequestStatus{Conditions: []v1beta1.CertificateSigningRequestCondition{{Type: v1beta1.CertificateApproved}}}}
+			pending := v1beta1.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: "pending"},
+				Spec: v1beta1.CertificateSigningRequestSpec{Username: "system:node:node0"}}
+			mockk8sclient.EXPECT().ListCsrs().Return(&v1beta1.CertificateSigningRequestList{Items: []v1beta1.CertificateSigningRequest{approved, pending}}, nil).Times(1)
+			bmh := metal3v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: "bmh0", Namespace: "openshift-machine-api"},
+				Status: metal3v1alpha1.BareMetalHostStatus{ErrorMessage: "bmh error"}}
+			mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{Items: []metal3v1alpha1.BareMetalHost{bmh}}, nil).Times(1)
+			for _, namespace := range c.diagnosticsNamespaces() {
+				if namespace == "openshift-machine-api" {
+					continue
+				}
+				mockk8sclient.EXPECT().GetPods(namespace, nil).Return([]v1.Pod{}, nil).Times(1)
+			}
+			mockk8sclient.EXPECT().GetPods("openshift-machine-api", nil).
+				Return([]v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "mao"}}}, nil).Times(1)
+			mockk8sclient.EXPECT().GetPodLogs("openshift-machine-api", "mao", diagnosticsPodLogsOptions).Return("mao logs", nil).Times(1)
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), "cluster-id", diagnosticsLogsType, gomock.Any()).DoAndReturn(readBundle).Times(1)
+
+			c.GatherFailureDiagnostics(context.Background())
+			Expect(bundle).To(HaveLen(4))
+			Expect(bundle["mcs.log"]).To(Equal("mcs line\n"))
+			Expect(bundle["pending_csrs.json"]).To(ContainSubstring("pending"))
+			Expect(bundle["pending_csrs.json"]).To(ContainSubstring("system:node:node0"))
+			Expect(bundle["pending_csrs.json"]).NotTo(ContainSubstring("approved"))
+			Expect(bundle["bmh_statuses.json"]).To(ContainSubstring("openshift-machine-api/bmh0"))
+			Expect(bundle["bmh_statuses.json"]).To(ContainSubstring("bmh error"))
+			Expect(bundle["pods/openshift-machine-api/mao.log"]).To(Equal("mao logs"))
+		})
+		It("adds collection errors to the bundle and still uploads it", func() {
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("dummy")).AnyTimes()
+			mockk8sclient.EXPECT().ListCsrs().Return(nil, fmt.Errorf("dummy")).Times(1)
+			mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, fmt.Errorf("dummy")).Times(1)
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), "cluster-id", diagnosticsLogsType, gomock.Any()).DoAndReturn(readBundle).Times(1)
 
+			c.GatherFailureDiagnostics(context.Background())
+			Expect(bundle).To(HaveKey("mcs.log"))
+			Expect(bundle).NotTo(HaveKey("pending_csrs.json"))
+			Expect(bundle).NotTo(HaveKey("bmh_statuses.json"))
+			Expect(bundle["errors.txt"]).To(ContainSubstring("Failed to list csrs"))
+			Expect(bundle["errors.txt"]).To(ContainSubstring("Failed to list BMHs"))
+			Expect(bundle["errors.txt"]).To(ContainSubstring("Failed to get pods of namespace openshift-machine-api"))
+		})
+		It("gathers the pod logs of the mcs, console and default namespaces by default", func() {
+			Expect(c.diagnosticsNamespaces()).To(Equal([]string{"assisted-installer", "openshift-machine-api",
+				"openshift-cluster-version", "openshift-machine-config-operator", "openshift-console"}))
+			c.McsNamespace = "custom-mcs"
+			c.ConsoleNamespace = "custom-console"
+			Expect(c.diagnosticsNamespaces()).To(ContainElement("custom-mcs"))
+			Expect(c.diagnosticsNamespaces()).To(ContainElement("custom-console"))
+		})
+		It("gathers the pod logs of the configured namespaces only", func() {
+			c.DiagnosticNamespaces = []string{"openshift-etcd", "openshift-kube-apiserver"}
+			mockMcsPod()
+			mockk8sclient.EXPECT().ListCsrs().Return(&v1beta1.CertificateSigningRequestList{}, nil).Times(1)
+			mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, nil).Times(1)
+			mockk8sclient.EXPECT().GetPods("openshift-etcd", nil).
+				Return([]v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "etcd-0"}}}, nil).Times(1)
+			mockk8sclient.EXPECT().GetPodLogs("openshift-etcd", "etcd-0", diagnosticsPodLogsOptions).Return("etcd logs", nil).Times(1)
+			mockk8sclient.EXPECT().GetPods("openshift-kube-apiserver", nil).Return([]v1.Pod{}, nil).Times(1)
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), "cluster-id", diagnosticsLogsType, gomock.Any()).DoAndReturn(readBundle).Times(1)
+
+			c.GatherFailureDiagnostics(context.Background())
+			Expect(bundle["pods/openshift-etcd/etcd-0.log"]).To(Equal("etcd logs"))
+			Expect(bundle).NotTo(HaveKey("errors.txt"))
+		})
+		It("upload failure is not fatal", func() {
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			mockk8sclient.EXPECT().ListCsrs().Return(&v1beta1.CertificateSigningRequestList{}, nil).Times(1)
+			mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, nil).Times(1)
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), "cluster-id", diagnosticsLogsType, gomock.Any()).Return(fmt.Errorf("dummy")).Times(1)
+			c.GatherFailureDiagnostics(context.Background())
+		})
+	})
+	Context("validating calculateProgress", func() {
+		It("computes the percentage of joined nodes and post install stages", func() {
+			tests := []struct {
+				expectedNodes int
+				joinedNodes   int
+				ingressCA     bool
+				etcd          bool
+				console       bool
+				percentage    int
+			}{
+				{expectedNodes: 3, joinedNodes: 0, percentage: 0},
+				{expectedNodes: 3, joinedNodes: 1, percentage: 23},
+				{expectedNodes: 3, joinedNodes: 3, percentage: 70},
+				{expectedNodes: 3, joinedNodes: 3, ingressCA: true, percentage: 80},
+				{expectedNodes: 3, joinedNodes: 3, ingressCA: true, etcd: true, percentage: 90},
+				{expectedNodes: 3, joinedNodes: 3, ingressCA: true, etcd: true, console: true, percentage: 100},
+				{expectedNodes: 3, joinedNodes: 5, ingressCA: true, etcd: true, console: true, percentage: 100},
+				{expectedNodes: 0, joinedNodes: 0, percentage: 70},
+				{expectedNodes: 0, joinedNodes: 0, console: true, percentage: 80},
+			}
+			for _, t := range tests {
+				Expect(calculateProgress(t.expectedNodes, t.joinedNodes, t.ingressCA, t.etcd, t.console)).To(Equal(t.percentage), fmt.Sprintf("%+v", t))
+			}
+		})
+		It("reports only progress changes", func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id"}, mockops, mockbmclient, mockk8sclient)
+			c.progress.setPendingNodes(2)
+			c.reportProgress(context.Background())
+			c.reportProgress(context.Background())
+			c.progress.setPendingNodes(1)
+			c.reportProgress(context.Background())
+			c.postInstallStageDone(context.Background(), "add_router_ca")
+			Expect(progressReports).To(Equal([]int{0, 35, 45}))
+		})
+		It("counts the joined nodes of the configured expected nodes", func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", ExpectedNodeCount: 5}, mockops, mockbmclient, mockk8sclient)
+			joined, expected := c.progress.joinedNodes()
+			Expect([]int{joined, expected}).To(Equal([]int{0, 5}))
+			c.progress.setPendingNodes(3)
+			joined, expected = c.progress.joinedNodes()
+			Expect([]int{joined, expected}).To(Equal([]int{2, 5}))
+		})
+		It("infers the expected nodes from the pending hosts", func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id"}, mockops, mockbmclient, mockk8sclient)
+			c.progress.setPendingNodes(3)
+			c.progress.setPendingNodes(1)
+			joined, expected := c.progress.joinedNodes()
+			Expect([]int{joined, expected}).To(Equal([]int{2, 3}))
 		})
 	})
 	Context("validating ApproveCsrs", func() {
@@ -223,30 +1207,31 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			URL:       "https://assisted-service.com:80",
 		}
 		BeforeEach(func() {
-			c = NewController(l, conf, mockops, mockbmclient, mockk8sclient)
-			GeneralWaitTimeout = 1 * time.Second
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+			c.waitInterval = 1 * time.Second
 		})
 		It("Run ApproveCsrs and validate it exists on channel set", func() {
 			testList := v1beta1.CertificateSigningRequestList{}
 			mockk8sclient.EXPECT().ListCsrs().Return(&testList, nil).MinTimes(2).MaxTimes(5)
-			done := make(chan bool)
+			ctx, cancel := context.WithCancel(context.Background())
 			wg.Add(1)
-			go c.ApproveCsrs(done, &wg)
+			go c.ApproveCsrs(ctx, &wg)
 			time.Sleep(3 * time.Second)
-			done <- true
+			cancel()
 			wg.Wait()
 		})
 		It("Run ApproveCsrs when list returns error", func() {
 			mockk8sclient.EXPECT().ListCsrs().Return(nil, fmt.Errorf("dummy")).MinTimes(2).MaxTimes(5)
-			done := make(chan bool)
+			ctx, cancel := context.WithCancel(context.Background())
 			wg.Add(1)
-			go c.ApproveCsrs(done, &wg)
+			go c.ApproveCsrs(ctx, &wg)
 			time.Sleep(3 * time.Second)
-			done <- true
+			cancel()
 			wg.Wait()
 		})
 		It("Run ApproveCsrs with csrs list", func() {
 			csr := v1beta1.CertificateSigningRequest{}
+			csr.Spec.Request = createCsrPem("system:node:node0", []string{"system:nodes"}, nil, nil)
 			csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1beta1.CertificateSigningRequestCondition{
 				Type:           certificatesv1beta1.CertificateDenied,
 				Reason:         "dummy",
@@ -263,66 +1248,2463 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			testList := v1beta1.CertificateSigningRequestList{}
 			testList.Items = []v1beta1.CertificateSigningRequest{csr, csrApproved}
 			mockk8sclient.EXPECT().ListCsrs().Return(&testList, nil).MinTimes(1)
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any()).Return(inventoryNamesIds, nil).MinTimes(1)
 			mockk8sclient.EXPECT().ApproveCsr(&csr).Return(nil).MinTimes(1)
 			mockk8sclient.EXPECT().ApproveCsr(&csrApproved).Return(nil).Times(0)
-			done := make(chan bool)
+			ctx, cancel := context.WithCancel(context.Background())
 			wg.Add(1)
-			go c.ApproveCsrs(done, &wg)
+			go c.ApproveCsrs(ctx, &wg)
 			time.Sleep(2 * time.Second)
-			done <- true
+			cancel()
+			wg.Wait()
+		})
+		It("warns once about a csr that stays pending after it was approved", func() {
+			logger, hook := logrustest.NewNullLogger()
+			c = newTestController(logger, ControllerConfig{ClusterID: "cluster-id"}, mockops, mockbmclient, mockk8sclient)
+			csr := v1beta1.CertificateSigningRequest{}
+			csr.Name = "csr-1"
+			csr.Spec.Request = createCsrPem("system:node:node0", []string{"system:nodes"}, nil, nil)
+			csrs := &v1beta1.CertificateSigningRequestList{Items: []v1beta1.CertificateSigningRequest{csr}}
+			polls := stuckCsrMaxPendingPolls + 3
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any()).Return(inventoryNamesIds, nil).Times(polls)
+			// the csr is approved again on every poll
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).Return(nil).Times(polls)
+			for i := 0; i < polls; i++ {
+				c.approveCsrs(context.Background(), csrs)
+			}
+			var warnings []string
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.WarnLevel {
+					warnings = append(warnings, entry.Message)
+				}
+			}
+			Expect(warnings).To(HaveLen(1))
+			Expect(warnings[0]).To(HavePrefix("Csr csr-1 is still pending after it was approved"))
+		})
+		It("logs the requestor and usages of the approved csrs", func() {
+			logger, hook := logrustest.NewNullLogger()
+			c = newTestController(logger, ControllerConfig{ClusterID: "cluster-id"}, mockops, mockbmclient, mockk8sclient)
+			csr := v1beta1.CertificateSigningRequest{}
+			csr.Name = "csr-1"
+			csr.Spec.Username = "system:serviceaccount:openshift-machine-config-operator:node-bootstrapper"
+			csr.Spec.Usages = []v1beta1.KeyUsage{v1beta1.UsageDigitalSignature, v1beta1.UsageKeyEncipherment, v1beta1.UsageClientAuth}
+			csr.Spec.Request = createCsrPem("system:node:node0", []string{"system:nodes"}, nil, nil)
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any()).Return(inventoryNamesIds, nil).Times(1)
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).Return(nil).Times(1)
+			c.approveCsrs(context.Background(), &v1beta1.CertificateSigningRequestList{Items: []v1beta1.CertificateSigningRequest{csr}})
+			var approving *logrus.Entry
+			for _, entry := range hook.AllEntries() {
+				if strings.HasPrefix(entry.Message, "Approving csr") {
+					approving = entry
+				}
+			}
+			Expect(approving).NotTo(BeNil())
+			Expect(approving.Level).To(Equal(logrus.InfoLevel))
+			Expect(approving.Data).To(And(
+				HaveKeyWithValue("csr", "csr-1"),
+				HaveKeyWithValue("username", "system:serviceaccount:openshift-machine-config-operator:node-bootstrapper"),
+				HaveKeyWithValue("usages", "digital signature,key encipherment,client auth"),
+				HaveKeyWithValue("common_name", "system:node:node0"),
+			))
+			Expect(approving.Message).NotTo(ContainSubstring("BEGIN CERTIFICATE REQUEST"))
+		})
+		It("ApproveCsrs approves pending csrs before the first tick", func() {
+			c.waitInterval = 10 * time.Second
+			csr := v1beta1.CertificateSigningRequest{}
+			csr.Spec.Request = createCsrPem("system:node:node0", []string{"system:nodes"}, nil, nil)
+			testList := v1beta1.CertificateSigningRequestList{Items: []v1beta1.CertificateSigningRequest{csr}}
+			mockk8sclient.EXPECT().ListCsrs().Return(&testList, nil).Times(1)
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any()).Return(inventoryNamesIds, nil).Times(1)
+			approved := make(chan struct{})
+			mockk8sclient.EXPECT().ApproveCsr(&csr).DoAndReturn(func(*v1beta1.CertificateSigningRequest) error {
+				close(approved)
+				return nil
+			}).Times(1)
+			ctx, cancel := context.WithCancel(context.Background())
+			wg.Add(1)
+			go c.ApproveCsrs(ctx, &wg)
+			Eventually(approved, 2*time.Second).Should(BeClosed())
+			cancel()
+			wg.Wait()
+		})
+		It("ApproveCsrs lists csrs once per poll interval", func() {
+			fakeClock := clock.NewFakeClock(time.Now())
+			c.clock = fakeClock
+			testList := v1beta1.CertificateSigningRequestList{}
+			mockk8sclient.EXPECT().ListCsrs().Return(&testList, nil).Times(3)
+			ctx, cancel := context.WithCancel(context.Background())
+			wg.Add(1)
+			go c.ApproveCsrs(ctx, &wg)
+			for i := 0; i < 2; i++ {
+				Eventually(fakeClock.HasWaiters).Should(BeTrue())
+				fakeClock.Step(c.waitInterval / 2)
+				Expect(fakeClock.HasWaiters()).To(BeTrue())
+				fakeClock.Step(c.waitInterval / 2)
+			}
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			cancel()
+			wg.Wait()
 		})
 	})
 
-	Context("validating AddRouterCAToClusterCA", func() {
+	Context("validating concurrent csrs approval", func() {
+		const numOfCsrs = 10
+		var (
+			csrList *v1beta1.CertificateSigningRequestList
+			hosts   map[string]inventory_client.HostData
+		)
+		BeforeEach(func() {
+			csrList = &v1beta1.CertificateSigningRequestList{}
+			hosts = make(map[string]inventory_client.HostData)
+			for i := 0; i < numOfCsrs; i++ {
+				nodeName := fmt.Sprintf("node%d", i)
+				hosts[nodeName] = inventory_client.HostData{}
+				csr := v1beta1.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("csr-%d", i)}}
+				csr.Spec.Request = createCsrPem("system:node:"+nodeName, []string{"system:nodes"}, nil, nil)
+				csrList.Items = append(csrList.Items, csr)
+			}
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any()).Return(hosts, nil).Times(1)
+		})
+		It("approves all csrs with bounded concurrency", func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", CsrApprovalConcurrency: 3}, mockops, mockbmclient, mockk8sclient)
+			var (
+				lock     sync.Mutex
+				inFlight int
+				maxSeen  int
+				approved []string
+			)
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).DoAndReturn(func(csr *v1beta1.CertificateSigningRequest) error {
+				lock.Lock()
+				inFlight++
+				if inFlight > maxSeen {
+					maxSeen = inFlight
+				}
+				lock.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				lock.Lock()
+				inFlight--
+				approved = append(approved, csr.Name)
+				lock.Unlock()
+				return nil
+			}).Times(numOfCsrs)
+			c.approveCsrs(context.Background(), csrList)
+			Expect(approved).To(HaveLen(numOfCsrs))
+			Expect(maxSeen).To(BeNumerically("<=", 3))
+			Expect(maxSeen).To(BeNumerically(">", 1))
+			Expect(testutil.ToFloat64(c.metrics.csrsApproved)).To(Equal(float64(numOfCsrs)))
+		})
+		It("respects the rate limit", func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", CsrApprovalConcurrency: numOfCsrs,
+				CsrApprovalQPS: 20, CsrApprovalBurst: 1}, mockops, mockbmclient, mockk8sclient)
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).Return(nil).Times(numOfCsrs)
+			start := time.Now()
+			c.approveCsrs(context.Background(), csrList)
+			// the first approval uses the burst, each of the others waits 50ms for a token
+			Expect(time.Since(start)).To(BeNumerically(">=", (numOfCsrs-1)*50*time.Millisecond-10*time.Millisecond))
+		})
+		It("doesn't wait for the rate limit once cancelled", func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", CsrApprovalConcurrency: numOfCsrs,
+				CsrApprovalQPS: 0.001, CsrApprovalBurst: 1}, mockops, mockbmclient, mockk8sclient)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			// the first approval uses the burst, the others wait for a token till the approval is cancelled
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).DoAndReturn(func(csr *v1beta1.CertificateSigningRequest) error {
+				cancel()
+				return nil
+			}).Times(1)
+			start := time.Now()
+			c.approveCsrs(ctx, csrList)
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+			Expect(testutil.ToFloat64(c.metrics.csrsApproved)).To(Equal(float64(1)))
+		})
+		It("approves the other csrs when some fail", func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", CsrApprovalConcurrency: 4}, mockops, mockbmclient, mockk8sclient)
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).DoAndReturn(func(csr *v1beta1.CertificateSigningRequest) error {
+				if csr.Name == "csr-3" || csr.Name == "csr-7" {
+					return fmt.Errorf("dummy")
+				}
+				return nil
+			}).Times(numOfCsrs)
+			c.approveCsrs(context.Background(), csrList)
+			Expect(testutil.ToFloat64(c.metrics.csrsApproved)).To(Equal(float64(numOfCsrs - 2)))
+		})
+	})
+
+	Context("validating csrs of cluster nodes", func() {
 		conf := ControllerConfig{
 			ClusterID: "cluster-id",
 			URL:       "https://assisted-service.com:80",
 		}
+		var hosts map[string]inventory_client.HostData
 		BeforeEach(func() {
-			c = NewController(l, conf, mockops, mockbmclient, mockk8sclient)
-			GeneralWaitTimeout = 1 * time.Second
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+			hosts = map[string]inventory_client.HostData{
+				"node0": {Host: inventoryNamesIds["node0"].Host, IPs: []string{"192.168.126.10", "fe80::1"}}}
 		})
-		It("Run addRouterCAToClusterCA", func() {
-			cmName := "default-ingress-cert"
-			cmNamespace := "openshift-config-managed"
-			data := make(map[string]string)
-			data["ca-bundle.crt"] = "CA"
-			cm := v1.ConfigMap{Data: data}
-			mockk8sclient.EXPECT().GetConfigMap(cmNamespace, cmName).Return(nil, fmt.Errorf("dummy")).Times(1)
-			mockk8sclient.EXPECT().GetConfigMap(cmNamespace, cmName).Return(&cm, nil).Times(2)
-			mockbmclient.EXPECT().UploadIngressCa(data["ca-bundle.crt"], c.ClusterID).Return(fmt.Errorf("dummy")).Times(1)
-			mockbmclient.EXPECT().UploadIngressCa(data["ca-bundle.crt"], c.ClusterID).Return(nil).Times(1)
-			c.addRouterCAToClusterCA()
+		approveOnce := func(csr *v1beta1.CertificateSigningRequest) {
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any()).Return(hosts, nil).Times(1)
+			c.approveCsrs(context.Background(), &v1beta1.CertificateSigningRequestList{Items: []v1beta1.CertificateSigningRequest{*csr}})
+		}
+		nodeWithAddresses := func(addresses ...string) *v1.NodeList {
+			node := v1.Node{}
+			node.Name = "node0"
+			for _, address := range addresses {
+				node.Status.Addresses = append(node.Status.Addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: address})
+			}
+			node.Status.Addresses = append(node.Status.Addresses, v1.NodeAddress{Type: v1.NodeHostName, Address: "node0"})
+			return &v1.NodeList{Items: []v1.Node{node}}
+		}
+		servingCsr := func(ips ...string) v1beta1.CertificateSigningRequest {
+			csr := v1beta1.CertificateSigningRequest{}
+			csr.Spec.Username = "system:node:node0"
+			csr.Spec.Usages = []v1beta1.KeyUsage{v1beta1.UsageDigitalSignature, v1beta1.UsageServerAuth}
+			var parsed []net.IP
+			for _, ip := range ips {
+				parsed = append(parsed, net.ParseIP(ip))
+			}
+			csr.Spec.Request = createCsrPem("system:node:node0", []string{"system:nodes"}, []string{"node0"}, parsed)
+			return csr
+		}
+		It("approves node-client csr of a known node", func() {
+			csr := v1beta1.CertificateSigningRequest{}
+			csr.Spec.Username = "system:serviceaccount:openshift-machine-config-operator:node-bootstrapper"
+			csr.Spec.Usages = []v1beta1.KeyUsage{v1beta1.UsageDigitalSignature, v1beta1.UsageClientAuth}
+			csr.Spec.Request = createCsrPem("system:node:node0", []string{"system:nodes"}, nil, nil)
+			mockk8sclient.EXPECT().ApproveCsr(&csr).Return(nil).Times(1)
+			approveOnce(&csr)
+			Expect(testutil.ToFloat64(c.metrics.csrsApproved)).To(Equal(float64(1)))
 		})
-		It("Run PostInstallConfigs", func() {
-			cmName := "default-ingress-cert"
-			cmNamespace := "openshift-config-managed"
-			consoleNamespace := "openshift-console"
-			data := make(map[string]string)
-			data["ca-bundle.crt"] = "CA"
-			cm := v1.ConfigMap{Data: data}
-			finalizing := models.ClusterStatusFinalizing
-			installing := models.ClusterStatusInstalling
-			cluster := models.Cluster{Status: &finalizing}
-			mockbmclient.EXPECT().GetCluster().Return(nil, fmt.Errorf("dummy")).Times(1)
-			mockbmclient.EXPECT().GetCluster().Return(&models.Cluster{Status: &installing}, nil).Times(1)
-			mockbmclient.EXPECT().GetCluster().Return(&cluster, nil).Times(1)
-			mockk8sclient.EXPECT().GetConfigMap(cmNamespace, cmName).Return(&cm, nil).Times(1)
-			mockbmclient.EXPECT().UploadIngressCa(data["ca-bundle.crt"], c.ClusterID).Return(nil).Times(1)
-			mockk8sclient.EXPECT().UnPatchEtcd().Return(fmt.Errorf("dummy")).Times(1)
-			mockk8sclient.EXPECT().UnPatchEtcd().Return(nil).Times(1)
-			mockk8sclient.EXPECT().GetPods(consoleNamespace, gomock.Any()).Return(nil, fmt.Errorf("dummy")).Times(1)
-			mockk8sclient.EXPECT().GetPods(consoleNamespace, gomock.Any()).Return([]v1.Pod{{Status: v1.PodStatus{Phase: "Pending"}}}, nil).Times(1)
-			mockk8sclient.EXPECT().GetPods(consoleNamespace, gomock.Any()).Return([]v1.Pod{{Status: v1.PodStatus{Phase: "Running"}}}, nil).Times(1)
-			mockbmclient.EXPECT().CompleteInstallation("cluster-id", true, "").Return(fmt.Errorf("dummy")).Times(1)
-			mockbmclient.EXPECT().CompleteInstallation("cluster-id", true, "").Return(nil).Times(1)
+		It("records the approval with the served csr api version", func() {
+			csrGroupVersion = "certificates.k8s.io/v1"
+			csr := v1beta1.CertificateSigningRequest{}
+			csr.Name = "csr-1"
+			csr.Spec.Username = "system:serviceaccount:openshift-machine-config-operator:node-bootstrapper"
+			csr.Spec.Usages = []v1beta1.KeyUsage{v1beta1.UsageDigitalSignature, v1beta1.UsageClientAuth}
+			csr.Spec.Request = createCsrPem("system:node:node0", []string{"system:nodes"}, nil, nil)
+			mockk8sclient.EXPECT().ApproveCsr(&csr).Return(nil).Times(1)
+			approveOnce(&csr)
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Reason).To(Equal(eventReasonCsrApproved))
+			Expect(events[0].InvolvedObject.APIVersion).To(Equal("certificates.k8s.io/v1"))
+			Expect(events[0].InvolvedObject.Name).To(Equal("csr-1"))
+		})
+		It("approves only csrs older than the min age", func() {
+			fakeClock := clock.NewFakeClock(time.Now())
+			c.clock = fakeClock
+			c.CSRApprovalMinAge = time.Minute
+			clientCsr := func(name string, age time.Duration) v1beta1.CertificateSigningRequest {
+				csr := v1beta1.CertificateSigningRequest{}
+				csr.Name = name
+				csr.CreationTimestamp = metav1.NewTime(fakeClock.Now().Add(-age))
+				csr.Spec.Username = "system:serviceaccount:openshift-machine-config-operator:node-bootstrapper"
+				csr.Spec.Usages = []v1beta1.KeyUsage{v1beta1.UsageDigitalSignature, v1beta1.UsageClientAuth}
+				csr.Spec.Request = createCsrPem("system:node:node0", []string{"system:nodes"}, nil, nil)
+				return csr
+			}
+			csrs := &v1beta1.CertificateSigningRequestList{Items: []v1beta1.CertificateSigningRequest{
+				clientCsr("new", 0), clientCsr("young", 30*time.Second), clientCsr("old", 2*time.Minute),
+			}}
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any()).Return(hosts, nil).Times(2)
+			mockk8sclient.EXPECT().ApproveCsr(&csrs.Items[2]).Return(nil).Times(1)
+			c.approveCsrs(context.Background(), csrs)
+			Expect(testutil.ToFloat64(c.metrics.csrsApproved)).To(Equal(float64(1)))
 
-			wg.Add(1)
-			go c.PostInstallConfigs(&wg)
-			wg.Wait()
+			fakeClock.Step(45 * time.Second)
+			csrs.Items = csrs.Items[:2]
+			mockk8sclient.EXPECT().ApproveCsr(&csrs.Items[1]).Return(nil).Times(1)
+			c.approveCsrs(context.Background(), csrs)
+			Expect(testutil.ToFloat64(c.metrics.csrsApproved)).To(Equal(float64(2)))
 		})
-	})
-})
+		It("approves kubelet-serving csr with the node addresses", func() {
+			csr := v1beta1.CertificateSigningRequest{}
+			csr.Spec.Username = "system:node:node0"
+			csr.Spec.Usages = []v1beta1.KeyUsage{v1beta1.UsageDigitalSignature, v1beta1.UsageServerAuth}
+			csr.Spec.Request = createCsrPem("system:node:node0", []string{"system:nodes"}, []string{"node0"},
+				[]net.IP{net.ParseIP("192.168.126.10"), net.ParseIP("fe80::1")})
+			mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{}, nil).Times(1)
+			mockk8sclient.EXPECT().ApproveCsr(&csr).Return(nil).Times(1)
+			approveOnce(&csr)
+		})
+		It("approves kubelet-serving csr of an ipv6 only node", func() {
+			hosts["node0"] = inventory_client.HostData{Host: inventoryNamesIds["node0"].Host}
+			csr := servingCsr("2001:db8::10")
+			mockk8sclient.EXPECT().ListNodes().Return(nodeWithAddresses("2001:0db8:0000::0010"), nil).Times(1)
+			mockk8sclient.EXPECT().ApproveCsr(&csr).Return(nil).Times(1)
+			approveOnce(&csr)
+		})
+		It("approves kubelet-serving csr of a dual-stack node", func() {
+			hosts["node0"] = inventory_client.HostData{Host: inventoryNamesIds["node0"].Host}
+			csr := servingCsr("192.168.126.10", "2001:db8::10", "fe80::1")
+			mockk8sclient.EXPECT().ListNodes().Return(nodeWithAddresses("192.168.126.10", "[2001:db8::10]", "fe80::1%ens3"), nil).Times(1)
+			mockk8sclient.EXPECT().ApproveCsr(&csr).Return(nil).Times(1)
+			approveOnce(&csr)
+		})
+		It("skips kubelet-serving csr of a dual-stack node with an unknown ipv6 address", func() {
+			hosts["node0"] = inventory_client.HostData{Host: inventoryNamesIds["node0"].Host}
+			csr := servingCsr("192.168.126.10", "2001:db8::11")
+			mockk8sclient.EXPECT().ListNodes().Return(nodeWithAddresses("192.168.126.10", "2001:db8::10"), nil).Times(1)
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).Times(0)
+			approveOnce(&csr)
+		})
+		It("validates kubelet-serving csr with the inventory addresses when listing nodes fails", func() {
+			csr := servingCsr("192.168.126.10")
+			mockk8sclient.EXPECT().ListNodes().Return(nil, fmt.Errorf("dummy")).Times(1)
+			mockk8sclient.EXPECT().ApproveCsr(&csr).Return(nil).Times(1)
+			approveOnce(&csr)
+		})
+		It("parses ip addresses in their different notations", func() {
+			for address, expected := range map[string]string{
+				"192.168.126.10":        "192.168.126.10",
+				"192.168.126.10/24":     "192.168.126.10",
+				"::ffff:192.168.126.10": "192.168.126.10",
+				"2001:0db8::0010":       "2001:db8::10",
+				"[2001:db8::10]":        "2001:db8::10",
+				"fe80::1%eth0":          "fe80::1",
+				"2001:db8::10/64":       "2001:db8::10",
+			} {
+				Expect(parseIPAddress(address)).To(Equal(net.ParseIP(expected)), address)
+			}
+			Expect(parseIPAddress("node0")).To(BeNil())
+		})
+		It("skips kubelet-serving csr with unknown address", func() {
+			csr := v1beta1.CertificateSigningRequest{}
+			csr.Spec.Username = "system:node:node0"
+			csr.Spec.Usages = []v1beta1.KeyUsage{v1beta1.UsageDigitalSignature, v1beta1.UsageServerAuth}
+			csr.Spec.Request = createCsrPem("system:node:node0", []string{"system:nodes"}, []string{"node0"},
+				[]net.IP{net.ParseIP("10.0.0.1")})
+			mockk8sclient.EXPECT().ListNodes().Return(nodeWithAddresses("192.168.126.10"), nil).Times(1)
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).Times(0)
+			approveOnce(&csr)
+		})
+		It("skips csr of an unknown node", func() {
+			csr := v1beta1.CertificateSigningRequest{}
+			csr.Spec.Request = createCsrPem("system:node:intruder", []string{"system:nodes"}, nil, nil)
+			mockk8sclient.EXPECT().ListNodes().Return(nodeWithAddresses("192.168.126.10"), nil).Times(1)
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).Times(0)
+			approveOnce(&csr)
+			Expect(testutil.ToFloat64(c.metrics.csrsApproved)).To(Equal(float64(0)))
+		})
+		Context("of the bootstrap host that joins under another name", func() {
+			var bootstrapNode v1.Node
+			BeforeEach(func() {
+				bootstrapHost := *inventoryNamesIds["node0"].Host
+				bootstrapHost.Bootstrap = true
+				hosts["node0"] = inventory_client.HostData{Host: &bootstrapHost, IPs: []string{"192.168.126.10"}}
+				bootstrapNode = v1.Node{}
+				bootstrapNode.Name = "master-0"
+				bootstrapNode.Status.NodeInfo.SystemUUID = bootstrapHost.ID.String()
+				bootstrapNode.Status.Addresses = []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.126.11"}}
+			})
+			clientCsr := func() v1beta1.CertificateSigningRequest {
+				csr := v1beta1.CertificateSigningRequest{}
+				csr.Spec.Username = "system:serviceaccount:openshift-machine-config-operator:node-bootstrapper"
+				csr.Spec.Usages = []v1beta1.KeyUsage{v1beta1.UsageDigitalSignature, v1beta1.UsageClientAuth}
+				csr.Spec.Request = createCsrPem("system:node:master-0", []string{"system:nodes"}, nil, nil)
+				return csr
+			}
+			It("approves its client csr before its node exists", func() {
+				csr := clientCsr()
+				mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{}, nil).Times(1)
+				mockk8sclient.EXPECT().ApproveCsr(&csr).Return(nil).Times(1)
+				approveOnce(&csr)
+			})
+			It("approves its serving csr matched by the node system uuid", func() {
+				csr := v1beta1.CertificateSigningRequest{}
+				csr.Spec.Username = "system:node:master-0"
+				csr.Spec.Usages = []v1beta1.KeyUsage{v1beta1.UsageDigitalSignature, v1beta1.UsageServerAuth}
+				csr.Spec.Request = createCsrPem("system:node:master-0", []string{"system:nodes"}, []string{"master-0"},
+					[]net.IP{net.ParseIP("192.168.126.10"), net.ParseIP("192.168.126.11")})
+				mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{Items: []v1.Node{bootstrapNode}}, nil).Times(1)
+				mockk8sclient.EXPECT().ApproveCsr(&csr).Return(nil).Times(1)
+				approveOnce(&csr)
+			})
+			It("skips client csrs of other names once its node joined", func() {
+				csr := v1beta1.CertificateSigningRequest{}
+				csr.Spec.Request = createCsrPem("system:node:intruder", []string{"system:nodes"}, nil, nil)
+				mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{Items: []v1.Node{bootstrapNode}}, nil).Times(1)
+				mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).Times(0)
+				approveOnce(&csr)
+			})
+			It("skips csrs of a node of another host", func() {
+				csr := clientCsr()
+				bootstrapNode.Status.NodeInfo.SystemUUID = "eb82821f-bf21-4614-9a3b-ecb07929f238"
+				mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{Items: []v1.Node{bootstrapNode}}, nil).Times(1)
+				mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).Times(0)
+				approveOnce(&csr)
+			})
+		})
+		It("skips bogus csr", func() {
+			csr := v1beta1.CertificateSigningRequest{}
+			csr.Spec.Request = []byte("-----BEGIN CERTIFICATE REQUEST-----\nbogus\n-----END CERTIFICATE REQUEST-----\n")
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).Times(0)
+			approveOnce(&csr)
+		})
+		It("skips csr without nodes organization", func() {
+			csr := v1beta1.CertificateSigningRequest{}
+			csr.Spec.Request = createCsrPem("system:node:node0", []string{"system:masters"}, nil, nil)
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).Times(0)
+			approveOnce(&csr)
+		})
+	})
+
+	Context("validating readiness checks", func() {
+		conf := ControllerConfig{
+			ClusterID:              "cluster-id",
+			URL:                    "https://assisted-service.com:80",
+			ReadinessChecksTimeout: 350 * time.Millisecond,
+		}
+		running := v1.Pod{Status: v1.PodStatus{Phase: v1.PodRunning}}
+		pending := v1.Pod{Status: v1.PodStatus{Phase: v1.PodPending}}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+			Expect(c.ReadinessChecks.Decode(`[
+				{"name": "monitoring", "namespace": "openshift-monitoring", "labels": {"app": "prometheus"}, "runningCount": 2},
+				{"namespace": "openshift-image-registry", "labels": {"docker-registry": "default"}}]`)).To(Succeed())
+		})
+		It("decodes checks with defaults", func() {
+			Expect(c.ReadinessChecks).To(HaveLen(2))
+			Expect(c.ReadinessChecks[1].Name).To(Equal("openshift-image-registry"))
+			Expect(c.ReadinessChecks[1].RunningCount).To(Equal(1))
+			Expect(c.ReadinessChecks.Decode(`[{"labels": {"app": "x"}}]`)).To(HaveOccurred())
+			Expect(c.ReadinessChecks.Decode(`not json`)).To(HaveOccurred())
+		})
+		It("passes once all checks are ready", func() {
+			gomock.InOrder(
+				mockk8sclient.EXPECT().GetPods("openshift-monitoring", map[string]string{"app": "prometheus"}).
+					Return([]v1.Pod{running, pending}, nil).Times(1),
+				mockk8sclient.EXPECT().GetPods("openshift-monitoring", map[string]string{"app": "prometheus"}).
+					Return([]v1.Pod{running, running}, nil).Times(1),
+			)
+			mockk8sclient.EXPECT().GetPods("openshift-image-registry", gomock.Any()).Return([]v1.Pod{running}, nil).Times(1)
+			Expect(c.waitForReadinessChecks(context.Background())).To(BeEmpty())
+		})
+		It("reports checks that are not ready after timeout", func() {
+			mockk8sclient.EXPECT().GetPods("openshift-monitoring", gomock.Any()).Return([]v1.Pod{running}, nil).MinTimes(2)
+			mockk8sclient.EXPECT().GetPods("openshift-image-registry", gomock.Any()).Return([]v1.Pod{running}, nil).Times(1)
+			failed := c.waitForReadinessChecks(context.Background())
+			Expect(failed).To(HaveLen(1))
+			Expect(failed[0]).To(ContainSubstring("monitoring"))
+		})
+		It("stops waiting once cancelled", func() {
+			c.ReadinessChecksTimeout = time.Hour
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{pending}, nil).MinTimes(2)
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			Expect(c.waitForReadinessChecks(ctx)).To(BeEmpty())
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		})
+	})
+
+	Context("validating getMCSLogs", func() {
+		conf := ControllerConfig{
+			ClusterID: "cluster-id",
+			URL:       "https://assisted-service.com:80",
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("fetches only new logs and drops overlapping lines", func() {
+			namespace := "openshift-machine-config-operator"
+			mcsPod := v1.Pod{}
+			mcsPod.Name = "mcs-0"
+			mockk8sclient.EXPECT().GetPods(namespace, gomock.Any()).Return([]v1.Pod{mcsPod}, nil).Times(3)
+			gomock.InOrder(
+				mockk8sclient.EXPECT().GetPodLogs(namespace, "mcs-0", k8s_client.PodLogsOptions{
+					SinceSeconds: mcsLogsInitialSinceSeconds, TailLines: mcsLogsTailLines, Timeout: podLogsTimeout}).
+					Return("line1\nline2\n", nil).Times(1),
+				mockk8sclient.EXPECT().GetPodLogs(namespace, "mcs-0", k8s_client.PodLogsOptions{
+					SinceSeconds: 1, TailLines: mcsLogsTailLines, Timeout: podLogsTimeout}).
+					Return("line2\nline3\n", nil).Times(1),
+				mockk8sclient.EXPECT().GetPodLogs(namespace, "mcs-0", gomock.Any()).
+					Return("line3\n", nil).Times(1),
+			)
+			logs, err := c.getMCSLogs()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logs).To(Equal("line1\nline2\n"))
+			logs, _ = c.getMCSLogs()
+			Expect(logs).To(Equal("line1\nline2\nline3\n"))
+			logs, _ = c.getMCSLogs()
+			Expect(logs).To(Equal("line1\nline2\nline3\n"))
+		})
+		It("skips terminating mcs pods", func() {
+			namespace := "openshift-machine-config-operator"
+			terminating := v1.Pod{}
+			terminating.Name = "mcs-0"
+			deleted := metav1.Now()
+			terminating.DeletionTimestamp = &deleted
+			replacement := v1.Pod{}
+			replacement.Name = "mcs-1"
+			mockk8sclient.EXPECT().GetPods(namespace, gomock.Any()).Return([]v1.Pod{terminating, replacement}, nil).Times(1)
+			mockk8sclient.EXPECT().GetPodLogs(namespace, "mcs-0", gomock.Any()).Times(0)
+			mockk8sclient.EXPECT().GetPodLogs(namespace, "mcs-1", gomock.Any()).Return("line1\n", nil).Times(1)
+			logs, err := c.getMCSLogs()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logs).To(Equal("line1\n"))
+		})
+		It("uses the first candidate that has mcs pods", func() {
+			c.McsCandidates = PodSelectors{
+				{Namespace: "openshift-mcs", Labels: map[string]string{"app": "mcs"}},
+				{Namespace: "openshift-machine-config-server", Labels: map[string]string{"k8s-app": "machine-config-server"}},
+				{Namespace: "unused", Labels: map[string]string{"app": "unused"}},
+			}
+			mcsPod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "mcs-0"}}
+			mockk8sclient.EXPECT().GetPods("openshift-machine-config-operator", map[string]string{"k8s-app": "machine-config-server"}).
+				Return([]v1.Pod{}, nil).Times(2)
+			mockk8sclient.EXPECT().GetPods("openshift-mcs", map[string]string{"app": "mcs"}).
+				Return(nil, fmt.Errorf("dummy")).Times(2)
+			mockk8sclient.EXPECT().GetPods("openshift-machine-config-server", map[string]string{"k8s-app": "machine-config-server"}).
+				Return([]v1.Pod{mcsPod}, nil).Times(2)
+			mockk8sclient.EXPECT().GetPods("unused", gomock.Any()).Times(0)
+			mockk8sclient.EXPECT().GetPodLogs("openshift-machine-config-server", "mcs-0", gomock.Any()).Return("line1\n", nil).Times(1)
+			mockk8sclient.EXPECT().GetPodLogs("openshift-machine-config-server", "mcs-0", gomock.Any()).Return("line2\n", nil).Times(1)
+			logs, err := c.getMCSLogs()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logs).To(Equal("line1\n"))
+			Expect(c.mcsLogs.selector).To(Equal("openshift-machine-config-server/k8s-app=machine-config-server"))
+			logs, _ = c.getMCSLogs()
+			Expect(logs).To(Equal("line1\nline2\n"))
+		})
+		It("keeps the logs when no candidate has mcs pods", func() {
+			c.McsCandidates = PodSelectors{{Namespace: "openshift-mcs", Labels: map[string]string{"app": "mcs"}}}
+			c.mcsLogs.logs = "line1\n"
+			mockk8sclient.EXPECT().GetPods("openshift-machine-config-operator", gomock.Any()).Return([]v1.Pod{}, nil).Times(1)
+			mockk8sclient.EXPECT().GetPods("openshift-mcs", gomock.Any()).Return([]v1.Pod{}, nil).Times(1)
+			logs, err := c.getMCSLogs()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logs).To(Equal("line1\n"))
+		})
+		It("decodes the mcs candidates", func() {
+			var candidates PodSelectors
+			Expect(candidates.Decode(`[{"namespace": "openshift-mcs", "labels": {"app": "mcs"}}]`)).To(Succeed())
+			Expect(candidates).To(Equal(PodSelectors{{Namespace: "openshift-mcs", Labels: map[string]string{"app": "mcs"}}}))
+			Expect(candidates.Decode(`[{"namespace": "openshift-mcs"}]`)).To(HaveOccurred())
+			Expect(candidates.Decode(`[{"labels": {"app": "mcs"}}]`)).To(HaveOccurred())
+			Expect(candidates.Decode(`not json`)).To(HaveOccurred())
+		})
+		It("retains only the tail of the logs", func() {
+			longLine := strings.Repeat("a", 1024)
+			for i := 0; i < 2*maxMCSLogsSize/len(longLine); i++ {
+				c.mcsLogs.append("mcs-0", fmt.Sprintf("%d %s\n", i, longLine))
+			}
+			Expect(len(c.mcsLogs.logs)).To(BeNumerically("<=", maxMCSLogsSize))
+			Expect(c.mcsLogs.logs).To(HaveSuffix(fmt.Sprintf("%d %s\n", 2*maxMCSLogsSize/len(longLine)-1, longLine)))
+		})
+	})
+
+	Context("waiting for ready masters", func() {
+		masters := func(ready ...v1.ConditionStatus) *v1.NodeList {
+			nodes := &v1.NodeList{}
+			for i, status := range ready {
+				node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("master-%d", i)}}
+				if status != "" {
+					node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: status}}
+				}
+				nodes.Items = append(nodes.Items, node)
+			}
+			return nodes
+		}
+		BeforeEach(func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", MinReadyMasters: 3}, mockops, mockbmclient, mockk8sclient)
+		})
+		It("counts only ready masters", func() {
+			Expect(countReadyNodes(masters())).To(Equal(0))
+			Expect(countReadyNodes(masters(v1.ConditionTrue, v1.ConditionFalse, v1.ConditionUnknown, ""))).To(Equal(1))
+			Expect(countReadyNodes(masters(v1.ConditionTrue, v1.ConditionTrue, v1.ConditionTrue))).To(Equal(3))
+		})
+		It("requires the minimum ready masters", func() {
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListMasterNodes().Return(masters(v1.ConditionTrue, v1.ConditionTrue), nil).Times(1),
+				mockk8sclient.EXPECT().ListMasterNodes().Return(masters(v1.ConditionTrue, v1.ConditionTrue, v1.ConditionFalse), nil).Times(1),
+				mockk8sclient.EXPECT().ListMasterNodes().Return(nil, fmt.Errorf("dummy")).Times(1),
+				mockk8sclient.EXPECT().ListMasterNodes().Return(masters(v1.ConditionTrue, v1.ConditionTrue, v1.ConditionTrue), nil).Times(1),
+			)
+			Expect(c.enoughMastersReady(nil)).To(BeFalse())
+			Expect(c.enoughMastersReady(nil)).To(BeFalse())
+			Expect(c.enoughMastersReady(nil)).To(BeFalse())
+			Expect(c.enoughMastersReady(nil)).To(BeTrue())
+		})
+		It("doesn't list masters when no minimum is required", func() {
+			c.MinReadyMasters = 0
+			mockk8sclient.EXPECT().ListMasterNodes().Times(0)
+			Expect(c.enoughMastersReady(nil)).To(BeTrue())
+		})
+		clusterWithMasters := func(count int) *models.Cluster {
+			cluster := &models.Cluster{}
+			for i := 0; i < count; i++ {
+				role := models.HostRoleMaster
+				if i == 0 {
+					role = models.HostRoleBootstrap
+				}
+				cluster.Hosts = append(cluster.Hosts, &models.Host{Role: role})
+			}
+			disabled := models.HostStatusDisabled
+			cluster.Hosts = append(cluster.Hosts, &models.Host{Role: models.HostRoleWorker},
+				&models.Host{Role: models.HostRoleMaster, Status: &disabled})
+			return cluster
+		}
+		It("counts the enabled control plane hosts of the cluster", func() {
+			Expect(controlPlaneReplicas(nil)).To(Equal(0))
+			Expect(controlPlaneReplicas(&models.Cluster{})).To(Equal(0))
+			Expect(controlPlaneReplicas(clusterWithMasters(1))).To(Equal(1))
+			Expect(controlPlaneReplicas(clusterWithMasters(3))).To(Equal(3))
+			Expect(controlPlaneReplicas(clusterWithMasters(5))).To(Equal(5))
+		})
+		It("requires the single master of a single node cluster", func() {
+			mockk8sclient.EXPECT().ListMasterNodes().Return(masters(v1.ConditionTrue), nil).Times(1)
+			Expect(c.enoughMastersReady(clusterWithMasters(1))).To(BeTrue())
+		})
+		It("requires all the masters of a standard cluster", func() {
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListMasterNodes().Return(masters(v1.ConditionTrue, v1.ConditionTrue), nil).Times(1),
+				mockk8sclient.EXPECT().ListMasterNodes().Return(masters(v1.ConditionTrue, v1.ConditionTrue, v1.ConditionTrue), nil).Times(1),
+			)
+			Expect(c.enoughMastersReady(clusterWithMasters(3))).To(BeFalse())
+			Expect(c.enoughMastersReady(clusterWithMasters(3))).To(BeTrue())
+		})
+		It("requires all the masters of a five masters cluster", func() {
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListMasterNodes().Return(masters(v1.ConditionTrue, v1.ConditionTrue, v1.ConditionTrue,
+					v1.ConditionTrue, v1.ConditionFalse), nil).Times(1),
+				mockk8sclient.EXPECT().ListMasterNodes().Return(masters(v1.ConditionTrue, v1.ConditionTrue, v1.ConditionTrue,
+					v1.ConditionTrue, v1.ConditionTrue), nil).Times(1),
+			)
+			Expect(c.enoughMastersReady(clusterWithMasters(5))).To(BeFalse())
+			Expect(c.enoughMastersReady(clusterWithMasters(5))).To(BeTrue())
+		})
+		It("PostInstallConfigs completes a single node cluster once its master is ready", func() {
+			finalizing := models.ClusterStatusFinalizing
+			cluster := clusterWithMasters(1)
+			cluster.Status = &finalizing
+			tmpDir, err := ioutil.TempDir("", "controller-masters")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(tmpDir)
+			checkpointPath := filepath.Join(tmpDir, "checkpoint.json")
+			Expect(saveProgressState(checkpointPath, ProgressState{
+				PostInstallStagesDone: []string{"add_router_ca", "unpatch_etcd", "wait_for_console"},
+			})).To(Succeed())
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", MinReadyMasters: 3, CheckpointPath: checkpointPath},
+				mockops, mockbmclient, mockk8sclient)
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(cluster, nil).Times(1)
+			mockk8sclient.EXPECT().ListMasterNodes().Return(masters(v1.ConditionTrue), nil).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		It("PostInstallConfigs waits for the masters of a finalizing cluster to be ready", func() {
+			tmpDir, err := ioutil.TempDir("", "controller-masters")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(tmpDir)
+			checkpointPath := filepath.Join(tmpDir, "checkpoint.json")
+			// the post install stages were done before, only the wait for the masters is left
+			Expect(saveProgressState(checkpointPath, ProgressState{
+				PostInstallStagesDone: []string{"add_router_ca", "unpatch_etcd", "wait_for_console"},
+			})).To(Succeed())
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", MinReadyMasters: 3, CheckpointPath: checkpointPath},
+				mockops, mockbmclient, mockk8sclient)
+			finalizing := models.ClusterStatusFinalizing
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &finalizing}, nil).Times(2)
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListMasterNodes().Return(masters(v1.ConditionTrue, v1.ConditionFalse, v1.ConditionTrue), nil).Times(1),
+				mockk8sclient.EXPECT().ListMasterNodes().Return(masters(v1.ConditionTrue, v1.ConditionTrue, v1.ConditionTrue), nil).Times(1),
+			)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		It("PostInstallConfigs runs anyway once the cluster is finalizing for longer than the finalizing timeout", func() {
+			tmpDir, err := ioutil.TempDir("", "controller-masters")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(tmpDir)
+			checkpointPath := filepath.Join(tmpDir, "checkpoint.json")
+			Expect(saveProgressState(checkpointPath, ProgressState{
+				PostInstallStagesDone: []string{"add_router_ca", "unpatch_etcd", "wait_for_console"},
+			})).To(Succeed())
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", MinReadyMasters: 3, CheckpointPath: checkpointPath,
+				FinalizingTimeout: 3 * testWaitInterval}, mockops, mockbmclient, mockk8sclient)
+			finalizing := models.ClusterStatusFinalizing
+			// the masters never get ready, the cluster sits in finalizing
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &finalizing}, nil).MinTimes(2)
+			mockk8sclient.EXPECT().ListMasterNodes().Return(masters(v1.ConditionTrue, v1.ConditionFalse, v1.ConditionFalse), nil).MinTimes(2)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+	})
+	Context("resuming from checkpoint", func() {
+		var (
+			tmpDir string
+			conf   ControllerConfig
+		)
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "controller-checkpoint")
+			Expect(err).NotTo(HaveOccurred())
+			conf = ControllerConfig{
+				ClusterID:      "cluster-id",
+				URL:            "https://assisted-service.com:80",
+				CheckpointPath: filepath.Join(tmpDir, "checkpoint.json"),
+			}
+		})
+		AfterEach(func() {
+			os.RemoveAll(tmpDir)
+		})
+		It("checkpoints done hosts and doesn't update them again after restart", func() {
+			doneHostId := inventoryNamesIds["node0"].Host.ID.String()
+			Expect(saveProgressState(conf.CheckpointPath, ProgressState{DoneHosts: []string{doneHostId}, ExpectedNodes: 3})).To(Succeed())
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+			Expect(c.progress.percentage()).To(Equal(0))
+			getInventoryNodes(1)
+			listNodes()
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), doneHostId, gomock.Any(), gomock.Any()).Times(0)
+			for _, name := range []string{"node1", "node2"} {
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), inventoryNamesIds[name].Host.ID.String(), models.HostStageDone, "").
+					Return(nil).Times(1)
+			}
+			c.WaitAndUpdateNodesStatus(context.Background())
+			state, err := loadProgressState(conf.CheckpointPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.DoneHosts).To(ConsistOf(doneHostId, inventoryNamesIds["node1"].Host.ID.String(),
+				inventoryNamesIds["node2"].Host.ID.String()))
+			Expect(state.ExpectedNodes).To(Equal(3))
+		})
+		It("skips post install stages that were done before restart", func() {
+			Expect(saveProgressState(conf.CheckpointPath, ProgressState{
+				PostInstallStagesDone: []string{"add_router_ca", "unpatch_etcd", "wait_for_console"},
+			})).To(Succeed())
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+			finalizing := models.ClusterStatusFinalizing
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &finalizing}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap(gomock.Any(), gomock.Any()).Times(0)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			mockk8sclient.EXPECT().UnPatchEtcd().Times(0)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Times(0)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+			Expect(events).To(BeEmpty())
+		})
+		It("checkpoints done post install stages", func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+			finalizing := models.ClusterStatusFinalizing
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &finalizing}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap(gomock.Any(), gomock.Any()).
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "CA", "cluster-id").Return(nil).Times(1)
+			mockk8sclient.EXPECT().UnPatchEtcd().Return(k8s_client.EtcdUnpatched, nil).Times(1)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).
+				Return([]v1.Pod{readyPod()}, nil).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+			state, err := loadProgressState(conf.CheckpointPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.PostInstallStagesDone).To(Equal([]string{"add_router_ca", "unpatch_etcd", "wait_for_console"}))
+			Expect(state.IngressCAHash).To(Equal(hashCaBundle("CA")))
+		})
+		It("doesn't update the status of BMHs that were updated before restart", func() {
+			Expect(saveProgressState(conf.CheckpointPath, ProgressState{UpdatedBMHs: []types.UID{"bmh-0"}})).To(Succeed())
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+			bmh := metal3v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: "bmh-0", UID: "bmh-0"}}
+			bmh.SetAnnotations(map[string]string{metal3v1alpha1.StatusAnnotation: `{"operationalStatus": "OK"}`})
+			mockk8sclient.EXPECT().IsMetalProvisioningExists().Return(false, nil).Times(2)
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{Items: []metal3v1alpha1.BareMetalHost{bmh}}, nil).Times(1),
+				mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, nil).Times(1),
+			)
+			mockk8sclient.EXPECT().UpdateBMHStatus(gomock.Any()).Times(0)
+			mockk8sclient.EXPECT().UpdateBMH(gomock.Any()).Return(nil).Times(1)
+			wg.Add(1)
+			c.UpdateBMHs(context.Background(), &wg)
+		})
+	})
+
+	Context("custom pod selectors", func() {
+		conf := ControllerConfig{
+			ClusterID:        "cluster-id",
+			URL:              "https://assisted-service.com:80",
+			McsNamespace:     "custom-mco",
+			McsLabels:        map[string]string{"app": "custom-mcs"},
+			ConsoleNamespace: "custom-console",
+			ConsoleLabels:    map[string]string{"app": "custom-console"},
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("getMCSLogs uses the configured mcs selector", func() {
+			mcsPod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "mcs-0"}}
+			mockk8sclient.EXPECT().GetPods("custom-mco", map[string]string{"app": "custom-mcs"}).Return([]v1.Pod{mcsPod}, nil).Times(1)
+			mockk8sclient.EXPECT().GetPodLogs("custom-mco", "mcs-0", gomock.Any()).Return("line1\n", nil).Times(1)
+			logs, err := c.getMCSLogs()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logs).To(Equal("line1\n"))
+		})
+		It("waitForConsole uses the configured console selector", func() {
+			consolePod := readyPod()
+			mockk8sclient.EXPECT().GetPods("custom-console", map[string]string{"app": "custom-console"}).
+				Return([]v1.Pod{consolePod}, nil).Times(1)
+			Expect(c.waitForConsole(context.Background())).To(Succeed())
+		})
+		It("falls back to the default selectors when not set", func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id"}, mockops, mockbmclient, mockk8sclient)
+			namespace, labels := c.mcsPodSelector()
+			Expect(namespace).To(Equal("openshift-machine-config-operator"))
+			Expect(labels).To(Equal(map[string]string{"k8s-app": "machine-config-server"}))
+			namespace, labels = c.consolePodSelector()
+			Expect(namespace).To(Equal("openshift-console"))
+			Expect(labels).To(Equal(map[string]string{"app": "console", "component": "ui"}))
+		})
+	})
+
+	Context("validating updateBMHStatus", func() {
+		conf := ControllerConfig{
+			ClusterID: "cluster-id",
+			URL:       "https://assisted-service.com:80",
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("updates status from annotation and counts updated BMHs", func() {
+			bmh := metal3v1alpha1.BareMetalHost{}
+			bmh.Name = "bmh0"
+			bmh.SetAnnotations(map[string]string{metal3v1alpha1.StatusAnnotation: `{"operationalStatus": "OK"}`})
+			bmhWithoutAnnotation := metal3v1alpha1.BareMetalHost{}
+			bmhWithoutAnnotation.Name = "bmh1"
+			mockk8sclient.EXPECT().UpdateBMHStatus(gomock.Any()).Return(nil).Times(1)
+			mockk8sclient.EXPECT().UpdateBMH(gomock.Any()).Return(nil).Times(1)
+			allUpdated := c.updateBMHStatus(metal3v1alpha1.BareMetalHostList{
+				Items: []metal3v1alpha1.BareMetalHost{bmh, bmhWithoutAnnotation}}, map[types.UID]bool{})
+			Expect(allUpdated).To(BeFalse())
+			Expect(testutil.ToFloat64(c.metrics.bmhsUpdated)).To(Equal(float64(1)))
+		})
+		It("retries only BMHs that failed", func() {
+			newBmh := func(name string) metal3v1alpha1.BareMetalHost {
+				bmh := metal3v1alpha1.BareMetalHost{}
+				bmh.Name = name
+				bmh.UID = types.UID(name)
+				bmh.SetAnnotations(map[string]string{metal3v1alpha1.StatusAnnotation: `{"operationalStatus": "OK"}`})
+				return bmh
+			}
+			statusUpdates := map[string]int{}
+			statusFailures := map[string]int{"bmh0": 1}
+			mockk8sclient.EXPECT().UpdateBMHStatus(gomock.Any()).DoAndReturn(func(bmh *metal3v1alpha1.BareMetalHost) error {
+				statusUpdates[bmh.Name]++
+				if statusFailures[bmh.Name] > 0 {
+					statusFailures[bmh.Name]--
+					return fmt.Errorf("dummy")
+				}
+				return nil
+			}).Times(3)
+			annotationFailures := map[string]int{"bmh1": 1}
+			mockk8sclient.EXPECT().UpdateBMH(gomock.Any()).DoAndReturn(func(bmh *metal3v1alpha1.BareMetalHost) error {
+				if annotationFailures[bmh.Name] > 0 {
+					annotationFailures[bmh.Name]--
+					return fmt.Errorf("dummy")
+				}
+				return nil
+			}).Times(3)
+
+			statusUpdated := map[types.UID]bool{}
+			// bmh0 status update fails and bmh1 annotation removal fails
+			allUpdated := c.updateBMHStatus(metal3v1alpha1.BareMetalHostList{
+				Items: []metal3v1alpha1.BareMetalHost{newBmh("bmh0"), newBmh("bmh1")}}, statusUpdated)
+			Expect(allUpdated).To(BeFalse())
+			allUpdated = c.updateBMHStatus(metal3v1alpha1.BareMetalHostList{
+				Items: []metal3v1alpha1.BareMetalHost{newBmh("bmh0"), newBmh("bmh1")}}, statusUpdated)
+			Expect(allUpdated).To(BeFalse())
+			allUpdated = c.updateBMHStatus(metal3v1alpha1.BareMetalHostList{}, statusUpdated)
+			Expect(allUpdated).To(BeTrue())
+			Expect(statusUpdates).To(Equal(map[string]int{"bmh0": 2, "bmh1": 1}))
+		})
+		It("updates many BMHs with bounded concurrency and isolates failures", func() {
+			const numOfBmhs = 20
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", BMHUpdateConcurrency: 4},
+				mockops, mockbmclient, mockk8sclient)
+			bmhList := func() metal3v1alpha1.BareMetalHostList {
+				list := metal3v1alpha1.BareMetalHostList{}
+				for i := 0; i < numOfBmhs; i++ {
+					bmh := metal3v1alpha1.BareMetalHost{}
+					bmh.Name = fmt.Sprintf("bmh%d", i)
+					bmh.UID = types.UID(bmh.Name)
+					bmh.SetAnnotations(map[string]string{metal3v1alpha1.StatusAnnotation: `{"operationalStatus": "OK"}`})
+					list.Items = append(list.Items, bmh)
+				}
+				return list
+			}
+			var (
+				lock     sync.Mutex
+				inFlight int
+				maxSeen  int
+				failed   bool
+			)
+			mockk8sclient.EXPECT().UpdateBMHStatus(gomock.Any()).DoAndReturn(func(bmh *metal3v1alpha1.BareMetalHost) error {
+				lock.Lock()
+				inFlight++
+				if inFlight > maxSeen {
+					maxSeen = inFlight
+				}
+				lock.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				lock.Lock()
+				defer lock.Unlock()
+				inFlight--
+				// the first status update of bmh7 fails
+				if bmh.Name == "bmh7" && !failed {
+					failed = true
+					return fmt.Errorf("dummy")
+				}
+				return nil
+			}).Times(numOfBmhs + 1)
+			mockk8sclient.EXPECT().UpdateBMH(gomock.Any()).Return(nil).Times(numOfBmhs)
+
+			statusUpdated := map[types.UID]bool{}
+			Expect(c.updateBMHStatus(bmhList(), statusUpdated)).To(BeFalse())
+			Expect(statusUpdated).To(HaveLen(numOfBmhs - 1))
+			Expect(statusUpdated).NotTo(HaveKey(types.UID("bmh7")))
+			Expect(maxSeen).To(BeNumerically("<=", 4))
+			Expect(maxSeen).To(BeNumerically(">", 1))
+
+			// only bmh7 is listed with its annotation on the next poll
+			retryList := metal3v1alpha1.BareMetalHostList{Items: []metal3v1alpha1.BareMetalHost{bmhList().Items[7]}}
+			Expect(c.updateBMHStatus(retryList, statusUpdated)).To(BeFalse())
+			Expect(statusUpdated).To(HaveLen(numOfBmhs))
+			Expect(c.updateBMHStatus(metal3v1alpha1.BareMetalHostList{}, statusUpdated)).To(BeTrue())
+			Expect(testutil.ToFloat64(c.metrics.bmhsUpdated)).To(Equal(float64(numOfBmhs)))
+		})
+		It("removes a malformed status annotation after a few attempts", func() {
+			bmh := metal3v1alpha1.BareMetalHost{}
+			bmh.Name = "bmh0"
+			bmh.UID = types.UID("bmh0")
+			bmh.SetAnnotations(map[string]string{metal3v1alpha1.StatusAnnotation: `{"operationalStatus": `})
+			mockk8sclient.EXPECT().UpdateBMHStatus(gomock.Any()).Times(0)
+			mockk8sclient.EXPECT().UpdateBMH(gomock.Any()).DoAndReturn(func(updated *metal3v1alpha1.BareMetalHost) error {
+				Expect(updated.GetAnnotations()).NotTo(HaveKey(metal3v1alpha1.StatusAnnotation))
+				return nil
+			}).Times(1)
+
+			statusUpdated := map[types.UID]bool{}
+			list := metal3v1alpha1.BareMetalHostList{Items: []metal3v1alpha1.BareMetalHost{bmh}}
+			for i := 1; i < malformedStatusAnnotationMaxAttempts; i++ {
+				Expect(c.updateBMHStatus(list, statusUpdated)).To(BeFalse())
+			}
+			Expect(c.updateBMHStatus(list, statusUpdated)).To(BeFalse())
+			Expect(statusUpdated).NotTo(HaveKey(bmh.UID))
+			Expect(c.updateBMHStatus(metal3v1alpha1.BareMetalHostList{}, statusUpdated)).To(BeTrue())
+		})
+	})
+
+	Context("validating UpdateBMHs", func() {
+		conf := ControllerConfig{
+			ClusterID: "cluster-id",
+			URL:       "https://assisted-service.com:80",
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("returns right away when the BareMetalHost CRD is not installed", func() {
+			mockk8sclient.EXPECT().IsMetalProvisioningExists().Return(false, nil).Times(1)
+			mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, k8s_client.ErrBMHCRDNotInstalled).Times(1)
+			wg.Add(1)
+			c.UpdateBMHs(context.Background(), &wg)
+		})
+		It("returns when the provisioning CR exists", func() {
+			mockk8sclient.EXPECT().IsMetalProvisioningExists().Return(true, nil).Times(1)
+			mockk8sclient.EXPECT().ListBMHs().Times(0)
+			wg.Add(1)
+			c.UpdateBMHs(context.Background(), &wg)
+		})
+		It("retries on transient errors", func() {
+			gomock.InOrder(
+				mockk8sclient.EXPECT().IsMetalProvisioningExists().Return(false, fmt.Errorf("dummy")).Times(1),
+				mockk8sclient.EXPECT().IsMetalProvisioningExists().Return(false, nil).Times(1),
+			)
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, fmt.Errorf("dummy")).Times(2),
+				mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, nil).Times(1),
+			)
+			wg.Add(1)
+			c.UpdateBMHs(context.Background(), &wg)
+		})
+		It("reports the progress of the BMHs update and its completion", func() {
+			logger, hook := logrustest.NewNullLogger()
+			c = newTestController(logger, conf, mockops, mockbmclient, mockk8sclient)
+			newBmh := func(name string, annotated bool) metal3v1alpha1.BareMetalHost {
+				bmh := metal3v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID(name)}}
+				if annotated {
+					bmh.SetAnnotations(map[string]string{metal3v1alpha1.StatusAnnotation: `{"operationalStatus": "OK"}`})
+				}
+				return bmh
+			}
+			bmhList := func(annotated ...bool) metal3v1alpha1.BareMetalHostList {
+				list := metal3v1alpha1.BareMetalHostList{}
+				for i, a := range annotated {
+					list.Items = append(list.Items, newBmh(fmt.Sprintf("bmh-%d", i), a))
+				}
+				return list
+			}
+			mockk8sclient.EXPECT().IsMetalProvisioningExists().Return(false, nil).Times(3)
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListBMHs().Return(bmhList(true, true, false), nil).Times(1),
+				mockk8sclient.EXPECT().ListBMHs().Return(bmhList(false, true, false), nil).Times(1),
+				mockk8sclient.EXPECT().ListBMHs().Return(bmhList(false, false, false), nil).Times(1),
+			)
+			bmh1Failures := 1
+			mockk8sclient.EXPECT().UpdateBMHStatus(gomock.Any()).DoAndReturn(func(bmh *metal3v1alpha1.BareMetalHost) error {
+				if bmh.Name == "bmh-1" && bmh1Failures > 0 {
+					bmh1Failures--
+					return fmt.Errorf("dummy")
+				}
+				return nil
+			}).Times(3)
+			mockk8sclient.EXPECT().UpdateBMH(gomock.Any()).Return(nil).Times(2)
+			wg.Add(1)
+			c.UpdateBMHs(context.Background(), &wg)
+
+			var progress []string
+			for _, entry := range hook.AllEntries() {
+				if strings.HasPrefix(entry.Message, "Updated ") && strings.HasSuffix(entry.Message, " BMHs") {
+					progress = append(progress, entry.Message)
+				}
+			}
+			Expect(progress).To(Equal([]string{"Updated 2 of 3 BMHs", "Updated 3 of 3 BMHs", "Updated 3 of 3 BMHs"}))
+			Expect(testutil.ToFloat64(c.metrics.bmhsPending)).To(Equal(float64(0)))
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Reason).To(Equal(eventReasonBMHsUpdated))
+			Expect(events[0].Message).To(ContainSubstring("all the 3 BMHs"))
+		})
+		It("doesn't record the completion without BMHs", func() {
+			mockk8sclient.EXPECT().IsMetalProvisioningExists().Return(false, nil).Times(1)
+			mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, nil).Times(1)
+			wg.Add(1)
+			c.UpdateBMHs(context.Background(), &wg)
+			Expect(events).To(BeEmpty())
+		})
+	})
+	Context("dry run", func() {
+		conf := ControllerConfig{
+			ClusterID: "cluster-id",
+			URL:       "https://assisted-service.com:80",
+			DryRun:    true,
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).Times(0)
+			mockk8sclient.EXPECT().UpdateBMHStatus(gomock.Any()).Times(0)
+			mockk8sclient.EXPECT().UpdateBMH(gomock.Any()).Times(0)
+			mockk8sclient.EXPECT().UnPatchEtcd().Times(0)
+		})
+		It("WaitAndUpdateNodesStatus doesn't update hosts", func() {
+			getInventoryNodes(1)
+			listNodes()
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			c.WaitAndUpdateNodesStatus(context.Background())
+		})
+		It("approveCsrs doesn't approve csrs", func() {
+			csr := v1beta1.CertificateSigningRequest{}
+			csr.Spec.Request = createCsrPem("system:node:node0", []string{"system:nodes"}, nil, nil)
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any()).Return(inventoryNamesIds, nil).Times(1)
+			c.approveCsrs(context.Background(), &v1beta1.CertificateSigningRequestList{Items: []v1beta1.CertificateSigningRequest{csr}})
+		})
+		It("updateBMHStatus doesn't update BMHs", func() {
+			bmh := metal3v1alpha1.BareMetalHost{}
+			bmh.SetAnnotations(map[string]string{metal3v1alpha1.StatusAnnotation: `{"operationalStatus": "OK"}`})
+			c.updateBMHStatus(metal3v1alpha1.BareMetalHostList{Items: []metal3v1alpha1.BareMetalHost{bmh}}, map[types.UID]bool{})
+		})
+		It("PostInstallConfigs doesn't change cluster or inventory", func() {
+			finalizing := models.ClusterStatusFinalizing
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &finalizing}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap(gomock.Any(), gomock.Any()).
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}, nil).Times(1)
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).
+				Return([]v1.Pod{readyPod()}, nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+	})
+
+	Context("pausing the controller", func() {
+		conf := ControllerConfig{
+			ClusterID: "cluster-id",
+			URL:       "https://assisted-service.com:80",
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("stops and resumes csrs approval", func() {
+			csr := v1beta1.CertificateSigningRequest{}
+			csr.Spec.Usages = []v1beta1.KeyUsage{v1beta1.UsageDigitalSignature, v1beta1.UsageClientAuth}
+			csr.Spec.Request = createCsrPem("system:node:node0", []string{"system:nodes"}, nil, nil)
+			csrs := &v1beta1.CertificateSigningRequestList{Items: []v1beta1.CertificateSigningRequest{csr}}
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any()).Return(inventoryNamesIds, nil).Times(2)
+
+			c.Pause()
+			Expect(c.isPaused()).To(BeTrue())
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).Times(0)
+			c.approveCsrs(context.Background(), csrs)
+
+			c.Resume()
+			Expect(c.isPaused()).To(BeFalse())
+			mockk8sclient.EXPECT().ApproveCsr(&csr).Return(nil).Times(1)
+			c.approveCsrs(context.Background(), csrs)
+		})
+		It("stops and resumes BMHs updates", func() {
+			bmh := metal3v1alpha1.BareMetalHost{}
+			bmh.Name = "bmh0"
+			bmh.SetAnnotations(map[string]string{metal3v1alpha1.StatusAnnotation: `{"operationalStatus": "OK"}`})
+			list := metal3v1alpha1.BareMetalHostList{Items: []metal3v1alpha1.BareMetalHost{bmh}}
+			statusUpdated := map[types.UID]bool{}
+
+			c.Pause()
+			Expect(c.updateBMHStatus(list, statusUpdated)).To(BeFalse())
+			Expect(statusUpdated).To(BeEmpty())
+
+			c.Resume()
+			mockk8sclient.EXPECT().UpdateBMHStatus(gomock.Any()).Return(nil).Times(1)
+			mockk8sclient.EXPECT().UpdateBMH(gomock.Any()).Return(nil).Times(1)
+			Expect(c.updateBMHStatus(list, statusUpdated)).To(BeFalse())
+			Expect(c.updateBMHStatus(metal3v1alpha1.BareMetalHostList{}, statusUpdated)).To(BeTrue())
+		})
+		It("stops and resumes cluster progress updates", func() {
+			c.Pause()
+			c.progress.setPendingNodes(3)
+			c.progress.setPendingNodes(2)
+			c.reportProgress(context.Background())
+			Expect(progressReports).To(BeEmpty())
+			c.Resume()
+			c.reportProgress(context.Background())
+			Expect(progressReports).To(HaveLen(1))
+		})
+		It("waits while paused", func() {
+			Expect(c.waitWhilePaused(context.Background())).To(Succeed())
+			c.Pause()
+			c.Pause()
+			done := make(chan error, 1)
+			go func() { done <- c.waitWhilePaused(context.Background()) }()
+			Consistently(done, 200*time.Millisecond).ShouldNot(Receive())
+			c.Resume()
+			Eventually(done).Should(Receive(BeNil()))
+
+			c.Pause()
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			Expect(c.waitWhilePaused(ctx)).To(HaveOccurred())
+		})
+		It("is paused and resumed by POST requests", func() {
+			pause := httptest.NewServer(pauseHandler(c.Pause))
+			defer pause.Close()
+			resume := httptest.NewServer(pauseHandler(c.Resume))
+			defer resume.Close()
+
+			resp, err := http.Get(pause.URL)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+			Expect(c.isPaused()).To(BeFalse())
+
+			resp, err = http.Post(pause.URL, "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+			Expect(c.isPaused()).To(BeTrue())
+
+			resp, err = http.Post(resume.URL, "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(c.isPaused()).To(BeFalse())
+		})
+	})
+
+	Context("wait interval", func() {
+		It("defaults the wait interval when it is not set", func() {
+			c = NewController(l, ControllerConfig{ClusterID: "cluster-id"}, mockops, mockbmclient, mockk8sclient)
+			Expect(c.waitInterval).To(Equal(defaultWaitInterval))
+		})
+		It("uses the configured wait interval of every instance", func() {
+			c = NewController(l, ControllerConfig{ClusterID: "cluster-id", WaitInterval: time.Minute}, mockops, mockbmclient, mockk8sclient)
+			other := NewController(l, ControllerConfig{ClusterID: "cluster-id", WaitInterval: 5 * time.Second},
+				mockops, mockbmclient, mockk8sclient)
+			Expect(c.pollInterval()).To(Equal(time.Minute))
+			Expect(other.pollInterval()).To(Equal(5 * time.Second))
+		})
+		It("polls at the configured wait interval", func() {
+			c = NewController(l, ControllerConfig{ClusterID: "cluster-id", WaitInterval: time.Minute}, mockops, mockbmclient, mockk8sclient)
+			fakeClock := clock.NewFakeClock(time.Now())
+			c.clock = fakeClock
+			listed := make(chan struct{}, 2)
+			mockk8sclient.EXPECT().ListCsrs().DoAndReturn(func() (*v1beta1.CertificateSigningRequestList, error) {
+				listed <- struct{}{}
+				return &v1beta1.CertificateSigningRequestList{}, nil
+			}).Times(2)
+			ctx, cancel := context.WithCancel(context.Background())
+			wg.Add(1)
+			go c.ApproveCsrs(ctx, &wg)
+			Eventually(listed).Should(Receive())
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			fakeClock.Step(time.Minute - time.Second)
+			Consistently(listed, 10*time.Millisecond).ShouldNot(Receive())
+			fakeClock.Step(time.Second)
+			Eventually(listed).Should(Receive())
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			cancel()
+			wg.Wait()
+		})
+	})
+	Context("poll intervals per loop", func() {
+		var (
+			fakeClock *clock.FakeClock
+			polled    chan struct{}
+		)
+		BeforeEach(func() {
+			c = NewController(l, ControllerConfig{ClusterID: "cluster-id", WaitInterval: time.Hour,
+				CSRPollInterval: time.Minute, NodeStatusPollInterval: 2 * time.Minute, BMHPollInterval: 3 * time.Minute,
+				PostInstallPollInterval: 4 * time.Minute}, mockops, mockbmclient, mockk8sclient)
+			fakeClock = clock.NewFakeClock(time.Now())
+			c.clock = fakeClock
+			polled = make(chan struct{}, 10)
+		})
+		signal := func() {
+			polled <- struct{}{}
+		}
+		// expectPollAfter verifies the loop polls only once interval passed
+		expectPollAfter := func(interval time.Duration) {
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			fakeClock.Step(interval - time.Second)
+			Consistently(polled, 10*time.Millisecond).ShouldNot(Receive())
+			fakeClock.Step(time.Second)
+			Eventually(polled).Should(Receive())
+		}
+		It("falls back to the wait interval", func() {
+			c.CSRPollInterval = 0
+			Expect(c.pollIntervalOf(c.CSRPollInterval)).To(Equal(time.Hour))
+			Expect(c.pollIntervalOf(c.BMHPollInterval)).To(Equal(3 * time.Minute))
+		})
+		It("approves csrs at the csr poll interval", func() {
+			mockk8sclient.EXPECT().ListCsrs().DoAndReturn(func() (*v1beta1.CertificateSigningRequestList, error) {
+				signal()
+				return &v1beta1.CertificateSigningRequestList{}, nil
+			}).Times(2)
+			ctx, cancel := context.WithCancel(context.Background())
+			wg.Add(1)
+			go c.ApproveCsrs(ctx, &wg)
+			Eventually(polled).Should(Receive())
+			expectPollAfter(time.Minute)
+			cancel()
+			wg.Wait()
+		})
+		It("updates the nodes status at the node status poll interval", func() {
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, skippedStatuses []string) (map[string]inventory_client.HostData, error) {
+				signal()
+				return map[string]inventory_client.HostData{}, nil
+			}).Times(1)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				_, _ = c.WaitAndUpdateNodesStatus(context.Background())
+			}()
+			expectPollAfter(2 * time.Minute)
+			Eventually(done).Should(BeClosed())
+		})
+		It("updates the BMHs at the BMH poll interval", func() {
+			mockk8sclient.EXPECT().IsMetalProvisioningExists().DoAndReturn(func() (bool, error) {
+				signal()
+				return true, nil
+			}).Times(1)
+			wg.Add(1)
+			go c.UpdateBMHs(context.Background(), &wg)
+			expectPollAfter(3 * time.Minute)
+			wg.Wait()
+		})
+		It("waits for the cluster to be finalizing at the post install poll interval", func() {
+			installed := models.ClusterStatusInstalled
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).DoAndReturn(func(context.Context) (*models.Cluster, error) {
+				signal()
+				return &models.Cluster{Status: &installed}, nil
+			}).Times(1)
+			wg.Add(1)
+			go c.PostInstallConfigs(context.Background(), &wg)
+			expectPollAfter(4 * time.Minute)
+			wg.Wait()
+		})
+	})
+	Context("validating Run", func() {
+		conf := ControllerConfig{
+			ClusterID:              "cluster-id",
+			URL:                    "https://assisted-service.com:80",
+			CsrApprovalGracePeriod: 300 * time.Millisecond,
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("starts all go routines and returns once they are done", func() {
+			installed := models.ClusterStatusInstalled
+			getInventoryNodes(0)
+			mockk8sclient.EXPECT().IsBootstrapComplete().Return(true, nil).Times(1)
+			mockk8sclient.EXPECT().ListCsrs().Return(&v1beta1.CertificateSigningRequestList{}, nil).MinTimes(1)
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &installed}, nil).Times(1)
+			mockk8sclient.EXPECT().IsMetalProvisioningExists().Return(true, nil).Times(1)
+			Expect(c.Run(context.Background())).To(Succeed())
+		})
+		It("returns an error when cancelled", func() {
+			installing := models.ClusterStatusInstalling
+			mockk8sclient.EXPECT().IsBootstrapComplete().Return(false, nil).AnyTimes()
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(inventoryNamesIds, nil).AnyTimes()
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{}), nil).AnyTimes()
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			mockk8sclient.EXPECT().ListCsrs().Return(&v1beta1.CertificateSigningRequestList{}, nil).AnyTimes()
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &installing}, nil).AnyTimes()
+			mockk8sclient.EXPECT().IsMetalProvisioningExists().Return(false, fmt.Errorf("dummy")).AnyTimes()
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			Expect(c.Run(ctx)).To(HaveOccurred())
+		})
+		It("skips the finalizing wait when adding hosts", func() {
+			c.InstallMode = InstallModeAddHosts
+			updateProgressSuccess(defaultStages, inventoryNamesIds)
+			getInventoryNodes(1)
+			listNodes()
+			configuringSuccess()
+			mockk8sclient.EXPECT().IsBootstrapComplete().Times(0)
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Times(0)
+			mockk8sclient.EXPECT().IsMetalProvisioningExists().Times(0)
+			mockk8sclient.EXPECT().ListCsrs().Return(&v1beta1.CertificateSigningRequestList{}, nil).MinTimes(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			Expect(c.Run(context.Background())).To(Succeed())
+		})
+		It("doesn't complete the installation when adding hosts is cancelled", func() {
+			c.InstallMode = InstallModeAddHosts
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(inventoryNamesIds, nil).AnyTimes()
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{}), nil).AnyTimes()
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			mockk8sclient.EXPECT().ListCsrs().Return(&v1beta1.CertificateSigningRequestList{}, nil).AnyTimes()
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			Expect(c.Run(ctx)).To(HaveOccurred())
+		})
+		It("fails the installation once the install deadline passed", func() {
+			c.InstallDeadline = 500 * time.Millisecond
+			installing := models.ClusterStatusInstalling
+			mockk8sclient.EXPECT().IsBootstrapComplete().Return(true, nil).Times(1)
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(inventoryNamesIds, nil).AnyTimes()
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{}), nil).AnyTimes()
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			mockk8sclient.EXPECT().ListCsrs().Return(&v1beta1.CertificateSigningRequestList{}, nil).AnyTimes()
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &installing}, nil).AnyTimes()
+			mockk8sclient.EXPECT().IsMetalProvisioningExists().Return(false, fmt.Errorf("dummy")).AnyTimes()
+			mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, nil).Times(1)
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), "cluster-id", diagnosticsLogsType, gomock.Any()).Return(nil).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false,
+				"Installation didn't complete within the install deadline of 500ms").Return(nil).Times(1)
+			Expect(c.Run(context.Background())).To(Succeed())
+		})
+		It("fails the installation only once when the cluster moves to error after the node join timeout", func() {
+			c.NodeJoinTimeout = 300 * time.Millisecond
+			installing := models.ClusterStatusInstalling
+			clusterError := models.ClusterStatusError
+			statusInfo := "hosts didn't join"
+			failed := &completionSwitch{}
+			mockk8sclient.EXPECT().IsBootstrapComplete().Return(true, nil).Times(1)
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(inventoryNamesIds, nil).AnyTimes()
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(map[string]string{}), nil).AnyTimes()
+			configuringSuccess()
+			mockk8sclient.EXPECT().ListCsrs().Return(&v1beta1.CertificateSigningRequestList{}, nil).AnyTimes()
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).DoAndReturn(func(context.Context) (*models.Cluster, error) {
+				if failed.isSet() {
+					return &models.Cluster{Status: &clusterError, StatusInfo: &statusInfo}, nil
+				}
+				return &models.Cluster{Status: &installing}, nil
+			}).AnyTimes()
+			mockk8sclient.EXPECT().IsMetalProvisioningExists().Return(false, fmt.Errorf("dummy")).AnyTimes()
+			mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, nil).AnyTimes()
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), "cluster-id", diagnosticsLogsType, gomock.Any()).Return(nil).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false, gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ string, _ bool, errorInfo string) error {
+					Expect(errorInfo).To(ContainSubstring("Timed out after 300ms"))
+					failed.set()
+					return nil
+				}).Times(1)
+			Expect(c.Run(context.Background())).To(Succeed())
+		})
+		It("doesn't fail the installation once it completed within the install deadline", func() {
+			c.InstallDeadline = time.Hour
+			installed := models.ClusterStatusInstalled
+			getInventoryNodes(0)
+			mockk8sclient.EXPECT().IsBootstrapComplete().Return(true, nil).Times(1)
+			mockk8sclient.EXPECT().ListCsrs().Return(&v1beta1.CertificateSigningRequestList{}, nil).MinTimes(1)
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &installed}, nil).Times(1)
+			mockk8sclient.EXPECT().IsMetalProvisioningExists().Return(true, nil).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			Expect(c.Run(context.Background())).To(Succeed())
+		})
+		It("doesn't stop once the install deadline passes after a successful completion", func() {
+			c.InstallDeadline = time.Hour
+			fakeClock := clock.NewFakeClock(time.Now())
+			c.clock = fakeClock
+			stopped := make(chan struct{})
+			passed := c.watchInstallDeadline(context.Background(), func() { close(stopped) })
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			c.sendCompleteInstallation(context.Background(), true, "")
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			fakeClock.Step(2 * time.Hour)
+			Consistently(passed, 200*time.Millisecond).ShouldNot(BeClosed())
+			Expect(stopped).NotTo(BeClosed())
+			Expect(c.forceComplete.isSet()).To(BeFalse())
+		})
+		It("doesn't approve csrs when csr approval is disabled", func() {
+			c.DisableCSRApproval = true
+			c.CsrApprovalGracePeriod = time.Hour
+			installed := models.ClusterStatusInstalled
+			getInventoryNodes(0)
+			mockk8sclient.EXPECT().IsBootstrapComplete().Return(true, nil).Times(1)
+			mockk8sclient.EXPECT().ListCsrs().Times(0)
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).Times(0)
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &installed}, nil).Times(1)
+			mockk8sclient.EXPECT().IsMetalProvisioningExists().Return(true, nil).Times(1)
+			Expect(c.Run(context.Background())).To(Succeed())
+		})
+	})
+
+	Context("pre-flight checks", func() {
+		conf := ControllerConfig{
+			ClusterID:        "cluster-id",
+			URL:              "https://assisted-service.com:80",
+			PreflightTimeout: 500 * time.Millisecond,
+		}
+		connectionRefused := &inventory_client.InventoryError{Err: &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+			c.waitInterval = 50 * time.Millisecond
+		})
+		It("passes once assisted-service and the cluster API are reachable", func() {
+			installing := models.ClusterStatusInstalling
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(nil, connectionRefused).Times(1),
+				mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &installing}, nil).Times(1),
+			)
+			mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{}, nil).Times(1)
+			Expect(c.preflight(context.Background())).To(Succeed())
+		})
+		It("fails right away when assisted-service rejects the request", func() {
+			unauthorized := &inventory_client.InventoryError{StatusCode: http.StatusUnauthorized, Err: fmt.Errorf("dummy")}
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(nil, unauthorized).Times(1)
+			mockk8sclient.EXPECT().ListNodes().Times(0)
+			err := c.preflight(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("assisted-service at https://assisted-service.com:80")))
+			Expect(errors.Is(err, unauthorized)).To(BeTrue())
+		})
+		It("fails once assisted-service isn't reachable till the timeout", func() {
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(nil, connectionRefused).MinTimes(2)
+			mockk8sclient.EXPECT().ListNodes().Times(0)
+			Expect(c.preflight(context.Background())).To(MatchError(ContainSubstring("assisted-service at")))
+		})
+		It("fails once the cluster API isn't reachable till the timeout", func() {
+			installing := models.ClusterStatusInstalling
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &installing}, nil).Times(1)
+			mockk8sclient.EXPECT().ListNodes().Return(nil, fmt.Errorf("connection refused")).MinTimes(2)
+			Expect(c.preflight(context.Background())).To(MatchError(ContainSubstring("the cluster API is not reachable")))
+		})
+		It("Run doesn't start when the pre-flight checks fail", func() {
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(nil, &inventory_client.InventoryError{StatusCode: http.StatusNotFound,
+				Err: fmt.Errorf("dummy")}).Times(1)
+			mockk8sclient.EXPECT().IsBootstrapComplete().Times(0)
+			mockk8sclient.EXPECT().ListCsrs().Times(0)
+			Expect(c.Run(context.Background())).To(MatchError(ContainSubstring("pre-flight checks failed")))
+		})
+		It("skips the checks without a timeout", func() {
+			c.PreflightTimeout = 0
+			Expect(c.preflight(context.Background())).To(Succeed())
+		})
+	})
+
+	Context("context cancellation", func() {
+		conf := ControllerConfig{
+			ClusterID: "cluster-id",
+			URL:       "https://assisted-service.com:80",
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("WaitAndUpdateNodesStatus returns when cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			summary, err := c.WaitAndUpdateNodesStatus(ctx)
+			Expect(err).To(MatchError(ContainSubstring("WaitAndUpdateNodesStatus was cancelled")))
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+			Expect(summary.AllJoined).To(BeFalse())
+		})
+		It("PostInstallConfigs and UpdateBMHs return when cancelled", func() {
+			installing := models.ClusterStatusInstalling
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &installing}, nil).AnyTimes()
+			mockk8sclient.EXPECT().IsMetalProvisioningExists().Return(false, fmt.Errorf("dummy")).AnyTimes()
+			ctx, cancel := context.WithCancel(context.Background())
+			wg.Add(2)
+			go c.PostInstallConfigs(ctx, &wg)
+			go c.UpdateBMHs(ctx, &wg)
+			time.Sleep(300 * time.Millisecond)
+			cancel()
+			wg.Wait()
+		})
+	})
+
+	Context("assisted-service events", func() {
+		BeforeEach(func() {
+			c = newTestController(l, ControllerConfig{ClusterID: "cluster-id"}, mockops, mockbmclient, mockk8sclient)
+		})
+		It("adds the completed installation as info", func() {
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			c.sendCompleteInstallation(context.Background(), true, "")
+			Expect(serviceEvents).To(Equal([]serviceEvent{{clusterId: "cluster-id", severity: models.EventSeverityInfo,
+				message: "Installation of cluster cluster-id was completed"}}))
+		})
+		It("adds the failed installation as error", func() {
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false, "error").Return(nil).Times(1)
+			c.sendCompleteInstallation(context.Background(), false, "error")
+			Expect(serviceEvents).To(Equal([]serviceEvent{{clusterId: "cluster-id", severity: models.EventSeverityError,
+				message: "Installation of cluster cluster-id failed: error"}}))
+		})
+		It("adds a host that didn't join in time as warning of the host", func() {
+			c.HostJoinTimeout = time.Minute
+			c.handleLateHosts(context.Background(), []string{"node1"}, inventoryNamesIds)
+			Expect(serviceEvents).To(Equal([]serviceEvent{{clusterId: "cluster-id",
+				hostId: inventoryNamesIds["node1"].Host.ID.String(), severity: models.EventSeverityWarning,
+				message: "Host node1 didn't join the cluster within 1m0s"}}))
+		})
+		It("doesn't add the events that aren't milestones", func() {
+			c.recordEvent(context.Background(), v1.ObjectReference{Kind: "CertificateSigningRequest", Name: "csr"},
+				v1.EventTypeNormal, eventReasonCsrApproved, "Csr csr of user user was approved")
+			Expect(events).To(HaveLen(1))
+			Expect(serviceEvents).To(BeEmpty())
+		})
+		It("stops adding events once the service doesn't support them", func() {
+			serviceEventsErr = &inventory_client.InventoryError{StatusCode: http.StatusNotFound, Err: fmt.Errorf("not found")}
+			c.recordEvent(context.Background(), clusterObjectReference, v1.EventTypeNormal, eventReasonAllNodesJoined, "joined")
+			c.recordEvent(context.Background(), clusterObjectReference, v1.EventTypeNormal, eventReasonBMHsUpdated, "updated")
+			Expect(serviceEvents).To(HaveLen(1))
+			// the kubernetes events are still created
+			Expect(events).To(HaveLen(2))
+		})
+		It("keeps adding events after a failure", func() {
+			serviceEventsErr = &inventory_client.InventoryError{StatusCode: http.StatusServiceUnavailable, Err: fmt.Errorf("unavailable")}
+			c.recordEvent(context.Background(), clusterObjectReference, v1.EventTypeNormal, eventReasonAllNodesJoined, "joined")
+			c.recordEvent(context.Background(), clusterObjectReference, v1.EventTypeNormal, eventReasonBMHsUpdated, "updated")
+			Expect(serviceEvents).To(HaveLen(2))
+		})
+		It("doesn't add events on dry run", func() {
+			c.DryRun = true
+			c.recordEvent(context.Background(), clusterObjectReference, v1.EventTypeNormal, eventReasonAllNodesJoined, "joined")
+			Expect(serviceEvents).To(BeEmpty())
+		})
+	})
+	Context("validating sendCompleteInstallation", func() {
+		conf := ControllerConfig{
+			ClusterID:                         "cluster-id",
+			URL:                               "https://assisted-service.com:80",
+			CompleteInstallationRetryMinDelay: 50 * time.Millisecond,
+			CompleteInstallationRetryMaxDelay: 100 * time.Millisecond,
+			CompleteInstallationMaxRetries:    5,
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("retries with backoff until success", func() {
+			unavailable := &inventory_client.InventoryError{StatusCode: http.StatusServiceUnavailable, Err: fmt.Errorf("dummy")}
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(unavailable).Times(3)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			start := time.Now()
+			c.sendCompleteInstallation(context.Background(), true, "")
+			// 50ms and then jittered between the min delay and 100ms
+			Expect(time.Since(start)).Should(BeNumerically(">=", 150*time.Millisecond))
+		})
+		It("doesn't retry permanent errors", func() {
+			notFound := &inventory_client.InventoryError{StatusCode: http.StatusNotFound, Err: fmt.Errorf("dummy")}
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(notFound).Times(1)
+			c.sendCompleteInstallation(context.Background(), true, "")
+		})
+		It("doesn't complete the installation again once it was completed", func() {
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false, "error").Return(nil).Times(1)
+			c.sendCompleteInstallation(context.Background(), false, "error")
+			c.sendCompleteInstallation(context.Background(), false, "another error")
+			Expect(c.completed.isSet()).To(BeTrue())
+		})
+		It("retries transient errors", func() {
+			unavailable := &inventory_client.InventoryError{StatusCode: http.StatusServiceUnavailable, Err: fmt.Errorf("dummy")}
+			noResponse := &inventory_client.InventoryError{Err: &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}}
+			gomock.InOrder(
+				mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(unavailable).Times(1),
+				mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(noResponse).Times(1),
+				mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1),
+			)
+			c.sendCompleteInstallation(context.Background(), true, "")
+		})
+		It("gives up after max retries", func() {
+			logger, hook := logrustest.NewNullLogger()
+			c = newTestController(logger, conf, mockops, mockbmclient, mockk8sclient)
+			unavailable := &inventory_client.InventoryError{StatusCode: http.StatusServiceUnavailable, Err: fmt.Errorf("dummy")}
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false, "error").Return(unavailable).Times(5)
+			c.sendCompleteInstallation(context.Background(), false, "error")
+			Expect(hook.LastEntry().Level).To(Equal(logrus.FatalLevel))
+			Expect(hook.LastEntry().Message).To(Equal("Failed to complete installation after 5 attempts, giving up"))
+		})
+		It("aborts the request in flight and doesn't retry once cancelled", func() {
+			c.CompleteInstallationMaxRetries = 0
+			ctx, cancel := context.WithCancel(context.Background())
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").DoAndReturn(
+				func(requestCtx context.Context, clusterId string, isSuccess bool, errorInfo string) error {
+					cancel()
+					<-requestCtx.Done()
+					return &inventory_client.InventoryError{Err: requestCtx.Err()}
+				}).Times(1)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				c.sendCompleteInstallation(ctx, true, "")
+			}()
+			Eventually(done, time.Second).Should(BeClosed())
+		})
+		webhook := func(statuses ...int) (*httptest.Server, *[]map[string]interface{}) {
+			var (
+				lock          sync.Mutex
+				notifications []map[string]interface{}
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				lock.Lock()
+				defer lock.Unlock()
+				Expect(r.Method).To(Equal(http.MethodPost))
+				Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+				var notification map[string]interface{}
+				Expect(json.NewDecoder(r.Body).Decode(&notification)).To(Succeed())
+				notifications = append(notifications, notification)
+				status := http.StatusOK
+				if len(notifications) <= len(statuses) {
+					status = statuses[len(notifications)-1]
+				}
+				w.WriteHeader(status)
+			}))
+			return server, &notifications
+		}
+		It("notifies the webhook about a successful installation", func() {
+			server, notifications := webhook()
+			defer server.Close()
+			notifyConf := conf
+			notifyConf.NotifyWebhookURL = server.URL
+			c = newTestController(l, notifyConf, mockops, mockbmclient, mockk8sclient)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			c.sendCompleteInstallation(context.Background(), true, "")
+			Expect(*notifications).To(HaveLen(1))
+			Expect((*notifications)[0]).To(HaveKeyWithValue("clusterId", "cluster-id"))
+			Expect((*notifications)[0]).To(HaveKeyWithValue("success", true))
+			Expect((*notifications)[0]).NotTo(HaveKey("errorInfo"))
+			Expect((*notifications)[0]).To(HaveKey("duration"))
+		})
+		It("notifies the webhook about a failed installation, retrying rejected notifications", func() {
+			server, notifications := webhook(http.StatusInternalServerError)
+			defer server.Close()
+			notifyConf := conf
+			notifyConf.NotifyWebhookURL = server.URL
+			c = newTestController(l, notifyConf, mockops, mockbmclient, mockk8sclient)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false, "error").Return(nil).Times(1)
+			c.sendCompleteInstallation(context.Background(), false, "error")
+			Expect(*notifications).To(HaveLen(2))
+			Expect((*notifications)[1]).To(HaveKeyWithValue("success", false))
+			Expect((*notifications)[1]).To(HaveKeyWithValue("errorInfo", "error"))
+		})
+		It("measures the installation duration from the start of Run", func() {
+			server, notifications := webhook()
+			defer server.Close()
+			notifyConf := conf
+			notifyConf.NotifyWebhookURL = server.URL
+			notifyConf.PreflightTimeout = time.Minute
+			c = newTestController(l, notifyConf, mockops, mockbmclient, mockk8sclient)
+			fakeClock := clock.NewFakeClock(time.Now())
+			c.clock = fakeClock
+			fakeClock.Step(time.Hour)
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(nil, &inventory_client.InventoryError{StatusCode: http.StatusNotFound,
+				Err: fmt.Errorf("dummy")}).Times(1)
+			Expect(c.Run(context.Background())).To(HaveOccurred())
+			fakeClock.Step(90 * time.Second)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			c.sendCompleteInstallation(context.Background(), true, "")
+			Expect(*notifications).To(HaveLen(1))
+			Expect((*notifications)[0]).To(HaveKeyWithValue("duration", "1m30s"))
+		})
+		It("doesn't fail the completion when the webhook keeps rejecting the notification", func() {
+			server, notifications := webhook(http.StatusInternalServerError, http.StatusInternalServerError,
+				http.StatusInternalServerError, http.StatusInternalServerError)
+			defer server.Close()
+			notifyConf := conf
+			notifyConf.NotifyWebhookURL = server.URL
+			c = newTestController(l, notifyConf, mockops, mockbmclient, mockk8sclient)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			c.sendCompleteInstallation(context.Background(), true, "")
+			Expect(*notifications).To(HaveLen(notifyMaxAttempts))
+		})
+		It("doesn't notify the webhook when the completion wasn't reported", func() {
+			server, notifications := webhook()
+			defer server.Close()
+			notifyConf := conf
+			notifyConf.NotifyWebhookURL = server.URL
+			c = newTestController(l, notifyConf, mockops, mockbmclient, mockk8sclient)
+			notFound := &inventory_client.InventoryError{StatusCode: http.StatusNotFound, Err: fmt.Errorf("dummy")}
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(notFound).Times(1)
+			c.sendCompleteInstallation(context.Background(), true, "")
+			Expect(*notifications).To(BeEmpty())
+		})
+		It("stops retrying the notification once cancelled", func() {
+			server, notifications := webhook(http.StatusInternalServerError, http.StatusInternalServerError,
+				http.StatusInternalServerError)
+			defer server.Close()
+			notifyConf := conf
+			notifyConf.NotifyWebhookURL = server.URL
+			c = newTestController(l, notifyConf, mockops, mockbmclient, mockk8sclient)
+			c.waitInterval = time.Hour
+			ctx, cancel := context.WithCancel(context.Background())
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			time.AfterFunc(100*time.Millisecond, cancel)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				c.sendCompleteInstallation(ctx, true, "")
+			}()
+			Eventually(done, time.Second).Should(BeClosed())
+			Expect(*notifications).To(HaveLen(1))
+		})
+	})
+
+	Context("validating AddRouterCAToClusterCA", func() {
+		conf := ControllerConfig{
+			ClusterID: "cluster-id",
+			URL:       "https://assisted-service.com:80",
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+			c.waitInterval = 1 * time.Second
+		})
+		It("Run addRouterCAToClusterCA", func() {
+			cmName := "default-ingress-cert"
+			cmNamespace := "openshift-config-managed"
+			data := make(map[string]string)
+			data["ca-bundle.crt"] = "CA"
+			cm := v1.ConfigMap{Data: data}
+			mockk8sclient.EXPECT().GetConfigMap(cmNamespace, cmName).Return(nil, fmt.Errorf("dummy")).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap(cmNamespace, cmName).Return(&cm, nil).Times(2)
+			unavailable := &inventory_client.InventoryError{StatusCode: http.StatusServiceUnavailable, Err: fmt.Errorf("dummy")}
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), data["ca-bundle.crt"], c.ClusterID).Return(unavailable).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), data["ca-bundle.crt"], c.ClusterID).Return(nil).Times(1)
+			_, err := c.addRouterCAToClusterCA(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("addRouterCAToClusterCA waits for non empty ca bundle", func() {
+			cmName := "default-ingress-cert"
+			cmNamespace := "openshift-config-managed"
+			emptyCm := v1.ConfigMap{Data: map[string]string{}}
+			cm := v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}
+			mockk8sclient.EXPECT().GetConfigMap(cmNamespace, cmName).Return(nil, fmt.Errorf("dummy")).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap(cmNamespace, cmName).Return(&emptyCm, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap(cmNamespace, cmName).Return(&cm, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "CA", c.ClusterID).Return(nil).Times(1)
+			_, err := c.addRouterCAToClusterCA(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("addRouterCAToClusterCA combines the unique certs of multiple configmaps", func() {
+			c.IngressCAConfigMaps = []string{"openshift-config-managed/default-ingress-cert", "custom-ingress/router-ca", "custom-ingress/empty-ca"}
+			certA, certB, certC := string(createCertPem()), string(createCertPem()), string(createCertPem())
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": certA + certB}}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap("custom-ingress", "router-ca").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": certB + "\n" + certC + certA}}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap("custom-ingress", "empty-ca").
+				Return(&v1.ConfigMap{Data: map[string]string{}}, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), certA+certB+certC, c.ClusterID).Return(nil).Times(1)
+			hash, err := c.addRouterCAToClusterCA(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hash).To(Equal(hashCaBundle(certA + certB + certC)))
+		})
+		It("addRouterCAToClusterCA adds the unique certs of the additional cas", func() {
+			tmpDir, err := ioutil.TempDir("", "controller-additional-ca")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(tmpDir)
+			certA, certB, certC := string(createCertPem()), string(createCertPem()), string(createCertPem())
+			extraB := filepath.Join(tmpDir, "extra-b.crt")
+			Expect(ioutil.WriteFile(extraB, []byte(certB+certA), 0600)).To(Succeed())
+			extraC := filepath.Join(tmpDir, "extra-c.crt")
+			Expect(ioutil.WriteFile(extraC, []byte(certC), 0600)).To(Succeed())
+			c.AdditionalCAPaths = []string{extraB, extraC}
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": certA}}, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), certA+certB+certC, c.ClusterID).Return(nil).Times(1)
+			hash, err := c.addRouterCAToClusterCA(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hash).To(Equal(hashCaBundle(certA + certB + certC)))
+		})
+		It("addRouterCAToClusterCA doesn't upload the bundle without an additional ca", func() {
+			c.AdditionalCAPaths = []string{"/nonexistent/extra.crt"}
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": string(createCertPem())}}, nil).MinTimes(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+			defer cancel()
+			_, err := c.addRouterCAToClusterCA(ctx)
+			Expect(err).To(MatchError(ContainSubstring("reading additional ca /nonexistent/extra.crt")))
+		})
+		It("addRouterCAToClusterCA doesn't upload a partial bundle", func() {
+			c.IngressCAConfigMaps = []string{"openshift-config-managed/default-ingress-cert", "custom-ingress/router-ca"}
+			cert := string(createCertPem())
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": cert}}, nil).MinTimes(2)
+			mockk8sclient.EXPECT().GetConfigMap("custom-ingress", "router-ca").Return(nil, fmt.Errorf("dummy")).MinTimes(2)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+			defer cancel()
+			_, err := c.addRouterCAToClusterCA(ctx)
+			Expect(err).To(HaveOccurred())
+		})
+		It("addRouterCAToClusterCA doesn't retry permanent upload errors", func() {
+			cm := v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}
+			badRequest := &inventory_client.InventoryError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("dummy")}
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").Return(&cm, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "CA", c.ClusterID).Return(badRequest).Times(1)
+			_, err := c.addRouterCAToClusterCA(context.Background())
+			Expect(err).To(HaveOccurred())
+			Expect(inventory_client.IsTransient(err)).To(BeFalse())
+		})
+		It("addRouterCAToClusterCA treats an already uploaded ingress ca as uploaded", func() {
+			cm := v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}
+			conflict := &inventory_client.InventoryError{StatusCode: http.StatusConflict, Err: fmt.Errorf("dummy")}
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").Return(&cm, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "CA", c.ClusterID).Return(conflict).Times(1)
+			hash, err := c.addRouterCAToClusterCA(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hash).To(Equal(hashCaBundle("CA")))
+		})
+		It("addRouterCAToClusterCA gives up after timeout", func() {
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(nil, fmt.Errorf("dummy")).MinTimes(2)
+			err := c.runPostInstallStage(context.Background(), "add_router_ca", 1500*time.Millisecond, func(ctx context.Context) error {
+				_, err := c.addRouterCAToClusterCA(ctx)
+				return err
+			})
+			Expect(err).To(MatchError("add_router_ca: timed out after 1.5s"))
+		})
+		It("waitForConsole waits for a console pod that is serving", func() {
+			terminating := readyPod()
+			deleted := metav1.Now()
+			terminating.DeletionTimestamp = &deleted
+			notReady := readyPod()
+			notReady.Status.ContainerStatuses = append(notReady.Status.ContainerStatuses, v1.ContainerStatus{Name: "proxy"})
+			noContainers := v1.Pod{Status: v1.PodStatus{Phase: v1.PodRunning}}
+			gomock.InOrder(
+				mockk8sclient.EXPECT().GetPods("openshift-console", gomock.Any()).
+					Return([]v1.Pod{terminating, notReady, noContainers}, nil).Times(1),
+				mockk8sclient.EXPECT().GetPods("openshift-console", gomock.Any()).
+					Return([]v1.Pod{terminating, readyPod()}, nil).Times(1),
+			)
+			Expect(c.waitForConsole(context.Background())).To(Succeed())
+		})
+		It("isPodServing requires a running pod with all its containers ready", func() {
+			pod := readyPod()
+			Expect(isPodServing(&pod)).To(BeTrue())
+			pod.Status.Phase = v1.PodPending
+			Expect(isPodServing(&pod)).To(BeFalse())
+		})
+		It("waitForConsole gives up after timeout", func() {
+			notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "openshift-console")
+			mockk8sclient.EXPECT().GetPods("openshift-console", gomock.Any()).Return(nil, notFound).MinTimes(2)
+			ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+			defer cancel()
+			Expect(c.waitForConsole(ctx)).To(HaveOccurred())
+		})
+		It("runPostInstallStage abandons a hung stage after its timeout", func() {
+			release := make(chan struct{})
+			defer close(release)
+			err := c.runPostInstallStage(context.Background(), "hung_stage", 200*time.Millisecond, func(ctx context.Context) error {
+				<-release
+				return nil
+			})
+			Expect(err).To(MatchError("hung_stage: timed out after 200ms"))
+		})
+		It("runPostInstallStage prefixes stage errors with the stage name", func() {
+			err := c.runPostInstallStage(context.Background(), "failed_stage", time.Minute, func(ctx context.Context) error {
+				return fmt.Errorf("dummy")
+			})
+			Expect(err).To(MatchError("failed_stage: dummy"))
+		})
+		It("runPostInstallStage fails a panicking stage", func() {
+			err := c.runPostInstallStage(context.Background(), "panicking_stage", time.Minute, func(ctx context.Context) error {
+				panic("dummy")
+			})
+			Expect(err).To(MatchError("panicking_stage: panicked: dummy"))
+			Expect(testutil.ToFloat64(c.metrics.goRoutinePanics.WithLabelValues("panicking_stage"))).To(Equal(float64(1)))
+		})
+		It("PostInstallConfigs reports failure when the cluster moves to error", func() {
+			installing := models.ClusterStatusInstalling
+			clusterError := models.ClusterStatusError
+			statusInfo := "Host master-0 failed to install"
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &installing}, nil).Times(1),
+				mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &clusterError, StatusInfo: &statusInfo}, nil).Times(1),
+			)
+			mockk8sclient.EXPECT().GetConfigMap(gomock.Any(), gomock.Any()).Times(0)
+			mockk8sclient.EXPECT().UnPatchEtcd().Times(0)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false,
+				"Cluster moved to error before post install configs: Host master-0 failed to install").Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		It("PostInstallConfigs reports a hung stage as installation failure", func() {
+			c.UnpatchEtcdTimeout = 300 * time.Millisecond
+			finalizing := models.ClusterStatusFinalizing
+			release := make(chan struct{})
+			defer close(release)
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &finalizing}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "CA", c.ClusterID).Return(nil).Times(1)
+			mockk8sclient.EXPECT().UnPatchEtcd().DoAndReturn(func() (k8s_client.EtcdUnpatchResult, error) {
+				<-release
+				return k8s_client.EtcdUnpatched, nil
+			}).Times(1)
+			mockk8sclient.EXPECT().GetPods("openshift-console", gomock.Any()).
+				Return([]v1.Pod{readyPod()}, nil).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false, "unpatch_etcd: timed out after 300ms").Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		hungUnpatchEtcd := func(release chan struct{}) {
+			c.UnpatchEtcdTimeout = 300 * time.Millisecond
+			finalizing := models.ClusterStatusFinalizing
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &finalizing}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "CA", c.ClusterID).Return(nil).Times(1)
+			mockk8sclient.EXPECT().UnPatchEtcd().DoAndReturn(func() (k8s_client.EtcdUnpatchResult, error) {
+				<-release
+				return k8s_client.EtcdUnpatched, nil
+			}).Times(1)
+			mockk8sclient.EXPECT().GetPods("openshift-console", gomock.Any()).
+				Return([]v1.Pod{readyPod()}, nil).Times(1)
+		}
+		It("PostInstallConfigs completes successfully with a warning when a non critical stage fails", func() {
+			c.NonCriticalPostInstallStages = []string{"unpatch_etcd"}
+			release := make(chan struct{})
+			defer close(release)
+			hungUnpatchEtcd(release)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "warning: unpatch_etcd: timed out after 300ms").
+				Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		It("PostInstallConfigs fails the installation when a critical stage fails", func() {
+			c.NonCriticalPostInstallStages = []string{"wait_for_console", "wait_for_cluster_operators"}
+			release := make(chan struct{})
+			defer close(release)
+			hungUnpatchEtcd(release)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false, "unpatch_etcd: timed out after 300ms").
+				Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		It("PostInstallConfigs uncordons the nodes when enabled", func() {
+			c.UncordonNodes = true
+			finalizing := models.ClusterStatusFinalizing
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &finalizing}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "CA", c.ClusterID).Return(nil).Times(1)
+			mockk8sclient.EXPECT().UnPatchEtcd().Return(k8s_client.EtcdUnpatched, nil).Times(1)
+			mockk8sclient.EXPECT().GetPods("openshift-console", gomock.Any()).Return([]v1.Pod{readyPod()}, nil).Times(1)
+			mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{Items: []v1.Node{
+				{ObjectMeta: metav1.ObjectMeta{Name: "node0"}, Spec: v1.NodeSpec{Unschedulable: true}}}}, nil).Times(1)
+			mockk8sclient.EXPECT().UncordonNode("node0").Return(nil).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		It("PostInstallConfigs runs the stages concurrently", func() {
+			c.ParallelPostInstallStages = true
+			finalizing := models.ClusterStatusFinalizing
+			consoleChecked := make(chan struct{})
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &finalizing}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "CA", c.ClusterID).Return(nil).Times(1)
+			// etcd is unpatched only once the console is checked, which never happens when running one after the other
+			mockk8sclient.EXPECT().UnPatchEtcd().DoAndReturn(func() (k8s_client.EtcdUnpatchResult, error) {
+				select {
+				case <-consoleChecked:
+					return k8s_client.EtcdUnpatched, nil
+				case <-time.After(time.Second):
+					return k8s_client.EtcdUnpatchPermanentError, fmt.Errorf("console wasn't checked concurrently")
+				}
+			}).Times(1)
+			mockk8sclient.EXPECT().GetPods("openshift-console", gomock.Any()).DoAndReturn(func(namespace string, labels map[string]string) ([]v1.Pod, error) {
+				close(consoleChecked)
+				return []v1.Pod{readyPod()}, nil
+			}).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		It("PostInstallConfigs aggregates the failures of the concurrent stages in the stages order", func() {
+			c.ParallelPostInstallStages = true
+			c.ConsoleWaitTimeout = 300 * time.Millisecond
+			finalizing := models.ClusterStatusFinalizing
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &finalizing}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "CA", c.ClusterID).Return(nil).Times(1)
+			mockk8sclient.EXPECT().UnPatchEtcd().Return(k8s_client.EtcdUnpatchPermanentError, fmt.Errorf("dummy")).Times(1)
+			mockk8sclient.EXPECT().GetPods("openshift-console", gomock.Any()).
+				Return([]v1.Pod{{Status: v1.PodStatus{Phase: "Pending"}}}, nil).MinTimes(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false,
+				"unpatch_etcd: failed to unpatch etcd: dummy; wait_for_console: timed out after 300ms").Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		It("PostInstallConfigs reports a panicking concurrent stage as its failure", func() {
+			c.ParallelPostInstallStages = true
+			finalizing := models.ClusterStatusFinalizing
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &finalizing}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "CA", c.ClusterID).Return(nil).Times(1)
+			mockk8sclient.EXPECT().UnPatchEtcd().DoAndReturn(func() (k8s_client.EtcdUnpatchResult, error) {
+				panic("dummy")
+			}).Times(1)
+			mockk8sclient.EXPECT().GetPods("openshift-console", gomock.Any()).Return([]v1.Pod{readyPod()}, nil).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false,
+				"unpatch_etcd: panicked: dummy").Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		It("waitForEtcdHealthy waits till the expected etcd members are healthy", func() {
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListEtcdMembers().Return(nil, fmt.Errorf("dummy")).Times(1),
+				mockk8sclient.EXPECT().ListEtcdMembers().Return([]k8s_client.EtcdMember{
+					{Name: "etcd-master-0", Healthy: true},
+					{Name: "etcd-master-1", Healthy: true},
+				}, nil).Times(1),
+				mockk8sclient.EXPECT().ListEtcdMembers().Return([]k8s_client.EtcdMember{
+					{Name: "etcd-master-0", Healthy: true},
+					{Name: "etcd-master-1", Healthy: true},
+					{Name: "etcd-master-2", Healthy: false},
+				}, nil).Times(1),
+				mockk8sclient.EXPECT().ListEtcdMembers().Return([]k8s_client.EtcdMember{
+					{Name: "etcd-master-0", Healthy: true},
+					{Name: "etcd-master-1", Healthy: true},
+					{Name: "etcd-master-2", Healthy: true},
+				}, nil).Times(1),
+			)
+			status := &etcdHealthStatus{}
+			Expect(c.waitForEtcdHealthy(context.Background(), 3, status)).To(Succeed())
+			Expect(status.String()).To(BeEmpty())
+		})
+		It("waitForEtcdHealthy doesn't wait without expected members", func() {
+			mockk8sclient.EXPECT().ListEtcdMembers().Times(0)
+			Expect(c.waitForEtcdHealthy(context.Background(), 0, &etcdHealthStatus{})).To(Succeed())
+		})
+		It("expects an etcd member on every control plane replica", func() {
+			bootstrap := &models.Host{Role: models.HostRoleBootstrap}
+			master := &models.Host{Role: models.HostRoleMaster}
+			worker := &models.Host{Role: models.HostRoleWorker}
+			Expect(c.expectedEtcdMembers(&models.Cluster{Hosts: []*models.Host{bootstrap, master, master, worker}})).To(Equal(3))
+			Expect(c.expectedEtcdMembers(&models.Cluster{Hosts: []*models.Host{bootstrap}})).To(Equal(1))
+			Expect(c.expectedEtcdMembers(&models.Cluster{})).To(Equal(0))
+			Expect(c.expectedEtcdMembers(nil)).To(Equal(0))
+		})
+		It("expects the overridden etcd members", func() {
+			c.EtcdExpectedMembers = 5
+			Expect(c.expectedEtcdMembers(&models.Cluster{Hosts: []*models.Host{{Role: models.HostRoleBootstrap}}})).To(Equal(5))
+		})
+		It("PostInstallConfigs unpatches etcd of a single node cluster once its single member is healthy", func() {
+			finalizing := models.ClusterStatusFinalizing
+			sno := &models.Cluster{Status: &finalizing, Hosts: []*models.Host{{Role: models.HostRoleBootstrap}}}
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(sno, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "CA", c.ClusterID).Return(nil).Times(1)
+			mockk8sclient.EXPECT().ListEtcdMembers().Return([]k8s_client.EtcdMember{
+				{Name: "etcd-master-0", Healthy: true},
+			}, nil).Times(1)
+			mockk8sclient.EXPECT().UnPatchEtcd().Return(k8s_client.EtcdUnpatched, nil).Times(1)
+			mockk8sclient.EXPECT().GetPods("openshift-console", gomock.Any()).Return([]v1.Pod{readyPod()}, nil).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		It("PostInstallConfigs doesn't unpatch etcd that never becomes healthy", func() {
+			c.EtcdExpectedMembers = 3
+			c.UnpatchEtcdTimeout = 300 * time.Millisecond
+			finalizing := models.ClusterStatusFinalizing
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &finalizing}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "CA", c.ClusterID).Return(nil).Times(1)
+			mockk8sclient.EXPECT().ListEtcdMembers().Return([]k8s_client.EtcdMember{
+				{Name: "etcd-master-0", Healthy: true},
+				{Name: "etcd-master-1", Healthy: false},
+				{Name: "etcd-master-2", Healthy: true},
+			}, nil).MinTimes(1)
+			mockk8sclient.EXPECT().UnPatchEtcd().Times(0)
+			mockk8sclient.EXPECT().GetPods("openshift-console", gomock.Any()).
+				Return([]v1.Pod{readyPod()}, nil).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false,
+				"unpatch_etcd: timed out after 300ms: etcd has 2/3 healthy members, not healthy: etcd-master-1").
+				Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		clusterOperator := func(name string, available configv1.ConditionStatus, degraded configv1.ConditionStatus) configv1.ClusterOperator {
+			operator := configv1.ClusterOperator{}
+			operator.Name = name
+			operator.Status.Conditions = []configv1.ClusterOperatorStatusCondition{
+				{Type: configv1.OperatorAvailable, Status: available},
+				{Type: configv1.OperatorDegraded, Status: degraded, Message: name + " is broken"},
+			}
+			return operator
+		}
+		It("notReadyClusterOperators reports missing, unavailable and degraded operators", func() {
+			operators := &configv1.ClusterOperatorList{Items: []configv1.ClusterOperator{
+				clusterOperator("console", configv1.ConditionTrue, configv1.ConditionFalse),
+				clusterOperator("dns", configv1.ConditionFalse, configv1.ConditionFalse),
+				clusterOperator("ingress", configv1.ConditionTrue, configv1.ConditionTrue),
+				clusterOperator("network", configv1.ConditionFalse, configv1.ConditionTrue),
+				{ObjectMeta: metav1.ObjectMeta{Name: "etcd"}},
+				clusterOperator("not-expected", configv1.ConditionFalse, configv1.ConditionTrue),
+			}}
+			Expect(notReadyClusterOperators(operators, []string{"console", "dns", "ingress", "network", "etcd", "authentication"})).
+				To(Equal([]string{
+					"dns is not available",
+					"ingress is degraded: ingress is broken",
+					"network is degraded: network is broken",
+					"etcd is not available",
+					"authentication is missing",
+				}))
+		})
+		It("waitForClusterOperators waits till the operators are available and not degraded", func() {
+			c.ClusterOperators = []string{"console", "ingress"}
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListClusterOperators().Return(nil, fmt.Errorf("dummy")).Times(1),
+				mockk8sclient.EXPECT().ListClusterOperators().Return(&configv1.ClusterOperatorList{Items: []configv1.ClusterOperator{
+					clusterOperator("console", configv1.ConditionTrue, configv1.ConditionFalse),
+					clusterOperator("ingress", configv1.ConditionTrue, configv1.ConditionTrue),
+				}}, nil).Times(1),
+				mockk8sclient.EXPECT().ListClusterOperators().Return(&configv1.ClusterOperatorList{Items: []configv1.ClusterOperator{
+					clusterOperator("console", configv1.ConditionTrue, configv1.ConditionFalse),
+					clusterOperator("ingress", configv1.ConditionTrue, configv1.ConditionFalse),
+				}}, nil).Times(1),
+			)
+			status := &clusterOperatorsStatus{}
+			Expect(c.waitForClusterOperators(context.Background(), status)).To(Succeed())
+			Expect(status.String()).To(BeEmpty())
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Reason).To(Equal(eventReasonClusterOperatorsAvailable))
+		})
+		It("PostInstallConfigs reports the cluster operators that are not ready after timeout", func() {
+			c.ClusterOperators = []string{"console", "ingress"}
+			c.ClusterOperatorsTimeout = 300 * time.Millisecond
+			finalizing := models.ClusterStatusFinalizing
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &finalizing}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "CA", c.ClusterID).Return(nil).Times(1)
+			mockk8sclient.EXPECT().UnPatchEtcd().Return(k8s_client.EtcdUnpatched, nil).Times(1)
+			mockk8sclient.EXPECT().GetPods("openshift-console", gomock.Any()).
+				Return([]v1.Pod{readyPod()}, nil).Times(1)
+			mockk8sclient.EXPECT().ListClusterOperators().Return(&configv1.ClusterOperatorList{Items: []configv1.ClusterOperator{
+				clusterOperator("console", configv1.ConditionTrue, configv1.ConditionTrue),
+			}}, nil).MinTimes(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false,
+				"wait_for_cluster_operators: timed out after 300ms: console is degraded: console is broken; ingress is missing").
+				Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		progressingOperator := func(name string) configv1.ClusterOperator {
+			operator := clusterOperator(name, configv1.ConditionTrue, configv1.ConditionFalse)
+			operator.Status.Conditions = append(operator.Status.Conditions, configv1.ClusterOperatorStatusCondition{
+				Type: configv1.OperatorProgressing, Status: configv1.ConditionTrue, Message: name + " is rolling out"})
+			return operator
+		}
+		It("unsettledClusterOperators reports unavailable, degraded and progressing operators", func() {
+			operators := &configv1.ClusterOperatorList{Items: []configv1.ClusterOperator{
+				clusterOperator("console", configv1.ConditionTrue, configv1.ConditionFalse),
+				clusterOperator("dns", configv1.ConditionFalse, configv1.ConditionFalse),
+				clusterOperator("ingress", configv1.ConditionTrue, configv1.ConditionTrue),
+				progressingOperator("network"),
+			}}
+			Expect(unsettledClusterOperators(operators)).To(Equal([]string{
+				"dns is not available",
+				"ingress is degraded: ingress is broken",
+				"network is progressing: network is rolling out",
+			}))
+		})
+		It("waitForAllClusterOperators waits till all the operators settle", func() {
+			c.AllClusterOperatorsTimeout = time.Minute
+			c.waitInterval = testWaitInterval
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListClusterOperators().Return(nil, fmt.Errorf("dummy")).Times(1),
+				mockk8sclient.EXPECT().ListClusterOperators().Return(&configv1.ClusterOperatorList{Items: []configv1.ClusterOperator{
+					clusterOperator("console", configv1.ConditionTrue, configv1.ConditionFalse),
+					progressingOperator("network"),
+				}}, nil).Times(1),
+				mockk8sclient.EXPECT().ListClusterOperators().Return(&configv1.ClusterOperatorList{Items: []configv1.ClusterOperator{
+					clusterOperator("console", configv1.ConditionTrue, configv1.ConditionFalse),
+					clusterOperator("network", configv1.ConditionTrue, configv1.ConditionFalse),
+				}}, nil).Times(1),
+			)
+			Expect(c.waitForAllClusterOperators(context.Background())).To(BeEmpty())
+		})
+		It("PostInstallConfigs completes successfully with the operators that didn't settle after timeout", func() {
+			c.AllClusterOperatorsTimeout = 300 * time.Millisecond
+			finalizing := models.ClusterStatusFinalizing
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &finalizing}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").
+				Return(&v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "CA", c.ClusterID).Return(nil).Times(1)
+			mockk8sclient.EXPECT().UnPatchEtcd().Return(k8s_client.EtcdUnpatched, nil).Times(1)
+			mockk8sclient.EXPECT().GetPods("openshift-console", gomock.Any()).
+				Return([]v1.Pod{readyPod()}, nil).Times(1)
+			mockk8sclient.EXPECT().ListClusterOperators().Return(&configv1.ClusterOperatorList{Items: []configv1.ClusterOperator{
+				clusterOperator("console", configv1.ConditionTrue, configv1.ConditionFalse),
+				clusterOperator("ingress", configv1.ConditionTrue, configv1.ConditionTrue),
+				progressingOperator("network"),
+			}}, nil).MinTimes(2)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true,
+				"cluster operators didn't settle after 300ms: ingress is degraded: ingress is broken; network is progressing: network is rolling out").
+				Return(nil).Times(1)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		It("watchIngressCA uploads only changed ca bundle", func() {
+			c.IngressCARotationWindow = 3500 * time.Millisecond
+			cm := v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "CA"}}
+			rotatedCm := v1.ConfigMap{Data: map[string]string{"ca-bundle.crt": "ROTATED"}}
+			gomock.InOrder(
+				mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").Return(&cm, nil).Times(1),
+				mockk8sclient.EXPECT().GetConfigMap("openshift-config-managed", "default-ingress-cert").Return(&rotatedCm, nil).MinTimes(2),
+			)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "ROTATED", c.ClusterID).Return(nil).Times(1)
+			wg.Add(1)
+			c.watchIngressCA(context.Background(), &wg, hashCaBundle("CA"))
+		})
+		It("PostInstallConfigs returns when cluster doesn't exist", func() {
+			notFound := &inventory_client.InventoryError{StatusCode: http.StatusNotFound, Err: fmt.Errorf("dummy")}
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(nil, notFound).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap(gomock.Any(), gomock.Any()).Times(0)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		It("PostInstallConfigs returns when cluster is already installed", func() {
+			installed := models.ClusterStatusInstalled
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &installed}, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap(gomock.Any(), gomock.Any()).Times(0)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			mockk8sclient.EXPECT().UnPatchEtcd().Times(0)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			wg.Add(1)
+			c.PostInstallConfigs(context.Background(), &wg)
+		})
+		It("unpatchEtcd skips already unpatched etcd", func() {
+			mockk8sclient.EXPECT().UnPatchEtcd().Return(k8s_client.EtcdAlreadyUnpatched, nil).Times(1)
+			Expect(c.unpatchEtcd(context.Background())).To(Succeed())
+			Expect(events).To(BeEmpty())
+		})
+		It("unpatchEtcd records event when etcd was unpatched", func() {
+			mockk8sclient.EXPECT().UnPatchEtcd().Return(k8s_client.EtcdUnpatched, nil).Times(1)
+			Expect(c.unpatchEtcd(context.Background())).To(Succeed())
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Reason).To(Equal(eventReasonEtcdUnpatched))
+		})
+		It("unpatchEtcd doesn't retry permanent errors", func() {
+			mockk8sclient.EXPECT().UnPatchEtcd().Return(k8s_client.EtcdUnpatchPermanentError, fmt.Errorf("forbidden")).Times(1)
+			Expect(c.unpatchEtcd(context.Background())).To(MatchError(ContainSubstring("forbidden")))
+		})
+		It("unpatchEtcd gives up on transient errors after max attempts", func() {
+			c.waitInterval = 10 * time.Millisecond
+			mockk8sclient.EXPECT().UnPatchEtcd().Return(k8s_client.EtcdUnpatchTransientError, fmt.Errorf("dummy")).
+				Times(unpatchEtcdMaxAttempts)
+			Expect(c.unpatchEtcd(context.Background())).To(MatchError(ContainSubstring(fmt.Sprintf("after %d attempts", unpatchEtcdMaxAttempts))))
+		})
+		It("Run PostInstallConfigs", func() {
+			cmName := "default-ingress-cert"
+			cmNamespace := "openshift-config-managed"
+			consoleNamespace := "openshift-console"
+			data := make(map[string]string)
+			data["ca-bundle.crt"] = "CA"
+			cm := v1.ConfigMap{Data: data}
+			finalizing := models.ClusterStatusFinalizing
+			installing := models.ClusterStatusInstalling
+			cluster := models.Cluster{Status: &finalizing}
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(nil, fmt.Errorf("dummy")).Times(1)
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&models.Cluster{Status: &installing}, nil).Times(1)
+			mockbmclient.EXPECT().GetCluster(gomock.Any()).Return(&cluster, nil).Times(1)
+			mockk8sclient.EXPECT().GetConfigMap(cmNamespace, cmName).Return(&cm, nil).Times(1)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), data["ca-bundle.crt"], c.ClusterID).Return(nil).Times(1)
+			mockk8sclient.EXPECT().UnPatchEtcd().Return(k8s_client.EtcdUnpatchTransientError, fmt.Errorf("dummy")).Times(1)
+			mockk8sclient.EXPECT().UnPatchEtcd().Return(k8s_client.EtcdUnpatched, nil).Times(1)
+			mockk8sclient.EXPECT().GetPods(consoleNamespace, gomock.Any()).Return(nil, fmt.Errorf("dummy")).Times(1)
+			mockk8sclient.EXPECT().GetPods(consoleNamespace, gomock.Any()).Return([]v1.Pod{{Status: v1.PodStatus{Phase: "Pending"}}}, nil).Times(1)
+			mockk8sclient.EXPECT().GetPods(consoleNamespace, gomock.Any()).Return([]v1.Pod{readyPod()}, nil).Times(1)
+			unavailable := &inventory_client.InventoryError{StatusCode: http.StatusServiceUnavailable, Err: fmt.Errorf("dummy")}
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(unavailable).Times(1)
+			mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+
+			wg.Add(1)
+			go c.PostInstallConfigs(context.Background(), &wg)
+			wg.Wait()
+
+			metricFamilies, err := c.metrics.registry.Gather()
+			Expect(err).NotTo(HaveOccurred())
+			stages := map[string]uint64{}
+			for _, mf := range metricFamilies {
+				if mf.GetName() != "assisted_controller_post_install_stage_duration_seconds" {
+					continue
+				}
+				for _, m := range mf.GetMetric() {
+					stages[m.GetLabel()[0].GetValue()] = m.GetHistogram().GetSampleCount()
+				}
+			}
+			Expect(stages).To(Equal(map[string]uint64{"add_router_ca": 1, "unpatch_etcd": 1, "wait_for_console": 1, "readiness_checks": 1}))
+		})
+		It("measures the post install stages with the controller clock", func() {
+			fakeClock := clock.NewFakeClock(time.Now())
+			c.clock = fakeClock
+			Expect(c.runPostInstallStage(context.Background(), "add_router_ca", 0, func(ctx context.Context) error {
+				fakeClock.Step(90 * time.Second)
+				return nil
+			})).To(Succeed())
+			metricFamilies, err := c.metrics.registry.Gather()
+			Expect(err).NotTo(HaveOccurred())
+			var durations []float64
+			for _, mf := range metricFamilies {
+				if mf.GetName() != "assisted_controller_post_install_stage_duration_seconds" {
+					continue
+				}
+				for _, m := range mf.GetMetric() {
+					durations = append(durations, m.GetHistogram().GetSampleSum())
+				}
+			}
+			Expect(durations).To(Equal([]float64{90}))
+		})
+		It("registers the build info metric", func() {
+			metricFamilies, err := c.metrics.registry.Gather()
+			Expect(err).NotTo(HaveOccurred())
+			labels := map[string]string{}
+			for _, mf := range metricFamilies {
+				if mf.GetName() != "assisted_controller_build_info" {
+					continue
+				}
+				Expect(mf.GetMetric()).To(HaveLen(1))
+				Expect(mf.GetMetric()[0].GetGauge().GetValue()).To(Equal(float64(1)))
+				for _, label := range mf.GetMetric()[0].GetLabel() {
+					labels[label.GetName()] = label.GetValue()
+				}
+			}
+			Expect(labels).To(Equal(map[string]string{"version": version.Version, "commit": version.GitCommit,
+				"build_date": version.BuildDate}))
+		})
+	})
+
+	Context("uncordon nodes", func() {
+		conf := ControllerConfig{
+			ClusterID:     "cluster-id",
+			URL:           "https://assisted-service.com:80",
+			UncordonNodes: true,
+		}
+		cordonedNode := func(name string, annotations map[string]string) v1.Node {
+			return v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations},
+				Spec: v1.NodeSpec{Unschedulable: true}}
+		}
+		BeforeEach(func() {
+			c = newTestController(l, conf, mockops, mockbmclient, mockk8sclient)
+		})
+		It("uncordons the cordoned nodes only", func() {
+			schedulable := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+			mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{Items: []v1.Node{cordonedNode("node0", nil),
+				schedulable, cordonedNode("node2", nil)}}, nil).Times(1)
+			mockk8sclient.EXPECT().UncordonNode("node0").Return(nil).Times(1)
+			mockk8sclient.EXPECT().UncordonNode("node2").Return(nil).Times(1)
+			Expect(c.uncordonNodes(context.Background())).To(Succeed())
+		})
+		It("doesn't uncordon nodes the machine config daemon is updating", func() {
+			mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{Items: []v1.Node{
+				cordonedNode("node0", map[string]string{machineConfigStateAnnotation: machineConfigStateWorking})}}, nil).Times(1)
+			Expect(c.uncordonNodes(context.Background())).To(Succeed())
+		})
+		It("keeps the nodes of errored hosts cordoned", func() {
+			c.CordonErroredNodes = true
+			errored := models.HostStatusError
+			installed := models.HostStatusInstalled
+			mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{Items: []v1.Node{cordonedNode("node0", nil),
+				cordonedNode("node1", nil)}}, nil).Times(1)
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any()).Return(map[string]inventory_client.HostData{
+				"node0": {Host: &models.Host{Status: &errored}},
+				"node1": {Host: &models.Host{Status: &installed}},
+			}, nil).Times(1)
+			mockk8sclient.EXPECT().UncordonNode("node1").Return(nil).Times(1)
+			Expect(c.uncordonNodes(context.Background())).To(Succeed())
+		})
+		It("attempts all the nodes and returns the ones that failed", func() {
+			mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{Items: []v1.Node{cordonedNode("node0", nil),
+				cordonedNode("node1", nil)}}, nil).Times(1)
+			mockk8sclient.EXPECT().UncordonNode("node0").Return(fmt.Errorf("dummy")).Times(1)
+			mockk8sclient.EXPECT().UncordonNode("node1").Return(nil).Times(1)
+			Expect(c.uncordonNodes(context.Background())).To(MatchError("failed to uncordon nodes node0"))
+		})
+		It("fails when the nodes can't be listed", func() {
+			mockk8sclient.EXPECT().ListNodes().Return(nil, fmt.Errorf("dummy")).Times(1)
+			Expect(c.uncordonNodes(context.Background())).To(MatchError(ContainSubstring("Failed to list nodes")))
+		})
+		It("doesn't uncordon on dry run", func() {
+			c.DryRun = true
+			mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{Items: []v1.Node{cordonedNode("node0", nil)}}, nil).Times(1)
+			Expect(c.uncordonNodes(context.Background())).To(Succeed())
+		})
+	})
+
+})
+
+// testWaitInterval keeps the loops of the controllers under test short
+const testWaitInterval = 100 * time.Millisecond
+
+func newTestController(log *logrus.Logger, cfg ControllerConfig, ops ops.Ops, ic inventory_client.InventoryClient,
+	kc k8s_client.K8SClient) *controller {
+	if cfg.WaitInterval == 0 {
+		cfg.WaitInterval = testWaitInterval
+	}
+	return NewController(log, cfg, ops, ic, kc)
+}
+
+// readyPod is a running pod whose containers are all ready
+func readyPod() v1.Pod {
+	return v1.Pod{Status: v1.PodStatus{Phase: v1.PodRunning,
+		ContainerStatuses: []v1.ContainerStatus{{Name: "container", Ready: true}}}}
+}
+
+func createCsrPem(commonName string, organization []string, dnsNames []string, ips []net.IP) []byte {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: commonName, Organization: organization},
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+	}
+	der, _ := x509.CreateCertificateRequest(rand.Reader, &template, key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+// serviceEvent is a recorded AddEvent call
+type serviceEvent struct {
+	clusterId string
+	hostId    string
+	severity  string
+	message   string
+}
 
 func GetKubeNodes(kubeNamesIds map[string]string) *v1.NodeList {
 	file, _ := ioutil.ReadFile("../../test_files/node.json")
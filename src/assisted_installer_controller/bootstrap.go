@@ -0,0 +1,69 @@
+package assisted_installer_controller
+
+import (
+	"strings"
+
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	v1 "k8s.io/api/core/v1"
+)
+
+// bootstrapTracker follows the bootstrap host while it pivots to a master, its node may appear
+// under another name than the inventory hostname and may leave the cluster and rejoin during the pivot
+type bootstrapTracker struct {
+	hostName string
+	joined   bool
+	done     bool
+}
+
+// isBootstrapHost identifies the bootstrap host by BootstrapHostname and otherwise by its inventory role
+func (c controller) isBootstrapHost(name string, host inventory_client.HostData) bool {
+	if c.BootstrapHostname != "" {
+		return strings.EqualFold(name, c.BootstrapHostname)
+	}
+	return host.Host != nil && host.Host.Bootstrap
+}
+
+// trackBootstrapNode logs the transitions of the pending bootstrap host and returns the name of the node it
+// joined as, the node is matched by the host name and otherwise by the host system uuid
+func (c controller) trackBootstrapNode(tracker *bootstrapTracker, hosts map[string]inventory_client.HostData,
+	nodes *v1.NodeList) (string, inventory_client.HostData, string) {
+	for name, host := range hosts {
+		if !c.isBootstrapHost(name, host) {
+			continue
+		}
+		if tracker.hostName == "" {
+			tracker.hostName = name
+			c.log.Infof("Host %s with inventory id %s is the bootstrap host, waiting for it to join as a master",
+				name, host.Host.ID.String())
+		}
+		nodeName := findBootstrapNode(name, host, nodes)
+		switch {
+		case nodeName != "" && !tracker.joined:
+			c.log.Infof("Bootstrap host %s joined the cluster as master node %s", name, nodeName)
+			tracker.joined = true
+		case nodeName == "" && tracker.joined:
+			c.log.Warnf("Bootstrap host %s left the cluster during pivot, waiting for it to rejoin as a master", name)
+			tracker.joined = false
+		}
+		return name, host, nodeName
+	}
+	if tracker.hostName != "" && !tracker.done {
+		tracker.done = true
+		c.log.Infof("Bootstrap host %s is done", tracker.hostName)
+	}
+	return "", inventory_client.HostData{}, ""
+}
+
+func findBootstrapNode(name string, host inventory_client.HostData, nodes *v1.NodeList) string {
+	for _, node := range nodes.Items {
+		if node.Name == name {
+			return node.Name
+		}
+	}
+	for _, node := range nodes.Items {
+		if host.Host.ID != nil && strings.EqualFold(host.Host.ID.String(), node.Status.NodeInfo.SystemUUID) {
+			return node.Name
+		}
+	}
+	return ""
+}
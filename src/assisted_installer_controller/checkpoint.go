@@ -0,0 +1,178 @@
+package assisted_installer_controller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ProgressState is the controller progress that is checkpointed to CheckpointPath,
+// so a restarted controller resumes without repeating the work that was already done
+type ProgressState struct {
+	DoneHosts             []string    `json:"doneHosts,omitempty"`
+	UpdatedBMHs           []types.UID `json:"updatedBMHs,omitempty"`
+	PostInstallStagesDone []string    `json:"postInstallStagesDone,omitempty"`
+	IngressCAHash         string      `json:"ingressCAHash,omitempty"`
+	ExpectedNodes         int         `json:"expectedNodes,omitempty"`
+}
+
+func (s *ProgressState) isHostDone(hostId string) bool {
+	return containsString(s.DoneHosts, hostId)
+}
+
+func (s *ProgressState) isStageDone(stage string) bool {
+	return containsString(s.PostInstallStagesDone, stage)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// loadProgressState reads the checkpoint, a missing checkpoint is an empty state
+func loadProgressState(path string) (ProgressState, error) {
+	var state ProgressState
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, errors.Wrapf(err, "failed to read checkpoint %s", path)
+	}
+	if err = json.Unmarshal(data, &state); err != nil {
+		return ProgressState{}, errors.Wrapf(err, "failed to decode checkpoint %s", path)
+	}
+	return state, nil
+}
+
+// saveProgressState writes the checkpoint through a temporary file, so a restart while writing
+// doesn't leave a partial checkpoint behind
+func saveProgressState(path string, state ProgressState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode checkpoint")
+	}
+	tmpPath := path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return errors.Wrapf(err, "failed to write checkpoint %s", tmpPath)
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return errors.Wrapf(err, "failed to rename checkpoint %s", tmpPath)
+	}
+	return nil
+}
+
+// checkpointTracker holds the progress state that is updated by the controller go routines,
+// it is saved on every change when a checkpoint path is configured
+type checkpointTracker struct {
+	sync.Mutex
+	path  string
+	state ProgressState
+}
+
+func newCheckpointTracker(path string, state ProgressState) *checkpointTracker {
+	return &checkpointTracker{path: path, state: state}
+}
+
+// snapshot returns a copy of the current state
+func (t *checkpointTracker) snapshot() ProgressState {
+	t.Lock()
+	defer t.Unlock()
+	state := t.state
+	state.DoneHosts = append([]string(nil), t.state.DoneHosts...)
+	state.UpdatedBMHs = append([]types.UID(nil), t.state.UpdatedBMHs...)
+	state.PostInstallStagesDone = append([]string(nil), t.state.PostInstallStagesDone...)
+	return state
+}
+
+// update applies fn to the state and saves it in case fn reports a change
+func (t *checkpointTracker) update(fn func(state *ProgressState) bool) error {
+	t.Lock()
+	defer t.Unlock()
+	if !fn(&t.state) || t.path == "" {
+		return nil
+	}
+	return saveProgressState(t.path, t.state)
+}
+
+// loadCheckpoint returns the state to resume from, failing to load the checkpoint only means starting over
+func (c *controller) loadCheckpoint() ProgressState {
+	if c.CheckpointPath == "" {
+		return ProgressState{}
+	}
+	state, err := loadProgressState(c.CheckpointPath)
+	if err != nil {
+		c.log.WithError(err).Warnf("Failed to load checkpoint, starting over")
+		return ProgressState{}
+	}
+	c.log.Infof("Resuming from checkpoint %s: %d done hosts, %d updated BMHs, post install stages done %v",
+		c.CheckpointPath, len(state.DoneHosts), len(state.UpdatedBMHs), state.PostInstallStagesDone)
+	return state
+}
+
+// checkpointProgress updates the checkpoint, failures are only logged as the checkpoint is an optimization
+func (c controller) checkpointProgress(fn func(state *ProgressState) bool) {
+	if err := c.checkpoint.update(fn); err != nil {
+		c.log.WithError(err).Warnf("Failed to save checkpoint")
+	}
+}
+
+func (c controller) checkpointHostDone(hostId string) {
+	c.checkpointProgress(func(state *ProgressState) bool {
+		if state.isHostDone(hostId) {
+			return false
+		}
+		state.DoneHosts = append(state.DoneHosts, hostId)
+		return true
+	})
+}
+
+func (c controller) checkpointBMHUpdated(uid types.UID) {
+	c.checkpointProgress(func(state *ProgressState) bool {
+		for _, updated := range state.UpdatedBMHs {
+			if updated == uid {
+				return false
+			}
+		}
+		state.UpdatedBMHs = append(state.UpdatedBMHs, uid)
+		return true
+	})
+}
+
+func (c controller) checkpointStageDone(stage string) {
+	c.checkpointProgress(func(state *ProgressState) bool {
+		if state.isStageDone(stage) {
+			return false
+		}
+		state.PostInstallStagesDone = append(state.PostInstallStagesDone, stage)
+		return true
+	})
+}
+
+func (c controller) checkpointExpectedNodes(expectedNodes int) {
+	c.checkpointProgress(func(state *ProgressState) bool {
+		if expectedNodes <= state.ExpectedNodes {
+			return false
+		}
+		state.ExpectedNodes = expectedNodes
+		return true
+	})
+}
+
+func (c controller) checkpointIngressCAHash(hash string) {
+	c.checkpointProgress(func(state *ProgressState) bool {
+		if state.IngressCAHash == hash {
+			return false
+		}
+		state.IngressCAHash = hash
+		return true
+	})
+}
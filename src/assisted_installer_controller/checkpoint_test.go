@@ -0,0 +1,75 @@
+package assisted_installer_controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("progress checkpoint", func() {
+	var (
+		tmpDir string
+		path   string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "controller-checkpoint")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(tmpDir, "checkpoint.json")
+	})
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("saves and loads the progress state", func() {
+		state := ProgressState{
+			DoneHosts:             []string{"7916fa89-ea7a-443e-a862-b3e930309f65"},
+			UpdatedBMHs:           []types.UID{"bmh-uid"},
+			PostInstallStagesDone: []string{"add_router_ca", "unpatch_etcd"},
+			IngressCAHash:         "hash",
+			ExpectedNodes:         3,
+		}
+		Expect(saveProgressState(path, state)).To(Succeed())
+		loaded, err := loadProgressState(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(Equal(state))
+		_, err = os.Stat(path + ".tmp")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+	It("loads an empty state when there is no checkpoint", func() {
+		loaded, err := loadProgressState(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(Equal(ProgressState{}))
+	})
+	It("fails to load a corrupted checkpoint", func() {
+		Expect(ioutil.WriteFile(path, []byte("{not json"), 0600)).To(Succeed())
+		_, err := loadProgressState(path)
+		Expect(err).To(HaveOccurred())
+	})
+	It("saves only changes", func() {
+		tracker := newCheckpointTracker(path, ProgressState{})
+		Expect(tracker.update(func(state *ProgressState) bool { return false })).To(Succeed())
+		_, err := os.Stat(path)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		Expect(tracker.update(func(state *ProgressState) bool {
+			state.ExpectedNodes = 3
+			return true
+		})).To(Succeed())
+		loaded, err := loadProgressState(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.ExpectedNodes).To(Equal(3))
+	})
+	It("keeps the state in memory without a checkpoint path", func() {
+		tracker := newCheckpointTracker("", ProgressState{})
+		Expect(tracker.update(func(state *ProgressState) bool {
+			state.DoneHosts = append(state.DoneHosts, "host")
+			return true
+		})).To(Succeed())
+		Expect(tracker.snapshot().isHostDone("host")).To(BeTrue())
+	})
+})
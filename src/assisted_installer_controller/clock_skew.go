@@ -0,0 +1,60 @@
+package assisted_installer_controller
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// nodeClockSkew returns the difference between now and the heartbeat of the node ready condition, which the
+// kubelet stamps with the node clock, and false if the node isn't ready. The heartbeat lags the node clock by
+// up to the node status update interval, so only a skew well above it points to skewed clocks. A node that
+// stopped heartbeating, e.g. while rebooting, is marked not ready or unknown, so its stale heartbeat is ignored
+func nodeClockSkew(now time.Time, node *v1.Node) (time.Duration, bool) {
+	var latest time.Time
+	for _, condition := range node.Status.Conditions {
+		if condition.Type != v1.NodeReady || condition.Status != v1.ConditionTrue {
+			continue
+		}
+		if condition.LastHeartbeatTime.Time.After(latest) {
+			latest = condition.LastHeartbeatTime.Time
+		}
+	}
+	if latest.IsZero() {
+		return 0, false
+	}
+	skew := now.Sub(latest)
+	if skew < 0 {
+		skew = -skew
+	}
+	return skew, true
+}
+
+// maxNodeClockSkew returns the largest clock skew between now and the nodes and the name of its node,
+// nodes that aren't ready are ignored
+func maxNodeClockSkew(now time.Time, nodes []v1.Node) (time.Duration, string) {
+	var maxSkew time.Duration
+	var maxNode string
+	for i := range nodes {
+		skew, ok := nodeClockSkew(now, &nodes[i])
+		if ok && (maxNode == "" || skew > maxSkew) {
+			maxSkew, maxNode = skew, nodes[i].Name
+		}
+	}
+	return maxSkew, maxNode
+}
+
+// checkClockSkew warns once when the clock of a node is skewed from the controller clock by more than
+// ClockSkewThreshold, skewed clocks break the stage timestamps and the certificates validity
+func (c *controller) checkClockSkew(nodes []v1.Node) {
+	if c.ClockSkewThreshold <= 0 || c.clockSkewReported {
+		return
+	}
+	skew, node := maxNodeClockSkew(c.clock.Now(), nodes)
+	if node == "" || skew <= c.ClockSkewThreshold {
+		return
+	}
+	c.clockSkewReported = true
+	c.log.Warnf("The clock of node %s is skewed by %s from the controller clock, more than %s, "+
+		"check the time synchronization of the hosts", node, skew.Round(time.Second), c.ClockSkewThreshold)
+}
@@ -0,0 +1,92 @@
+package assisted_installer_controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+var _ = Describe("nodes clock skew", func() {
+	now := time.Now()
+	heartbeatNode := func(name string, heartbeats ...time.Time) v1.Node {
+		node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		for _, heartbeat := range heartbeats {
+			node.Status.Conditions = append(node.Status.Conditions,
+				v1.NodeCondition{Type: v1.NodeReady, Status: v1.ConditionTrue, LastHeartbeatTime: metav1.NewTime(heartbeat)})
+		}
+		return node
+	}
+
+	It("computes the max skew across the nodes", func() {
+		nodes := []v1.Node{
+			heartbeatNode("node0", now.Add(-30*time.Second)),
+			heartbeatNode("node1", now.Add(-2*time.Hour), now.Add(20*time.Minute)),
+			heartbeatNode("node2", now.Add(-5*time.Minute)),
+			heartbeatNode("node3"),
+		}
+		skew, node := maxNodeClockSkew(now, nodes)
+		Expect(node).To(Equal("node1"))
+		Expect(skew).To(Equal(20 * time.Minute))
+	})
+	It("ignores nodes without a heartbeat", func() {
+		skew, node := maxNodeClockSkew(now, []v1.Node{heartbeatNode("node0")})
+		Expect(node).To(BeEmpty())
+		Expect(skew).To(BeZero())
+	})
+
+	Context("checkClockSkew", func() {
+		var (
+			hook *logrustest.Hook
+			c    *controller
+		)
+		BeforeEach(func() {
+			logger, h := logrustest.NewNullLogger()
+			hook = h
+			c = &controller{ControllerConfig: ControllerConfig{ClockSkewThreshold: 10 * time.Minute},
+				log: logrus.NewEntry(logger), clock: clock.NewFakeClock(now)}
+		})
+
+		It("warns once about a node whose clock is behind", func() {
+			nodes := []v1.Node{heartbeatNode("node0", now), heartbeatNode("node1", now.Add(-time.Hour))}
+			c.checkClockSkew(nodes)
+			c.checkClockSkew(nodes)
+			Expect(hook.AllEntries()).To(HaveLen(1))
+			Expect(hook.LastEntry().Level).To(Equal(logrus.WarnLevel))
+			Expect(hook.LastEntry().Message).To(ContainSubstring("The clock of node node1 is skewed by 1h0m0s"))
+		})
+		It("warns about a node whose clock is ahead", func() {
+			c.checkClockSkew([]v1.Node{heartbeatNode("node0", now.Add(15*time.Minute))})
+			Expect(hook.AllEntries()).To(HaveLen(1))
+			Expect(hook.LastEntry().Message).To(ContainSubstring("node node0 is skewed by 15m0s"))
+		})
+		It("doesn't warn within the threshold", func() {
+			c.checkClockSkew([]v1.Node{heartbeatNode("node0", now.Add(-5*time.Minute)), heartbeatNode("node1", now.Add(time.Minute))})
+			Expect(hook.AllEntries()).To(BeEmpty())
+		})
+		It("doesn't warn about a node that isn't ready and stopped heartbeating", func() {
+			notReady := heartbeatNode("node0", now.Add(-time.Hour))
+			notReady.Status.Conditions[0].Status = v1.ConditionFalse
+			unknown := heartbeatNode("node1", now.Add(-time.Hour))
+			unknown.Status.Conditions[0].Status = v1.ConditionUnknown
+			c.checkClockSkew([]v1.Node{notReady, unknown, heartbeatNode("node2", now)})
+			Expect(hook.AllEntries()).To(BeEmpty())
+			Expect(c.clockSkewReported).To(BeFalse())
+
+			// a skew found once the node is ready again is still reported
+			c.checkClockSkew([]v1.Node{heartbeatNode("node0", now.Add(-time.Hour))})
+			Expect(hook.AllEntries()).To(HaveLen(1))
+			Expect(hook.LastEntry().Message).To(ContainSubstring("The clock of node node0 is skewed by 1h0m0s"))
+		})
+		It("doesn't warn without a threshold", func() {
+			c.ClockSkewThreshold = 0
+			c.checkClockSkew([]v1.Node{heartbeatNode("node0", now.Add(-time.Hour))})
+			Expect(hook.AllEntries()).To(BeEmpty())
+		})
+	})
+})
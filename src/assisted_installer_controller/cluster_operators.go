@@ -0,0 +1,152 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	configv1 "github.com/openshift/api/config/v1"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+)
+
+// clusterOperatorsStatus keeps the operators that were not ready on the last poll,
+// so they are reported even if the stage is abandoned on timeout
+type clusterOperatorsStatus struct {
+	sync.Mutex
+	notReady []string
+}
+
+func (s *clusterOperatorsStatus) set(notReady []string) {
+	s.Lock()
+	defer s.Unlock()
+	s.notReady = notReady
+}
+
+func (s *clusterOperatorsStatus) String() string {
+	s.Lock()
+	defer s.Unlock()
+	return strings.Join(s.notReady, "; ")
+}
+
+// waitForClusterOperators waits till all the ClusterOperators are available and not degraded
+func (c controller) waitForClusterOperators(ctx context.Context, status *clusterOperatorsStatus) error {
+	c.log.Infof("Waiting for cluster operators %s to be available", strings.Join(c.ClusterOperators, ", "))
+	for {
+		operators, err := c.kc.ListClusterOperators()
+		if err != nil {
+			c.log.WithError(err).Warnf("Failed to list cluster operators")
+		} else {
+			notReady := notReadyClusterOperators(operators, c.ClusterOperators)
+			status.set(notReady)
+			if len(notReady) == 0 {
+				c.log.Infof("All cluster operators are available")
+				c.recordEvent(ctx, clusterObjectReference, v1.EventTypeNormal, eventReasonClusterOperatorsAvailable,
+					"All cluster operators are available")
+				return nil
+			}
+			c.log.Infof("Cluster operators are not ready: %s", strings.Join(notReady, "; "))
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "cluster operators are not ready")
+		case <-c.clock.After(c.pollInterval()):
+		}
+	}
+}
+
+// waitForAllClusterOperators waits up to AllClusterOperatorsTimeout for all the ClusterOperators to be available,
+// not progressing and not degraded. The operators that didn't settle by then are returned, they don't fail the
+// installation but are reported in the completion error info
+func (c controller) waitForAllClusterOperators(ctx context.Context) []string {
+	c.log.Infof("Waiting for all the cluster operators to be available and not progressing")
+	deadline := c.clock.Now().Add(c.AllClusterOperatorsTimeout)
+	var unsettled []string
+	var listErr error
+	for {
+		operators, err := c.kc.ListClusterOperators()
+		if err != nil {
+			c.log.WithError(err).Warnf("Failed to list cluster operators")
+			listErr = err
+		} else {
+			unsettled, listErr = unsettledClusterOperators(operators), nil
+			if len(unsettled) == 0 {
+				c.log.Infof("All the cluster operators are available and not progressing")
+				return nil
+			}
+			c.log.Infof("Cluster operators are not settled: %s", strings.Join(unsettled, "; "))
+		}
+		if c.clock.Now().After(deadline) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			c.log.WithError(ctx.Err()).Warnf("Stopped waiting for all the cluster operators")
+			return nil
+		case <-c.clock.After(c.pollInterval()):
+		}
+	}
+	if listErr != nil && len(unsettled) == 0 {
+		c.log.WithError(listErr).Warnf("Cluster operators couldn't be listed after %s", c.AllClusterOperatorsTimeout)
+		return []string{fmt.Sprintf("cluster operators couldn't be listed after %s: %s", c.AllClusterOperatorsTimeout, listErr)}
+	}
+	c.log.Warnf("Cluster operators didn't settle after %s: %s", c.AllClusterOperatorsTimeout, strings.Join(unsettled, "; "))
+	return []string{fmt.Sprintf("cluster operators didn't settle after %s: %s", c.AllClusterOperatorsTimeout,
+		strings.Join(unsettled, "; "))}
+}
+
+// unsettledClusterOperators describes the operators that are degraded, not available or progressing
+func unsettledClusterOperators(operators *configv1.ClusterOperatorList) []string {
+	var unsettled []string
+	for i := range operators.Items {
+		operator := &operators.Items[i]
+		available := clusterOperatorCondition(operator, configv1.OperatorAvailable)
+		degraded := clusterOperatorCondition(operator, configv1.OperatorDegraded)
+		progressing := clusterOperatorCondition(operator, configv1.OperatorProgressing)
+		switch {
+		case degraded != nil && degraded.Status == configv1.ConditionTrue:
+			unsettled = append(unsettled, fmt.Sprintf("%s is degraded: %s", operator.Name, degraded.Message))
+		case available == nil || available.Status != configv1.ConditionTrue:
+			unsettled = append(unsettled, fmt.Sprintf("%s is not available", operator.Name))
+		case progressing != nil && progressing.Status == configv1.ConditionTrue:
+			unsettled = append(unsettled, fmt.Sprintf("%s is progressing: %s", operator.Name, progressing.Message))
+		}
+	}
+	return unsettled
+}
+
+// notReadyClusterOperators describes the expected operators that are missing, not available or degraded
+func notReadyClusterOperators(operators *configv1.ClusterOperatorList, expected []string) []string {
+	byName := make(map[string]*configv1.ClusterOperator)
+	for i := range operators.Items {
+		byName[operators.Items[i].Name] = &operators.Items[i]
+	}
+	var notReady []string
+	for _, name := range expected {
+		operator, ok := byName[name]
+		if !ok {
+			notReady = append(notReady, fmt.Sprintf("%s is missing", name))
+			continue
+		}
+		available := clusterOperatorCondition(operator, configv1.OperatorAvailable)
+		degraded := clusterOperatorCondition(operator, configv1.OperatorDegraded)
+		switch {
+		case degraded != nil && degraded.Status == configv1.ConditionTrue:
+			notReady = append(notReady, fmt.Sprintf("%s is degraded: %s", name, degraded.Message))
+		case available == nil || available.Status != configv1.ConditionTrue:
+			notReady = append(notReady, fmt.Sprintf("%s is not available", name))
+		}
+	}
+	return notReady
+}
+
+func clusterOperatorCondition(operator *configv1.ClusterOperator,
+	conditionType configv1.ClusterStatusConditionType) *configv1.ClusterOperatorStatusCondition {
+	for i := range operator.Status.Conditions {
+		if operator.Status.Conditions[i].Type == conditionType {
+			return &operator.Status.Conditions[i]
+		}
+	}
+	return nil
+}
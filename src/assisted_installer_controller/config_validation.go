@@ -0,0 +1,247 @@
+package assisted_installer_controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/openshift/assisted-service/models"
+	"github.com/thoas/go-funk"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// knownPostInstallStages are the post install stages that NON_CRITICAL_POST_INSTALL_STAGES may contain
+var knownPostInstallStages = []string{"add_router_ca", "unpatch_etcd", "wait_for_console", "wait_for_cluster_operators",
+	"uncordon_nodes"}
+
+// knownHostStatuses are the host statuses of assisted-service that IGNORED_HOST_STATUSES may contain
+var knownHostStatuses = []string{
+	models.HostStatusDiscovering,
+	models.HostStatusKnown,
+	models.HostStatusDisconnected,
+	models.HostStatusInsufficient,
+	models.HostStatusDisabled,
+	models.HostStatusPreparingForInstallation,
+	models.HostStatusPendingForInput,
+	models.HostStatusInstalling,
+	models.HostStatusInstallingInProgress,
+	models.HostStatusInstallingPendingUserAction,
+	models.HostStatusResettingPendingUserAction,
+	models.HostStatusInstalled,
+	models.HostStatusError,
+	models.HostStatusResetting,
+	models.HostStatusCancelled,
+}
+
+// Validate checks the configuration semantics that envconfig can't verify
+func (cfg *ControllerConfig) Validate() error {
+	if !strfmt.IsUUID(cfg.ClusterID) {
+		return fmt.Errorf("CLUSTER_ID %q is not a valid UUID", cfg.ClusterID)
+	}
+	u, err := url.ParseRequestURI(cfg.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("INVENTORY_URL %q is not a valid URL, expected scheme://host[:port]", cfg.URL)
+	}
+	if cfg.CACertPath != "" {
+		if err := validateCACert("CA_CERT_PATH", cfg.CACertPath); err != nil {
+			return err
+		}
+	}
+	if (cfg.ClientCertPath == "") != (cfg.ClientKeyPath == "") {
+		return fmt.Errorf("CLIENT_CERT_PATH and CLIENT_KEY_PATH must be set together")
+	}
+	if cfg.ClientCertPath != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.ClientCertPath, cfg.ClientKeyPath); err != nil {
+			return fmt.Errorf("CLIENT_CERT_PATH %s and CLIENT_KEY_PATH %s can't be loaded: %s", cfg.ClientCertPath,
+				cfg.ClientKeyPath, err)
+		}
+	}
+	for _, path := range cfg.AdditionalCAPaths {
+		if err := validateCACert("ADDITIONAL_CA_PATHS", path); err != nil {
+			return err
+		}
+	}
+	if cfg.LogFormat != "" && cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return fmt.Errorf("LOG_FORMAT %q is not supported, expected text or json", cfg.LogFormat)
+	}
+	if cfg.InstallMode != "" && cfg.InstallMode != InstallModeFull && cfg.InstallMode != InstallModeAddHosts {
+		return fmt.Errorf("INSTALL_MODE %q is not supported, expected %s or %s", cfg.InstallMode, InstallModeFull, InstallModeAddHosts)
+	}
+	if cfg.PollJitterFactor < 0 || cfg.PollJitterFactor >= 1 {
+		return fmt.Errorf("POLL_JITTER_FACTOR %v must be in the range [0, 1)", cfg.PollJitterFactor)
+	}
+	if cfg.WaitInterval < 0 {
+		return fmt.Errorf("WAIT_INTERVAL %s must not be negative", cfg.WaitInterval)
+	}
+	for name, interval := range map[string]time.Duration{
+		"CSR_POLL_INTERVAL":          cfg.CSRPollInterval,
+		"NODE_STATUS_POLL_INTERVAL":  cfg.NodeStatusPollInterval,
+		"BMH_POLL_INTERVAL":          cfg.BMHPollInterval,
+		"POST_INSTALL_POLL_INTERVAL": cfg.PostInstallPollInterval,
+	} {
+		if interval < 0 {
+			return fmt.Errorf("%s %s must not be negative", name, interval)
+		}
+	}
+	if cfg.PreflightTimeout < 0 {
+		return fmt.Errorf("PREFLIGHT_TIMEOUT %s must not be negative", cfg.PreflightTimeout)
+	}
+	if cfg.InstallDeadline < 0 {
+		return fmt.Errorf("INSTALL_DEADLINE %s must not be negative", cfg.InstallDeadline)
+	}
+	if cfg.InventorySlowRequestThreshold < 0 {
+		return fmt.Errorf("INVENTORY_SLOW_REQUEST_THRESHOLD %s must not be negative", cfg.InventorySlowRequestThreshold)
+	}
+	if cfg.AllClusterOperatorsTimeout < 0 {
+		return fmt.Errorf("ALL_CLUSTER_OPERATORS_TIMEOUT %s must not be negative", cfg.AllClusterOperatorsTimeout)
+	}
+	if cfg.HostJoinTimeout < 0 {
+		return fmt.Errorf("HOST_JOIN_TIMEOUT %s must not be negative", cfg.HostJoinTimeout)
+	}
+	if cfg.FinalizingTimeout < 0 {
+		return fmt.Errorf("FINALIZING_TIMEOUT %s must not be negative", cfg.FinalizingTimeout)
+	}
+	if cfg.ClockSkewThreshold < 0 {
+		return fmt.Errorf("CLOCK_SKEW_THRESHOLD %s must not be negative", cfg.ClockSkewThreshold)
+	}
+	if cfg.CSRApprovalMinAge < 0 {
+		return fmt.Errorf("CSR_APPROVAL_MIN_AGE %s must not be negative", cfg.CSRApprovalMinAge)
+	}
+	if cfg.CsrApprovalConcurrency < 0 {
+		return fmt.Errorf("CSR_APPROVAL_CONCURRENCY %d must not be negative", cfg.CsrApprovalConcurrency)
+	}
+	if cfg.MinReadyMasters < 0 {
+		return fmt.Errorf("MIN_READY_MASTERS %d must not be negative", cfg.MinReadyMasters)
+	}
+	if cfg.BMHUpdateConcurrency < 0 {
+		return fmt.Errorf("BMH_UPDATE_CONCURRENCY %d must not be negative", cfg.BMHUpdateConcurrency)
+	}
+	if cfg.ExpectedNodeCount < 0 {
+		return fmt.Errorf("EXPECTED_NODE_COUNT %d must not be negative", cfg.ExpectedNodeCount)
+	}
+	if cfg.EtcdExpectedMembers < 0 {
+		return fmt.Errorf("ETCD_EXPECTED_MEMBERS %d must not be negative", cfg.EtcdExpectedMembers)
+	}
+	if cfg.ForceCompleteConfigMap != "" {
+		if _, err := parseNamespacedName(cfg.ForceCompleteConfigMap); err != nil {
+			return fmt.Errorf("FORCE_COMPLETE_CONFIGMAP %s", err)
+		}
+	}
+	for name, stage := range map[string]models.HostStage{"NOT_READY_NODE_STAGE": cfg.NotReadyNodeStage,
+		"READY_NODE_STAGE": cfg.ReadyNodeStage} {
+		if stage != "" && !containsHostStage(nodeStages, stage) {
+			return fmt.Errorf("%s %q is not supported, expected one of %v", name, stage, nodeStages)
+		}
+	}
+	if cfg.ReadyNodeStage != "" && cfg.ReadyNodeStage == cfg.NotReadyNodeStage {
+		return fmt.Errorf("READY_NODE_STAGE %q must differ from NOT_READY_NODE_STAGE", cfg.ReadyNodeStage)
+	}
+	for _, cm := range cfg.IngressCAConfigMaps {
+		if _, err := parseNamespacedName(cm); err != nil {
+			return fmt.Errorf("INGRESS_CA_CONFIGMAPS %s", err)
+		}
+	}
+	for _, namespace := range cfg.DiagnosticNamespaces {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return fmt.Errorf("DIAGNOSTIC_NAMESPACES %q is not a valid namespace: %s", namespace, strings.Join(errs, ", "))
+		}
+	}
+	for _, status := range cfg.IgnoredHostStatuses {
+		if !funk.ContainsString(knownHostStatuses, status) {
+			return fmt.Errorf("IGNORED_HOST_STATUSES %q is not a known host status", status)
+		}
+	}
+	for _, stage := range cfg.NonCriticalPostInstallStages {
+		if !funk.ContainsString(knownPostInstallStages, stage) {
+			return fmt.Errorf("NON_CRITICAL_POST_INSTALL_STAGES %q is not a known post install stage", stage)
+		}
+	}
+	if cfg.NotifyWebhookURL != "" {
+		if u, err := url.Parse(cfg.NotifyWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("NOTIFY_WEBHOOK_URL %q is not a valid http or https URL", cfg.NotifyWebhookURL)
+		}
+	}
+	if cfg.PauseAddress != "" {
+		if err := validateLocalhostAddress(cfg.PauseAddress); err != nil {
+			return fmt.Errorf("PAUSE_ADDRESS %s", err)
+		}
+	}
+	for name, proxy := range map[string]string{"INVENTORY_HTTP_PROXY": cfg.HTTPProxy, "INVENTORY_HTTPS_PROXY": cfg.HTTPSProxy} {
+		if proxy == "" {
+			continue
+		}
+		if u, err := url.Parse(proxy); err != nil || u.Host == "" {
+			return fmt.Errorf("%s %q is not a valid proxy URL", name, proxy)
+		}
+	}
+	return nil
+}
+
+// LoadPullSecretToken reads the pull secret token from PULL_SECRET_TOKEN_PATH unless PULL_SECRET_TOKEN is set,
+// which takes precedence. It fails if neither provides a token
+func (cfg *ControllerConfig) LoadPullSecretToken() error {
+	if cfg.PullSecretToken != "" {
+		return nil
+	}
+	if cfg.PullSecretTokenPath == "" {
+		return fmt.Errorf("either PULL_SECRET_TOKEN or PULL_SECRET_TOKEN_PATH is required")
+	}
+	data, err := ioutil.ReadFile(cfg.PullSecretTokenPath)
+	if err != nil {
+		return fmt.Errorf("PULL_SECRET_TOKEN_PATH %s can't be read: %s", cfg.PullSecretTokenPath, err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return fmt.Errorf("PULL_SECRET_TOKEN_PATH %s is empty", cfg.PullSecretTokenPath)
+	}
+	cfg.PullSecretToken = token
+	return nil
+}
+
+// ProxyConfigured returns true if the inventory client proxy was explicitly configured
+func (cfg *ControllerConfig) ProxyConfigured() bool {
+	return cfg.HTTPProxy != "" || cfg.HTTPSProxy != ""
+}
+
+// validateLocalhostAddress checks that address is a host:port whose host is localhost or a loopback ip
+func validateLocalhostAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid host:port address", address)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%q must be bound to localhost", address)
+	}
+	return nil
+}
+
+// validateCACert checks that the file at caCertPath, set by envName, contains PEM encoded certificates only
+func validateCACert(envName string, caCertPath string) error {
+	caData, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		return fmt.Errorf("%s %s can't be read: %s", envName, caCertPath, err)
+	}
+	block, rest := pem.Decode(caData)
+	if block == nil {
+		return fmt.Errorf("%s %s doesn't contain a PEM encoded certificate", envName, caCertPath)
+	}
+	for ; block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			return fmt.Errorf("%s %s doesn't contain a PEM encoded certificate", envName, caCertPath)
+		}
+		if _, err = x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("%s %s contains an invalid certificate: %s", envName, caCertPath, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package assisted_installer_controller
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/thoas/go-funk"
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	nodeUserPrefix = "system:node:"
+	nodeGroup      = "system:nodes"
+)
+
+// validateNodeCsr verifies that the csr was created by a node that is known to the inventory.
+// Client csrs must have the node user as common name and the nodes group as organization,
+// serving csrs must also be requested by that node and carry only its name and addresses as SANs.
+// The node addresses are the inventory ones and the ones reported in the status of the node.
+// nodes may be nil, then the node is matched by its inventory hostname only
+func validateNodeCsr(csr *certificatesv1beta1.CertificateSigningRequest, hosts map[string]inventory_client.HostData,
+	nodes *v1.NodeList, isBootstrapHost func(string, inventory_client.HostData) bool) error {
+	x509cr, err := parseCsr(csr)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(x509cr.Subject.CommonName, nodeUserPrefix) {
+		return fmt.Errorf("common name %s doesn't belong to a node", x509cr.Subject.CommonName)
+	}
+	nodeName := strings.TrimPrefix(x509cr.Subject.CommonName, nodeUserPrefix)
+	if !funk.ContainsString(x509cr.Subject.Organization, nodeGroup) {
+		return fmt.Errorf("organization %v doesn't contain %s", x509cr.Subject.Organization, nodeGroup)
+	}
+	host, ok := csrNodeHost(nodeName, hosts, nodes, isBootstrapHost)
+	if !ok {
+		return fmt.Errorf("node %s is not known to the inventory", nodeName)
+	}
+	if !isServingCsr(csr) {
+		return nil
+	}
+	if csr.Spec.Username != x509cr.Subject.CommonName {
+		return fmt.Errorf("serving csr of node %s was requested by %s", nodeName, csr.Spec.Username)
+	}
+	if len(x509cr.EmailAddresses) > 0 || len(x509cr.URIs) > 0 {
+		return fmt.Errorf("serving csr of node %s contains email or uri SANs", nodeName)
+	}
+	addresses := nodeAddresses(nodes)
+	for _, dnsName := range x509cr.DNSNames {
+		if dnsName != nodeName {
+			return fmt.Errorf("dns name %s doesn't match node %s", dnsName, nodeName)
+		}
+	}
+	for _, ip := range x509cr.IPAddresses {
+		if !containsIP(host.IPs, ip) && !containsIP(addresses[nodeName], ip) {
+			return fmt.Errorf("ip %s doesn't belong to node %s", ip.String(), nodeName)
+		}
+	}
+	return nil
+}
+
+// csrNodeHost returns the inventory host of the node a csr was requested for. A node may join under another
+// name than its inventory hostname, e.g. the bootstrap host, so an existing node is matched by its system uuid
+// as well. The client csrs that come before the node exists are attributed to the bootstrap host till its node
+// joined, unless the node name is taken by another node
+func csrNodeHost(nodeName string, hosts map[string]inventory_client.HostData, nodes *v1.NodeList,
+	isBootstrapHost func(string, inventory_client.HostData) bool) (inventory_client.HostData, bool) {
+	if host, ok := hosts[nodeName]; ok {
+		return host, true
+	}
+	if nodes == nil {
+		return inventory_client.HostData{}, false
+	}
+	for _, node := range nodes.Items {
+		if node.Name != nodeName {
+			continue
+		}
+		for _, host := range hosts {
+			if host.Host != nil && host.Host.ID != nil && strings.EqualFold(host.Host.ID.String(), node.Status.NodeInfo.SystemUUID) {
+				return host, true
+			}
+		}
+		return inventory_client.HostData{}, false
+	}
+	for name, host := range hosts {
+		if host.Host != nil && isBootstrapHost(name, host) && findBootstrapNode(name, host, nodes) == "" {
+			return host, true
+		}
+	}
+	return inventory_client.HostData{}, false
+}
+
+// nodeAddresses returns the internal and external ip addresses of every node by its name
+func nodeAddresses(nodes *v1.NodeList) map[string][]string {
+	addresses := make(map[string][]string)
+	if nodes == nil {
+		return addresses
+	}
+	for _, node := range nodes.Items {
+		for _, address := range node.Status.Addresses {
+			if address.Type == v1.NodeInternalIP || address.Type == v1.NodeExternalIP {
+				addresses[node.Name] = append(addresses[node.Name], address.Address)
+			}
+		}
+	}
+	return addresses
+}
+
+// containsIP compares the addresses as ips, so different notations of the same ipv6 address
+// and ipv4 addresses in their ipv6 mapped form match
+func containsIP(addresses []string, ip net.IP) bool {
+	for _, address := range addresses {
+		if parsed := parseIPAddress(address); parsed != nil && parsed.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIPAddress parses an address that may be bracketed, carry an ipv6 zone id or a prefix length,
+// e.g. [fe80::1%eth0] or 192.168.126.10/24
+func parseIPAddress(address string) net.IP {
+	address = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(address), "["), "]")
+	if i := strings.IndexByte(address, '/'); i >= 0 {
+		address = address[:i]
+	}
+	if i := strings.IndexByte(address, '%'); i >= 0 {
+		address = address[:i]
+	}
+	return net.ParseIP(address)
+}
+
+func parseCsr(csr *certificatesv1beta1.CertificateSigningRequest) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("failed to decode certificate request PEM")
+	}
+	x509cr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse certificate request")
+	}
+	return x509cr, nil
+}
+
+// isInventoryNodeCsr returns true if the csr is requested for a node named after an inventory host, a malformed
+// csr is rejected by the validation anyway
+func isInventoryNodeCsr(csr *certificatesv1beta1.CertificateSigningRequest, hosts map[string]inventory_client.HostData) bool {
+	x509cr, err := parseCsr(csr)
+	if err != nil {
+		return true
+	}
+	_, ok := hosts[strings.TrimPrefix(x509cr.Subject.CommonName, nodeUserPrefix)]
+	return ok
+}
+
+func isServingCsr(csr *certificatesv1beta1.CertificateSigningRequest) bool {
+	for _, usage := range csr.Spec.Usages {
+		if usage == certificatesv1beta1.UsageServerAuth {
+			return true
+		}
+	}
+	return false
+}
+
+// csrAuditFields describe who requested the csr and what is going to be signed, the request itself isn't logged
+func csrAuditFields(csr *certificatesv1beta1.CertificateSigningRequest) logrus.Fields {
+	usages := make([]string, len(csr.Spec.Usages))
+	for i, usage := range csr.Spec.Usages {
+		usages[i] = string(usage)
+	}
+	commonName := "unknown"
+	if x509cr, err := parseCsr(csr); err == nil {
+		commonName = x509cr.Subject.CommonName
+	}
+	return logrus.Fields{
+		"csr":         csr.Name,
+		"username":    csr.Spec.Username,
+		"usages":      strings.Join(usages, ","),
+		"common_name": commonName,
+	}
+}
@@ -0,0 +1,28 @@
+package assisted_installer_controller
+
+import (
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	v1 "k8s.io/api/core/v1"
+)
+
+// forgetDeletedNodes drops what was recorded about the nodes of the pending hosts that are not listed anymore, e.g.
+// since their host was reprovisioned, so the nodes are evaluated from scratch once they join again instead of
+// being reported as done right away
+func (c *controller) forgetDeletedNodes(nodes *v1.NodeList, pendingHosts map[string]inventory_client.HostData) {
+	listed := make(map[string]bool, len(nodes.Items))
+	for _, node := range nodes.Items {
+		listed[node.Name] = true
+	}
+	for _, host := range pendingHosts {
+		hostId := host.Host.ID.String()
+		nodeName, ok := c.matchedNodes[hostId]
+		if !ok || listed[nodeName] {
+			continue
+		}
+		c.log.WithField("host_id", hostId).Warnf("Node %s of host %s was deleted, waiting for it to join again",
+			nodeName, hostId)
+		delete(c.matchedNodes, hostId)
+		delete(c.readyStageReported, hostId)
+		delete(c.annotatedNodes, nodeName)
+	}
+}
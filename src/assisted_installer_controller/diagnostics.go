@@ -0,0 +1,186 @@
+package assisted_installer_controller
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/pkg/apis/metal3/v1alpha1"
+	"github.com/openshift/assisted-installer/src/k8s_client"
+	"github.com/pkg/errors"
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+)
+
+const (
+	diagnosticsLogsType            = "controller"
+	diagnosticsPodLogsSinceSeconds = int64(60 * 60)
+	diagnosticsPodLogsTailLines    = int64(5000)
+	// diagnosticsControllerLogsName is the tail of the controller own logs in the bundle
+	diagnosticsControllerLogsName = "assisted-installer-controller.log"
+)
+
+var diagnosticsPodLogsOptions = k8s_client.PodLogsOptions{
+	SinceSeconds: diagnosticsPodLogsSinceSeconds,
+	TailLines:    diagnosticsPodLogsTailLines,
+	Timeout:      podLogsTimeout,
+}
+
+// defaultDiagnosticsNamespaces are the namespaces whose recent pod logs are added to the failure diagnostics
+// besides the mcs and console namespaces when DiagnosticNamespaces is empty
+var defaultDiagnosticsNamespaces = []string{
+	"assisted-installer",
+	"openshift-machine-api",
+	"openshift-cluster-version",
+}
+
+type diagnosticsFile struct {
+	name    string
+	content []byte
+}
+
+type csrDiagnostics struct {
+	Name       string                                                   `json:"name"`
+	Username   string                                                   `json:"username"`
+	Groups     []string                                                 `json:"groups"`
+	Usages     []certificatesv1beta1.KeyUsage                           `json:"usages"`
+	Created    time.Time                                                `json:"created"`
+	Conditions []certificatesv1beta1.CertificateSigningRequestCondition `json:"conditions,omitempty"`
+}
+
+// GatherFailureDiagnostics collects mcs logs, pending csrs, bmh statuses and recent pod logs of the key
+// namespaces into a tar.gz bundle and uploads it to assisted-service.
+// Failures are only logged, they must not prevent reporting the installation failure
+func (c *controller) GatherFailureDiagnostics(ctx context.Context) {
+	if c.DryRun {
+		c.log.Infof("Dry run: skipping failure diagnostics upload")
+		return
+	}
+	c.log.Infof("Gathering failure diagnostics")
+	bundle, err := createTarGz(c.collectDiagnostics())
+	if err != nil {
+		c.log.WithError(err).Errorf("Failed to create failure diagnostics bundle")
+		return
+	}
+	if err := c.ic.UploadLogs(ctx, c.ClusterID, diagnosticsLogsType, bundle); err != nil {
+		c.log.WithError(err).Errorf("Failed to upload failure diagnostics")
+		return
+	}
+	c.diagnosticsUploaded.set()
+	c.log.Infof("Failure diagnostics were uploaded")
+}
+
+// collectDiagnostics gathers whatever is available, collection errors are added to the bundle as well
+func (c *controller) collectDiagnostics() []diagnosticsFile {
+	var files []diagnosticsFile
+	var collectErrors []string
+	addError := func(err error, msg string) {
+		c.log.WithError(err).Warn(msg)
+		collectErrors = append(collectErrors, fmt.Sprintf("%s: %s", msg, err))
+	}
+	addJSON := func(name string, obj interface{}) {
+		content, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			addError(err, fmt.Sprintf("Failed to marshal %s", name))
+			return
+		}
+		files = append(files, diagnosticsFile{name: name, content: content})
+	}
+
+	mcsLogs, _ := c.getMCSLogs()
+	files = append(files, diagnosticsFile{name: "mcs.log", content: []byte(mcsLogs)})
+
+	if csrs, err := c.kc.ListCsrs(); err != nil {
+		addError(err, "Failed to list csrs")
+	} else {
+		pendingCsrs := []csrDiagnostics{}
+		for i := range csrs.Items {
+			csr := csrs.Items[i]
+			if isCsrApproved(&csr) {
+				continue
+			}
+			pendingCsrs = append(pendingCsrs, csrDiagnostics{
+				Name:       csr.Name,
+				Username:   csr.Spec.Username,
+				Groups:     csr.Spec.Groups,
+				Usages:     csr.Spec.Usages,
+				Created:    csr.CreationTimestamp.Time,
+				Conditions: csr.Status.Conditions,
+			})
+		}
+		addJSON("pending_csrs.json", pendingCsrs)
+	}
+
+	if bmhs, err := c.kc.ListBMHs(); err != nil {
+		addError(err, "Failed to list BMHs")
+	} else {
+		statuses := make(map[string]metal3v1alpha1.BareMetalHostStatus, len(bmhs.Items))
+		for _, bmh := range bmhs.Items {
+			statuses[bmh.Namespace+"/"+bmh.Name] = bmh.Status
+		}
+		addJSON("bmh_statuses.json", statuses)
+	}
+
+	for _, namespace := range c.diagnosticsNamespaces() {
+		pods, err := c.kc.GetPods(namespace, nil)
+		if err != nil {
+			addError(err, fmt.Sprintf("Failed to get pods of namespace %s", namespace))
+			continue
+		}
+		for _, pod := range pods {
+			podLogs, err := c.kc.GetPodLogs(namespace, pod.Name, diagnosticsPodLogsOptions)
+			if err != nil {
+				addError(err, fmt.Sprintf("Failed to get logs of pod %s/%s", namespace, pod.Name))
+				continue
+			}
+			files = append(files, diagnosticsFile{name: fmt.Sprintf("pods/%s/%s.log", namespace, pod.Name), content: []byte(podLogs)})
+		}
+	}
+
+	if c.logsTail != nil {
+		tail, _ := c.logsTail.tail()
+		files = append(files, diagnosticsFile{name: diagnosticsControllerLogsName, content: tail})
+	}
+
+	if len(collectErrors) > 0 {
+		files = append(files, diagnosticsFile{name: "errors.txt", content: []byte(strings.Join(collectErrors, "\n") + "\n")})
+	}
+	return files
+}
+
+// diagnosticsNamespaces returns the namespaces whose recent pod logs are added to the failure diagnostics
+func (c controller) diagnosticsNamespaces() []string {
+	if len(c.DiagnosticNamespaces) > 0 {
+		return c.DiagnosticNamespaces
+	}
+	mcsNamespace, _ := c.mcsPodSelector()
+	consoleNamespace, _ := c.consolePodSelector()
+	return append(append([]string{}, defaultDiagnosticsNamespaces...), mcsNamespace, consoleNamespace)
+}
+
+func createTarGz(files []diagnosticsFile) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	now := time.Now()
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content)), ModTime: now}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, errors.Wrapf(err, "failed to write header of %s", file.name)
+		}
+		if _, err := tw.Write(file.content); err != nil {
+			return nil, errors.Wrapf(err, "failed to write %s", file.name)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to close tar writer")
+	}
+	if err := gw.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to close gzip writer")
+	}
+	return &buf, nil
+}
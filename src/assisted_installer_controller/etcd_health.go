@@ -0,0 +1,85 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/openshift/assisted-installer/src/k8s_client"
+	"github.com/openshift/assisted-service/models"
+	"github.com/pkg/errors"
+)
+
+// etcdHealthStatus keeps why etcd wasn't healthy on the last poll,
+// so it is reported even if the unpatch stage is abandoned on timeout
+type etcdHealthStatus struct {
+	sync.Mutex
+	notHealthy string
+}
+
+func (s *etcdHealthStatus) set(notHealthy string) {
+	s.Lock()
+	defer s.Unlock()
+	s.notHealthy = notHealthy
+}
+
+func (s *etcdHealthStatus) String() string {
+	s.Lock()
+	defer s.Unlock()
+	return s.notHealthy
+}
+
+// expectedEtcdMembers is EtcdExpectedMembers when set, otherwise an etcd member runs on every control plane
+// replica of the cluster, a single one on a single node cluster. It is 0 when the cluster hosts are unknown
+func (c controller) expectedEtcdMembers(cluster *models.Cluster) int {
+	if c.EtcdExpectedMembers > 0 {
+		return c.EtcdExpectedMembers
+	}
+	return controlPlaneReplicas(cluster)
+}
+
+// waitForEtcdHealthy waits till etcd has expected healthy members, so unpatching etcd
+// doesn't destabilize a cluster without quorum. Zero expected members doesn't wait
+func (c controller) waitForEtcdHealthy(ctx context.Context, expected int, status *etcdHealthStatus) error {
+	if expected == 0 {
+		return nil
+	}
+	c.log.Infof("Waiting for etcd to have %d healthy members", expected)
+	for {
+		members, err := c.kc.ListEtcdMembers()
+		if err != nil {
+			c.log.WithError(err).Warnf("Failed to list etcd members")
+			status.set(fmt.Sprintf("failed to list etcd members: %s", err))
+		} else {
+			notHealthy := notHealthyEtcdMembers(members)
+			healthy := len(members) - len(notHealthy)
+			if healthy >= expected {
+				c.log.Infof("Etcd has %d healthy members", healthy)
+				status.set("")
+				return nil
+			}
+			description := fmt.Sprintf("etcd has %d/%d healthy members", healthy, expected)
+			if len(notHealthy) > 0 {
+				description = fmt.Sprintf("%s, not healthy: %s", description, strings.Join(notHealthy, ", "))
+			}
+			c.log.Infof("Etcd is not healthy yet, %s", description)
+			status.set(description)
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "etcd is not healthy")
+		case <-c.clock.After(c.pollInterval()):
+		}
+	}
+}
+
+func notHealthyEtcdMembers(members []k8s_client.EtcdMember) []string {
+	var notHealthy []string
+	for _, member := range members {
+		if !member.Healthy {
+			notHealthy = append(notHealthy, member.Name)
+		}
+	}
+	return notHealthy
+}
@@ -0,0 +1,115 @@
+package assisted_installer_controller
+
+import (
+	"context"
+
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/openshift/assisted-service/models"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	eventReasonAllNodesJoined            = "AllNodesJoined"
+	eventReasonNodesJoinStalled          = "NodesJoinStalled"
+	eventReasonHostJoinTimedOut          = "HostJoinTimedOut"
+	eventReasonBMHsUpdated               = "BMHsUpdated"
+	eventReasonCsrApproved               = "CsrApproved"
+	eventReasonIngressCAUploaded         = "IngressCAUploaded"
+	eventReasonEtcdUnpatched             = "EtcdUnpatched"
+	eventReasonConsoleReady              = "ConsoleReady"
+	eventReasonClusterOperatorsAvailable = "ClusterOperatorsAvailable"
+	eventReasonInstallationCompleted     = "InstallationCompleted"
+	eventReasonInstallationFailed        = "InstallationFailed"
+)
+
+// serviceEventReasons are the milestones that are added to the cluster events of assisted-service as well
+var serviceEventReasons = map[string]bool{
+	eventReasonAllNodesJoined:            true,
+	eventReasonNodesJoinStalled:          true,
+	eventReasonHostJoinTimedOut:          true,
+	eventReasonBMHsUpdated:               true,
+	eventReasonIngressCAUploaded:         true,
+	eventReasonClusterOperatorsAvailable: true,
+	eventReasonInstallationCompleted:     true,
+	eventReasonInstallationFailed:        true,
+}
+
+// clusterObjectReference references the controller configmap that holds the cluster id,
+// it is used for the events of milestones that belong to the whole cluster
+var clusterObjectReference = v1.ObjectReference{
+	APIVersion: "v1",
+	Kind:       "ConfigMap",
+	Namespace:  "assisted-installer",
+	Name:       "assisted-installer-controller-config",
+}
+
+// recordEvent creates an event of the referenced object, failures are only logged
+func (c controller) recordEvent(ctx context.Context, object v1.ObjectReference, eventType string, reason string, message string) {
+	c.recordHostEvent(ctx, object, "", eventType, reason, message)
+}
+
+// recordHostEvent creates an event of the referenced object like recordEvent, a milestone is also added to the
+// events of assisted-service referencing the host when hostId is set
+func (c controller) recordHostEvent(ctx context.Context, object v1.ObjectReference, hostId string, eventType string,
+	reason string, message string) {
+	if c.DryRun {
+		c.log.Infof("Dry run: skipping %s event %s: %s", eventType, reason, message)
+		return
+	}
+	// events of cluster scoped objects must be created in the default namespace
+	namespace := object.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	now := metav1.Now()
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "assisted-installer-controller.",
+			Namespace:    namespace,
+		},
+		InvolvedObject: object,
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Source:         v1.EventSource{Component: "assisted-installer-controller"},
+	}
+	if err := c.kc.CreateEvent(event); err != nil {
+		c.log.WithError(err).Warnf("Failed to create event %s", reason)
+	}
+	if serviceEventReasons[reason] {
+		c.addServiceEvent(ctx, hostId, serviceEventSeverity(eventType, reason), message)
+	}
+}
+
+// serviceEventSeverity maps the type of an event to its assisted-service severity, a failed installation is an error
+func serviceEventSeverity(eventType string, reason string) string {
+	switch {
+	case reason == eventReasonInstallationFailed:
+		return models.EventSeverityError
+	case eventType == v1.EventTypeWarning:
+		return models.EventSeverityWarning
+	default:
+		return models.EventSeverityInfo
+	}
+}
+
+// addServiceEvent adds an event of the cluster to assisted-service, failures are only logged. No events are added
+// once assisted-service turned out not to support them
+func (c controller) addServiceEvent(ctx context.Context, hostId string, severity string, message string) {
+	if c.serviceEventsUnsupported.isSet() {
+		return
+	}
+	err := c.ic.AddEvent(ctx, c.ClusterID, hostId, severity, message)
+	switch {
+	case err == nil:
+	case inventory_client.IsUnsupported(err):
+		c.log.Infof("Not adding events to assisted-service, it doesn't support them: %s", err)
+		c.serviceEventsUnsupported.set()
+	default:
+		c.log.WithError(err).Warnf("Failed to add event to assisted-service: %s", message)
+	}
+}
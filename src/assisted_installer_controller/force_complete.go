@@ -0,0 +1,104 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// forceCompleteAnnotation on the ForceCompleteConfigMap makes the controller stop waiting and report the
+	// installation as completed, its value is the reason reported to assisted-service
+	forceCompleteAnnotation = "assisted-installer.openshift.io/force-complete"
+	// forceCompleteSuccessAnnotation set to true reports the forced completion as successful, it is failed otherwise
+	forceCompleteSuccessAnnotation = "assisted-installer.openshift.io/force-complete-success"
+)
+
+// completionSwitch is set once the installation was completed, e.g. force completed so the completion isn't
+// reported again
+type completionSwitch struct {
+	sync.Mutex
+	completed bool
+}
+
+func (s *completionSwitch) set() {
+	s.Lock()
+	defer s.Unlock()
+	s.completed = true
+}
+
+func (s *completionSwitch) isSet() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.completed
+}
+
+// setUnless sets the switch unless it is already set or skip returns true, it returns whether it was set
+func (s *completionSwitch) setUnless(skip func() bool) bool {
+	s.Lock()
+	defer s.Unlock()
+	if s.completed || skip() {
+		return false
+	}
+	s.completed = true
+	return true
+}
+
+// unlessSet calls f unless the switch is set, the switch can't be set till f returns
+func (s *completionSwitch) unlessSet(f func()) bool {
+	s.Lock()
+	defer s.Unlock()
+	if s.completed {
+		return false
+	}
+	f()
+	return true
+}
+
+// WatchForceComplete polls the ForceCompleteConfigMap till it is annotated by an operator, then it calls stop so
+// the controller stops waiting and reports the installation as completed with the operator reason. The completion
+// is sent with ctx, so it must not be cancelled by stop
+func (c *controller) WatchForceComplete(ctx context.Context, stop context.CancelFunc) {
+	if c.ForceCompleteConfigMap == "" {
+		return
+	}
+	cm, err := parseNamespacedName(c.ForceCompleteConfigMap)
+	if err != nil {
+		c.log.WithError(err).Errorf("Invalid force complete configmap, not watching it")
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.clock.After(c.pollInterval()):
+		}
+		// the install deadline passed meanwhile and already failed the installation, or it was completed
+		if c.forceComplete.isSet() || c.completed.isSet() {
+			return
+		}
+		configMap, err := c.kc.GetConfigMap(cm.Namespace, cm.Name)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			c.log.WithError(err).Warnf("Failed to get force complete configmap %s", c.ForceCompleteConfigMap)
+			continue
+		}
+		reason := configMap.Annotations[forceCompleteAnnotation]
+		if reason == "" {
+			continue
+		}
+		success := configMap.Annotations[forceCompleteSuccessAnnotation] == "true"
+		// a completion that is being reported meanwhile wins, its result isn't overridden
+		if !c.forceComplete.setUnless(c.completed.isSet) {
+			c.log.Infof("Installation was already completed, ignoring the forced completion with success %t: %s", success, reason)
+			return
+		}
+		c.log.Warnf("Installation was force completed by an operator with success %t: %s", success, reason)
+		stop()
+		c.completeInstallation(ctx, success, "Installation was force completed: "+reason)
+		return
+	}
+}
@@ -0,0 +1,139 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/openshift/assisted-installer/src/k8s_client"
+	"github.com/openshift/assisted-installer/src/ops"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+var _ = Describe("force complete", func() {
+	var (
+		ctrl          *gomock.Controller
+		mockbmclient  *inventory_client.MockInventoryClient
+		mockk8sclient *k8s_client.MockK8SClient
+		c             *controller
+		fakeClock     *clock.FakeClock
+		ctx           context.Context
+		cancel        context.CancelFunc
+		stopped       chan struct{}
+		done          chan struct{}
+	)
+	configMap := func(annotations map[string]string) *v1.ConfigMap {
+		return &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "assisted-installer", Name: "force-complete",
+			Annotations: annotations}}
+	}
+	stepPoll := func() {
+		Eventually(fakeClock.HasWaiters).Should(BeTrue())
+		fakeClock.Step(time.Minute)
+	}
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockbmclient = inventory_client.NewMockInventoryClient(ctrl)
+		mockk8sclient = k8s_client.NewMockK8SClient(ctrl)
+		mockk8sclient.EXPECT().CreateEvent(gomock.Any()).Return(nil).AnyTimes()
+		mockbmclient.EXPECT().AddEvent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		l := logrus.New()
+		l.SetOutput(ioutil.Discard)
+		c = NewController(l, ControllerConfig{ClusterID: "cluster-id", WaitInterval: time.Minute,
+			ForceCompleteConfigMap: "assisted-installer/force-complete"},
+			ops.NewMockOps(ctrl), mockbmclient, mockk8sclient)
+		fakeClock = clock.NewFakeClock(time.Now())
+		c.clock = fakeClock
+		ctx, cancel = context.WithCancel(context.Background())
+		stopped = make(chan struct{})
+		done = make(chan struct{})
+	})
+	AfterEach(func() {
+		cancel()
+		Eventually(done).Should(BeClosed())
+		ctrl.Finish()
+	})
+	watch := func() {
+		go func() {
+			defer close(done)
+			c.WatchForceComplete(ctx, func() { close(stopped) })
+		}()
+	}
+
+	It("completes the installation with the operator reason once annotated", func() {
+		notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "force-complete")
+		gomock.InOrder(
+			mockk8sclient.EXPECT().GetConfigMap("assisted-installer", "force-complete").Return(nil, notFound).Times(1),
+			mockk8sclient.EXPECT().GetConfigMap("assisted-installer", "force-complete").Return(nil, fmt.Errorf("dummy")).Times(1),
+			mockk8sclient.EXPECT().GetConfigMap("assisted-installer", "force-complete").Return(configMap(nil), nil).Times(1),
+			mockk8sclient.EXPECT().GetConfigMap("assisted-installer", "force-complete").Return(configMap(map[string]string{
+				forceCompleteAnnotation:        "console operator is degraded, cluster verified manually",
+				forceCompleteSuccessAnnotation: "true",
+			}), nil).Times(1),
+		)
+		mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true,
+			"Installation was force completed: console operator is degraded, cluster verified manually").Return(nil).Times(1)
+		watch()
+		for i := 0; i < 3; i++ {
+			stepPoll()
+			Consistently(stopped, 50*time.Millisecond).ShouldNot(BeClosed())
+		}
+		stepPoll()
+		Eventually(done).Should(BeClosed())
+		Expect(stopped).To(BeClosed())
+
+		// the controller completion is skipped once force completed
+		c.sendCompleteInstallation(context.Background(), false, "Timeout while waiting for console to become available")
+	})
+	It("reports a failed installation without the success annotation", func() {
+		mockk8sclient.EXPECT().GetConfigMap("assisted-installer", "force-complete").Return(configMap(map[string]string{
+			forceCompleteAnnotation: "aborted by the operator",
+		}), nil).Times(1)
+		mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", false,
+			"Installation was force completed: aborted by the operator").Return(nil).Times(1)
+		watch()
+		stepPoll()
+		Eventually(done).Should(BeClosed())
+		Expect(stopped).To(BeClosed())
+	})
+	It("doesn't complete the installation again once it was completed", func() {
+		mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+		mockk8sclient.EXPECT().GetConfigMap("assisted-installer", "force-complete").Return(configMap(map[string]string{
+			forceCompleteAnnotation: "aborted by the operator",
+		}), nil).AnyTimes()
+		c.sendCompleteInstallation(context.Background(), true, "")
+		watch()
+		stepPoll()
+		Eventually(done).Should(BeClosed())
+		Expect(stopped).NotTo(BeClosed())
+		Expect(c.forceComplete.isSet()).To(BeFalse())
+	})
+	It("isn't force completed once the completion was recorded meanwhile", func() {
+		c.completed.set()
+		Expect(c.forceComplete.setUnless(c.completed.isSet)).To(BeFalse())
+		Expect(c.forceComplete.isSet()).To(BeFalse())
+		close(done)
+	})
+	It("doesn't watch without a configmap", func() {
+		c.ForceCompleteConfigMap = ""
+		watch()
+		Eventually(done).Should(BeClosed())
+		Expect(stopped).NotTo(BeClosed())
+	})
+	It("stops watching when cancelled", func() {
+		watch()
+		Eventually(fakeClock.HasWaiters).Should(BeTrue())
+		cancel()
+		Eventually(done).Should(BeClosed())
+		Expect(stopped).NotTo(BeClosed())
+	})
+})
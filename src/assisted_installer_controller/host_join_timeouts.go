@@ -0,0 +1,64 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	v1 "k8s.io/api/core/v1"
+)
+
+// hostJoinTracker remembers since when every host, by its id, is pending, to flag once each host that is pending
+// for longer than the timeout while the other hosts keep joining
+type hostJoinTracker struct {
+	timeout      time.Duration
+	pendingSince map[string]time.Time
+	flagged      map[string]bool
+}
+
+func newHostJoinTracker(timeout time.Duration) *hostJoinTracker {
+	return &hostJoinTracker{timeout: timeout, pendingSince: make(map[string]time.Time), flagged: make(map[string]bool)}
+}
+
+// update records the pending hosts and returns the sorted names of the hosts that became late in this poll,
+// the hosts that are no longer pending are forgotten
+func (t *hostJoinTracker) update(now time.Time, pendingHosts map[string]inventory_client.HostData) []string {
+	pending := make(map[string]bool, len(pendingHosts))
+	var late []string
+	for name, host := range pendingHosts {
+		hostId := host.Host.ID.String()
+		pending[hostId] = true
+		since, ok := t.pendingSince[hostId]
+		if !ok {
+			t.pendingSince[hostId] = now
+			continue
+		}
+		if t.timeout <= 0 || t.flagged[hostId] || now.Sub(since) < t.timeout {
+			continue
+		}
+		t.flagged[hostId] = true
+		late = append(late, name)
+	}
+	for hostId := range t.pendingSince {
+		if !pending[hostId] {
+			delete(t.pendingSince, hostId)
+			delete(t.flagged, hostId)
+		}
+	}
+	sort.Strings(late)
+	return late
+}
+
+// handleLateHosts reports every host that didn't join within HostJoinTimeout, the installation goes on
+func (c *controller) handleLateHosts(ctx context.Context, late []string, pendingHosts map[string]inventory_client.HostData) {
+	for _, name := range late {
+		hostId := pendingHosts[name].Host.ID.String()
+		c.log.WithField("host_id", hostId).Warnf("Host %s didn't join the cluster within %s, still waiting for it",
+			name, c.HostJoinTimeout)
+		c.metrics.hostsJoinTimedOut.Inc()
+		c.recordHostEvent(ctx, clusterObjectReference, hostId, v1.EventTypeWarning, eventReasonHostJoinTimedOut,
+			fmt.Sprintf("Host %s didn't join the cluster within %s", name, c.HostJoinTimeout))
+	}
+}
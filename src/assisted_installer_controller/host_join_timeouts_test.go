@@ -0,0 +1,50 @@
+package assisted_installer_controller
+
+import (
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/openshift/assisted-service/models"
+)
+
+var _ = Describe("per host join timeout", func() {
+	start := time.Now()
+	hostIds := map[string]strfmt.UUID{
+		"node0": "7916fa89-ea7a-443e-a862-b3e930309f65",
+		"node1": "eb82821f-bf21-4614-9a3b-ecb07929f238",
+		"node2": "b898d516-3e16-49d0-86a5-0ad5bd04e3ed",
+	}
+	pending := func(names ...string) map[string]inventory_client.HostData {
+		hosts := make(map[string]inventory_client.HostData, len(names))
+		for _, name := range names {
+			id := hostIds[name]
+			hosts[name] = inventory_client.HostData{Host: &models.Host{ID: &id}}
+		}
+		return hosts
+	}
+
+	It("flags once every host that is pending for longer than the timeout", func() {
+		t := newHostJoinTracker(10 * time.Minute)
+		Expect(t.update(start, pending("node0", "node1"))).To(BeEmpty())
+		Expect(t.update(start.Add(5*time.Minute), pending("node0", "node1", "node2"))).To(BeEmpty())
+		Expect(t.update(start.Add(10*time.Minute), pending("node0", "node1", "node2"))).To(Equal([]string{"node0", "node1"}))
+		Expect(t.update(start.Add(12*time.Minute), pending("node0", "node1", "node2"))).To(BeEmpty())
+		Expect(t.update(start.Add(15*time.Minute), pending("node0", "node1", "node2"))).To(Equal([]string{"node2"}))
+	})
+	It("forgets the hosts that are no longer pending", func() {
+		t := newHostJoinTracker(10 * time.Minute)
+		Expect(t.update(start, pending("node0"))).To(BeEmpty())
+		Expect(t.update(start.Add(10*time.Minute), pending("node0"))).To(Equal([]string{"node0"}))
+		Expect(t.update(start.Add(11*time.Minute), pending())).To(BeEmpty())
+		Expect(t.update(start.Add(12*time.Minute), pending("node0"))).To(BeEmpty())
+		Expect(t.update(start.Add(22*time.Minute), pending("node0"))).To(Equal([]string{"node0"}))
+	})
+	It("doesn't flag hosts without a timeout", func() {
+		t := newHostJoinTracker(0)
+		Expect(t.update(start, pending("node0"))).To(BeEmpty())
+		Expect(t.update(start.Add(time.Hour), pending("node0"))).To(BeEmpty())
+	})
+})
@@ -0,0 +1,39 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"fmt"
+)
+
+// watchInstallDeadline calls stop once InstallDeadline passed, so all the loops stop like on a cancellation, and
+// closes the returned channel. The completions of the stopping loops are skipped, the installation failure is
+// reported by failInstallDeadline once they returned. Nothing is done once the installation was completed,
+// non positive InstallDeadline disables it
+func (c *controller) watchInstallDeadline(ctx context.Context, stop context.CancelFunc) <-chan struct{} {
+	passed := make(chan struct{})
+	if c.InstallDeadline <= 0 {
+		return passed
+	}
+	deadline := c.clock.After(c.InstallDeadline)
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+		}
+		if !c.forceComplete.setUnless(c.completed.isSet) {
+			return
+		}
+		c.log.Errorf("Installation didn't complete within the install deadline of %s, stopping", c.InstallDeadline)
+		close(passed)
+		stop()
+	}()
+	return passed
+}
+
+// failInstallDeadline gathers the failure diagnostics and reports the installation as failed
+func (c *controller) failInstallDeadline(ctx context.Context) {
+	c.GatherFailureDiagnostics(ctx)
+	c.completeInstallation(ctx, false, fmt.Sprintf("Installation didn't complete within the install deadline of %s",
+		c.InstallDeadline))
+}
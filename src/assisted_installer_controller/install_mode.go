@@ -0,0 +1,13 @@
+package assisted_installer_controller
+
+const (
+	// InstallModeFull installs a cluster, waiting for the bootstrap and running the post install configs
+	InstallModeFull = "Full"
+	// InstallModeAddHosts adds hosts to an installed cluster, there are no masters to wait for
+	// and the cluster never moves to finalizing
+	InstallModeAddHosts = "AddHosts"
+)
+
+func (c controller) isAddHostsMode() bool {
+	return c.InstallMode == InstallModeAddHosts
+}
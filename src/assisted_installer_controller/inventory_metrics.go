@@ -0,0 +1,98 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/openshift/assisted-service/models"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// instrumentedInventoryClient records the latency and the errors of every assisted-service request,
+// requests that took at least slowThreshold are also logged. A non positive slowThreshold doesn't log them
+type instrumentedInventoryClient struct {
+	ic            inventory_client.InventoryClient
+	log           *logrus.Entry
+	metrics       *controllerMetrics
+	clock         clock.Clock
+	slowThreshold time.Duration
+}
+
+func newInstrumentedInventoryClient(ic inventory_client.InventoryClient, log *logrus.Entry, metrics *controllerMetrics,
+	clock clock.Clock, slowThreshold time.Duration) *instrumentedInventoryClient {
+	return &instrumentedInventoryClient{ic: ic, log: log, metrics: metrics, clock: clock, slowThreshold: slowThreshold}
+}
+
+func (i *instrumentedInventoryClient) observe(method string, start time.Time, err *error) {
+	elapsed := i.clock.Since(start)
+	i.metrics.inventoryRequestDuration.WithLabelValues(method).Observe(elapsed.Seconds())
+	if *err != nil {
+		i.metrics.inventoryRequestErrors.WithLabelValues(method).Inc()
+	}
+	if i.slowThreshold > 0 && elapsed >= i.slowThreshold {
+		i.log.Warnf("assisted-service request %s took %s", method, elapsed)
+	}
+}
+
+func (i *instrumentedInventoryClient) DownloadFile(ctx context.Context, filename string, dest string) (err error) {
+	defer i.observe("DownloadFile", i.clock.Now(), &err)
+	return i.ic.DownloadFile(ctx, filename, dest)
+}
+
+func (i *instrumentedInventoryClient) UpdateHostInstallProgress(ctx context.Context, hostId string, newStage models.HostStage, info string) (err error) {
+	defer i.observe("UpdateHostInstallProgress", i.clock.Now(), &err)
+	return i.ic.UpdateHostInstallProgress(ctx, hostId, newStage, info)
+}
+
+func (i *instrumentedInventoryClient) UpdateHostsInstallProgress(ctx context.Context, updates []inventory_client.HostProgressUpdate) (err error) {
+	defer i.observe("UpdateHostsInstallProgress", i.clock.Now(), &err)
+	return i.ic.UpdateHostsInstallProgress(ctx, updates)
+}
+
+func (i *instrumentedInventoryClient) GetEnabledHostsNamesHosts(ctx context.Context) (hosts map[string]inventory_client.HostData, err error) {
+	defer i.observe("GetEnabledHostsNamesHosts", i.clock.Now(), &err)
+	return i.ic.GetEnabledHostsNamesHosts(ctx)
+}
+
+func (i *instrumentedInventoryClient) UploadIngressCa(ctx context.Context, ingressCA string, clusterId string) (err error) {
+	defer i.observe("UploadIngressCa", i.clock.Now(), &err)
+	return i.ic.UploadIngressCa(ctx, ingressCA, clusterId)
+}
+
+func (i *instrumentedInventoryClient) GetCluster(ctx context.Context) (cluster *models.Cluster, err error) {
+	defer i.observe("GetCluster", i.clock.Now(), &err)
+	return i.ic.GetCluster(ctx)
+}
+
+func (i *instrumentedInventoryClient) CompleteInstallation(ctx context.Context, clusterId string, isSuccess bool, errorInfo string) (err error) {
+	defer i.observe("CompleteInstallation", i.clock.Now(), &err)
+	return i.ic.CompleteInstallation(ctx, clusterId, isSuccess, errorInfo)
+}
+
+func (i *instrumentedInventoryClient) GetHosts(ctx context.Context, skippedStatuses []string) (hosts map[string]inventory_client.HostData, err error) {
+	defer i.observe("GetHosts", i.clock.Now(), &err)
+	return i.ic.GetHosts(ctx, skippedStatuses)
+}
+
+func (i *instrumentedInventoryClient) UploadLogs(ctx context.Context, clusterId string, logsType string, upfile io.Reader) (err error) {
+	defer i.observe("UploadLogs", i.clock.Now(), &err)
+	return i.ic.UploadLogs(ctx, clusterId, logsType, upfile)
+}
+
+func (i *instrumentedInventoryClient) UploadControllerLogs(ctx context.Context, clusterId string, logs io.Reader) (err error) {
+	defer i.observe("UploadControllerLogs", i.clock.Now(), &err)
+	return i.ic.UploadControllerLogs(ctx, clusterId, logs)
+}
+
+func (i *instrumentedInventoryClient) UpdateClusterProgress(ctx context.Context, clusterId string, percentage int) (err error) {
+	defer i.observe("UpdateClusterProgress", i.clock.Now(), &err)
+	return i.ic.UpdateClusterProgress(ctx, clusterId, percentage)
+}
+
+func (i *instrumentedInventoryClient) AddEvent(ctx context.Context, clusterId string, hostId string, severity string, message string) (err error) {
+	defer i.observe("AddEvent", i.clock.Now(), &err)
+	return i.ic.AddEvent(ctx, clusterId, hostId, severity, message)
+}
@@ -0,0 +1,106 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/openshift/assisted-service/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+var _ = Describe("instrumented inventory client", func() {
+	var (
+		ctrl      *gomock.Controller
+		mockic    *inventory_client.MockInventoryClient
+		metrics   *controllerMetrics
+		hook      *logrustest.Hook
+		fakeClock *clock.FakeClock
+		ic        *instrumentedInventoryClient
+		ctx       = context.Background()
+	)
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockic = inventory_client.NewMockInventoryClient(ctrl)
+		metrics = newControllerMetrics()
+		logger, h := logrustest.NewNullLogger()
+		hook = h
+		fakeClock = clock.NewFakeClock(time.Now())
+		ic = newInstrumentedInventoryClient(mockic, logrus.NewEntry(logger), metrics, fakeClock, 10*time.Second)
+	})
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+	taking := func(d time.Duration) func(context.Context) {
+		return func(context.Context) { fakeClock.Step(d) }
+	}
+	expectDurations := func(expected string) {
+		Expect(testutil.CollectAndCompare(metrics.inventoryRequestDuration, strings.NewReader(`
+# HELP assisted_controller_inventory_request_duration_seconds Time spent in each assisted-service request
+# TYPE assisted_controller_inventory_request_duration_seconds histogram
+`+expected), "assisted_controller_inventory_request_duration_seconds")).To(Succeed())
+	}
+
+	It("records the latency of GetCluster and GetHosts", func() {
+		cluster := &models.Cluster{}
+		mockic.EXPECT().GetCluster(gomock.Any()).Do(taking(2*time.Second)).Return(cluster, nil).Times(1)
+		hosts := map[string]inventory_client.HostData{"node0": {}}
+		mockic.EXPECT().GetHosts(gomock.Any(), []string{models.HostStatusDisabled}).
+			Do(func(context.Context, []string) { fakeClock.Step(20 * time.Second) }).Return(hosts, nil).Times(1)
+
+		Expect(ic.GetCluster(ctx)).To(Equal(cluster))
+		Expect(ic.GetHosts(ctx, []string{models.HostStatusDisabled})).To(Equal(hosts))
+		expectDurations(`
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetCluster",le="0.1"} 0
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetCluster",le="0.5"} 0
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetCluster",le="1"} 0
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetCluster",le="5"} 1
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetCluster",le="15"} 1
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetCluster",le="30"} 1
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetCluster",le="60"} 1
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetCluster",le="+Inf"} 1
+assisted_controller_inventory_request_duration_seconds_sum{method="GetCluster"} 2
+assisted_controller_inventory_request_duration_seconds_count{method="GetCluster"} 1
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetHosts",le="0.1"} 0
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetHosts",le="0.5"} 0
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetHosts",le="1"} 0
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetHosts",le="5"} 0
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetHosts",le="15"} 0
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetHosts",le="30"} 1
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetHosts",le="60"} 1
+assisted_controller_inventory_request_duration_seconds_bucket{method="GetHosts",le="+Inf"} 1
+assisted_controller_inventory_request_duration_seconds_sum{method="GetHosts"} 20
+assisted_controller_inventory_request_duration_seconds_count{method="GetHosts"} 1
+`)
+		Expect(hook.AllEntries()).To(HaveLen(1))
+		Expect(hook.LastEntry().Message).To(Equal("assisted-service request GetHosts took 20s"))
+	})
+	It("counts failed requests", func() {
+		mockic.EXPECT().GetCluster(gomock.Any()).Return(nil, fmt.Errorf("connection refused")).Times(2)
+		mockic.EXPECT().GetHosts(gomock.Any(), gomock.Any()).Return(nil, nil).Times(1)
+		for i := 0; i < 2; i++ {
+			_, err := ic.GetCluster(ctx)
+			Expect(err).To(HaveOccurred())
+		}
+		_, err := ic.GetHosts(ctx, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(testutil.ToFloat64(metrics.inventoryRequestErrors.WithLabelValues("GetCluster"))).To(Equal(float64(2)))
+		Expect(testutil.ToFloat64(metrics.inventoryRequestErrors.WithLabelValues("GetHosts"))).To(Equal(float64(0)))
+		Expect(hook.AllEntries()).To(BeEmpty())
+	})
+	It("doesn't log slow requests without a threshold", func() {
+		ic.slowThreshold = 0
+		mockic.EXPECT().GetCluster(gomock.Any()).Do(taking(time.Minute)).Return(&models.Cluster{}, nil).Times(1)
+		_, err := ic.GetCluster(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hook.AllEntries()).To(BeEmpty())
+	})
+})
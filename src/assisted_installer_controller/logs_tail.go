@@ -0,0 +1,108 @@
+package assisted_installer_controller
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultLogsTailLines is used when LOGS_TAIL_LINES is not positive
+const defaultLogsTailLines = 1000
+
+// logsTailHook keeps the last formatted lines of the controller logs in a ring buffer
+type logsTailHook struct {
+	sync.Mutex
+	lines [][]byte
+	// next is the index the next line is written at, once the buffer is full it is the oldest line
+	next int
+	full bool
+	// written counts all the lines ever written, so an unchanged tail isn't uploaded again
+	written uint64
+}
+
+func newLogsTailHook(size int) *logsTailHook {
+	if size < 1 {
+		size = defaultLogsTailLines
+	}
+	return &logsTailHook{lines: make([][]byte, size)}
+}
+
+func (h *logsTailHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *logsTailHook) Fire(entry *logrus.Entry) error {
+	line, err := entry.Logger.Formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	h.Lock()
+	defer h.Unlock()
+	// the formatter may reuse its buffer
+	h.lines[h.next] = append([]byte(nil), line...)
+	h.next = (h.next + 1) % len(h.lines)
+	if h.next == 0 {
+		h.full = true
+	}
+	h.written++
+	return nil
+}
+
+// tail returns the buffered lines from the oldest to the newest and the number of lines ever written
+func (h *logsTailHook) tail() ([]byte, uint64) {
+	h.Lock()
+	defer h.Unlock()
+	var buf bytes.Buffer
+	if h.full {
+		for _, line := range h.lines[h.next:] {
+			buf.Write(line)
+		}
+	}
+	for _, line := range h.lines[:h.next] {
+		buf.Write(line)
+	}
+	return buf.Bytes(), h.written
+}
+
+// UploadLogsTail uploads the tail of the controller logs to assisted-service every LogsUploadInterval till stop
+// is closed, and once more then so the last lines are uploaded as well. The uploads are aborted once ctx is
+// cancelled and stop once the failure diagnostics were uploaded, the bundle has the tail already and uploading
+// the tail would replace it. Failures are only logged
+func (c *controller) UploadLogsTail(ctx context.Context, stop <-chan struct{}) {
+	if c.logsTail == nil {
+		return
+	}
+	var uploaded uint64
+	for {
+		select {
+		case <-stop:
+			c.uploadLogsTail(ctx, &uploaded)
+			return
+		case <-c.clock.After(c.LogsUploadInterval):
+		}
+		c.uploadLogsTail(ctx, &uploaded)
+	}
+}
+
+// uploadLogsTail uploads the tail unless no line was written since the last upload
+func (c *controller) uploadLogsTail(ctx context.Context, uploaded *uint64) {
+	tail, written := c.logsTail.tail()
+	if written == *uploaded {
+		return
+	}
+	// uploading is a change to assisted-service like any other
+	if c.DryRun || c.isPaused() {
+		return
+	}
+	// both are uploaded as the controller logs, the diagnostics bundle must be kept
+	if c.diagnosticsUploaded.isSet() {
+		return
+	}
+	if err := c.ic.UploadControllerLogs(ctx, c.ClusterID, bytes.NewReader(tail)); err != nil {
+		c.log.WithError(err).Warnf("Failed to upload the controller logs tail")
+		return
+	}
+	*uploaded = written
+}
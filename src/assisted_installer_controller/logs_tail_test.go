@@ -0,0 +1,154 @@
+package assisted_installer_controller
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/pkg/apis/metal3/v1alpha1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/openshift/assisted-installer/src/k8s_client"
+	"github.com/openshift/assisted-installer/src/ops"
+	"github.com/sirupsen/logrus"
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+var _ = Describe("controller logs tail", func() {
+	newLogger := func() *logrus.Logger {
+		l := logrus.New()
+		l.SetOutput(ioutil.Discard)
+		l.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+		return l
+	}
+
+	It("keeps the last lines from the oldest to the newest", func() {
+		l := newLogger()
+		hook := newLogsTailHook(3)
+		l.AddHook(hook)
+		for _, msg := range []string{"line0", "line1", "line2", "line3", "line4"} {
+			l.Info(msg)
+		}
+		tail, written := hook.tail()
+		Expect(string(tail)).To(Equal("level=info msg=line2\nlevel=info msg=line3\nlevel=info msg=line4\n"))
+		Expect(written).To(Equal(uint64(5)))
+	})
+	It("keeps all the lines till the buffer is full", func() {
+		l := newLogger()
+		hook := newLogsTailHook(3)
+		l.AddHook(hook)
+		l.Info("line0")
+		tail, _ := hook.tail()
+		Expect(string(tail)).To(Equal("level=info msg=line0\n"))
+	})
+	It("falls back to the default size", func() {
+		Expect(newLogsTailHook(0).lines).To(HaveLen(defaultLogsTailLines))
+	})
+
+	Context("uploading", func() {
+		var (
+			ctrl          *gomock.Controller
+			mockbmclient  *inventory_client.MockInventoryClient
+			mockk8sclient *k8s_client.MockK8SClient
+			l             *logrus.Logger
+			c             *controller
+			fakeClock     *clock.FakeClock
+			uploads       chan string
+		)
+		BeforeEach(func() {
+			ctrl = gomock.NewController(GinkgoT())
+			mockbmclient = inventory_client.NewMockInventoryClient(ctrl)
+			mockk8sclient = k8s_client.NewMockK8SClient(ctrl)
+			l = newLogger()
+			c = NewController(l, ControllerConfig{ClusterID: "cluster-id", LogsUploadInterval: time.Minute},
+				ops.NewMockOps(ctrl), mockbmclient, mockk8sclient)
+			fakeClock = clock.NewFakeClock(time.Now())
+			c.clock = fakeClock
+			uploads = make(chan string, 10)
+			mockbmclient.EXPECT().UploadControllerLogs(gomock.Any(), "cluster-id", gomock.Any()).DoAndReturn(func(_ context.Context, clusterId string, logs io.Reader) error {
+				content, err := ioutil.ReadAll(logs)
+				Expect(err).NotTo(HaveOccurred())
+				uploads <- string(content)
+				return nil
+			}).AnyTimes()
+		})
+		AfterEach(func() {
+			ctrl.Finish()
+		})
+
+		It("uploads the tail every interval and once more when stopped", func() {
+			stop := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				c.UploadLogsTail(context.Background(), stop)
+			}()
+			l.Info("first")
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			fakeClock.Step(time.Minute - time.Second)
+			Consistently(uploads, 50*time.Millisecond).ShouldNot(Receive())
+			fakeClock.Step(time.Second)
+			var upload string
+			Eventually(uploads).Should(Receive(&upload))
+			Expect(upload).To(ContainSubstring("msg=first"))
+
+			// an unchanged tail isn't uploaded again
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			fakeClock.Step(time.Minute)
+			Consistently(uploads, 50*time.Millisecond).ShouldNot(Receive())
+
+			l.Info("last")
+			close(stop)
+			Eventually(done).Should(BeClosed())
+			Expect(uploads).To(Receive(&upload))
+			Expect(upload).To(ContainSubstring("msg=first"))
+			Expect(upload).To(ContainSubstring("msg=last"))
+		})
+		It("adds the tail to the failure diagnostics and doesn't replace them once uploaded", func() {
+			mockk8sclient.EXPECT().GetPods(gomock.Any(), gomock.Any()).Return([]v1.Pod{}, nil).AnyTimes()
+			mockk8sclient.EXPECT().ListCsrs().Return(&certificatesv1beta1.CertificateSigningRequestList{}, nil).Times(1)
+			mockk8sclient.EXPECT().ListBMHs().Return(metal3v1alpha1.BareMetalHostList{}, nil).Times(1)
+			bundle := make(map[string]string)
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), "cluster-id", diagnosticsLogsType, gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ string, _ string, upfile io.Reader) error {
+					gr, err := gzip.NewReader(upfile)
+					Expect(err).NotTo(HaveOccurred())
+					tr := tar.NewReader(gr)
+					for {
+						header, err := tr.Next()
+						if err == io.EOF {
+							break
+						}
+						Expect(err).NotTo(HaveOccurred())
+						content, err := ioutil.ReadAll(tr)
+						Expect(err).NotTo(HaveOccurred())
+						bundle[header.Name] = string(content)
+					}
+					return nil
+				}).Times(1)
+			l.Info("before failure")
+			c.GatherFailureDiagnostics(context.Background())
+			Expect(bundle[diagnosticsControllerLogsName]).To(ContainSubstring("msg=\"before failure\""))
+
+			l.Info("after failure")
+			stop := make(chan struct{})
+			close(stop)
+			c.UploadLogsTail(context.Background(), stop)
+			Expect(uploads).NotTo(Receive())
+		})
+		It("doesn't upload on dry run", func() {
+			c.DryRun = true
+			stop := make(chan struct{})
+			close(stop)
+			c.UploadLogsTail(context.Background(), stop)
+			Expect(uploads).NotTo(Receive())
+		})
+	})
+})
@@ -0,0 +1,119 @@
+package assisted_installer_controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// maxMCSLogsSize bounds the mcs logs that are retained for matching hosts that pulled ignition
+	maxMCSLogsSize = 1024 * 1024
+	// mcsLogsInitialSinceSeconds is how far back the logs of an mcs pod are fetched for the first time
+	mcsLogsInitialSinceSeconds = int64(generalWaitTimeoutInt * 10)
+	// mcsLogsTailLines bounds the lines of every fetch
+	mcsLogsTailLines = int64(10000)
+)
+
+type mcsLogsTracker struct {
+	lastFetch map[string]time.Time
+	lastLine  map[string]string
+	logs      string
+	// selector is the candidate the mcs pods were last found with
+	selector string
+}
+
+func newMCSLogsTracker() *mcsLogsTracker {
+	return &mcsLogsTracker{
+		lastFetch: make(map[string]time.Time),
+		lastLine:  make(map[string]string),
+	}
+}
+
+// append adds the pod logs that were not seen yet, dropping everything up to the last line of the previous fetch
+func (t *mcsLogsTracker) append(podName string, podLogs string) {
+	trimmed := strings.TrimRight(podLogs, "\n")
+	if trimmed == "" {
+		return
+	}
+	newLogs := podLogs
+	if lastLine := t.lastLine[podName]; lastLine != "" {
+		if i := strings.LastIndex(podLogs, lastLine); i >= 0 {
+			newLogs = strings.TrimPrefix(podLogs[i+len(lastLine):], "\n")
+		}
+	}
+	t.lastLine[podName] = trimmed[strings.LastIndex(trimmed, "\n")+1:]
+	if newLogs == "" {
+		return
+	}
+	if !strings.HasSuffix(newLogs, "\n") {
+		newLogs += "\n"
+	}
+	t.logs += newLogs
+	if len(t.logs) > maxMCSLogsSize {
+		t.logs = t.logs[len(t.logs)-maxMCSLogsSize:]
+		// don't keep a partial line
+		if i := strings.Index(t.logs, "\n"); i >= 0 {
+			t.logs = t.logs[i+1:]
+		}
+	}
+}
+
+// PodSelector selects the pods matching Labels in Namespace
+type PodSelector struct {
+	Namespace string            `json:"namespace"`
+	Labels    map[string]string `json:"labels"`
+}
+
+func (s PodSelector) String() string {
+	return fmt.Sprintf("%s/%s", s.Namespace, labels.SelectorFromSet(s.Labels))
+}
+
+// PodSelectors is decoded by envconfig from a json list of selectors
+type PodSelectors []PodSelector
+
+func (p *PodSelectors) Decode(value string) error {
+	var selectors []PodSelector
+	if err := json.Unmarshal([]byte(value), &selectors); err != nil {
+		return fmt.Errorf("failed to decode pod selectors %q: %s", value, err)
+	}
+	for i, selector := range selectors {
+		if selector.Namespace == "" || len(selector.Labels) == 0 {
+			return fmt.Errorf("pod selector %d must have both namespace and labels", i)
+		}
+	}
+	*p = selectors
+	return nil
+}
+
+// mcsPodCandidates returns the configured mcs selector followed by McsCandidates, where the mcs pods of other
+// OpenShift versions may be found
+func (c controller) mcsPodCandidates() []PodSelector {
+	namespace, labels := c.mcsPodSelector()
+	return append([]PodSelector{{Namespace: namespace, Labels: labels}}, c.McsCandidates...)
+}
+
+// discoverMCSPods returns the pods of the first candidate that has any, the candidate is logged whenever it changes.
+// It returns false if no candidate has pods
+func (c *controller) discoverMCSPods() (PodSelector, []v1.Pod, bool) {
+	for _, candidate := range c.mcsPodCandidates() {
+		pods, err := c.kc.GetPods(candidate.Namespace, candidate.Labels)
+		if err != nil {
+			c.log.WithError(err).Warnf("Failed to get mcs pods of %s", candidate)
+			continue
+		}
+		if len(pods) == 0 {
+			continue
+		}
+		if selector := candidate.String(); selector != c.mcsLogs.selector {
+			c.log.Infof("Found %d mcs pods with %s", len(pods), selector)
+			c.mcsLogs.selector = selector
+		}
+		return candidate, pods, true
+	}
+	return PodSelector{}, nil, false
+}
@@ -0,0 +1,120 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/openshift/assisted-installer/src/version"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "assisted_controller"
+
+type controllerMetrics struct {
+	registry                 *prometheus.Registry
+	buildInfo                *prometheus.GaugeVec
+	nodesPending             prometheus.Gauge
+	csrsApproved             prometheus.Counter
+	bmhsUpdated              prometheus.Counter
+	bmhsPending              prometheus.Gauge
+	hostsErrored             prometheus.Counter
+	hostsJoinTimedOut        prometheus.Counter
+	goRoutinePanics          *prometheus.CounterVec
+	postInstallStageDuration *prometheus.HistogramVec
+	inventoryRequestDuration *prometheus.HistogramVec
+	inventoryRequestErrors   *prometheus.CounterVec
+}
+
+// newControllerMetrics creates the controller metrics on their own registry,
+// so every controller instance exposes only its own values
+func newControllerMetrics() *controllerMetrics {
+	m := &controllerMetrics{
+		registry: prometheus.NewRegistry(),
+		buildInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "build_info",
+			Help:      "Build information of the running controller, always 1",
+		}, []string{"version", "commit", "build_date"}),
+		nodesPending: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "nodes_pending",
+			Help:      "Number of hosts that didn't join the cluster yet",
+		}),
+		csrsApproved: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "csrs_approved_total",
+			Help:      "Number of csrs approved by the controller",
+		}),
+		bmhsUpdated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "bmhs_updated_total",
+			Help:      "Number of BMHs whose status was updated from the status annotation",
+		}),
+		bmhsPending: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "bmhs_pending",
+			Help:      "Number of BMHs whose status wasn't updated from the status annotation yet",
+		}),
+		hostsErrored: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "hosts_errored_total",
+			Help:      "Number of hosts that moved to error while waiting for the nodes to join",
+		}),
+		hostsJoinTimedOut: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "hosts_join_timed_out_total",
+			Help:      "Number of hosts that didn't join the cluster within the host join timeout",
+		}),
+		goRoutinePanics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "goroutine_panics_total",
+			Help:      "Number of panics recovered in each controller go routine",
+		}, []string{"goroutine"}),
+		postInstallStageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "post_install_stage_duration_seconds",
+			Help:      "Time spent in each PostInstallConfigs stage",
+			Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+		}, []string{"stage"}),
+		inventoryRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "inventory_request_duration_seconds",
+			Help:      "Time spent in each assisted-service request",
+			Buckets:   []float64{0.1, 0.5, 1, 5, 15, 30, 60},
+		}, []string{"method"}),
+		inventoryRequestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "inventory_request_errors_total",
+			Help:      "Number of assisted-service requests that failed",
+		}, []string{"method"}),
+	}
+	m.buildInfo.WithLabelValues(version.Version, version.GitCommit, version.BuildDate).Set(1)
+	m.registry.MustRegister(m.buildInfo, m.nodesPending, m.csrsApproved, m.bmhsUpdated, m.bmhsPending, m.hostsErrored, m.hostsJoinTimedOut, m.goRoutinePanics,
+		m.postInstallStageDuration, m.inventoryRequestDuration, m.inventoryRequestErrors)
+	return m
+}
+
+func (m *controllerMetrics) observePostInstallStage(stage string, elapsed time.Duration) {
+	m.postInstallStageDuration.WithLabelValues(stage).Observe(elapsed.Seconds())
+}
+
+// ServeMetrics exposes the controller metrics on /metrics till the context is cancelled
+func (c *controller) ServeMetrics(ctx context.Context) {
+	if c.MetricsAddress == "" {
+		c.log.Infof("Metrics address is not set, metrics will not be served")
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(c.metrics.registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: c.MetricsAddress, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	c.log.Infof("Serving metrics on %s", c.MetricsAddress)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		c.log.WithError(err).Errorf("Failed to serve metrics on %s", c.MetricsAddress)
+	}
+}
@@ -0,0 +1,31 @@
+package assisted_installer_controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// hostIDAnnotation is the node annotation with the id of the assisted-service host the node runs on
+const hostIDAnnotation = "assisted-installer.openshift.io/host-id"
+
+// annotateNodeHostID annotates the node with its host id unless it already has it or it was already annotated,
+// so it is annotated once even across restarts. It is best effort, a failure is only logged and retried on the next poll
+func (c *controller) annotateNodeHostID(node *v1.Node, hostId string) {
+	if !c.AnnotateNodes || node.Annotations[hostIDAnnotation] == hostId || c.annotatedNodes[node.Name] == hostId {
+		return
+	}
+	hostLog := c.log.WithField("host_id", hostId)
+	if c.DryRun {
+		hostLog.Infof("Dry run: skipping annotation of node %s with host id %s", node.Name, hostId)
+		return
+	}
+	if c.isPaused() {
+		hostLog.Infof("Paused: skipping annotation of node %s with host id %s", node.Name, hostId)
+		return
+	}
+	if err := c.kc.AnnotateNode(node.Name, map[string]string{hostIDAnnotation: hostId}); err != nil {
+		hostLog.WithError(err).Warnf("Failed to annotate node %s with host id %s", node.Name, hostId)
+		return
+	}
+	c.annotatedNodes[node.Name] = hostId
+	hostLog.Infof("Annotated node %s with host id %s", node.Name, hostId)
+}
@@ -0,0 +1,86 @@
+package assisted_installer_controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	v1 "k8s.io/api/core/v1"
+)
+
+// pendingHostSummary describes why a host didn't join, by its last inventory status and stage
+// and by the node that matches it in case the node joined but isn't ready
+type pendingHostSummary struct {
+	HostID     string
+	Name       string
+	Status     string
+	Stage      string
+	Node       string
+	NodeReason string
+}
+
+func (s pendingHostSummary) String() string {
+	summary := fmt.Sprintf("%s (%s) status %s stage %s", s.HostID, s.Name, s.Status, s.Stage)
+	if s.Node == "" {
+		return summary + ", node never appeared"
+	}
+	return summary + fmt.Sprintf(", node %s is not ready: %s", s.Node, s.NodeReason)
+}
+
+// summarizePendingHosts correlates the pending hosts with the nodes by name and otherwise by system uuid,
+// the summaries are sorted by host id
+func summarizePendingHosts(hosts map[string]inventory_client.HostData, nodes *v1.NodeList) []pendingHostSummary {
+	summaries := make([]pendingHostSummary, 0, len(hosts))
+	for name, host := range hosts {
+		summary := pendingHostSummary{HostID: host.Host.ID.String(), Name: name, Status: "unknown", Stage: "unknown"}
+		if host.Host.Status != nil {
+			summary.Status = *host.Host.Status
+		}
+		if host.Host.Progress != nil && host.Host.Progress.CurrentStage != "" {
+			summary.Stage = string(host.Host.Progress.CurrentStage)
+		}
+		if node := findPendingHostNode(name, host, nodes); node != nil {
+			summary.Node = node.Name
+			summary.NodeReason = nodeNotReadyReason(node)
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].HostID < summaries[j].HostID })
+	return summaries
+}
+
+func findPendingHostNode(name string, host inventory_client.HostData, nodes *v1.NodeList) *v1.Node {
+	if nodes == nil {
+		return nil
+	}
+	for i := range nodes.Items {
+		if nodes.Items[i].Name == name {
+			return &nodes.Items[i]
+		}
+	}
+	for i := range nodes.Items {
+		if strings.EqualFold(host.Host.ID.String(), nodes.Items[i].Status.NodeInfo.SystemUUID) {
+			return &nodes.Items[i]
+		}
+	}
+	return nil
+}
+
+// nodeNotReadyReason describes the Ready condition of the node
+func nodeNotReadyReason(node *v1.Node) string {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type != v1.NodeReady {
+			continue
+		}
+		reason := fmt.Sprintf("Ready is %s", condition.Status)
+		if condition.Reason != "" {
+			reason += fmt.Sprintf(", %s", condition.Reason)
+		}
+		if condition.Message != "" {
+			reason += fmt.Sprintf(", %s", condition.Message)
+		}
+		return reason
+	}
+	return "no Ready condition"
+}
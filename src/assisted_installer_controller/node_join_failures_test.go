@@ -0,0 +1,65 @@
+package assisted_installer_controller
+
+import (
+	"github.com/go-openapi/strfmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/openshift/assisted-service/models"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("pending hosts summary", func() {
+	var (
+		hosts map[string]inventory_client.HostData
+		nodes *v1.NodeList
+	)
+	newHost := func(id, status string, stage models.HostStage) inventory_client.HostData {
+		hostId := strfmt.UUID(id)
+		return inventory_client.HostData{Host: &models.Host{ID: &hostId, Status: &status,
+			Progress: &models.HostProgressInfo{CurrentStage: stage}}}
+	}
+	newNode := func(name, systemUUID string, conditions ...v1.NodeCondition) v1.Node {
+		return v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{SystemUUID: systemUUID}, Conditions: conditions}}
+	}
+
+	BeforeEach(func() {
+		hosts = map[string]inventory_client.HostData{
+			"node0": newHost("7916fa89-ea7a-443e-a862-b3e930309f65", models.HostStatusInstalling, models.HostStageRebooting),
+			"node1": newHost("eb82821f-bf21-4614-9a3b-ecb07929f238", models.HostStatusInstallingInProgress, models.HostStageJoined),
+			"node2": newHost("b898d516-3e16-49d0-86a5-0ad5bd04e3ed", models.HostStatusInstallingInProgress, models.HostStageConfiguring),
+		}
+		nodes = &v1.NodeList{Items: []v1.Node{
+			newNode("node1", "6d6f00e8-70dd-48a5-859a-0f1459485ad9", v1.NodeCondition{Type: v1.NodeReady,
+				Status: v1.ConditionFalse, Reason: "KubeletNotReady", Message: "network plugin is not ready"}),
+			// joined under another name than the inventory hostname
+			newNode("master-2", "B898D516-3E16-49D0-86A5-0AD5BD04E3ED"),
+		}}
+	})
+
+	It("summarizes never appeared and not ready hosts", func() {
+		summaries := summarizePendingHosts(hosts, nodes)
+		Expect(summaries).To(Equal([]pendingHostSummary{
+			{HostID: "7916fa89-ea7a-443e-a862-b3e930309f65", Name: "node0", Status: models.HostStatusInstalling,
+				Stage: string(models.HostStageRebooting)},
+			{HostID: "b898d516-3e16-49d0-86a5-0ad5bd04e3ed", Name: "node2", Status: models.HostStatusInstallingInProgress,
+				Stage: string(models.HostStageConfiguring), Node: "master-2", NodeReason: "no Ready condition"},
+			{HostID: "eb82821f-bf21-4614-9a3b-ecb07929f238", Name: "node1", Status: models.HostStatusInstallingInProgress,
+				Stage: string(models.HostStageJoined), Node: "node1",
+				NodeReason: "Ready is False, KubeletNotReady, network plugin is not ready"},
+		}))
+		Expect(summaries[0].String()).To(Equal(
+			"7916fa89-ea7a-443e-a862-b3e930309f65 (node0) status installing stage Rebooting, node never appeared"))
+		Expect(summaries[2].String()).To(Equal("eb82821f-bf21-4614-9a3b-ecb07929f238 (node1) status installing-in-progress " +
+			"stage Joined, node node1 is not ready: Ready is False, KubeletNotReady, network plugin is not ready"))
+	})
+	It("summarizes the hosts without nodes and inventory progress", func() {
+		hostId := strfmt.UUID("7916fa89-ea7a-443e-a862-b3e930309f65")
+		summaries := summarizePendingHosts(map[string]inventory_client.HostData{"node0": {Host: &models.Host{ID: &hostId}}}, nil)
+		Expect(summaries).To(Equal([]pendingHostSummary{
+			{HostID: "7916fa89-ea7a-443e-a862-b3e930309f65", Name: "node0", Status: "unknown", Stage: "unknown"},
+		}))
+	})
+})
@@ -0,0 +1,51 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	v1 "k8s.io/api/core/v1"
+)
+
+// joinStallDetector tells once that no node joined within the window, it is armed again by the next join
+type joinStallDetector struct {
+	window     time.Duration
+	lastJoined int
+	lastJoin   time.Time
+	reported   bool
+}
+
+func newJoinStallDetector(window time.Duration, now time.Time) *joinStallDetector {
+	return &joinStallDetector{window: window, lastJoin: now}
+}
+
+// update records the joined nodes and returns true the first time no node joined within the window
+func (d *joinStallDetector) update(now time.Time, joined int) bool {
+	if joined > d.lastJoined {
+		d.lastJoined = joined
+		d.lastJoin = now
+		d.reported = false
+		return false
+	}
+	if d.window <= 0 || d.reported || now.Sub(d.lastJoin) < d.window {
+		return false
+	}
+	d.reported = true
+	return true
+}
+
+func (c *controller) handleNodeJoinStall(ctx context.Context, joined int, expected int, pendingHosts map[string]inventory_client.HostData) {
+	names := make([]string, 0, len(pendingHosts))
+	for name := range pendingHosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	c.log.Warnf("No node joined in the last %s, joined %d of %d nodes, hosts still pending: %s",
+		c.NodeJoinStallWindow, joined, expected, strings.Join(names, ", "))
+	c.recordEvent(ctx, clusterObjectReference, v1.EventTypeWarning, eventReasonNodesJoinStalled,
+		fmt.Sprintf("No node joined in the last %s, joined %d of %d nodes", c.NodeJoinStallWindow, joined, expected))
+}
@@ -0,0 +1,33 @@
+package assisted_installer_controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("nodes join stall detection", func() {
+	start := time.Now()
+
+	It("reports a stall once no node joined within the window", func() {
+		d := newJoinStallDetector(10*time.Minute, start)
+		Expect(d.update(start.Add(5*time.Minute), 0)).To(BeFalse())
+		Expect(d.update(start.Add(10*time.Minute-time.Second), 0)).To(BeFalse())
+		Expect(d.update(start.Add(10*time.Minute), 0)).To(BeTrue())
+		Expect(d.update(start.Add(15*time.Minute), 0)).To(BeFalse())
+	})
+	It("restarts the window on every join", func() {
+		d := newJoinStallDetector(10*time.Minute, start)
+		Expect(d.update(start.Add(8*time.Minute), 2)).To(BeFalse())
+		Expect(d.update(start.Add(12*time.Minute), 2)).To(BeFalse())
+		Expect(d.update(start.Add(18*time.Minute), 2)).To(BeTrue())
+		Expect(d.update(start.Add(20*time.Minute), 3)).To(BeFalse())
+		Expect(d.update(start.Add(29*time.Minute), 3)).To(BeFalse())
+		Expect(d.update(start.Add(30*time.Minute), 3)).To(BeTrue())
+	})
+	It("doesn't report a stall without a window", func() {
+		d := newJoinStallDetector(0, start)
+		Expect(d.update(start.Add(time.Hour), 0)).To(BeFalse())
+	})
+})
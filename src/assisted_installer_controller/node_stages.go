@@ -0,0 +1,35 @@
+package assisted_installer_controller
+
+import (
+	"github.com/openshift/assisted-service/models"
+	v1 "k8s.io/api/core/v1"
+)
+
+// nodeStages are the host stages that NOT_READY_NODE_STAGE and READY_NODE_STAGE may contain
+var nodeStages = []models.HostStage{models.HostStageRebooting, models.HostStageConfiguring, models.HostStageJoined}
+
+// nodeStage maps the node of a host to the stage to report: a node that isn't ready is reported with
+// NotReadyNodeStage, a ready node with ReadyNodeStage and on the following polls with Done. Without
+// ReadyNodeStage a ready node is reported with Done right away
+func (c *controller) nodeStage(hostId string, node *v1.Node) models.HostStage {
+	switch {
+	case !isNodeReady(node):
+		if c.NotReadyNodeStage == "" {
+			return models.HostStageJoined
+		}
+		return c.NotReadyNodeStage
+	case c.ReadyNodeStage == "" || c.readyStageReported[hostId]:
+		return models.HostStageDone
+	default:
+		return c.ReadyNodeStage
+	}
+}
+
+func containsHostStage(stages []models.HostStage, stage models.HostStage) bool {
+	for _, item := range stages {
+		if item == stage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package assisted_installer_controller
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// NodesJoinSummary describes how waiting for the nodes to join went
+type NodesJoinSummary struct {
+	// AllJoined is false when the wait was cancelled or the installation was failed
+	AllJoined bool
+	Joined    int
+	Expected  int
+	Duration  time.Duration
+	// NotReadyNodes are the nodes that were found not ready on any of the polls
+	NotReadyNodes []string
+}
+
+func (c *controller) nodesJoinSummary(allJoined bool, duration time.Duration, notReadyNodes map[string]bool) NodesJoinSummary {
+	joined, expected := c.progress.joinedNodes()
+	summary := NodesJoinSummary{AllJoined: allJoined, Joined: joined, Expected: expected, Duration: duration}
+	for name := range notReadyNodes {
+		summary.NotReadyNodes = append(summary.NotReadyNodes, name)
+	}
+	sort.Strings(summary.NotReadyNodes)
+	return summary
+}
+
+func (s NodesJoinSummary) log(log *logrus.Entry) {
+	log.WithFields(logrus.Fields{
+		"all_joined":      s.AllJoined,
+		"joined":          s.Joined,
+		"expected":        s.Expected,
+		"duration":        s.Duration.Round(time.Second).String(),
+		"not_ready_nodes": strings.Join(s.NotReadyNodes, ","),
+	}).Infof("Nodes join summary: %d of %d nodes joined in %s", s.Joined, s.Expected, s.Duration.Round(time.Second))
+}
@@ -0,0 +1,84 @@
+package assisted_installer_controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// notifyTimeout bounds every attempt to post the completion notification
+	notifyTimeout     = 10 * time.Second
+	notifyMaxAttempts = 3
+)
+
+// completionNotification is posted to the notifier once the installation completes
+type completionNotification struct {
+	ClusterID string `json:"clusterId"`
+	Success   bool   `json:"success"`
+	ErrorInfo string `json:"errorInfo,omitempty"`
+	Duration  string `json:"duration"`
+}
+
+// completionNotifier tells the operators about the installation completion, e.g. through a slack webhook
+type completionNotifier interface {
+	notify(ctx context.Context, notification completionNotification) error
+}
+
+// webhookNotifier posts the notification as json to url
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookNotifier(url string) *webhookNotifier {
+	return &webhookNotifier{url: url, client: &http.Client{Timeout: notifyTimeout}}
+}
+
+func (n *webhookNotifier) notify(ctx context.Context, notification completionNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode completion notification")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create completion notification request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to post completion notification")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("completion notification was rejected with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notifyCompletion sends the completion notification, failures are only logged as it is best effort.
+// The notification and its retries are aborted once ctx is cancelled
+func (c controller) notifyCompletion(ctx context.Context, isSuccess bool, errorInfo string) {
+	if c.notifier == nil {
+		return
+	}
+	notification := completionNotification{
+		ClusterID: c.ClusterID,
+		Success:   isSuccess,
+		ErrorInfo: errorInfo,
+		Duration:  c.clock.Since(c.started).Round(time.Second).String(),
+	}
+	err := c.retryWithBackoff(ctx, notifyMaxAttempts, func() error {
+		return c.notifier.notify(ctx, notification)
+	})
+	if err != nil {
+		c.log.WithError(err).Warnf("Failed to send completion notification")
+		return
+	}
+	c.log.Infof("Completion notification was sent")
+}
@@ -0,0 +1,100 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// pauseSwitch halts the controller mutations while field engineers intervene manually,
+// the controller keeps observing the cluster while paused and catches up once resumed
+type pauseSwitch struct {
+	sync.Mutex
+	// resumed is closed on resume, it is nil while not paused
+	resumed chan struct{}
+}
+
+func newPauseSwitch() *pauseSwitch {
+	return &pauseSwitch{}
+}
+
+// Pause stops the controller mutations till Resume is called
+func (c *controller) Pause() {
+	c.pause.Lock()
+	defer c.pause.Unlock()
+	if c.pause.resumed != nil {
+		return
+	}
+	c.pause.resumed = make(chan struct{})
+	c.log.Warnf("Controller is paused, csrs, hosts, cluster and BMHs will not be updated till it is resumed")
+}
+
+// Resume lets the controller mutate again
+func (c *controller) Resume() {
+	c.pause.Lock()
+	defer c.pause.Unlock()
+	if c.pause.resumed == nil {
+		return
+	}
+	close(c.pause.resumed)
+	c.pause.resumed = nil
+	c.log.Infof("Controller is resumed")
+}
+
+func (c controller) isPaused() bool {
+	c.pause.Lock()
+	defer c.pause.Unlock()
+	return c.pause.resumed != nil
+}
+
+// waitWhilePaused blocks till the controller is resumed or ctx is cancelled
+func (c controller) waitWhilePaused(ctx context.Context) error {
+	c.pause.Lock()
+	resumed := c.pause.resumed
+	c.pause.Unlock()
+	if resumed == nil {
+		return nil
+	}
+	c.log.Infof("Waiting for the controller to be resumed")
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "controller was not resumed")
+	}
+}
+
+// pauseHandler pauses or resumes the controller on POST requests
+func pauseHandler(toggle func()) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		toggle()
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// ServePause pauses and resumes the controller on POST requests to /pause and /resume till the context is
+// cancelled. The requests aren't authenticated, so they are served on PauseAddress only and not with the metrics
+func (c *controller) ServePause(ctx context.Context) {
+	if c.PauseAddress == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/pause", pauseHandler(c.Pause))
+	mux.Handle("/resume", pauseHandler(c.Resume))
+	server := &http.Server{Addr: c.PauseAddress, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	c.log.Infof("Serving pause and resume requests on %s", c.PauseAddress)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		c.log.WithError(err).Errorf("Failed to serve pause and resume requests on %s", c.PauseAddress)
+	}
+}
@@ -0,0 +1,47 @@
+package assisted_installer_controller
+
+import (
+	"context"
+
+	"github.com/openshift/assisted-installer/src/common"
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/pkg/errors"
+)
+
+// preflight checks that assisted-service and the cluster API are reachable before any loop starts, so a bad url,
+// token or kubeconfig fails the controller right away. Transient errors are retried till PreflightTimeout,
+// a non positive PreflightTimeout skips the checks
+func (c *controller) preflight(ctx context.Context) error {
+	if c.PreflightTimeout <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.PreflightTimeout)
+	defer cancel()
+	c.log.Infof("Running pre-flight checks")
+	err := c.retryWithBackoff(ctx, 0, func() error {
+		_, err := c.ic.GetCluster(ctx)
+		if err == nil {
+			return nil
+		}
+		c.log.WithError(err).Warnf("Pre-flight check of assisted-service failed")
+		if !inventory_client.IsTransient(err) {
+			return common.PermanentError(err)
+		}
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "assisted-service at %s is not reachable or rejected the cluster %s", c.URL, c.ClusterID)
+	}
+	err = c.retryWithBackoff(ctx, 0, func() error {
+		_, err := c.kc.ListNodes()
+		if err != nil {
+			c.log.WithError(err).Warnf("Pre-flight check of the cluster API failed")
+		}
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "the cluster API is not reachable")
+	}
+	c.log.Infof("Pre-flight checks passed")
+	return nil
+}
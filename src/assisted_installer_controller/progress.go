@@ -0,0 +1,145 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	// nodesProgressWeight is the part of the overall progress that belongs to nodes joining the cluster,
+	// the rest is split evenly between the post install stages
+	nodesProgressWeight = 70
+	postInstallStages   = 3
+)
+
+// calculateProgress returns the overall installation percentage of the joined nodes and the done post install stages.
+// Without expected nodes there is nothing to wait for, so the nodes part is considered done
+func calculateProgress(expectedNodes int, joinedNodes int, ingressCADone bool, etcdUnpatched bool, consoleReady bool) int {
+	nodesProgress := nodesProgressWeight
+	if expectedNodes > 0 {
+		if joinedNodes > expectedNodes {
+			joinedNodes = expectedNodes
+		}
+		if joinedNodes < 0 {
+			joinedNodes = 0
+		}
+		nodesProgress = nodesProgressWeight * joinedNodes / expectedNodes
+	}
+	stagesDone := 0
+	for _, done := range []bool{ingressCADone, etcdUnpatched, consoleReady} {
+		if done {
+			stagesDone++
+		}
+	}
+	return nodesProgress + (100-nodesProgressWeight)*stagesDone/postInstallStages
+}
+
+// progressTracker holds the progress state that is updated by the controller go routines
+type progressTracker struct {
+	sync.Mutex
+	expectedNodes int
+	pendingNodes  int
+	ingressCADone bool
+	etcdUnpatched bool
+	consoleReady  bool
+	lastReported  int
+}
+
+func newProgressTracker() *progressTracker {
+	return &progressTracker{lastReported: -1}
+}
+
+// setPendingNodes updates the nodes that didn't join yet, the first and largest count is taken as the expected nodes.
+// It returns the expected nodes
+func (t *progressTracker) setPendingNodes(pending int) int {
+	t.Lock()
+	defer t.Unlock()
+	if pending > t.expectedNodes {
+		t.expectedNodes = pending
+	}
+	t.pendingNodes = pending
+	return t.expectedNodes
+}
+
+// restore sets the expected nodes and the done post install stages of a checkpoint
+func (t *progressTracker) restore(state ProgressState) {
+	t.Lock()
+	t.expectedNodes = state.ExpectedNodes
+	t.pendingNodes = state.ExpectedNodes
+	t.Unlock()
+	for _, stage := range state.PostInstallStagesDone {
+		t.setStageDone(stage)
+	}
+}
+
+// setExpectedNodes raises the expected nodes to the configured count, the nodes that didn't join
+// yet are raised as well till the first poll tells how many are pending
+func (t *progressTracker) setExpectedNodes(expected int) {
+	t.Lock()
+	defer t.Unlock()
+	if expected <= t.expectedNodes {
+		return
+	}
+	t.pendingNodes += expected - t.expectedNodes
+	t.expectedNodes = expected
+}
+
+// joinedNodes returns how many of the expected nodes joined
+func (t *progressTracker) joinedNodes() (int, int) {
+	t.Lock()
+	defer t.Unlock()
+	return t.expectedNodes - t.pendingNodes, t.expectedNodes
+}
+
+// setStageDone marks one of the post install stages that count for the progress as done
+func (t *progressTracker) setStageDone(stage string) {
+	t.Lock()
+	defer t.Unlock()
+	switch stage {
+	case "add_router_ca":
+		t.ingressCADone = true
+	case "unpatch_etcd":
+		t.etcdUnpatched = true
+	case "wait_for_console":
+		t.consoleReady = true
+	}
+}
+
+func (t *progressTracker) percentage() int {
+	t.Lock()
+	defer t.Unlock()
+	return calculateProgress(t.expectedNodes, t.expectedNodes-t.pendingNodes, t.ingressCADone, t.etcdUnpatched, t.consoleReady)
+}
+
+// postInstallStageDone reports the progress of a post install stage that finished successfully
+func (c controller) postInstallStageDone(ctx context.Context, stage string) {
+	c.progress.setStageDone(stage)
+	c.checkpointStageDone(stage)
+	c.reportProgress(ctx)
+}
+
+// reportProgress sends the overall progress to assisted-service in case it changed since the last report
+func (c controller) reportProgress(ctx context.Context) {
+	percentage := c.progress.percentage()
+	c.progress.Lock()
+	lastReported := c.progress.lastReported
+	c.progress.Unlock()
+	if percentage == lastReported {
+		return
+	}
+	if c.DryRun {
+		c.log.Infof("Dry run: skipping progress update to %d%%", percentage)
+		return
+	}
+	if c.isPaused() {
+		c.log.Infof("Paused: skipping progress update to %d%%", percentage)
+		return
+	}
+	if err := c.ic.UpdateClusterProgress(ctx, c.ClusterID, percentage); err != nil {
+		c.log.WithError(err).Warnf("Failed to update cluster progress to %d%%", percentage)
+		return
+	}
+	c.progress.Lock()
+	c.progress.lastReported = percentage
+	c.progress.Unlock()
+}
@@ -0,0 +1,96 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ReadinessCheck waits for at least RunningCount pods matching Labels to run in Namespace
+type ReadinessCheck struct {
+	Name         string            `json:"name"`
+	Namespace    string            `json:"namespace"`
+	Labels       map[string]string `json:"labels"`
+	RunningCount int               `json:"runningCount"`
+}
+
+// ReadinessChecks is decoded by envconfig from a json list of checks
+type ReadinessChecks []ReadinessCheck
+
+func (r *ReadinessChecks) Decode(value string) error {
+	var checks []ReadinessCheck
+	if err := json.Unmarshal([]byte(value), &checks); err != nil {
+		return fmt.Errorf("failed to decode readiness checks %q: %s", value, err)
+	}
+	for i := range checks {
+		if checks[i].Namespace == "" {
+			return fmt.Errorf("readiness check %d has no namespace", i)
+		}
+		if checks[i].Name == "" {
+			checks[i].Name = checks[i].Namespace
+		}
+		if checks[i].RunningCount <= 0 {
+			checks[i].RunningCount = 1
+		}
+	}
+	*r = checks
+	return nil
+}
+
+// waitForReadinessChecks returns the checks that didn't pass till ReadinessChecksTimeout, none once cancelled
+func (c controller) waitForReadinessChecks(ctx context.Context) []string {
+	if len(c.ReadinessChecks) == 0 {
+		return nil
+	}
+	c.log.Infof("Waiting for %d readiness checks", len(c.ReadinessChecks))
+	pending := append(ReadinessChecks{}, c.ReadinessChecks...)
+	deadline := c.clock.Now().Add(c.ReadinessChecksTimeout)
+	for {
+		var stillPending ReadinessChecks
+		for _, check := range pending {
+			if !c.isReadinessCheckPassed(check) {
+				stillPending = append(stillPending, check)
+			}
+		}
+		pending = stillPending
+		if len(pending) == 0 {
+			c.log.Infof("All readiness checks passed")
+			return nil
+		}
+		if c.ReadinessChecksTimeout > 0 && c.clock.Now().After(deadline) {
+			var failed []string
+			for _, check := range pending {
+				c.log.Warnf("Readiness check %s didn't pass after %s", check.Name, c.ReadinessChecksTimeout)
+				failed = append(failed, fmt.Sprintf("readiness check %s didn't pass after %s", check.Name, c.ReadinessChecksTimeout))
+			}
+			return failed
+		}
+		select {
+		case <-ctx.Done():
+			c.log.WithError(ctx.Err()).Warnf("Stopped waiting for %d readiness checks", len(pending))
+			return nil
+		case <-c.clock.After(c.pollInterval()):
+		}
+	}
+}
+
+func (c controller) isReadinessCheckPassed(check ReadinessCheck) bool {
+	pods, err := c.kc.GetPods(check.Namespace, check.Labels)
+	if err != nil {
+		c.log.WithError(err).Warnf("Failed to get pods of readiness check %s", check.Name)
+		return false
+	}
+	running := 0
+	for _, pod := range pods {
+		if pod.Status.Phase == v1.PodRunning {
+			running++
+		}
+	}
+	if running < check.RunningCount {
+		c.log.Infof("Readiness check %s has %d running pods out of %d", check.Name, running, check.RunningCount)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package assisted_installer_controller
+
+import (
+	"github.com/openshift/assisted-service/models"
+	v1 "k8s.io/api/core/v1"
+)
+
+// enoughMastersReady tells whether all the control plane replicas of the cluster are ready, so a finalizing cluster
+// is not trusted before its masters actually joined. MinReadyMasters are required when the cluster hosts are unknown,
+// non positive MinReadyMasters skips the check
+func (c controller) enoughMastersReady(cluster *models.Cluster) bool {
+	if c.MinReadyMasters <= 0 {
+		return true
+	}
+	required := controlPlaneReplicas(cluster)
+	if required == 0 {
+		required = c.MinReadyMasters
+	}
+	nodes, err := c.kc.ListMasterNodes()
+	if err != nil {
+		c.log.WithError(err).Warnf("Failed to list master nodes")
+		return false
+	}
+	ready := countReadyNodes(nodes)
+	if ready < required {
+		c.log.Infof("Cluster is finalizing but only %d of the required %d masters are ready, waiting", ready, required)
+		return false
+	}
+	return true
+}
+
+// controlPlaneReplicas counts the enabled master hosts of the cluster, the bootstrap host pivots to a master
+// and is counted as well. It is 1 for single node clusters and 0 when the cluster hosts are unknown
+func controlPlaneReplicas(cluster *models.Cluster) int {
+	if cluster == nil {
+		return 0
+	}
+	replicas := 0
+	for _, host := range cluster.Hosts {
+		if host == nil || (host.Status != nil && *host.Status == models.HostStatusDisabled) {
+			continue
+		}
+		if host.Role == models.HostRoleMaster || host.Role == models.HostRoleBootstrap || host.Bootstrap {
+			replicas++
+		}
+	}
+	return replicas
+}
+
+func countReadyNodes(nodes *v1.NodeList) int {
+	ready := 0
+	for i := range nodes.Items {
+		if isNodeReady(&nodes.Items[i]) {
+			ready++
+		}
+	}
+	return ready
+}
@@ -0,0 +1,63 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// goWithRestarts runs a controller go routine that is added to wg and restarts it after a panic
+func (c *controller) goWithRestarts(ctx context.Context, wg *sync.WaitGroup, name string,
+	run func(ctx context.Context, wg *sync.WaitGroup)) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.runWithRestarts(ctx, name, func() {
+			// the go routine marks itself as done, also when it panics
+			wg.Add(1)
+			run(ctx, wg)
+		})
+	}()
+}
+
+// runWithRestarts runs fn and restarts it after a panic up to MaxGoRoutineRestarts times, so a bug that is hit
+// once doesn't abort the installation. Steps that were already done are skipped by the restarted go routines
+func (c *controller) runWithRestarts(ctx context.Context, name string, fn func()) {
+	for restarts := 0; c.runRecovering(name, fn); restarts++ {
+		if restarts >= c.MaxGoRoutineRestarts {
+			c.log.Errorf("%s panicked %d times, not restarting it anymore", name, restarts+1)
+			return
+		}
+		if ctx.Err() != nil {
+			c.log.Warnf("Not restarting %s, it was cancelled", name)
+			return
+		}
+		c.log.Warnf("Restarting %s after panic, restart %d/%d", name, restarts+1, c.MaxGoRoutineRestarts)
+	}
+}
+
+// runRecovering runs fn and returns true if it panicked, the panic is logged with its stack trace
+func (c *controller) runRecovering(name string, fn func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			c.metrics.goRoutinePanics.WithLabelValues(name).Inc()
+			c.log.Errorf("%s panicked: %v\n%s", name, r, debug.Stack())
+		}
+	}()
+	fn()
+	return false
+}
+
+// runRecoveringError runs fn and returns its error, a panic is logged with its stack trace and returned as the error
+func (c *controller) runRecoveringError(name string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.metrics.goRoutinePanics.WithLabelValues(name).Inc()
+			c.log.Errorf("%s panicked: %v\n%s", name, r, debug.Stack())
+			err = fmt.Errorf("panicked: %v", r)
+		}
+	}()
+	return fn()
+}
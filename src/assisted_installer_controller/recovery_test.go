@@ -0,0 +1,89 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/openshift/assisted-installer/src/k8s_client"
+	"github.com/openshift/assisted-installer/src/ops"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/certificates/v1beta1"
+)
+
+var _ = Describe("go routines panic recovery", func() {
+	var (
+		l             = logrus.New()
+		ctrl          *gomock.Controller
+		mockk8sclient *k8s_client.MockK8SClient
+		c             *controller
+	)
+	l.SetOutput(ioutil.Discard)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockk8sclient = k8s_client.NewMockK8SClient(ctrl)
+		c = newTestController(l, ControllerConfig{ClusterID: "cluster-id", MaxGoRoutineRestarts: 2},
+			ops.NewMockOps(ctrl), inventory_client.NewMockInventoryClient(ctrl), mockk8sclient)
+	})
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	It("restarts a go routine that panicked", func() {
+		c.waitInterval = 50 * time.Millisecond
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		listed := make(chan struct{})
+		gomock.InOrder(
+			// approving a nil list panics
+			mockk8sclient.EXPECT().ListCsrs().Return(nil, nil).Times(1),
+			mockk8sclient.EXPECT().ListCsrs().DoAndReturn(func() (*v1beta1.CertificateSigningRequestList, error) {
+				close(listed)
+				return &v1beta1.CertificateSigningRequestList{}, nil
+			}).Times(1),
+			mockk8sclient.EXPECT().ListCsrs().Return(&v1beta1.CertificateSigningRequestList{}, nil).AnyTimes(),
+		)
+		var wg sync.WaitGroup
+		c.goWithRestarts(ctx, &wg, "ApproveCsrs", c.ApproveCsrs)
+		Eventually(listed).Should(BeClosed())
+		cancel()
+		wg.Wait()
+		Expect(testutil.ToFloat64(c.metrics.goRoutinePanics.WithLabelValues("ApproveCsrs"))).To(Equal(float64(1)))
+	})
+	It("stops restarting after MaxGoRoutineRestarts", func() {
+		runs := 0
+		var wg sync.WaitGroup
+		c.goWithRestarts(context.Background(), &wg, "panicking", func(ctx context.Context, wg *sync.WaitGroup) {
+			defer wg.Done()
+			runs++
+			panic("dummy")
+		})
+		wg.Wait()
+		Expect(runs).To(Equal(3))
+		Expect(testutil.ToFloat64(c.metrics.goRoutinePanics.WithLabelValues("panicking"))).To(Equal(float64(3)))
+	})
+	It("doesn't restart a cancelled go routine", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		runs := 0
+		c.runWithRestarts(ctx, "cancelled", func() {
+			runs++
+			cancel()
+			panic("dummy")
+		})
+		Expect(runs).To(Equal(1))
+	})
+	It("doesn't restart a go routine that returned", func() {
+		runs := 0
+		c.runWithRestarts(context.Background(), "returned", func() {
+			runs++
+		})
+		Expect(runs).To(Equal(1))
+	})
+})
@@ -0,0 +1,60 @@
+package assisted_installer_controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// repeatedErrorsSummaryInterval is how often a repeated error is summarized instead of being logged on every attempt
+const repeatedErrorsSummaryInterval = 5 * time.Minute
+
+// repeatedErrorsLogger logs the first occurrence of an error of a retry loop and then a periodic summary of how
+// many times it repeated. Errors are identical when both the error and the format are, so the arguments, such as
+// the attempt number, may change between attempts
+type repeatedErrorsLogger struct {
+	log      *logrus.Entry
+	clock    clock.Clock
+	interval time.Duration
+
+	level   logrus.Level
+	key     string
+	err     error
+	message string
+	repeats int
+	since   time.Time
+}
+
+func newRepeatedErrorsLogger(log *logrus.Entry, clk clock.Clock, interval time.Duration) *repeatedErrorsLogger {
+	return &repeatedErrorsLogger{log: log, clock: clk, interval: interval}
+}
+
+// logf logs err unless it is the same as the last one, the repeats are summarized once every interval
+func (l *repeatedErrorsLogger) logf(level logrus.Level, err error, format string, args ...interface{}) {
+	key := fmt.Sprintf("%s: %v", format, err)
+	now := l.clock.Now()
+	if key != l.key {
+		l.flush()
+		l.log.WithError(err).Logf(level, format, args...)
+		l.level, l.key, l.since = level, key, now
+		return
+	}
+	l.err, l.message = err, fmt.Sprintf(format, args...)
+	l.repeats++
+	if now.Sub(l.since) >= l.interval {
+		l.flush()
+		l.since = now
+	}
+}
+
+// flush logs the summary of the repeats that were not logged yet, it is called once the retry loop is done
+func (l *repeatedErrorsLogger) flush() {
+	if l.repeats == 0 {
+		return
+	}
+	l.log.WithError(l.err).Logf(l.level, "%s (same error %d times in the last %s)", l.message, l.repeats,
+		l.clock.Since(l.since).Round(time.Second))
+	l.repeats = 0
+}
@@ -0,0 +1,68 @@
+package assisted_installer_controller
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+var _ = Describe("repeated errors logger", func() {
+	var (
+		l         *repeatedErrorsLogger
+		hook      *logrustest.Hook
+		fakeClock *clock.FakeClock
+	)
+	BeforeEach(func() {
+		logger, h := logrustest.NewNullLogger()
+		hook = h
+		fakeClock = clock.NewFakeClock(time.Now())
+		l = newRepeatedErrorsLogger(logrus.NewEntry(logger), fakeClock, time.Minute)
+	})
+	messages := func() []string {
+		var messages []string
+		for _, entry := range hook.AllEntries() {
+			messages = append(messages, fmt.Sprintf("%s: %v", entry.Message, entry.Data[logrus.ErrorKey]))
+		}
+		return messages
+	}
+
+	It("collapses duplicate errors into a periodic summary", func() {
+		for attempt := 1; attempt <= 4; attempt++ {
+			l.logf(logrus.ErrorLevel, fmt.Errorf("connection refused"), "Failed to complete installation, attempt %d", attempt)
+			fakeClock.Step(20 * time.Second)
+		}
+		Expect(messages()).To(Equal([]string{
+			"Failed to complete installation, attempt 1: connection refused",
+			"Failed to complete installation, attempt 4 (same error 3 times in the last 1m0s): connection refused",
+		}))
+		Expect(hook.LastEntry().Level).To(Equal(logrus.ErrorLevel))
+	})
+	It("logs a different error right away after summarizing the previous one", func() {
+		l.logf(logrus.WarnLevel, fmt.Errorf("dummy"), "Failed to unpatch etcd")
+		l.logf(logrus.WarnLevel, fmt.Errorf("dummy"), "Failed to unpatch etcd")
+		l.logf(logrus.WarnLevel, fmt.Errorf("forbidden"), "Failed to unpatch etcd")
+		Expect(messages()).To(Equal([]string{
+			"Failed to unpatch etcd: dummy",
+			"Failed to unpatch etcd (same error 1 times in the last 0s): dummy",
+			"Failed to unpatch etcd: forbidden",
+		}))
+	})
+	It("summarizes the pending repeats when flushed", func() {
+		l.logf(logrus.ErrorLevel, fmt.Errorf("dummy"), "Failed to add ingress ca to cluster")
+		fakeClock.Step(10 * time.Second)
+		l.logf(logrus.ErrorLevel, fmt.Errorf("dummy"), "Failed to add ingress ca to cluster")
+		Expect(hook.AllEntries()).To(HaveLen(1))
+		l.flush()
+		Expect(messages()).To(Equal([]string{
+			"Failed to add ingress ca to cluster: dummy",
+			"Failed to add ingress ca to cluster (same error 1 times in the last 10s): dummy",
+		}))
+		l.flush()
+		Expect(hook.AllEntries()).To(HaveLen(2))
+	})
+})
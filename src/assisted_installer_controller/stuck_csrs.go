@@ -0,0 +1,58 @@
+package assisted_installer_controller
+
+import (
+	"sort"
+	"sync"
+)
+
+// stuckCsrMaxPendingPolls is the number of polls an approved csr may still be listed as pending before it is
+// reported as stuck, it is approved again on every poll anyway
+const stuckCsrMaxPendingPolls = 3
+
+// stuckCsrsTracker counts the polls every approved csr was still listed as pending
+type stuckCsrsTracker struct {
+	sync.Mutex
+	pendingPolls map[string]int
+}
+
+func newStuckCsrsTracker() *stuckCsrsTracker {
+	return &stuckCsrsTracker{pendingPolls: make(map[string]int)}
+}
+
+// setApproved records a csr that was approved successfully
+func (t *stuckCsrsTracker) setApproved(name string) {
+	t.Lock()
+	defer t.Unlock()
+	if _, ok := t.pendingPolls[name]; !ok {
+		t.pendingPolls[name] = 0
+	}
+}
+
+// update counts a poll of the pending csrs and returns the approved ones that just became stuck, every csr is
+// returned once. Csrs that are not pending anymore are forgotten
+func (t *stuckCsrsTracker) update(pending []string) []string {
+	t.Lock()
+	defer t.Unlock()
+	pendingSet := make(map[string]bool, len(pending))
+	for _, name := range pending {
+		pendingSet[name] = true
+	}
+	for name := range t.pendingPolls {
+		if !pendingSet[name] {
+			delete(t.pendingPolls, name)
+		}
+	}
+	var stuck []string
+	for _, name := range pending {
+		polls, ok := t.pendingPolls[name]
+		if !ok {
+			continue
+		}
+		t.pendingPolls[name] = polls + 1
+		if polls+1 == stuckCsrMaxPendingPolls+1 {
+			stuck = append(stuck, name)
+		}
+	}
+	sort.Strings(stuck)
+	return stuck
+}
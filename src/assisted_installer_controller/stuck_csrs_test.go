@@ -0,0 +1,32 @@
+package assisted_installer_controller
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("stuck csrs tracker", func() {
+	var t *stuckCsrsTracker
+	BeforeEach(func() {
+		t = newStuckCsrsTracker()
+	})
+	It("reports an approved csr once it is still pending after too many polls", func() {
+		t.setApproved("csr-1")
+		for i := 0; i < stuckCsrMaxPendingPolls; i++ {
+			Expect(t.update([]string{"csr-1", "csr-2"})).To(BeEmpty())
+		}
+		Expect(t.update([]string{"csr-1", "csr-2"})).To(Equal([]string{"csr-1"}))
+		Expect(t.update([]string{"csr-1", "csr-2"})).To(BeEmpty())
+	})
+	It("doesn't report csrs that were not approved", func() {
+		for i := 0; i <= stuckCsrMaxPendingPolls; i++ {
+			Expect(t.update([]string{"csr-1"})).To(BeEmpty())
+		}
+	})
+	It("forgets csrs that are not pending anymore", func() {
+		t.setApproved("csr-1")
+		Expect(t.update([]string{"csr-1"})).To(BeEmpty())
+		Expect(t.update(nil)).To(BeEmpty())
+		Expect(t.pendingPolls).To(BeEmpty())
+	})
+})
@@ -0,0 +1,75 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/openshift/assisted-service/models"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// machineConfigStateAnnotation is set by the machine config daemon, which cordons the node while it is Working
+	machineConfigStateAnnotation = "machineconfiguration.openshift.io/state"
+	machineConfigStateWorking    = "Working"
+)
+
+// uncordonNodes uncordons the nodes that were left unschedulable by an earlier phase of the installation.
+// The nodes of errored hosts, that CORDON_ERRORED_NODES cordons, and the nodes the machine config daemon
+// is updating are left cordoned
+func (c controller) uncordonNodes(ctx context.Context) error {
+	nodes, err := c.kc.ListNodes()
+	if err != nil {
+		return errors.Wrap(err, "Failed to list nodes")
+	}
+	var cordoned []v1.Node
+	for _, node := range nodes.Items {
+		if node.Spec.Unschedulable {
+			cordoned = append(cordoned, node)
+		}
+	}
+	if len(cordoned) == 0 {
+		return nil
+	}
+	erroredHosts := map[string]bool{}
+	if c.CordonErroredNodes {
+		hosts, err := c.ic.GetEnabledHostsNamesHosts(ctx)
+		if err != nil {
+			return errors.Wrap(err, "Failed to get the hosts of the cordoned nodes")
+		}
+		for name, host := range hosts {
+			if host.Host.Status != nil && *host.Host.Status == models.HostStatusError {
+				erroredHosts[name] = true
+			}
+		}
+	}
+	var failed []string
+	for _, node := range cordoned {
+		switch {
+		case erroredHosts[node.Name]:
+			c.log.Infof("Node %s of an errored host stays cordoned", node.Name)
+			continue
+		case node.Annotations[machineConfigStateAnnotation] == machineConfigStateWorking:
+			c.log.Infof("Node %s is being updated by the machine config daemon, not uncordoning it", node.Name)
+			continue
+		case c.DryRun:
+			c.log.Infof("Dry run: skipping uncordon of node %s", node.Name)
+			continue
+		case c.isPaused():
+			c.log.Infof("Paused: skipping uncordon of node %s", node.Name)
+			continue
+		}
+		if err := c.kc.UncordonNode(node.Name); err != nil {
+			c.log.WithError(err).Errorf("Failed to uncordon node %s", node.Name)
+			failed = append(failed, node.Name)
+			continue
+		}
+		c.log.Infof("Uncordoned node %s that was left unschedulable", node.Name)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to uncordon nodes %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strings"
@@ -10,8 +11,8 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func SetConfiguringStatusForHosts(client inventory_client.InventoryClient, inventoryHostsMapWithIp map[string]inventory_client.HostData,
-	mcsLogs string, fromBootstrap bool, log *logrus.Logger) {
+func SetConfiguringStatusForHosts(ctx context.Context, client inventory_client.InventoryClient, inventoryHostsMapWithIp map[string]inventory_client.HostData,
+	mcsLogs string, fromBootstrap bool, log logrus.FieldLogger) {
 	notValidStates := map[models.HostStage]struct{}{models.HostStageConfiguring: {}, models.HostStageJoined: {}, models.HostStageDone: {}}
 	if fromBootstrap {
 		notValidStates[models.HostStageWaitingForIgnition] = struct{}{}
@@ -34,7 +35,7 @@ func SetConfiguringStatusForHosts(client inventory_client.InventoryClient, inven
 				status = models.HostStageWaitingForIgnition
 			}
 			log.Infof("Host %s found in mcs logs, moving it to %s state", host.Host.ID.String(), status)
-			if err := client.UpdateHostInstallProgress(host.Host.ID.String(), status, ""); err != nil {
+			if err := client.UpdateHostInstallProgress(ctx, host.Host.ID.String(), status, ""); err != nil {
 				log.Errorf("Failed to update node installation status, %s", err)
 				continue
 			}
@@ -1,9 +1,12 @@
 package common
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"testing"
+	"time"
 
 	"github.com/go-openapi/strfmt"
 	"github.com/golang/mock/gomock"
@@ -12,6 +15,7 @@ import (
 	"github.com/openshift/assisted-installer/src/inventory_client"
 	"github.com/openshift/assisted-service/models"
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/clock"
 )
 
 func TestCommon(t *testing.T) {
@@ -40,20 +44,106 @@ var _ = Describe("verify common", func() {
 				"node1": {Host: &models.Host{ID: &node1Id, Progress: &models.HostProgressInfo{CurrentStage: models.HostStageRebooting}, Role: models.HostRoleMaster}, IPs: []string{"192.168.126.11", "192.168.11.123", "fe80::5054:ff:fe9a:4739"}},
 				"node2": {Host: &models.Host{ID: &node2Id, Progress: &models.HostProgressInfo{CurrentStage: models.HostStageRebooting}, Role: models.HostRoleWorker}, IPs: []string{"192.168.126.12", "192.168.11.124", "fe80::5054:ff:fe9a:4740"}}}
 
-			mockbmclient.EXPECT().UpdateHostInstallProgress(node1Id.String(), models.HostStageConfiguring, gomock.Any()).Return(fmt.Errorf("dummy")).Times(1)
-			mockbmclient.EXPECT().UpdateHostInstallProgress(node2Id.String(), models.HostStageWaitingForIgnition, gomock.Any()).Return(nil).Times(1)
-			SetConfiguringStatusForHosts(mockbmclient, testInventoryIdsIps, logs, true, l)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), node1Id.String(), models.HostStageConfiguring, gomock.Any()).Return(fmt.Errorf("dummy")).Times(1)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), node2Id.String(), models.HostStageWaitingForIgnition, gomock.Any()).Return(nil).Times(1)
+			SetConfiguringStatusForHosts(context.Background(), mockbmclient, testInventoryIdsIps, logs, true, l)
 			Expect(testInventoryIdsIps["node0"].Host.Progress.CurrentStage).Should(Equal(models.HostStageRebooting))
 			Expect(testInventoryIdsIps["node1"].Host.Progress.CurrentStage).Should(Equal(models.HostStageRebooting))
 			Expect(testInventoryIdsIps["node2"].Host.Progress.CurrentStage).Should(Equal(models.HostStageWaitingForIgnition))
 
-			mockbmclient.EXPECT().UpdateHostInstallProgress(node1Id.String(), models.HostStageConfiguring, gomock.Any()).Return(nil).Times(1)
-			mockbmclient.EXPECT().UpdateHostInstallProgress(node2Id.String(), models.HostStageConfiguring, gomock.Any()).Return(nil).Times(1)
-			SetConfiguringStatusForHosts(mockbmclient, testInventoryIdsIps, logs, false, l)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), node1Id.String(), models.HostStageConfiguring, gomock.Any()).Return(nil).Times(1)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), node2Id.String(), models.HostStageConfiguring, gomock.Any()).Return(nil).Times(1)
+			SetConfiguringStatusForHosts(context.Background(), mockbmclient, testInventoryIdsIps, logs, false, l)
 			Expect(testInventoryIdsIps["node1"].Host.Progress.CurrentStage).Should(Equal(models.HostStageConfiguring))
 			Expect(testInventoryIdsIps["node2"].Host.Progress.CurrentStage).Should(Equal(models.HostStageConfiguring))
 			Expect(testInventoryIdsIps["node0"].Host.Progress.CurrentStage).Should(Equal(models.HostStageRebooting))
 		})
 	})
-
+	Context("Verify RetryWithBackoff", func() {
+		It("succeeds on the nth attempt", func() {
+			calls := 0
+			err := RetryWithBackoff(context.Background(), clock.RealClock{}, 5, time.Millisecond, 5*time.Millisecond, func() error {
+				calls++
+				if calls < 3 {
+					return fmt.Errorf("failed attempt %d", calls)
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calls).Should(Equal(3))
+		})
+		It("returns the last error when attempts are exhausted", func() {
+			calls := 0
+			err := RetryWithBackoff(context.Background(), clock.RealClock{}, 4, time.Millisecond, 5*time.Millisecond, func() error {
+				calls++
+				return fmt.Errorf("failed attempt %d", calls)
+			})
+			Expect(err).Should(MatchError("failed attempt 4"))
+			Expect(calls).Should(Equal(4))
+		})
+		It("retries without limit when attempts isn't positive", func() {
+			calls := 0
+			err := RetryWithBackoff(context.Background(), clock.RealClock{}, 0, time.Millisecond, 2*time.Millisecond, func() error {
+				calls++
+				if calls < 20 {
+					return fmt.Errorf("failed attempt %d", calls)
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calls).Should(Equal(20))
+		})
+		It("doesn't retry permanent errors", func() {
+			calls := 0
+			permanent := fmt.Errorf("permanent")
+			err := RetryWithBackoff(context.Background(), clock.RealClock{}, 5, time.Millisecond, 5*time.Millisecond, func() error {
+				calls++
+				return PermanentError(permanent)
+			})
+			Expect(err).Should(Equal(permanent))
+			Expect(calls).Should(Equal(1))
+		})
+		It("stops when the context is cancelled mid retry", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			calls := 0
+			start := time.Now()
+			err := RetryWithBackoff(ctx, clock.RealClock{}, 0, time.Hour, time.Hour, func() error {
+				calls++
+				time.AfterFunc(50*time.Millisecond, cancel)
+				return fmt.Errorf("failed attempt %d", calls)
+			})
+			Expect(errors.Is(err, context.Canceled)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("failed attempt 1"))
+			Expect(calls).Should(Equal(1))
+			Expect(time.Since(start)).Should(BeNumerically("<", time.Second))
+		})
+		It("waits at least the base delay between attempts", func() {
+			var attempts []time.Time
+			err := RetryWithBackoff(context.Background(), clock.RealClock{}, 4, 20*time.Millisecond, 40*time.Millisecond, func() error {
+				attempts = append(attempts, time.Now())
+				return fmt.Errorf("failed")
+			})
+			Expect(err).Should(HaveOccurred())
+			Expect(attempts).Should(HaveLen(4))
+			for i := 1; i < len(attempts); i++ {
+				delay := attempts[i].Sub(attempts[i-1])
+				Expect(delay).Should(BeNumerically(">=", 20*time.Millisecond))
+			}
+		})
+		It("waits on the given clock between attempts", func() {
+			fakeClock := clock.NewFakeClock(time.Now())
+			calls := 0
+			done := make(chan error)
+			go func() {
+				done <- RetryWithBackoff(context.Background(), fakeClock, 2, time.Hour, time.Hour, func() error {
+					calls++
+					return fmt.Errorf("failed attempt %d", calls)
+				})
+			}()
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			Consistently(done, 50*time.Millisecond).ShouldNot(Receive())
+			fakeClock.Step(2 * time.Hour)
+			Eventually(done).Should(Receive(MatchError("failed attempt 2")))
+		})
+	})
 })
@@ -0,0 +1,59 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// PermanentError marks an error that RetryWithBackoff must not retry
+func PermanentError(err error) error {
+	return &permanentError{err: err}
+}
+
+// RetryWithBackoff calls fn till it succeeds, up to attempts times or unlimited if attempts isn't positive.
+// The delay between attempts grows exponentially with jitter from baseDelay up to maxDelay.
+// It returns the last error of fn on exhaustion, the unwrapped error if fn returned a PermanentError
+// and an error wrapping the context error if ctx is done while waiting for the next attempt on clk
+func RetryWithBackoff(ctx context.Context, clk clock.Clock, attempts int, baseDelay time.Duration, maxDelay time.Duration, fn func() error) error {
+	b := &backoff.Backoff{
+		Min:    baseDelay,
+		Max:    maxDelay,
+		Factor: 2,
+		Jitter: true,
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if attempts > 0 && attempt >= attempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w, last error: %v", ctx.Err(), err)
+		case <-clk.After(b.Duration()):
+		}
+	}
+}
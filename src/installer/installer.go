@@ -228,7 +228,7 @@ func (i *installer) startBootstrap() error {
 func (i *installer) getFileFromService(filename string) (string, error) {
 	i.log.Infof("Getting %s file", filename)
 	dest := filepath.Join(InstallDir, filename)
-	err := i.inventoryClient.DownloadFile(filename, dest)
+	err := i.inventoryClient.DownloadFile(context.Background(), filename, dest)
 	if err != nil {
 		i.log.Errorf("Failed to fetch file (%s) from server. err: %s", filename, err)
 	}
@@ -254,7 +254,7 @@ func (i *installer) waitForControlPlane(ctx context.Context, kc k8s_client.K8SCl
 func (i *installer) UpdateHostInstallProgress(newStage models.HostStage, info string) {
 	i.log.Infof("Updating node installation stage: %s - %s", newStage, info)
 	if i.HostID != "" {
-		if err := i.inventoryClient.UpdateHostInstallProgress(i.HostID, newStage, info); err != nil {
+		if err := i.inventoryClient.UpdateHostInstallProgress(context.Background(), i.HostID, newStage, info); err != nil {
 			i.log.Errorf("Failed to update node installation stage, %s", err)
 		}
 	}
@@ -321,7 +321,7 @@ func (i *installer) waitForMasterNodes(ctx context.Context, minMasterNodes int,
 func (i *installer) getInventoryHostsMap(hostsMap map[string]inventory_client.HostData) map[string]inventory_client.HostData {
 	var err error
 	if hostsMap == nil {
-		hostsMap, err = i.inventoryClient.GetEnabledHostsNamesHosts()
+		hostsMap, err = i.inventoryClient.GetEnabledHostsNamesHosts(context.Background())
 		if err != nil {
 			i.log.Warnf("Failed to get hosts info from inventory, err %s", err)
 			return nil
@@ -345,7 +345,7 @@ func (i *installer) updateReadyMasters(nodes *v1.NodeList, readyMasters *[]strin
 					i.log.Warnf("Node %s is not in inventory hosts", node.Name)
 					break
 				}
-				if err := i.inventoryClient.UpdateHostInstallProgress(host.Host.ID.String(), models.HostStageJoined, ""); err != nil {
+				if err := i.inventoryClient.UpdateHostInstallProgress(context.Background(), host.Host.ID.String(), models.HostStageJoined, ""); err != nil {
 					i.log.Errorf("Failed to update node installation status, %s", err)
 				}
 			}
@@ -379,7 +379,7 @@ func (i *installer) verifyHostCanMoveToConfigurationStatus(inventoryHostsMapWith
 		i.log.Infof("Failed to get MCS logs, will retry")
 		return
 	}
-	common.SetConfiguringStatusForHosts(i.inventoryClient, inventoryHostsMapWithIp, logs, true, i.log)
+	common.SetConfiguringStatusForHosts(context.Background(), i.inventoryClient, inventoryHostsMapWithIp, logs, true, i.log)
 }
 
 // will run as go routine and tries to find nodes that pulled ignition from mcs
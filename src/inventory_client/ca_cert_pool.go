@@ -0,0 +1,94 @@
+package inventory_client
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// caCertPool holds the custom CA certificate pool and reloads it once the certificate file changes,
+// the file is checked at most once every reloadInterval while verifying the assisted-service certificate
+type caCertPool struct {
+	sync.Mutex
+	path           string
+	reloadInterval time.Duration
+	log            *logrus.Logger
+	pool           *x509.CertPool
+	data           []byte
+	lastCheck      time.Time
+}
+
+func newCACertPool(path string, reloadInterval time.Duration, logger *logrus.Logger) (*caCertPool, error) {
+	data, pool, err := loadCACertificate(path)
+	if err != nil {
+		return nil, err
+	}
+	return &caCertPool{path: path, reloadInterval: reloadInterval, log: logger, pool: pool, data: data,
+		lastCheck: time.Now()}, nil
+}
+
+func loadCACertificate(path string) ([]byte, *x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CA certificate %s: %w", path, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, nil, fmt.Errorf("certificate corrupted or in invalid format: %s", path)
+	}
+	return data, pool, nil
+}
+
+// current returns the pool, reloading it in case the file changed. A file that can't be loaded
+// keeps the previous pool, so a certificate that is being replaced doesn't break the connections
+func (p *caCertPool) current() *x509.CertPool {
+	p.Lock()
+	defer p.Unlock()
+	if time.Since(p.lastCheck) < p.reloadInterval {
+		return p.pool
+	}
+	p.lastCheck = time.Now()
+	data, pool, err := loadCACertificate(p.path)
+	if err != nil {
+		p.log.WithError(err).Warnf("Failed to reload custom CA certificate, using the previous one")
+		return p.pool
+	}
+	if !bytes.Equal(data, p.data) {
+		p.log.Infof("Reloaded custom CA certificate: %s", p.path)
+		p.pool, p.data = pool, data
+	}
+	return p.pool
+}
+
+// verifyPeerCertificate verifies the server certificate chain against the current pool, it replaces the
+// verification of the tls handshake whose roots are fixed once the transport is created
+func (p *caCertPool) verifyPeerCertificate(serverName string) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("server %s didn't present a certificate", serverName)
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("failed to parse certificate of server %s: %w", serverName, err)
+			}
+			certs[i] = cert
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			DNSName:       serverName,
+			Roots:         p.current(),
+			Intermediates: intermediates,
+		})
+		return err
+	}
+}
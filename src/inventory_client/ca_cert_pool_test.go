@@ -0,0 +1,105 @@
+package inventory_client
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("custom CA certificate", func() {
+	const clusterId = "7916fa89-ea7a-443e-a862-b3e930309f65"
+	var (
+		l       = logrus.New()
+		server  *httptest.Server
+		other   *httptest.Server
+		tmpDir  string
+		caPath  string
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("{}"))
+		})
+	)
+	l.SetOutput(ioutil.Discard)
+
+	writeCert := func(s *httptest.Server) {
+		data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+		Expect(ioutil.WriteFile(caPath, data, 0600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		server = httptest.NewTLSServer(handler)
+		other = httptest.NewTLSServer(handler)
+		var err error
+		tmpDir, err = ioutil.TempDir("", "inventory-ca")
+		Expect(err).NotTo(HaveOccurred())
+		caPath = filepath.Join(tmpDir, "ca.crt")
+	})
+	AfterEach(func() {
+		server.Close()
+		other.Close()
+		os.RemoveAll(tmpDir)
+	})
+
+	It("trusts the server signed by the custom CA", func() {
+		writeCert(server)
+		client, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", false, caPath, 0, "", "", l, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.GetCluster(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("trusts the server signed by the custom CA when reloading it", func() {
+		writeCert(server)
+		client, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", false, caPath, time.Millisecond, "", "", l, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.GetCluster(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("fails on invalid CA certificate", func() {
+		Expect(ioutil.WriteFile(caPath, []byte("not a certificate"), 0600)).To(Succeed())
+		_, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", false, caPath, 0, "", "", l, nil)
+		Expect(err).To(MatchError(ContainSubstring("certificate corrupted or in invalid format")))
+		_, err = CreateInventoryClient(clusterId, server.URL, "pull-secret", false, filepath.Join(tmpDir, "missing.crt"), 0, "", "", l, nil)
+		Expect(err).To(MatchError(ContainSubstring("failed to read CA certificate")))
+	})
+	It("ignores the CA certificate when skipping certificate verification", func() {
+		Expect(ioutil.WriteFile(caPath, []byte("not a certificate"), 0600)).To(Succeed())
+		client, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", true, caPath, time.Millisecond, "", "", l, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.GetCluster(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("doesn't verify the server against the reloaded CA certificate when skipping certificate verification", func() {
+		writeCert(other)
+		client, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", true, caPath, time.Millisecond, "", "", l, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.GetCluster(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("reloads the CA certificate once it changes", func() {
+		writeCert(other)
+		pool, err := newCACertPool(caPath, 10*time.Millisecond, l)
+		Expect(err).NotTo(HaveOccurred())
+		verify := pool.verifyPeerCertificate("127.0.0.1")
+		rawCerts := [][]byte{server.Certificate().Raw}
+		Expect(verify(rawCerts, nil)).To(HaveOccurred())
+
+		// a certificate that can't be loaded keeps the previous one
+		Expect(ioutil.WriteFile(caPath, []byte("not a certificate"), 0600)).To(Succeed())
+		time.Sleep(20 * time.Millisecond)
+		Expect(verify([][]byte{other.Certificate().Raw}, nil)).To(Succeed())
+
+		writeCert(server)
+		Eventually(func() error { return verify(rawCerts, nil) }).Should(Succeed())
+		Expect(verify([][]byte{}, nil)).To(HaveOccurred())
+	})
+})
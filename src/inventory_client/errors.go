@@ -0,0 +1,110 @@
+package inventory_client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/go-openapi/runtime"
+	"github.com/openshift/assisted-service/client/installer"
+)
+
+// InventoryError wraps an error returned by assisted-service with its http status code,
+// the status code is 0 when no response was received or its status isn't known
+type InventoryError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *InventoryError) Error() string {
+	if e.StatusCode == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s (status code %d)", e.Err.Error(), e.StatusCode)
+}
+
+func (e *InventoryError) Unwrap() error {
+	return e.Err
+}
+
+func newInventoryError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &InventoryError{StatusCode: statusCode(err), Err: err}
+}
+
+// statusCode returns the http status code of the error, the responses that are declared in the swagger are
+// returned as their generated types, the others as runtime.APIError
+func statusCode(err error) int {
+	var apiErr *runtime.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	switch err.(type) {
+	case *installer.UploadClusterIngressCertBadRequest:
+		return http.StatusBadRequest
+	case *installer.GetClusterNotFound, *installer.UpdateHostInstallProgressNotFound,
+		*installer.UploadClusterIngressCertNotFound, *installer.CompleteInstallationNotFound,
+		*installer.UploadLogsNotFound, *installer.UpdateClusterInstallProgressNotFound:
+		return http.StatusNotFound
+	case *installer.CompleteInstallationConflict:
+		return http.StatusConflict
+	case *installer.GetClusterInternalServerError, *installer.ListHostsInternalServerError,
+		*installer.UpdateHostInstallProgressInternalServerError, *installer.UploadClusterIngressCertInternalServerError,
+		*installer.CompleteInstallationInternalServerError, *installer.UploadLogsInternalServerError,
+		*installer.UpdateClusterInstallProgressInternalServerError:
+		return http.StatusInternalServerError
+	default:
+		return 0
+	}
+}
+
+// IsNotFound returns true if assisted-service responded that the requested resource doesn't exist
+func IsNotFound(err error) bool {
+	var inventoryErr *InventoryError
+	return errors.As(err, &inventoryErr) && inventoryErr.StatusCode == http.StatusNotFound
+}
+
+// IsConflict returns true if assisted-service responded that the request conflicts with the current state of the
+// resource, e.g. something that was already uploaded
+func IsConflict(err error) bool {
+	var inventoryErr *InventoryError
+	return errors.As(err, &inventoryErr) && inventoryErr.StatusCode == http.StatusConflict
+}
+
+// IsUnsupported returns true if assisted-service doesn't serve the request, versions that don't know it respond that
+// it isn't found or not allowed
+func IsUnsupported(err error) bool {
+	var inventoryErr *InventoryError
+	if !errors.As(err, &inventoryErr) {
+		return false
+	}
+	switch inventoryErr.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsTransient returns true if retrying the request may succeed, that is when the request failed on the network
+// before a response was received, the service failed or asked to retry later
+func IsTransient(err error) bool {
+	var inventoryErr *InventoryError
+	if !errors.As(err, &inventoryErr) {
+		return false
+	}
+	switch code := inventoryErr.StatusCode; {
+	case code == 0:
+		var netErr net.Error
+		return errors.As(inventoryErr.Err, &netErr)
+	case code >= http.StatusInternalServerError && code != http.StatusNotImplemented:
+		return true
+	case code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,336 @@
+// Package fake provides an in-memory InventoryClient that records the calls it got, for tests of packages that use
+// the inventory client without an assisted-service
+package fake
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/openshift/assisted-service/models"
+	"github.com/thoas/go-funk"
+)
+
+var _ inventory_client.InventoryClient = &InventoryClient{}
+
+// HostProgress is a recorded UpdateHostInstallProgress call or an update of an UpdateHostsInstallProgress call
+type HostProgress struct {
+	HostID string
+	Stage  models.HostStage
+	Info   string
+}
+
+// Completion is a recorded CompleteInstallation call
+type Completion struct {
+	ClusterID string
+	IsSuccess bool
+	ErrorInfo string
+}
+
+// Event is a recorded AddEvent call
+type Event struct {
+	ClusterID string
+	HostID    string
+	Severity  string
+	Message   string
+}
+
+// Logs is a recorded UploadLogs call
+type Logs struct {
+	ClusterID string
+	LogsType  string
+	Content   []byte
+}
+
+// InventoryClient keeps the hosts and the cluster in memory and updates them like assisted-service does:
+// a host whose progress is updated to Done moves to installed and a completed cluster moves to installed or error
+type InventoryClient struct {
+	mu              sync.Mutex
+	hosts           map[string]inventory_client.HostData
+	cluster         *models.Cluster
+	files           map[string][]byte
+	errors          map[string]error
+	hostProgress    []HostProgress
+	completions     []Completion
+	ingressCAs      []string
+	logs            []Logs
+	clusterProgress []int
+	events          []Event
+}
+
+func NewInventoryClient() *InventoryClient {
+	return &InventoryClient{
+		hosts:  make(map[string]inventory_client.HostData),
+		files:  make(map[string][]byte),
+		errors: make(map[string]error),
+	}
+}
+
+// AddHost preloads a host by its name, a host without status is considered installing
+func (f *InventoryClient) AddHost(name string, host *models.Host) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if host.Status == nil {
+		status := models.HostStatusInstalling
+		host.Status = &status
+	}
+	if host.Progress == nil {
+		host.Progress = &models.HostProgressInfo{}
+	}
+	f.hosts[name] = inventory_client.HostData{Host: host}
+}
+
+// SetCluster preloads the cluster returned by GetCluster
+func (f *InventoryClient) SetCluster(cluster *models.Cluster) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cluster = cluster
+}
+
+// SetFile preloads the content of a file returned by DownloadFile
+func (f *InventoryClient) SetFile(filename string, content []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[filename] = content
+}
+
+// SetError makes every call of the named method fail with err till it's set again to nil
+func (f *InventoryClient) SetError(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.errors, method)
+		return
+	}
+	f.errors[method] = err
+}
+
+// Host returns a copy of the named host
+func (f *InventoryClient) Host(name string) (models.Host, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	hostData, ok := f.hosts[name]
+	if !ok {
+		return models.Host{}, false
+	}
+	return *hostData.Host, true
+}
+
+func (f *InventoryClient) HostProgressUpdates() []HostProgress {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]HostProgress(nil), f.hostProgress...)
+}
+
+func (f *InventoryClient) Completions() []Completion {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Completion(nil), f.completions...)
+}
+
+func (f *InventoryClient) IngressCAs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.ingressCAs...)
+}
+
+func (f *InventoryClient) UploadedLogs() []Logs {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Logs(nil), f.logs...)
+}
+
+func (f *InventoryClient) ClusterProgress() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int(nil), f.clusterProgress...)
+}
+
+func (f *InventoryClient) Events() []Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Event(nil), f.events...)
+}
+
+// failure is the error a call of method fails with, a cancelled ctx fails it like an aborted request
+func (f *InventoryClient) failure(ctx context.Context, method string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.errors[method]
+}
+
+func (f *InventoryClient) DownloadFile(ctx context.Context, filename string, dest string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.failure(ctx, "DownloadFile"); err != nil {
+		return err
+	}
+	content, ok := f.files[filename]
+	if !ok {
+		return fmt.Errorf("file %s doesn't exist", filename)
+	}
+	return ioutil.WriteFile(dest, content, 0644)
+}
+
+func (f *InventoryClient) UpdateHostInstallProgress(ctx context.Context, hostId string, newStage models.HostStage, info string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.failure(ctx, "UpdateHostInstallProgress"); err != nil {
+		return err
+	}
+	f.updateHostProgress(hostId, newStage, info)
+	return nil
+}
+
+// UpdateHostsInstallProgress records every update like an UpdateHostInstallProgress call
+func (f *InventoryClient) UpdateHostsInstallProgress(ctx context.Context, updates []inventory_client.HostProgressUpdate) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.failure(ctx, "UpdateHostsInstallProgress"); err != nil {
+		return err
+	}
+	for _, update := range updates {
+		f.updateHostProgress(update.HostID, update.Stage, update.Info)
+	}
+	return nil
+}
+
+func (f *InventoryClient) updateHostProgress(hostId string, newStage models.HostStage, info string) {
+	f.hostProgress = append(f.hostProgress, HostProgress{HostID: hostId, Stage: newStage, Info: info})
+	for _, hostData := range f.hosts {
+		if hostData.Host.ID == nil || hostData.Host.ID.String() != hostId {
+			continue
+		}
+		hostData.Host.Progress.CurrentStage = newStage
+		hostData.Host.Progress.ProgressInfo = info
+		if newStage == models.HostStageDone {
+			status := models.HostStatusInstalled
+			hostData.Host.Status = &status
+		}
+	}
+}
+
+func (f *InventoryClient) GetEnabledHostsNamesHosts(ctx context.Context) (map[string]inventory_client.HostData, error) {
+	return f.GetHosts(ctx, []string{models.HostStatusDisabled})
+}
+
+func (f *InventoryClient) UploadIngressCa(ctx context.Context, ingressCA string, clusterId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.failure(ctx, "UploadIngressCa"); err != nil {
+		return err
+	}
+	f.ingressCAs = append(f.ingressCAs, ingressCA)
+	return nil
+}
+
+func (f *InventoryClient) GetCluster(ctx context.Context) (*models.Cluster, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.failure(ctx, "GetCluster"); err != nil {
+		return nil, err
+	}
+	if f.cluster == nil {
+		return nil, &inventory_client.InventoryError{StatusCode: http.StatusNotFound, Err: fmt.Errorf("cluster doesn't exist")}
+	}
+	cluster := *f.cluster
+	return &cluster, nil
+}
+
+func (f *InventoryClient) CompleteInstallation(ctx context.Context, clusterId string, isSuccess bool, errorInfo string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.failure(ctx, "CompleteInstallation"); err != nil {
+		return err
+	}
+	f.completions = append(f.completions, Completion{ClusterID: clusterId, IsSuccess: isSuccess, ErrorInfo: errorInfo})
+	if f.cluster != nil {
+		status := models.ClusterStatusInstalled
+		if !isSuccess {
+			status = models.ClusterStatusError
+		}
+		f.cluster.Status = &status
+	}
+	return nil
+}
+
+// GetHosts returns copies of the hosts whose status is not skipped, keyed by their names
+func (f *InventoryClient) GetHosts(ctx context.Context, skippedStatuses []string) (map[string]inventory_client.HostData, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.failure(ctx, "GetHosts"); err != nil {
+		return nil, err
+	}
+	hosts := make(map[string]inventory_client.HostData)
+	for name, hostData := range f.hosts {
+		if funk.ContainsString(skippedStatuses, *hostData.Host.Status) {
+			continue
+		}
+		host := *hostData.Host
+		progress := *hostData.Host.Progress
+		host.Progress = &progress
+		hosts[name] = inventory_client.HostData{IPs: hostData.IPs, Inventory: hostData.Inventory, Host: &host}
+	}
+	return hosts, nil
+}
+
+func (f *InventoryClient) UploadLogs(ctx context.Context, clusterId string, logsType string, upfile io.Reader) error {
+	content, err := ioutil.ReadAll(upfile)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.failure(ctx, "UploadLogs"); err != nil {
+		return err
+	}
+	f.logs = append(f.logs, Logs{ClusterID: clusterId, LogsType: logsType, Content: content})
+	return nil
+}
+
+// UploadControllerLogs is recorded like UploadLogs with the controller logs type
+func (f *InventoryClient) UploadControllerLogs(ctx context.Context, clusterId string, logs io.Reader) error {
+	content, err := ioutil.ReadAll(logs)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.failure(ctx, "UploadControllerLogs"); err != nil {
+		return err
+	}
+	f.logs = append(f.logs, Logs{ClusterID: clusterId, LogsType: "controller", Content: content})
+	return nil
+}
+
+func (f *InventoryClient) UpdateClusterProgress(ctx context.Context, clusterId string, percentage int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.failure(ctx, "UpdateClusterProgress"); err != nil {
+		return err
+	}
+	f.clusterProgress = append(f.clusterProgress, percentage)
+	return nil
+}
+
+func (f *InventoryClient) AddEvent(ctx context.Context, clusterId string, hostId string, severity string, message string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.failure(ctx, "AddEvent"); err != nil {
+		return err
+	}
+	f.events = append(f.events, Event{ClusterID: clusterId, HostID: hostId, Severity: severity, Message: message})
+	return nil
+}
+
+// NewHost returns a host with the given id and status for AddHost
+func NewHost(id string, status string) *models.Host {
+	hostId := strfmt.UUID(id)
+	return &models.Host{ID: &hostId, Status: &status, Progress: &models.HostProgressInfo{}}
+}
@@ -0,0 +1,124 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/openshift/assisted-service/models"
+)
+
+func TestFakeInventoryClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "fake_inventory_client_test")
+}
+
+var _ = Describe("fake inventory client", func() {
+	const (
+		clusterId = "cluster-id"
+		node0Id   = "7916fa89-ea7a-443e-a862-b3e930309f65"
+		node1Id   = "eb82821f-bf21-4614-9a3b-ecb07929f238"
+	)
+	var (
+		f   *InventoryClient
+		ctx = context.Background()
+	)
+
+	BeforeEach(func() {
+		f = NewInventoryClient()
+		f.AddHost("node0", NewHost(node0Id, models.HostStatusInstalling))
+		f.AddHost("node1", NewHost(node1Id, models.HostStatusError))
+	})
+
+	It("returns the hosts that are not skipped", func() {
+		f.AddHost("node2", NewHost("b898d516-3e16-49d0-86a5-0ad5bd04e3ed", models.HostStatusDisabled))
+		hosts, err := f.GetHosts(ctx, []string{models.HostStatusInstalling})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hosts).To(HaveLen(2))
+		Expect(hosts).To(HaveKey("node1"))
+		Expect(hosts).To(HaveKey("node2"))
+		enabled, err := f.GetEnabledHostsNamesHosts(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(enabled).To(HaveLen(2))
+		Expect(enabled).NotTo(HaveKey("node2"))
+	})
+	It("records host progress and moves done hosts to installed", func() {
+		Expect(f.UpdateHostInstallProgress(ctx, node0Id, models.HostStageJoined, "")).To(Succeed())
+		Expect(f.UpdateHostInstallProgress(ctx, node1Id, models.HostStageDone, "done")).To(Succeed())
+		Expect(f.HostProgressUpdates()).To(Equal([]HostProgress{
+			{HostID: node0Id, Stage: models.HostStageJoined},
+			{HostID: node1Id, Stage: models.HostStageDone, Info: "done"},
+		}))
+		node0, _ := f.Host("node0")
+		Expect(node0.Progress.CurrentStage).To(Equal(models.HostStageJoined))
+		Expect(*node0.Status).To(Equal(models.HostStatusInstalling))
+		node1, _ := f.Host("node1")
+		Expect(*node1.Status).To(Equal(models.HostStatusInstalled))
+		hosts, err := f.GetHosts(ctx, []string{models.HostStatusInstalled})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hosts).To(HaveLen(1))
+	})
+	It("returns copies of the hosts", func() {
+		hosts, err := f.GetHosts(ctx, nil)
+		Expect(err).NotTo(HaveOccurred())
+		hosts["node0"].Host.Progress.CurrentStage = models.HostStageDone
+		node0, _ := f.Host("node0")
+		Expect(node0.Progress.CurrentStage).NotTo(Equal(models.HostStageDone))
+	})
+	It("records completion and updates the cluster status", func() {
+		installing := models.ClusterStatusFinalizing
+		f.SetCluster(&models.Cluster{Status: &installing})
+		Expect(f.CompleteInstallation(ctx, clusterId, false, "failed")).To(Succeed())
+		Expect(f.Completions()).To(Equal([]Completion{{ClusterID: clusterId, IsSuccess: false, ErrorInfo: "failed"}}))
+		cluster, err := f.GetCluster(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*cluster.Status).To(Equal(models.ClusterStatusError))
+	})
+	It("reports a missing cluster as not found", func() {
+		_, err := f.GetCluster(ctx)
+		Expect(inventory_client.IsNotFound(err)).To(BeTrue())
+	})
+	It("records ingress cas, logs and cluster progress", func() {
+		Expect(f.UploadIngressCa(ctx, "CA", clusterId)).To(Succeed())
+		Expect(f.UploadLogs(ctx, clusterId, "controller", strings.NewReader("logs"))).To(Succeed())
+		Expect(f.UploadControllerLogs(ctx, clusterId, strings.NewReader("tail"))).To(Succeed())
+		Expect(f.UpdateClusterProgress(ctx, clusterId, 50)).To(Succeed())
+		Expect(f.IngressCAs()).To(Equal([]string{"CA"}))
+		Expect(f.UploadedLogs()).To(Equal([]Logs{{ClusterID: clusterId, LogsType: "controller", Content: []byte("logs")},
+			{ClusterID: clusterId, LogsType: "controller", Content: []byte("tail")}}))
+		Expect(f.ClusterProgress()).To(Equal([]int{50}))
+	})
+	It("downloads preloaded files", func() {
+		tmpDir, err := ioutil.TempDir("", "fake-inventory")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+		f.SetFile("bootstrap.ign", []byte("{}"))
+		dest := filepath.Join(tmpDir, "bootstrap.ign")
+		Expect(f.DownloadFile(ctx, "bootstrap.ign", dest)).To(Succeed())
+		Expect(ioutil.ReadFile(dest)).To(Equal([]byte("{}")))
+		Expect(f.DownloadFile(ctx, "master.ign", dest)).To(HaveOccurred())
+	})
+	It("fails the calls of a method with an injected error", func() {
+		f.SetError("UploadIngressCa", fmt.Errorf("dummy"))
+		Expect(f.UploadIngressCa(ctx, "CA", clusterId)).To(MatchError("dummy"))
+		Expect(f.IngressCAs()).To(BeEmpty())
+		f.SetError("UploadIngressCa", nil)
+		Expect(f.UploadIngressCa(ctx, "CA", clusterId)).To(Succeed())
+		Expect(f.IngressCAs()).To(Equal([]string{"CA"}))
+	})
+	It("fails the calls with a cancelled context", func() {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		Expect(f.CompleteInstallation(cancelled, clusterId, true, "")).To(MatchError(context.Canceled))
+		Expect(f.UploadIngressCa(cancelled, "CA", clusterId)).To(MatchError(context.Canceled))
+		Expect(f.Completions()).To(BeEmpty())
+		Expect(f.IngressCAs()).To(BeEmpty())
+	})
+})
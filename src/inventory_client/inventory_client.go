@@ -6,7 +6,7 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
@@ -14,7 +14,9 @@ import (
 	"time"
 
 	"github.com/thoas/go-funk"
+	"golang.org/x/net/http/httpproxy"
 
+	"github.com/go-openapi/runtime"
 	"github.com/go-openapi/strfmt"
 	"github.com/openshift/assisted-installer/src/utils"
 
@@ -30,23 +32,32 @@ const (
 	retryDelay    = time.Duration(2) * time.Second
 	retryMaxDelay = time.Duration(10) * time.Second
 	MaxTries      = 10
+	// controllerLogsFileName is the name the tail of the controller own logs is uploaded with
+	controllerLogsFileName = "assisted-installer-controller.log"
 )
 
 //go:generate mockgen -source=inventory_client.go -package=inventory_client -destination=mock_inventory_client.go
 type InventoryClient interface {
-	DownloadFile(filename string, dest string) error
-	UpdateHostInstallProgress(hostId string, newStage models.HostStage, info string) error
-	GetEnabledHostsNamesHosts() (map[string]HostData, error)
-	UploadIngressCa(ingressCA string, clusterId string) error
-	GetCluster() (*models.Cluster, error)
-	CompleteInstallation(clusterId string, isSuccess bool, errorInfo string) error
-	GetHosts(skippedStatuses []string) (map[string]HostData, error)
+	DownloadFile(ctx context.Context, filename string, dest string) error
+	UpdateHostInstallProgress(ctx context.Context, hostId string, newStage models.HostStage, info string) error
+	UpdateHostsInstallProgress(ctx context.Context, updates []HostProgressUpdate) error
+	GetEnabledHostsNamesHosts(ctx context.Context) (map[string]HostData, error)
+	UploadIngressCa(ctx context.Context, ingressCA string, clusterId string) error
+	GetCluster(ctx context.Context) (*models.Cluster, error)
+	CompleteInstallation(ctx context.Context, clusterId string, isSuccess bool, errorInfo string) error
+	GetHosts(ctx context.Context, skippedStatuses []string) (map[string]HostData, error)
+	UploadLogs(ctx context.Context, clusterId string, logsType string, upfile io.Reader) error
+	UploadControllerLogs(ctx context.Context, clusterId string, logs io.Reader) error
+	UpdateClusterProgress(ctx context.Context, clusterId string, percentage int) error
+	AddEvent(ctx context.Context, clusterId string, hostId string, severity string, message string) error
 }
 
 type inventoryClient struct {
 	log       *logrus.Logger
 	ai        *client.AssistedInstall
 	clusterId strfmt.UUID
+	// authInfo authenticates the requests that aren't sent by the generated client
+	authInfo runtime.ClientAuthInfoWriter
 }
 
 type HostData struct {
@@ -55,8 +66,19 @@ type HostData struct {
 	Host      *models.Host
 }
 
+// HostProgressUpdate is the install progress of a host that is updated together with the progress of other hosts
+type HostProgressUpdate struct {
+	HostID string
+	Stage  models.HostStage
+	Info   string
+}
+
+// CreateInventoryClient creates a client of assisted-service, a positive caReloadInterval reloads the custom
+// CA certificate once its file changes, checking it at most once every interval. The client certificate at
+// clientCertPath and clientKeyPath is presented to assisted-service when they are set
 func CreateInventoryClient(clusterId string, inventoryURL string, pullSecret string, insecure bool, caPath string,
-	logger *logrus.Logger, proxyFunc func(*http.Request) (*url.URL, error)) (*inventoryClient, error) {
+	caReloadInterval time.Duration, clientCertPath string, clientKeyPath string, logger *logrus.Logger,
+	proxyFunc func(*http.Request) (*url.URL, error)) (*inventoryClient, error) {
 	clientConfig := client.Config{}
 	var err error
 	clientConfig.URL, err = url.ParseRequestURI(createUrl(inventoryURL))
@@ -74,6 +96,27 @@ func CreateInventoryClient(clusterId string, inventoryURL string, pullSecret str
 		}
 	}
 
+	clientCerts, err := loadClientCertificate(clientCertPath, clientKeyPath, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecure,
+		RootCAs:            certs,
+		Certificates:       clientCerts,
+	}
+	if !insecure && certs != nil && caReloadInterval > 0 {
+		caPool, err := newCACertPool(caPath, caReloadInterval, logger)
+		if err != nil {
+			return nil, err
+		}
+		// the handshake roots can't be replaced once the transport is created, so the server certificate
+		// is verified against the reloaded pool instead
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = caPool.verifyPeerCertificate(clientConfig.URL.Hostname())
+	}
+
 	transport := requestid.Transport(&http.Transport{
 		Proxy: proxyFunc,
 		DialContext: (&net.Dialer{
@@ -85,10 +128,7 @@ func CreateInventoryClient(clusterId string, inventoryURL string, pullSecret str
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: insecure,
-			RootCAs:            certs,
-		},
+		TLSClientConfig:       tlsConfig,
 	})
 	// Add retry settings
 
@@ -100,7 +140,19 @@ func CreateInventoryClient(clusterId string, inventoryURL string, pullSecret str
 
 	clientConfig.AuthInfo = auth.AgentAuthHeaderWriter(pullSecret)
 	assistedInstallClient := client.New(clientConfig)
-	return &inventoryClient{logger, assistedInstallClient, strfmt.UUID(clusterId)}, nil
+	return &inventoryClient{logger, assistedInstallClient, strfmt.UUID(clusterId), clientConfig.AuthInfo}, nil
+}
+
+// ProxyFunc returns a proxy func of the given settings that can be passed to CreateInventoryClient
+func ProxyFunc(httpProxy string, httpsProxy string, noProxy string) func(*http.Request) (*url.URL, error) {
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  httpProxy,
+		HTTPSProxy: httpsProxy,
+		NoProxy:    noProxy,
+	}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
 }
 
 func readCACertificate(capath string, logger *logrus.Logger) (*x509.CertPool, error) {
@@ -109,22 +161,34 @@ func readCACertificate(capath string, logger *logrus.Logger) (*x509.CertPool, er
 		return nil, nil
 	}
 
-	caData, err := ioutil.ReadFile(capath)
+	_, pool, err := loadCACertificate(capath)
 	if err != nil {
 		return nil, err
 	}
-
-	pool := x509.NewCertPool()
-	if !pool.AppendCertsFromPEM(caData) {
-		return nil, fmt.Errorf("certificate corrupted or in invalid format: %s", capath)
-	} else {
-		logger.Infof("Using custom CA certificate: %s", capath)
-	}
+	logger.Infof("Using custom CA certificate: %s", capath)
 
 	return pool, nil
 }
 
-func (c *inventoryClient) DownloadFile(filename string, dest string) error {
+// loadClientCertificate loads the client certificate presented to assisted-service, there is none when neither
+// path is set
+func loadClientCertificate(certPath string, keyPath string, logger *logrus.Logger) ([]tls.Certificate, error) {
+	if certPath == "" && keyPath == "" {
+		return nil, nil
+	}
+	if certPath == "" || keyPath == "" {
+		return nil, fmt.Errorf("both the client certificate and its key are required, got certificate %q and key %q",
+			certPath, keyPath)
+	}
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate %s and key %s: %w", certPath, keyPath, err)
+	}
+	logger.Infof("Using client certificate: %s", certPath)
+	return []tls.Certificate{cert}, nil
+}
+
+func (c *inventoryClient) DownloadFile(ctx context.Context, filename string, dest string) error {
 	// open output file
 	fo, err := os.Create(dest)
 	if err != nil {
@@ -134,37 +198,50 @@ func (c *inventoryClient) DownloadFile(filename string, dest string) error {
 	defer func() {
 		fo.Close()
 	}()
-	_, err = c.ai.Installer.DownloadClusterFiles(context.Background(), c.createDownloadParams(filename), fo)
+	_, err = c.ai.Installer.DownloadClusterFiles(ctx, c.createDownloadParams(filename), fo)
 	return err
 }
 
-func (c *inventoryClient) UpdateHostInstallProgress(hostId string, newStage models.HostStage, info string) error {
-	_, err := c.ai.Installer.UpdateHostInstallProgress(context.Background(), c.createUpdateHostInstallProgressParams(hostId, newStage, info))
-	return err
+func (c *inventoryClient) UpdateHostInstallProgress(ctx context.Context, hostId string, newStage models.HostStage, info string) error {
+	_, err := c.ai.Installer.UpdateHostInstallProgress(ctx, c.createUpdateHostInstallProgressParams(hostId, newStage, info))
+	return newInventoryError(err)
+}
+
+// UpdateHostsInstallProgress updates the install progress of several hosts in one request, assisted-service versions
+// that don't support it fail it with an error that IsUnsupported recognizes
+func (c *inventoryClient) UpdateHostsInstallProgress(ctx context.Context, updates []HostProgressUpdate) error {
+	body := make([]*hostProgressParams, 0, len(updates))
+	for _, update := range updates {
+		body = append(body, &hostProgressParams{
+			HostID:       strfmt.UUID(update.HostID),
+			HostProgress: &models.HostProgress{CurrentStage: update.Stage, ProgressInfo: update.Info},
+		})
+	}
+	return c.submit(ctx, "UpdateHostsInstallProgress", http.MethodPut, "/clusters/{cluster_id}/hosts/progress", c.clusterId, body)
 }
 
-func (c *inventoryClient) UploadIngressCa(ingressCA string, clusterId string) error {
-	_, err := c.ai.Installer.UploadClusterIngressCert(context.Background(),
+func (c *inventoryClient) UploadIngressCa(ctx context.Context, ingressCA string, clusterId string) error {
+	_, err := c.ai.Installer.UploadClusterIngressCert(ctx,
 		&installer.UploadClusterIngressCertParams{ClusterID: strfmt.UUID(clusterId), IngressCertParams: models.IngressCertParams(ingressCA)})
-	return err
+	return newInventoryError(err)
 }
 
-func (c *inventoryClient) GetCluster() (*models.Cluster, error) {
-	cluster, err := c.ai.Installer.GetCluster(context.Background(), &installer.GetClusterParams{ClusterID: c.clusterId})
+func (c *inventoryClient) GetCluster(ctx context.Context) (*models.Cluster, error) {
+	cluster, err := c.ai.Installer.GetCluster(ctx, &installer.GetClusterParams{ClusterID: c.clusterId})
 	if err != nil {
-		return nil, err
+		return nil, newInventoryError(err)
 	}
 
 	return cluster.Payload, nil
 }
 
-func (c *inventoryClient) GetEnabledHostsNamesHosts() (map[string]HostData, error) {
-	return c.GetHosts([]string{models.HostStatusDisabled})
+func (c *inventoryClient) GetEnabledHostsNamesHosts(ctx context.Context) (map[string]HostData, error) {
+	return c.GetHosts(ctx, []string{models.HostStatusDisabled})
 }
 
-func (c *inventoryClient) GetHosts(skippedStatuses []string) (map[string]HostData, error) {
+func (c *inventoryClient) GetHosts(ctx context.Context, skippedStatuses []string) (map[string]HostData, error) {
 	namesIdsMap := make(map[string]HostData)
-	hosts, err := c.getHostsWithInventoryInfo(skippedStatuses)
+	hosts, err := c.getHostsWithInventoryInfo(ctx, skippedStatuses)
 	if err != nil {
 		return nil, err
 	}
@@ -205,11 +282,55 @@ func (c *inventoryClient) createUpdateHostInstallProgressParams(hostId string, n
 	}
 }
 
-func (c *inventoryClient) getHostsWithInventoryInfo(skippedStatuses []string) (map[string]HostData, error) {
+// hostProgressParams is the progress of a host in an UpdateHostsInstallProgress request
+type hostProgressParams struct {
+	HostID       strfmt.UUID          `json:"host_id"`
+	HostProgress *models.HostProgress `json:"host_progress"`
+}
+
+// eventParams is the event of an AddEvent request
+type eventParams struct {
+	ClusterID strfmt.UUID     `json:"cluster_id"`
+	HostID    strfmt.UUID     `json:"host_id,omitempty"`
+	Severity  string          `json:"severity"`
+	Message   string          `json:"message"`
+	EventTime strfmt.DateTime `json:"event_time"`
+}
+
+// submit sends a json request of the cluster that the generated client doesn't provide, a response with a status
+// other than 2xx fails it with its status code
+func (c *inventoryClient) submit(ctx context.Context, id string, method string, pathPattern string, clusterId strfmt.UUID,
+	body interface{}) error {
+	_, err := c.ai.Transport.Submit(&runtime.ClientOperation{
+		ID:                 id,
+		Method:             method,
+		PathPattern:        pathPattern,
+		ProducesMediaTypes: []string{"application/json"},
+		ConsumesMediaTypes: []string{"application/json"},
+		Schemes:            []string{"http", "https"},
+		Params: runtime.ClientRequestWriterFunc(func(req runtime.ClientRequest, _ strfmt.Registry) error {
+			if err := req.SetPathParam("cluster_id", clusterId.String()); err != nil {
+				return err
+			}
+			return req.SetBodyParam(body)
+		}),
+		Reader: runtime.ClientResponseReaderFunc(func(resp runtime.ClientResponse, _ runtime.Consumer) (interface{}, error) {
+			if resp.Code()/100 == 2 {
+				return nil, nil
+			}
+			return nil, runtime.NewAPIError(id, resp.Message(), resp.Code())
+		}),
+		AuthInfo: c.authInfo,
+		Context:  ctx,
+	})
+	return newInventoryError(err)
+}
+
+func (c *inventoryClient) getHostsWithInventoryInfo(ctx context.Context, skippedStatuses []string) (map[string]HostData, error) {
 	hostsWithHwInfo := make(map[string]HostData)
-	hosts, err := c.ai.Installer.ListHosts(context.Background(), &installer.ListHostsParams{ClusterID: c.clusterId})
+	hosts, err := c.ai.Installer.ListHosts(ctx, &installer.ListHostsParams{ClusterID: c.clusterId})
 	if err != nil {
-		return nil, err
+		return nil, newInventoryError(err)
 	}
 	for _, host := range hosts.Payload {
 		if funk.IndexOf(skippedStatuses, *host.Status) > -1 {
@@ -226,9 +347,46 @@ func (c *inventoryClient) getHostsWithInventoryInfo(skippedStatuses []string) (m
 	return hostsWithHwInfo, nil
 }
 
-func (c *inventoryClient) CompleteInstallation(clusterId string, isSuccess bool, errorInfo string) error {
-	_, err := c.ai.Installer.CompleteInstallation(context.Background(),
+func (c *inventoryClient) CompleteInstallation(ctx context.Context, clusterId string, isSuccess bool, errorInfo string) error {
+	_, err := c.ai.Installer.CompleteInstallation(ctx,
 		&installer.CompleteInstallationParams{ClusterID: strfmt.UUID(clusterId),
 			CompletionParams: &models.CompletionParams{IsSuccess: &isSuccess, ErrorInfo: errorInfo}})
-	return err
+	return newInventoryError(err)
+}
+
+func (c *inventoryClient) UploadLogs(ctx context.Context, clusterId string, logsType string, upfile io.Reader) error {
+	fileName := fmt.Sprintf("%s_logs.tar.gz", logsType)
+	_, err := c.ai.Installer.UploadLogs(ctx,
+		&installer.UploadLogsParams{ClusterID: strfmt.UUID(clusterId), LogsType: logsType,
+			Upfile: runtime.NamedReader(fileName, upfile)})
+	return newInventoryError(err)
+}
+
+// UploadControllerLogs uploads the plain text tail of the controller own logs as the controller logs of the cluster
+func (c *inventoryClient) UploadControllerLogs(ctx context.Context, clusterId string, logs io.Reader) error {
+	_, err := c.ai.Installer.UploadLogs(ctx,
+		&installer.UploadLogsParams{ClusterID: strfmt.UUID(clusterId), LogsType: "controller",
+			Upfile: runtime.NamedReader(controllerLogsFileName, logs)})
+	return newInventoryError(err)
+}
+
+func (c *inventoryClient) UpdateClusterProgress(ctx context.Context, clusterId string, percentage int) error {
+	_, err := c.ai.Installer.UpdateClusterInstallProgress(ctx,
+		&installer.UpdateClusterInstallProgressParams{ClusterID: strfmt.UUID(clusterId),
+			ClusterProgress: fmt.Sprintf("%d%%", percentage)})
+	return newInventoryError(err)
+}
+
+// AddEvent adds an event of the cluster with one of the models.EventSeverity severities to the cluster events of
+// assisted-service, the event references the host as well when hostId is set. assisted-service versions that don't
+// support it fail it with an error that IsUnsupported recognizes
+func (c *inventoryClient) AddEvent(ctx context.Context, clusterId string, hostId string, severity string, message string) error {
+	return c.submit(ctx, "AddEvent", http.MethodPost, "/clusters/{cluster_id}/events", strfmt.UUID(clusterId),
+		&eventParams{
+			ClusterID: strfmt.UUID(clusterId),
+			HostID:    strfmt.UUID(hostId),
+			Severity:  severity,
+			Message:   message,
+			EventTime: strfmt.DateTime(time.Now()),
+		})
 }
@@ -0,0 +1,418 @@
+package inventory_client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/assisted-service/client/installer"
+	"github.com/openshift/assisted-service/models"
+	"github.com/sirupsen/logrus"
+)
+
+func TestInventoryClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "inventory_client_test")
+}
+
+var _ = Describe("inventory client proxy", func() {
+	const (
+		clusterId    = "7916fa89-ea7a-443e-a862-b3e930309f65"
+		inventoryURL = "http://assisted-service.example.com:8090"
+	)
+	var (
+		l          = logrus.New()
+		proxy      *httptest.Server
+		mu         sync.Mutex
+		proxiedReq []string
+	)
+	l.SetOutput(ioutil.Discard)
+
+	BeforeEach(func() {
+		proxiedReq = nil
+		proxy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			proxiedReq = append(proxiedReq, r.Method+" "+r.URL.Host+r.URL.Path)
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			switch {
+			case strings.HasSuffix(r.URL.Path, "/uploads/ingress-cert"):
+				w.WriteHeader(http.StatusCreated)
+			case strings.HasSuffix(r.URL.Path, "/actions/complete_installation"):
+				w.WriteHeader(http.StatusAccepted)
+			default:
+				w.WriteHeader(http.StatusOK)
+			}
+			_, _ = w.Write([]byte("{}"))
+		}))
+	})
+	AfterEach(func() {
+		proxy.Close()
+	})
+
+	It("routes UploadIngressCa and CompleteInstallation through the proxy", func() {
+		client, err := CreateInventoryClient(clusterId, inventoryURL, "pull-secret", false, "", 0, "", "", l,
+			ProxyFunc(proxy.URL, proxy.URL, ""))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(client.UploadIngressCa(context.Background(), "ca", clusterId)).To(Succeed())
+		Expect(client.CompleteInstallation(context.Background(), clusterId, true, "")).To(Succeed())
+
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(proxiedReq).To(HaveLen(2))
+		Expect(proxiedReq[0]).To(HavePrefix("POST assisted-service.example.com:8090/"))
+		Expect(proxiedReq[0]).To(HaveSuffix("/clusters/" + clusterId + "/uploads/ingress-cert"))
+		Expect(proxiedReq[1]).To(HavePrefix("POST assisted-service.example.com:8090/"))
+		Expect(proxiedReq[1]).To(HaveSuffix("/clusters/" + clusterId + "/actions/complete_installation"))
+	})
+
+	It("ProxyFunc honors the scheme specific proxy and no proxy", func() {
+		proxyFunc := ProxyFunc("http://http-proxy.example.com:3128", "http://https-proxy.example.com:3129", ".internal.example.com")
+		for _, t := range []struct {
+			target   string
+			expected string
+		}{
+			{target: "http://assisted-service.example.com", expected: "http://http-proxy.example.com:3128"},
+			{target: "https://assisted-service.example.com", expected: "http://https-proxy.example.com:3129"},
+			{target: "https://assisted-service.internal.example.com", expected: ""},
+		} {
+			req, err := http.NewRequest(http.MethodGet, t.target, nil)
+			Expect(err).NotTo(HaveOccurred())
+			proxyURL, err := proxyFunc(req)
+			Expect(err).NotTo(HaveOccurred())
+			if t.expected == "" {
+				Expect(proxyURL).To(BeNil(), t.target)
+				continue
+			}
+			Expect(proxyURL).To(Equal(mustParseURL(t.expected)), t.target)
+		}
+	})
+})
+
+var _ = Describe("inventory client cancellation", func() {
+	const clusterId = "7916fa89-ea7a-443e-a862-b3e930309f65"
+	var (
+		l        = logrus.New()
+		server   *httptest.Server
+		received chan string
+		release  chan struct{}
+	)
+	l.SetOutput(ioutil.Discard)
+
+	BeforeEach(func() {
+		received = make(chan string, 10)
+		release = make(chan struct{})
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received <- r.URL.Path
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}))
+	})
+	AfterEach(func() {
+		close(release)
+		server.Close()
+	})
+
+	for _, t := range []struct {
+		name string
+		call func(ctx context.Context, client InventoryClient) error
+	}{
+		{name: "CompleteInstallation", call: func(ctx context.Context, client InventoryClient) error {
+			return client.CompleteInstallation(ctx, clusterId, true, "")
+		}},
+		{name: "UploadIngressCa", call: func(ctx context.Context, client InventoryClient) error {
+			return client.UploadIngressCa(ctx, "ca", clusterId)
+		}},
+	} {
+		t := t
+		It(fmt.Sprintf("aborts %s in flight once its context is cancelled", t.name), func() {
+			client, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", false, "", 0, "", "", l, nil)
+			Expect(err).NotTo(HaveOccurred())
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				done <- t.call(ctx, client)
+			}()
+			Eventually(received).Should(Receive())
+			cancel()
+			var callErr error
+			Eventually(done, 5*time.Second).Should(Receive(&callErr))
+			Expect(errors.Is(callErr, context.Canceled)).To(BeTrue(), fmt.Sprintf("%v", callErr))
+			// the cancelled request is not retried
+			Consistently(received, 100*time.Millisecond).ShouldNot(Receive())
+		})
+	}
+})
+
+var _ = Describe("inventory client certificate", func() {
+	const (
+		clusterId  = "7916fa89-ea7a-443e-a862-b3e930309f65"
+		clientName = "assisted-installer-controller"
+	)
+	var (
+		l         = logrus.New()
+		server    *httptest.Server
+		tmpDir    string
+		caPath    string
+		certPath  string
+		keyPath   string
+		presented chan string
+	)
+	l.SetOutput(ioutil.Discard)
+
+	writePem := func(name string, block *pem.Block) string {
+		path := filepath.Join(tmpDir, name)
+		Expect(ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "inventory-client-cert")
+		Expect(err).NotTo(HaveOccurred())
+		// the client certificate is self signed, so the server trusts it as its own ca
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		template := x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: clientName},
+			NotBefore:             time.Now().Add(-time.Minute),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+		clientCert, err := x509.ParseCertificate(der)
+		Expect(err).NotTo(HaveOccurred())
+		keyDer, err := x509.MarshalECPrivateKey(key)
+		Expect(err).NotTo(HaveOccurred())
+		certPath = writePem("client.crt", &pem.Block{Type: "CERTIFICATE", Bytes: der})
+		keyPath = writePem("client.key", &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+		clientCAs := x509.NewCertPool()
+		clientCAs.AddCert(clientCert)
+		presented = make(chan string, 10)
+		server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			presented <- r.TLS.PeerCertificates[0].Subject.CommonName
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("{}"))
+		}))
+		server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+		server.StartTLS()
+		caPath = writePem("ca.crt", &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	})
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(tmpDir)
+	})
+
+	It("presents the client certificate to the server signed by the custom CA", func() {
+		client, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", false, caPath, 0, certPath, keyPath, l, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.GetCluster(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(presented).To(Receive(Equal(clientName)))
+	})
+	It("presents the client certificate when reloading the custom CA", func() {
+		client, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", false, caPath, time.Millisecond, certPath, keyPath, l, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.GetCluster(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(presented).To(Receive(Equal(clientName)))
+	})
+	It("presents the client certificate when skipping certificate verification", func() {
+		client, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", true, "", 0, certPath, keyPath, l, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.GetCluster(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(presented).To(Receive(Equal(clientName)))
+	})
+	It("is rejected by the server without a client certificate", func() {
+		client, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", false, caPath, 0, "", "", l, nil)
+		Expect(err).NotTo(HaveOccurred())
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err = client.GetCluster(ctx)
+		Expect(err).To(HaveOccurred())
+		Expect(presented).NotTo(Receive())
+	})
+	It("requires both the client certificate and its key", func() {
+		_, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", false, caPath, 0, certPath, "", l, nil)
+		Expect(err).To(MatchError(ContainSubstring("both the client certificate and its key are required")))
+		_, err = CreateInventoryClient(clusterId, server.URL, "pull-secret", false, caPath, 0, "", keyPath, l, nil)
+		Expect(err).To(MatchError(ContainSubstring("both the client certificate and its key are required")))
+	})
+	It("fails on an invalid client key", func() {
+		Expect(ioutil.WriteFile(keyPath, []byte("not a key"), 0600)).To(Succeed())
+		_, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", false, caPath, 0, certPath, keyPath, l, nil)
+		Expect(err).To(MatchError(ContainSubstring("failed to load client certificate")))
+	})
+})
+
+var _ = Describe("inventory client requests without generated client", func() {
+	const clusterId = "7916fa89-ea7a-443e-a862-b3e930309f65"
+	var (
+		l        = logrus.New()
+		server   *httptest.Server
+		status   int
+		mu       sync.Mutex
+		requests []string
+		bodies   []string
+	)
+	l.SetOutput(ioutil.Discard)
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		requests = nil
+		bodies = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			mu.Lock()
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			bodies = append(bodies, string(body))
+			mu.Unlock()
+			w.WriteHeader(status)
+		}))
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("updates several hosts in one request", func() {
+		client, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", false, "", 0, "", "", l, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.UpdateHostsInstallProgress(context.Background(), []HostProgressUpdate{
+			{HostID: "eb82821f-bf21-4614-9a3b-ecb07929f238", Stage: models.HostStageDone},
+			{HostID: "b898d516-3e16-49d0-86a5-0ad5bd04e3ed", Stage: models.HostStageConfiguring, Info: "info"},
+		})).To(Succeed())
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0]).To(HavePrefix("PUT /"))
+		Expect(requests[0]).To(HaveSuffix("/clusters/" + clusterId + "/hosts/progress"))
+		Expect(bodies[0]).To(MatchJSON(`[
+			{"host_id": "eb82821f-bf21-4614-9a3b-ecb07929f238", "host_progress": {"current_stage": "Done"}},
+			{"host_id": "b898d516-3e16-49d0-86a5-0ad5bd04e3ed", "host_progress": {"current_stage": "Configuring", "progress_info": "info"}}
+		]`))
+	})
+	It("adds an event of the cluster referencing the host", func() {
+		client, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", false, "", 0, "", "", l, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.AddEvent(context.Background(), clusterId, "eb82821f-bf21-4614-9a3b-ecb07929f238",
+			models.EventSeverityWarning, "message")).To(Succeed())
+		Expect(client.AddEvent(context.Background(), clusterId, "", models.EventSeverityInfo, "cluster message")).To(Succeed())
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(requests).To(HaveLen(2))
+		for _, request := range requests {
+			Expect(request).To(HavePrefix("POST /"))
+			Expect(request).To(HaveSuffix("/clusters/" + clusterId + "/events"))
+		}
+		var event, clusterEvent map[string]interface{}
+		Expect(json.Unmarshal([]byte(bodies[0]), &event)).To(Succeed())
+		Expect(event).To(HaveKeyWithValue("cluster_id", clusterId))
+		Expect(event).To(HaveKeyWithValue("host_id", "eb82821f-bf21-4614-9a3b-ecb07929f238"))
+		Expect(event).To(HaveKeyWithValue("severity", models.EventSeverityWarning))
+		Expect(event).To(HaveKeyWithValue("message", "message"))
+		Expect(event).To(HaveKey("event_time"))
+		Expect(json.Unmarshal([]byte(bodies[1]), &clusterEvent)).To(Succeed())
+		Expect(clusterEvent).NotTo(HaveKey("host_id"))
+	})
+	It("fails as unsupported when the service doesn't know the request", func() {
+		status = http.StatusNotFound
+		client, err := CreateInventoryClient(clusterId, server.URL, "pull-secret", false, "", 0, "", "", l, nil)
+		Expect(err).NotTo(HaveOccurred())
+		err = client.UpdateHostsInstallProgress(context.Background(), []HostProgressUpdate{
+			{HostID: "eb82821f-bf21-4614-9a3b-ecb07929f238", Stage: models.HostStageDone},
+		})
+		Expect(IsUnsupported(err)).To(BeTrue(), fmt.Sprintf("%v", err))
+	})
+})
+
+func mustParseURL(rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	Expect(err).NotTo(HaveOccurred())
+	return u
+}
+
+var _ = Describe("inventory errors", func() {
+	It("status code is taken from the generated response type", func() {
+		Expect(statusCode(installer.NewGetClusterNotFound())).To(Equal(http.StatusNotFound))
+		Expect(statusCode(installer.NewCompleteInstallationConflict())).To(Equal(http.StatusConflict))
+		Expect(statusCode(installer.NewListHostsInternalServerError())).To(Equal(http.StatusInternalServerError))
+	})
+	It("status code is taken from unexpected responses", func() {
+		Expect(statusCode(runtime.NewAPIError("unknown error", nil, http.StatusBadGateway))).To(Equal(http.StatusBadGateway))
+	})
+	It("status code is 0 without response", func() {
+		Expect(statusCode(fmt.Errorf("connection refused"))).To(Equal(0))
+	})
+	It("classifies errors", func() {
+		tests := []struct {
+			err       error
+			notFound  bool
+			conflict  bool
+			transient bool
+		}{
+			{err: newInventoryError(installer.NewGetClusterNotFound()), notFound: true, transient: false},
+			{err: newInventoryError(installer.NewCompleteInstallationInternalServerError()), transient: true},
+			{err: newInventoryError(runtime.NewAPIError("unknown error", nil, http.StatusServiceUnavailable)), transient: true},
+			{err: &InventoryError{StatusCode: http.StatusBadRequest, Err: fmt.Errorf("dummy")}, transient: false},
+			{err: &InventoryError{StatusCode: http.StatusUnauthorized, Err: fmt.Errorf("dummy")}, transient: false},
+			{err: &InventoryError{StatusCode: http.StatusConflict, Err: fmt.Errorf("dummy")}, conflict: true, transient: false},
+			{err: newInventoryError(installer.NewCompleteInstallationConflict()), conflict: true, transient: false},
+			{err: &InventoryError{StatusCode: http.StatusTooManyRequests, Err: fmt.Errorf("dummy")}, transient: true},
+			{err: &InventoryError{StatusCode: http.StatusInternalServerError, Err: fmt.Errorf("dummy")}, transient: true},
+			{err: &InventoryError{StatusCode: http.StatusNotImplemented, Err: fmt.Errorf("dummy")}, transient: false},
+			{err: newInventoryError(&url.Error{Op: "Get", URL: "http://assisted-service.example.com",
+				Err: &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}}), transient: true},
+			{err: newInventoryError(fmt.Errorf("unexpected response")), transient: false},
+			{err: fmt.Errorf("dummy"), transient: false},
+		}
+		for _, t := range tests {
+			Expect(IsNotFound(t.err)).To(Equal(t.notFound), t.err.Error())
+			Expect(IsConflict(t.err)).To(Equal(t.conflict), t.err.Error())
+			Expect(IsTransient(t.err)).To(Equal(t.transient), t.err.Error())
+		}
+	})
+	It("classifies unsupported requests", func() {
+		Expect(IsUnsupported(&InventoryError{StatusCode: http.StatusNotFound, Err: fmt.Errorf("dummy")})).To(BeTrue())
+		Expect(IsUnsupported(&InventoryError{StatusCode: http.StatusMethodNotAllowed, Err: fmt.Errorf("dummy")})).To(BeTrue())
+		Expect(IsUnsupported(&InventoryError{StatusCode: http.StatusNotImplemented, Err: fmt.Errorf("dummy")})).To(BeTrue())
+		Expect(IsUnsupported(&InventoryError{StatusCode: http.StatusInternalServerError, Err: fmt.Errorf("dummy")})).To(BeFalse())
+		Expect(IsUnsupported(fmt.Errorf("dummy"))).To(BeFalse())
+	})
+	It("wraps nil as nil", func() {
+		Expect(newInventoryError(nil)).To(BeNil())
+	})
+})
@@ -5,6 +5,8 @@
 package inventory_client
 
 import (
+	context "context"
+	io "io"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -35,102 +37,172 @@ func (m *MockInventoryClient) EXPECT() *MockInventoryClientMockRecorder {
 }
 
 // DownloadFile mocks base method
-func (m *MockInventoryClient) DownloadFile(filename, dest string) error {
+func (m *MockInventoryClient) DownloadFile(ctx context.Context, filename, dest string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DownloadFile", filename, dest)
+	ret := m.ctrl.Call(m, "DownloadFile", ctx, filename, dest)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DownloadFile indicates an expected call of DownloadFile
-func (mr *MockInventoryClientMockRecorder) DownloadFile(filename, dest interface{}) *gomock.Call {
+func (mr *MockInventoryClientMockRecorder) DownloadFile(ctx, filename, dest interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadFile", reflect.TypeOf((*MockInventoryClient)(nil).DownloadFile), filename, dest)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadFile", reflect.TypeOf((*MockInventoryClient)(nil).DownloadFile), ctx, filename, dest)
 }
 
 // UpdateHostInstallProgress mocks base method
-func (m *MockInventoryClient) UpdateHostInstallProgress(hostId string, newStage models.HostStage, info string) error {
+func (m *MockInventoryClient) UpdateHostInstallProgress(ctx context.Context, hostId string, newStage models.HostStage, info string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateHostInstallProgress", hostId, newStage, info)
+	ret := m.ctrl.Call(m, "UpdateHostInstallProgress", ctx, hostId, newStage, info)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateHostInstallProgress indicates an expected call of UpdateHostInstallProgress
-func (mr *MockInventoryClientMockRecorder) UpdateHostInstallProgress(hostId, newStage, info interface{}) *gomock.Call {
+func (mr *MockInventoryClientMockRecorder) UpdateHostInstallProgress(ctx, hostId, newStage, info interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateHostInstallProgress", reflect.TypeOf((*MockInventoryClient)(nil).UpdateHostInstallProgress), hostId, newStage, info)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateHostInstallProgress", reflect.TypeOf((*MockInventoryClient)(nil).UpdateHostInstallProgress), ctx, hostId, newStage, info)
+}
+
+// UpdateHostsInstallProgress mocks base method
+func (m *MockInventoryClient) UpdateHostsInstallProgress(ctx context.Context, updates []HostProgressUpdate) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateHostsInstallProgress", ctx, updates)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateHostsInstallProgress indicates an expected call of UpdateHostsInstallProgress
+func (mr *MockInventoryClientMockRecorder) UpdateHostsInstallProgress(ctx, updates interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateHostsInstallProgress", reflect.TypeOf((*MockInventoryClient)(nil).UpdateHostsInstallProgress), ctx, updates)
 }
 
 // GetEnabledHostsNamesHosts mocks base method
-func (m *MockInventoryClient) GetEnabledHostsNamesHosts() (map[string]HostData, error) {
+func (m *MockInventoryClient) GetEnabledHostsNamesHosts(ctx context.Context) (map[string]HostData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetEnabledHostsNamesHosts")
+	ret := m.ctrl.Call(m, "GetEnabledHostsNamesHosts", ctx)
 	ret0, _ := ret[0].(map[string]HostData)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetEnabledHostsNamesHosts indicates an expected call of GetEnabledHostsNamesHosts
-func (mr *MockInventoryClientMockRecorder) GetEnabledHostsNamesHosts() *gomock.Call {
+func (mr *MockInventoryClientMockRecorder) GetEnabledHostsNamesHosts(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEnabledHostsNamesHosts", reflect.TypeOf((*MockInventoryClient)(nil).GetEnabledHostsNamesHosts))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEnabledHostsNamesHosts", reflect.TypeOf((*MockInventoryClient)(nil).GetEnabledHostsNamesHosts), ctx)
 }
 
 // UploadIngressCa mocks base method
-func (m *MockInventoryClient) UploadIngressCa(ingressCA, clusterId string) error {
+func (m *MockInventoryClient) UploadIngressCa(ctx context.Context, ingressCA, clusterId string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UploadIngressCa", ingressCA, clusterId)
+	ret := m.ctrl.Call(m, "UploadIngressCa", ctx, ingressCA, clusterId)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UploadIngressCa indicates an expected call of UploadIngressCa
-func (mr *MockInventoryClientMockRecorder) UploadIngressCa(ingressCA, clusterId interface{}) *gomock.Call {
+func (mr *MockInventoryClientMockRecorder) UploadIngressCa(ctx, ingressCA, clusterId interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadIngressCa", reflect.TypeOf((*MockInventoryClient)(nil).UploadIngressCa), ingressCA, clusterId)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadIngressCa", reflect.TypeOf((*MockInventoryClient)(nil).UploadIngressCa), ctx, ingressCA, clusterId)
 }
 
 // GetCluster mocks base method
-func (m *MockInventoryClient) GetCluster() (*models.Cluster, error) {
+func (m *MockInventoryClient) GetCluster(ctx context.Context) (*models.Cluster, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCluster")
+	ret := m.ctrl.Call(m, "GetCluster", ctx)
 	ret0, _ := ret[0].(*models.Cluster)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetCluster indicates an expected call of GetCluster
-func (mr *MockInventoryClientMockRecorder) GetCluster() *gomock.Call {
+func (mr *MockInventoryClientMockRecorder) GetCluster(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCluster", reflect.TypeOf((*MockInventoryClient)(nil).GetCluster))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCluster", reflect.TypeOf((*MockInventoryClient)(nil).GetCluster), ctx)
 }
 
 // CompleteInstallation mocks base method
-func (m *MockInventoryClient) CompleteInstallation(clusterId string, isSuccess bool, errorInfo string) error {
+func (m *MockInventoryClient) CompleteInstallation(ctx context.Context, clusterId string, isSuccess bool, errorInfo string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CompleteInstallation", clusterId, isSuccess, errorInfo)
+	ret := m.ctrl.Call(m, "CompleteInstallation", ctx, clusterId, isSuccess, errorInfo)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // CompleteInstallation indicates an expected call of CompleteInstallation
-func (mr *MockInventoryClientMockRecorder) CompleteInstallation(clusterId, isSuccess, errorInfo interface{}) *gomock.Call {
+func (mr *MockInventoryClientMockRecorder) CompleteInstallation(ctx, clusterId, isSuccess, errorInfo interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteInstallation", reflect.TypeOf((*MockInventoryClient)(nil).CompleteInstallation), clusterId, isSuccess, errorInfo)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteInstallation", reflect.TypeOf((*MockInventoryClient)(nil).CompleteInstallation), ctx, clusterId, isSuccess, errorInfo)
 }
 
 // GetHosts mocks base method
-func (m *MockInventoryClient) GetHosts(skippedStatuses []string) (map[string]HostData, error) {
+func (m *MockInventoryClient) GetHosts(ctx context.Context, skippedStatuses []string) (map[string]HostData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetHosts", skippedStatuses)
+	ret := m.ctrl.Call(m, "GetHosts", ctx, skippedStatuses)
 	ret0, _ := ret[0].(map[string]HostData)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetHosts indicates an expected call of GetHosts
-func (mr *MockInventoryClientMockRecorder) GetHosts(skippedStatuses interface{}) *gomock.Call {
+func (mr *MockInventoryClientMockRecorder) GetHosts(ctx, skippedStatuses interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHosts", reflect.TypeOf((*MockInventoryClient)(nil).GetHosts), ctx, skippedStatuses)
+}
+
+// UploadLogs mocks base method
+func (m *MockInventoryClient) UploadLogs(ctx context.Context, clusterId, logsType string, upfile io.Reader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadLogs", ctx, clusterId, logsType, upfile)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UploadLogs indicates an expected call of UploadLogs
+func (mr *MockInventoryClientMockRecorder) UploadLogs(ctx, clusterId, logsType, upfile interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadLogs", reflect.TypeOf((*MockInventoryClient)(nil).UploadLogs), ctx, clusterId, logsType, upfile)
+}
+
+// UploadControllerLogs mocks base method
+func (m *MockInventoryClient) UploadControllerLogs(ctx context.Context, clusterId string, logs io.Reader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadControllerLogs", ctx, clusterId, logs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UploadControllerLogs indicates an expected call of UploadControllerLogs
+func (mr *MockInventoryClientMockRecorder) UploadControllerLogs(ctx, clusterId, logs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadControllerLogs", reflect.TypeOf((*MockInventoryClient)(nil).UploadControllerLogs), ctx, clusterId, logs)
+}
+
+// UpdateClusterProgress mocks base method
+func (m *MockInventoryClient) UpdateClusterProgress(ctx context.Context, clusterId string, percentage int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateClusterProgress", ctx, clusterId, percentage)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateClusterProgress indicates an expected call of UpdateClusterProgress
+func (mr *MockInventoryClientMockRecorder) UpdateClusterProgress(ctx, clusterId, percentage interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateClusterProgress", reflect.TypeOf((*MockInventoryClient)(nil).UpdateClusterProgress), ctx, clusterId, percentage)
+}
+
+// AddEvent mocks base method
+func (m *MockInventoryClient) AddEvent(ctx context.Context, clusterId, hostId, severity, message string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddEvent", ctx, clusterId, hostId, severity, message)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddEvent indicates an expected call of AddEvent
+func (mr *MockInventoryClientMockRecorder) AddEvent(ctx, clusterId, hostId, severity, message interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHosts", reflect.TypeOf((*MockInventoryClient)(nil).GetHosts), skippedStatuses)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddEvent", reflect.TypeOf((*MockInventoryClient)(nil).AddEvent), ctx, clusterId, hostId, severity, message)
 }
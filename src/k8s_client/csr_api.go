@@ -0,0 +1,179 @@
+package k8s_client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	certificatesv1beta1client "k8s.io/client-go/kubernetes/typed/certificates/v1beta1"
+)
+
+const (
+	csrV1beta1GroupVersion = "certificates.k8s.io/v1beta1"
+	csrV1GroupVersion      = "certificates.k8s.io/v1"
+)
+
+var csrV1Resource = schema.GroupVersionResource{Group: "certificates.k8s.io", Version: "v1", Resource: "certificatesigningrequests"}
+
+// csrAPI lists, gets and approves the csrs of the certificates.k8s.io version served by the cluster,
+// the csrs are represented as v1beta1 csrs whatever the served version
+type csrAPI interface {
+	List(ctx context.Context) (*certificatesv1beta1.CertificateSigningRequestList, error)
+	Get(ctx context.Context, name string) (*certificatesv1beta1.CertificateSigningRequest, error)
+	UpdateApproval(ctx context.Context, csr *certificatesv1beta1.CertificateSigningRequest) error
+	// GroupVersion is the certificates.k8s.io version the csrs are served with
+	GroupVersion() string
+}
+
+// newCsrAPI picks the csr api from the versions served by the cluster, v1beta1 while it is served and v1 once
+// v1beta1 was removed in kubernetes 1.22. v1beta1 is assumed when the discovery fails
+func newCsrAPI(discoveryClient discovery.DiscoveryInterface, csrs certificatesv1beta1client.CertificateSigningRequestInterface,
+	dynamicClient dynamic.Interface, logger logrus.FieldLogger) (csrAPI, error) {
+	served, err := isCsrServed(discoveryClient, csrV1beta1GroupVersion)
+	if err != nil {
+		logger.WithError(err).Warnf("Failed to discover %s api, assuming it is served", csrV1beta1GroupVersion)
+		return csrV1beta1API{csrs: csrs}, nil
+	}
+	if served {
+		return csrV1beta1API{csrs: csrs}, nil
+	}
+	if served, err = isCsrServed(discoveryClient, csrV1GroupVersion); err != nil {
+		return nil, errors.Wrapf(err, "failed to discover %s api", csrV1GroupVersion)
+	}
+	if !served {
+		return nil, fmt.Errorf("neither %s nor %s api is served by the cluster, csrs can't be listed or approved",
+			csrV1beta1GroupVersion, csrV1GroupVersion)
+	}
+	logger.Infof("%s api is not served by the cluster, using %s", csrV1beta1GroupVersion, csrV1GroupVersion)
+	return csrV1API{csrs: dynamicClient.Resource(csrV1Resource)}, nil
+}
+
+// isCsrServed checks whether the cluster serves the csrs of the certificates.k8s.io group version
+func isCsrServed(discoveryClient discovery.DiscoveryInterface, groupVersion string) (bool, error) {
+	resources, err := discoveryClient.ServerResourcesForGroupVersion(groupVersion)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if resources == nil {
+		return false, nil
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Name == "certificatesigningrequests" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type csrV1beta1API struct {
+	csrs certificatesv1beta1client.CertificateSigningRequestInterface
+}
+
+func (a csrV1beta1API) List(ctx context.Context) (*certificatesv1beta1.CertificateSigningRequestList, error) {
+	return a.csrs.List(ctx, metav1.ListOptions{})
+}
+
+func (a csrV1beta1API) Get(ctx context.Context, name string) (*certificatesv1beta1.CertificateSigningRequest, error) {
+	return a.csrs.Get(ctx, name, metav1.GetOptions{})
+}
+
+func (a csrV1beta1API) UpdateApproval(ctx context.Context, csr *certificatesv1beta1.CertificateSigningRequest) error {
+	_, err := a.csrs.UpdateApproval(ctx, csr, metav1.UpdateOptions{})
+	return err
+}
+
+func (a csrV1beta1API) GroupVersion() string {
+	return csrV1beta1GroupVersion
+}
+
+// csrV1API serves the certificates.k8s.io/v1 csrs with the dynamic client, the typed v1 client requires client-go 0.19
+type csrV1API struct {
+	csrs dynamic.ResourceInterface
+}
+
+func (a csrV1API) GroupVersion() string {
+	return csrV1GroupVersion
+}
+
+func (a csrV1API) List(ctx context.Context) (*certificatesv1beta1.CertificateSigningRequestList, error) {
+	list, err := a.csrs.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	csrs := &certificatesv1beta1.CertificateSigningRequestList{}
+	for i := range list.Items {
+		csr, err := csrFromV1(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		csrs.Items = append(csrs.Items, *csr)
+	}
+	return csrs, nil
+}
+
+func (a csrV1API) Get(ctx context.Context, name string) (*certificatesv1beta1.CertificateSigningRequest, error) {
+	obj, err := a.csrs.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return csrFromV1(obj)
+}
+
+func (a csrV1API) UpdateApproval(ctx context.Context, csr *certificatesv1beta1.CertificateSigningRequest) error {
+	obj, err := csrToV1(csr)
+	if err != nil {
+		return err
+	}
+	_, err = a.csrs.Update(ctx, obj, metav1.UpdateOptions{}, "approval")
+	return err
+}
+
+// csrFromV1 converts a v1 csr to a v1beta1 csr, the fields are the same but for the conditions status
+// that v1beta1 csrs of client-go 0.18 don't have
+func csrFromV1(obj *unstructured.Unstructured) (*certificatesv1beta1.CertificateSigningRequest, error) {
+	csr := &certificatesv1beta1.CertificateSigningRequest{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), csr); err != nil {
+		return nil, errors.Wrapf(err, "failed to convert csr %s", obj.GetName())
+	}
+	return csr, nil
+}
+
+// csrToV1 converts a v1beta1 csr to a v1 csr. v1 requires the conditions status, the approved, denied
+// and failed conditions are only ever added as true
+func csrToV1(csr *certificatesv1beta1.CertificateSigningRequest) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(csr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert csr %s", csr.Name)
+	}
+	obj := &unstructured.Unstructured{Object: content}
+	obj.SetAPIVersion(csrV1GroupVersion)
+	obj.SetKind("CertificateSigningRequest")
+	conditions, found, err := unstructured.NestedSlice(content, "status", "conditions")
+	if err != nil || !found {
+		return obj, err
+	}
+	for _, condition := range conditions {
+		if fields, ok := condition.(map[string]interface{}); ok {
+			if _, set := fields["status"]; !set {
+				fields["status"] = string(v1.ConditionTrue)
+			}
+		}
+	}
+	if err := unstructured.SetNestedSlice(content, conditions, "status", "conditions"); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
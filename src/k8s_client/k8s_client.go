@@ -3,9 +3,11 @@ package k8s_client
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/openshift/assisted-installer/src/utils"
 	"k8s.io/apimachinery/pkg/labels"
@@ -18,6 +20,7 @@ import (
 
 	bmoapis "github.com/metal3-io/baremetal-operator/pkg/apis"
 	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/pkg/apis/metal3/v1alpha1"
+	configv1 "github.com/openshift/api/config/v1"
 	configv1client "github.com/openshift/client-go/config/clientset/versioned/typed/config/v1"
 	operatorv1 "github.com/openshift/client-go/operator/clientset/versioned"
 	"github.com/pkg/errors"
@@ -25,15 +28,17 @@ import (
 	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
-	certificatesv1beta1client "k8s.io/client-go/kubernetes/typed/certificates/v1beta1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
-	runtimeconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
 //var AddToSchemes runtime.SchemeBuilder
@@ -42,19 +47,28 @@ import (
 type K8SClient interface {
 	ListMasterNodes() (*v1.NodeList, error)
 	PatchEtcd() error
-	UnPatchEtcd() error
+	UnPatchEtcd() (EtcdUnpatchResult, error)
+	IsEtcdPatched() (bool, error)
 	ListNodes() (*v1.NodeList, error)
 	RunOCctlCommand(args []string, kubeconfigPath string, o ops.Ops) (string, error)
 	ApproveCsr(csr *v1beta1.CertificateSigningRequest) error
 	ListCsrs() (*v1beta1.CertificateSigningRequestList, error)
+	CsrGroupVersion() string
 	GetConfigMap(namespace string, name string) (*v1.ConfigMap, error)
-	GetPodLogs(namespace string, podName string, sinceSeconds int64) (string, error)
+	GetPodLogs(namespace string, podName string, opts PodLogsOptions) (string, error)
 	GetPods(namespace string, labelMatch map[string]string) ([]v1.Pod, error)
 	IsMetalProvisioningExists() (bool, error)
 	ListBMHs() (metal3v1alpha1.BareMetalHostList, error)
 	UpdateBMHStatus(bmh *metal3v1alpha1.BareMetalHost) error
 	UpdateBMH(bmh *metal3v1alpha1.BareMetalHost) error
 	SetProxyEnvVars() error
+	CreateEvent(event *v1.Event) error
+	IsBootstrapComplete() (bool, error)
+	ListClusterOperators() (*configv1.ClusterOperatorList, error)
+	ListEtcdMembers() ([]EtcdMember, error)
+	CordonNode(name string) error
+	AnnotateNode(name string, annotations map[string]string) error
+	UncordonNode(name string) error
 }
 
 type K8SClientBuilder func(configPath string, logger *logrus.Logger) (K8SClient, error)
@@ -64,15 +78,47 @@ type k8sClient struct {
 	client        *kubernetes.Clientset
 	ocClient      *operatorv1.Clientset
 	runtimeClient runtimeclient.Client
-	// CertificateSigningRequestInterface is interface
-	csrClient   certificatesv1beta1client.CertificateSigningRequestInterface
+	// csrClient serves the csrs of the certificates.k8s.io version served by the cluster
+	csrClient   csrAPI
 	proxyClient configv1client.ProxyInterface
+	// clusterOperatorsClient lists the cluster operators that report whether the cluster is ready
+	clusterOperatorsClient configv1client.ClusterOperatorInterface
+	// csrAPIError is set when no certificates.k8s.io version the client supports is served by the cluster
+	csrAPIError error
 }
 
+// NewK8SClient creates a client from the kubeconfig at configPath, or from the in-cluster config when configPath
+// is empty. The runtime client the BMHs are managed with is created only with the in-cluster config
 func NewK8SClient(configPath string, logger *logrus.Logger) (K8SClient, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", configPath)
+	return newK8SClient(configPath, configPath == "", logger)
+}
+
+// NewControllerK8SClient creates a client from the kubeconfig at kubeconfigPath, or from the in-cluster config when
+// kubeconfigPath is empty, so the controller can also run outside the cluster
+func NewControllerK8SClient(kubeconfigPath string, logger *logrus.Logger) (K8SClient, error) {
+	return newK8SClient(kubeconfigPath, true, logger)
+}
+
+// restConfig loads the kubeconfig at kubeconfigPath, or the in-cluster config when no path is given
+func restConfig(kubeconfigPath string) (*rest.Config, error) {
+	if kubeconfigPath != "" {
+		config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading kubeconfig %s", kubeconfigPath)
+		}
+		return config, nil
+	}
+	config, err := rest.InClusterConfig()
 	if err != nil {
-		return &k8sClient{}, errors.Wrap(err, "loading kubeconfig")
+		return nil, errors.Wrap(err, "no kubeconfig path was given and the in-cluster config is not available")
+	}
+	return config, nil
+}
+
+func newK8SClient(kubeconfigPath string, withRuntimeClient bool, logger *logrus.Logger) (K8SClient, error) {
+	config, err := restConfig(kubeconfigPath)
+	if err != nil {
+		return &k8sClient{}, err
 	}
 	client, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -82,13 +128,16 @@ func NewK8SClient(configPath string, logger *logrus.Logger) (K8SClient, error) {
 	if err != nil {
 		return &k8sClient{}, errors.Wrap(err, "creating a Kubernetes client")
 	}
-	csrClient := client.CertificatesV1beta1().CertificateSigningRequests()
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return &k8sClient{}, errors.Wrap(err, "creating a Kubernetes dynamic client")
+	}
 	configClient, err := configv1client.NewForConfig(config)
 	if err != nil {
 		return &k8sClient{}, errors.Wrap(err, "creating openshift config client")
 	}
 	var runtimeClient runtimeclient.Client
-	if configPath == "" {
+	if withRuntimeClient {
 		scheme := runtime.NewScheme()
 		err = clientgoscheme.AddToScheme(scheme)
 		if err != nil {
@@ -102,13 +151,20 @@ func NewK8SClient(configPath string, logger *logrus.Logger) (K8SClient, error) {
 			return &k8sClient{}, errors.Wrap(err, "failed to add BMH scheme")
 		}
 
-		runtimeClient, err = runtimeclient.New(runtimeconfig.GetConfigOrDie(), runtimeclient.Options{Scheme: scheme})
+		runtimeClient, err = runtimeclient.New(config, runtimeclient.Options{Scheme: scheme})
 		if err != nil {
 			return &k8sClient{}, errors.Wrap(err, "failed to create runtime client")
 		}
 	}
 
-	return &k8sClient{logger, client, ocClient, runtimeClient, csrClient, configClient.Proxies()}, nil
+	csrClient, csrAPIError := newCsrAPI(client.Discovery(), client.CertificatesV1beta1().CertificateSigningRequests(),
+		dynamicClient, logger)
+	if csrAPIError != nil {
+		logger.Error(csrAPIError)
+	}
+
+	return &k8sClient{logger, client, ocClient, runtimeClient, csrClient, configClient.Proxies(), configClient.ClusterOperators(),
+		csrAPIError}, nil
 }
 
 func (c *k8sClient) ListMasterNodes() (*v1.NodeList, error) {
@@ -127,6 +183,94 @@ func (c *k8sClient) ListNodes() (*v1.NodeList, error) {
 	return nodes, nil
 }
 
+// cordonPatch marks a node unschedulable like kubectl cordon
+var cordonPatch = []byte(`{"spec": {"unschedulable": true}}`)
+
+// uncordonPatch marks a node schedulable like kubectl uncordon
+var uncordonPatch = []byte(`{"spec": {"unschedulable": false}}`)
+
+// CordonNode marks the node unschedulable, the workloads that already run on it are not evicted
+func (c *k8sClient) CordonNode(name string) error {
+	c.log.Infof("Cordoning node %s", name)
+	return cordonNode(c.client.CoreV1().Nodes(), name)
+}
+
+func cordonNode(nodes corev1client.NodeInterface, name string) error {
+	_, err := nodes.Patch(context.TODO(), name, types.StrategicMergePatchType, cordonPatch, metav1.PatchOptions{})
+	return errors.Wrapf(err, "Failed to cordon node %s", name)
+}
+
+// UncordonNode marks the node schedulable again
+func (c *k8sClient) UncordonNode(name string) error {
+	c.log.Infof("Uncordoning node %s", name)
+	return uncordonNode(c.client.CoreV1().Nodes(), name)
+}
+
+func uncordonNode(nodes corev1client.NodeInterface, name string) error {
+	_, err := nodes.Patch(context.TODO(), name, types.StrategicMergePatchType, uncordonPatch, metav1.PatchOptions{})
+	return errors.Wrapf(err, "Failed to uncordon node %s", name)
+}
+
+// AnnotateNode adds the annotations to the node, overriding the existing values of the same keys
+func (c *k8sClient) AnnotateNode(name string, annotations map[string]string) error {
+	return annotateNode(c.client.CoreV1().Nodes(), name, annotations)
+}
+
+func annotateNode(nodes corev1client.NodeInterface, name string, annotations map[string]string) error {
+	data, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal annotations of node %s", name)
+	}
+	_, err = nodes.Patch(context.TODO(), name, types.MergePatchType, data, metav1.PatchOptions{})
+	return errors.Wrapf(err, "Failed to annotate node %s", name)
+}
+
+func (c *k8sClient) ListClusterOperators() (*configv1.ClusterOperatorList, error) {
+	operators, err := c.clusterOperatorsClient.List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return &configv1.ClusterOperatorList{}, err
+	}
+	return operators, nil
+}
+
+const (
+	etcdNamespace = "openshift-etcd"
+	etcdAppLabel  = "etcd"
+)
+
+// EtcdMember is an etcd member by its static pod, it is healthy once the pod is running and ready
+type EtcdMember struct {
+	Name    string
+	Node    string
+	Healthy bool
+}
+
+func (c *k8sClient) ListEtcdMembers() ([]EtcdMember, error) {
+	pods, err := c.GetPods(etcdNamespace, map[string]string{"app": etcdAppLabel})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list etcd pods")
+	}
+	return etcdMembers(pods), nil
+}
+
+func etcdMembers(pods []v1.Pod) []EtcdMember {
+	members := make([]EtcdMember, 0, len(pods))
+	for _, pod := range pods {
+		members = append(members, EtcdMember{Name: pod.Name, Node: pod.Spec.NodeName,
+			Healthy: pod.Status.Phase == v1.PodRunning && isPodReady(&pod)})
+	}
+	return members
+}
+
+func isPodReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
 func (c *k8sClient) PatchEtcd() error {
 	c.log.Info("Patching etcd")
 	data := []byte(`{"spec": {"unsupportedConfigOverrides": {"useUnsupportedUnsafeNonHANonProductionUnstableEtcd": true}}}`)
@@ -138,15 +282,54 @@ func (c *k8sClient) PatchEtcd() error {
 	return nil
 }
 
-func (c *k8sClient) UnPatchEtcd() error {
+// EtcdUnpatchResult is the outcome of UnPatchEtcd
+type EtcdUnpatchResult string
+
+const (
+	EtcdUnpatched             EtcdUnpatchResult = "unpatched"
+	EtcdAlreadyUnpatched      EtcdUnpatchResult = "already-unpatched"
+	EtcdUnpatchTransientError EtcdUnpatchResult = "transient-error"
+	EtcdUnpatchPermanentError EtcdUnpatchResult = "permanent-error"
+)
+
+// UnPatchEtcd removes the unsupported config overrides set by PatchEtcd, the result tells whether
+// there was nothing to do and whether a failure is worth retrying
+func (c *k8sClient) UnPatchEtcd() (EtcdUnpatchResult, error) {
+	patched, err := c.IsEtcdPatched()
+	if err != nil {
+		return etcdUnpatchErrorResult(err), err
+	}
+	if !patched {
+		return EtcdAlreadyUnpatched, nil
+	}
 	c.log.Info("UnPatching etcd")
 	data := []byte(`{"spec": {"unsupportedConfigOverrides": null}}`)
 	result, err := c.ocClient.OperatorV1().Etcds().Patch(context.Background(), "cluster", types.MergePatchType, data, metav1.PatchOptions{})
 	if err != nil {
-		return errors.Wrap(err, "Failed to unpatch etcd")
+		return etcdUnpatchErrorResult(err), errors.Wrap(err, "Failed to unpatch etcd")
 	}
 	c.log.Info(result)
-	return nil
+	return EtcdUnpatched, nil
+}
+
+// etcdUnpatchErrorResult treats errors that won't go away by retrying the same request as permanent
+func etcdUnpatchErrorResult(err error) EtcdUnpatchResult {
+	err = errors.Cause(err)
+	if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) ||
+		apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) || apierrors.IsMethodNotSupported(err) {
+		return EtcdUnpatchPermanentError
+	}
+	return EtcdUnpatchTransientError
+}
+
+// IsEtcdPatched checks whether etcd still has the unsupported config overrides set by PatchEtcd
+func (c *k8sClient) IsEtcdPatched() (bool, error) {
+	etcd, err := c.ocClient.OperatorV1().Etcds().Get(context.Background(), "cluster", metav1.GetOptions{})
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get etcd")
+	}
+	overrides := string(etcd.Spec.UnsupportedConfigOverrides.Raw)
+	return overrides != "" && overrides != "null", nil
 }
 
 func (c *k8sClient) RunOCctlCommand(args []string, kubeconfigPath string, o ops.Ops) (string, error) {
@@ -160,7 +343,10 @@ func (c *k8sClient) RunOCctlCommand(args []string, kubeconfigPath string, o ops.
 }
 
 func (c k8sClient) ListCsrs() (*v1beta1.CertificateSigningRequestList, error) {
-	csrs, err := c.csrClient.List(context.TODO(), metav1.ListOptions{})
+	if c.csrAPIError != nil {
+		return nil, c.csrAPIError
+	}
+	csrs, err := c.csrClient.List(context.TODO())
 	if err != nil {
 		c.log.Errorf("Failed to get list of csrs. err : %e", err)
 		return nil, err
@@ -168,21 +354,58 @@ func (c k8sClient) ListCsrs() (*v1beta1.CertificateSigningRequestList, error) {
 	return csrs, nil
 }
 
-func (c k8sClient) ApproveCsr(csr *v1beta1.CertificateSigningRequest) error {
+// CsrGroupVersion returns the certificates.k8s.io version the csrs are served with, empty when none the client
+// supports is served by the cluster
+func (c k8sClient) CsrGroupVersion() string {
+	if c.csrAPIError != nil {
+		return ""
+	}
+	return c.csrClient.GroupVersion()
+}
 
-	csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1beta1.CertificateSigningRequestCondition{
-		Type:           certificatesv1beta1.CertificateApproved,
-		Reason:         "NodeCSRApprove",
-		Message:        "This CSR was approved by the assisted-installer-controller",
-		LastUpdateTime: metav1.Now(),
-	})
-	if _, err := c.csrClient.UpdateApproval(context.TODO(), csr, metav1.UpdateOptions{}); err != nil {
+// approveCsrMaxAttempts bounds the approvals of a csr that keeps being modified between the attempts
+const approveCsrMaxAttempts = 3
+
+func (c k8sClient) ApproveCsr(csr *v1beta1.CertificateSigningRequest) error {
+	if c.csrAPIError != nil {
+		return c.csrAPIError
+	}
+	if err := approveCsr(c.csrClient, csr, approveCsrMaxAttempts); err != nil {
 		c.log.Errorf("Failed to approve csr %v, err %e", csr, err)
 		return err
 	}
 	return nil
 }
 
+// approveCsr adds the approved condition to the csr. A conflict with a modification of the csr since it was read
+// refetches it and approves it again right away, up to maxAttempts times, a refetched csr that is already approved
+// is left as is
+func approveCsr(csrs csrAPI, csr *v1beta1.CertificateSigningRequest,
+	maxAttempts int) error {
+	name := csr.Name
+	for attempt := 1; ; attempt++ {
+		approved := csr.DeepCopy()
+		approved.Status.Conditions = append(approved.Status.Conditions, certificatesv1beta1.CertificateSigningRequestCondition{
+			Type:           certificatesv1beta1.CertificateApproved,
+			Reason:         "NodeCSRApprove",
+			Message:        "This CSR was approved by the assisted-installer-controller",
+			LastUpdateTime: metav1.Now(),
+		})
+		err := csrs.UpdateApproval(context.TODO(), approved)
+		if !apierrors.IsConflict(err) || attempt >= maxAttempts {
+			return err
+		}
+		if csr, err = csrs.Get(context.TODO(), name); err != nil {
+			return errors.Wrapf(err, "failed to refetch csr %s after a conflict", name)
+		}
+		for _, condition := range csr.Status.Conditions {
+			if condition.Type == certificatesv1beta1.CertificateApproved {
+				return nil
+			}
+		}
+	}
+}
+
 func (c *k8sClient) GetConfigMap(namespace string, name string) (*v1.ConfigMap, error) {
 	cm, err := c.client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
 	if err != nil {
@@ -191,6 +414,24 @@ func (c *k8sClient) GetConfigMap(namespace string, name string) (*v1.ConfigMap,
 	return cm, nil
 }
 
+// IsBootstrapComplete checks the bootstrap configmap that is marked complete once the
+// temporary control plane was torn down and the bootstrap node can be removed
+func (c *k8sClient) IsBootstrapComplete() (bool, error) {
+	cm, err := c.GetConfigMap("kube-system", "bootstrap")
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get bootstrap configmap")
+	}
+	return cm.Data["status"] == "complete", nil
+}
+
+func (c *k8sClient) CreateEvent(event *v1.Event) error {
+	_, err := c.client.CoreV1().Events(event.Namespace).Create(context.TODO(), event, metav1.CreateOptions{})
+	return err
+}
+
 func (c *k8sClient) SetProxyEnvVars() error {
 	options := metav1.GetOptions{}
 	proxy, err := c.proxyClient.Get(context.TODO(), "cluster", options)
@@ -225,24 +466,66 @@ func (c *k8sClient) GetPods(namespace string, labelMatch map[string]string) ([]v
 	return pod.Items, nil
 }
 
-func (c *k8sClient) GetPodLogs(namespace string, podName string, sinceSeconds int64) (string, error) {
-	podLogOpts := v1.PodLogOptions{}
-	if sinceSeconds > 0 {
+// PodLogsOptions bounds the fetched pod logs, zero values mean no bound
+type PodLogsOptions struct {
+	// SinceSeconds fetches only the logs of the last seconds
+	SinceSeconds int64
+	// TailLines fetches only the last lines
+	TailLines int64
+	// Timeout bounds the whole fetch, the logs that were read till it passed are returned
+	Timeout time.Duration
+}
+
+func (opts PodLogsOptions) podLogOptions() *v1.PodLogOptions {
+	podLogOpts := &v1.PodLogOptions{}
+	if opts.SinceSeconds > 0 {
+		sinceSeconds := opts.SinceSeconds
 		podLogOpts.SinceSeconds = &sinceSeconds
 	}
-	req := c.client.CoreV1().Pods(namespace).GetLogs(podName, &podLogOpts)
-	podLogs, err := req.Stream(context.TODO())
+	if opts.TailLines > 0 {
+		tailLines := opts.TailLines
+		podLogOpts.TailLines = &tailLines
+	}
+	return podLogOpts
+}
+
+func (c *k8sClient) GetPodLogs(namespace string, podName string, opts PodLogsOptions) (string, error) {
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	req := c.client.CoreV1().Pods(namespace).GetLogs(podName, opts.podLogOptions())
+	podLogs, err := req.Stream(ctx)
 	if err != nil {
 		return "", err
 	}
-	defer podLogs.Close()
+	logs, err := readPodLogs(ctx, podLogs)
+	if err == nil && ctx.Err() != nil {
+		c.log.Warnf("Fetching logs of pod %s/%s timed out after %s, returning %d bytes", namespace, podName, opts.Timeout, len(logs))
+	}
+	return logs, err
+}
 
+// readPodLogs reads the logs stream till it ends or ctx is done, in which case the logs read till then are returned
+func readPodLogs(ctx context.Context, stream io.ReadCloser) (string, error) {
+	defer stream.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// unblocks the read below
+			stream.Close()
+		case <-done:
+		}
+	}()
 	buf := new(bytes.Buffer)
-	_, err = io.Copy(buf, podLogs)
-	if err != nil {
+	_, err := io.Copy(buf, stream)
+	if err != nil && ctx.Err() == nil {
 		return "", err
 	}
-
 	return buf.String(), nil
 }
 
@@ -261,6 +544,10 @@ func (c *k8sClient) IsMetalProvisioningExists() (bool, error) {
 		c.log.Infof("Baremetal provisioning CR is not found")
 		return false, nil
 	}
+	if meta.IsNoMatchError(err) {
+		c.log.Infof("Baremetal provisioning CRD is not installed")
+		return false, nil
+	}
 
 	if err != nil {
 		return false, err
@@ -278,11 +565,22 @@ func (c *k8sClient) ListBMHs() (metal3v1alpha1.BareMetalHostList, error) {
 	err := c.runtimeClient.List(context.Background(), &hosts, opts)
 	if err != nil {
 		c.log.Errorf("failed to list BMHs, error %s", err)
-		return metal3v1alpha1.BareMetalHostList{}, err
+		return metal3v1alpha1.BareMetalHostList{}, bmhListError(err)
 	}
 	return hosts, nil
 }
 
+// ErrBMHCRDNotInstalled is returned by ListBMHs when the BareMetalHost CRD isn't installed, i.e. on non baremetal clusters
+var ErrBMHCRDNotInstalled = errors.New("BareMetalHost CRD is not installed")
+
+// bmhListError tells the BareMetalHost kind not being served apart from errors that may go away on retry
+func bmhListError(err error) error {
+	if meta.IsNoMatchError(err) {
+		return ErrBMHCRDNotInstalled
+	}
+	return err
+}
+
 func (c *k8sClient) UpdateBMHStatus(bmh *metal3v1alpha1.BareMetalHost) error {
 	return c.runtimeClient.Status().Update(context.TODO(), bmh)
 }
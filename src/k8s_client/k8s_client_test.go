@@ -0,0 +1,493 @@
+package k8s_client
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestK8SClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "k8s_client_test")
+}
+
+var _ = Describe("csr api discovery", func() {
+	var (
+		fakeDiscovery *fakediscovery.FakeDiscovery
+		clientset     *fake.Clientset
+		dynamicClient *fakedynamic.FakeDynamicClient
+		logger        = logrus.New()
+	)
+	logger.SetOutput(ioutil.Discard)
+	served := func(groupVersion string) *metav1.APIResourceList {
+		return &metav1.APIResourceList{
+			GroupVersion: groupVersion,
+			APIResources: []metav1.APIResource{{Name: "certificatesigningrequests"}},
+		}
+	}
+
+	BeforeEach(func() {
+		clientset = fake.NewSimpleClientset()
+		fakeDiscovery = clientset.Discovery().(*fakediscovery.FakeDiscovery)
+		dynamicClient = fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	})
+
+	It("uses v1beta1 while it is served", func() {
+		fakeDiscovery.Resources = []*metav1.APIResourceList{served("certificates.k8s.io/v1beta1"), served("certificates.k8s.io/v1")}
+		api, err := newCsrAPI(fakeDiscovery, clientset.CertificatesV1beta1().CertificateSigningRequests(), dynamicClient, logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(api).To(BeAssignableToTypeOf(csrV1beta1API{}))
+		Expect(k8sClient{csrClient: api}.CsrGroupVersion()).To(Equal("certificates.k8s.io/v1beta1"))
+	})
+	It("uses v1 when only v1 is served", func() {
+		fakeDiscovery.Resources = []*metav1.APIResourceList{served("certificates.k8s.io/v1")}
+		api, err := newCsrAPI(fakeDiscovery, clientset.CertificatesV1beta1().CertificateSigningRequests(), dynamicClient, logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(api).To(BeAssignableToTypeOf(csrV1API{}))
+		Expect(k8sClient{csrClient: api}.CsrGroupVersion()).To(Equal("certificates.k8s.io/v1"))
+	})
+	It("fails when no csr api is served", func() {
+		_, err := newCsrAPI(fakeDiscovery, clientset.CertificatesV1beta1().CertificateSigningRequests(), dynamicClient, logger)
+		Expect(err).To(MatchError(ContainSubstring("csrs can't be listed or approved")))
+	})
+	It("ListCsrs and ApproveCsr fail when no csr api is served", func() {
+		notServed := fmt.Errorf("not served")
+		c := k8sClient{csrAPIError: notServed}
+		_, err := c.ListCsrs()
+		Expect(err).To(Equal(notServed))
+		Expect(c.ApproveCsr(nil)).To(Equal(notServed))
+	})
+})
+
+var _ = Describe("v1beta1 csr approval", func() {
+	csrResource := schema.GroupResource{Group: "certificates.k8s.io", Resource: "certificatesigningrequests"}
+	var (
+		clientset  *fake.Clientset
+		approvals  int
+		conflicts  int
+		pendingCsr *certificatesv1beta1.CertificateSigningRequest
+	)
+	BeforeEach(func() {
+		pendingCsr = &certificatesv1beta1.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: "csr-0"}}
+		clientset = fake.NewSimpleClientset(pendingCsr.DeepCopy())
+		approvals, conflicts = 0, 0
+		clientset.PrependReactor("update", "certificatesigningrequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "approval" {
+				return false, nil, nil
+			}
+			approvals++
+			if conflicts > 0 {
+				conflicts--
+				return true, nil, apierrors.NewConflict(csrResource, "csr-0", fmt.Errorf("the object has been modified"))
+			}
+			return false, nil, nil
+		})
+	})
+	isApproved := func() bool {
+		csr, err := clientset.CertificatesV1beta1().CertificateSigningRequests().Get(context.TODO(), "csr-0", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		for _, condition := range csr.Status.Conditions {
+			if condition.Type == certificatesv1beta1.CertificateApproved {
+				return true
+			}
+		}
+		return false
+	}
+
+	It("approves the csr", func() {
+		Expect(approveCsr(csrV1beta1API{csrs: clientset.CertificatesV1beta1().CertificateSigningRequests()}, pendingCsr, 3)).To(Succeed())
+		Expect(approvals).To(Equal(1))
+		Expect(isApproved()).To(BeTrue())
+	})
+	It("refetches the csr and approves it again after a conflict", func() {
+		conflicts = 1
+		Expect(approveCsr(csrV1beta1API{csrs: clientset.CertificatesV1beta1().CertificateSigningRequests()}, pendingCsr, 3)).To(Succeed())
+		Expect(approvals).To(Equal(2))
+		Expect(isApproved()).To(BeTrue())
+	})
+	It("gives up after the max attempts", func() {
+		conflicts = 5
+		err := approveCsr(csrV1beta1API{csrs: clientset.CertificatesV1beta1().CertificateSigningRequests()}, pendingCsr, 3)
+		Expect(apierrors.IsConflict(err)).To(BeTrue())
+		Expect(approvals).To(Equal(3))
+		Expect(isApproved()).To(BeFalse())
+	})
+	It("doesn't approve again a csr that was approved meanwhile", func() {
+		approvedCsr := pendingCsr.DeepCopy()
+		approvedCsr.Status.Conditions = []certificatesv1beta1.CertificateSigningRequestCondition{{Type: certificatesv1beta1.CertificateApproved}}
+		Expect(clientset.Tracker().Update(schema.GroupVersionResource{Group: "certificates.k8s.io", Version: "v1beta1",
+			Resource: "certificatesigningrequests"}, approvedCsr, "")).To(Succeed())
+		conflicts = 1
+		Expect(approveCsr(csrV1beta1API{csrs: clientset.CertificatesV1beta1().CertificateSigningRequests()}, pendingCsr, 3)).To(Succeed())
+		Expect(approvals).To(Equal(1))
+	})
+	It("fails on a missing csr", func() {
+		err := approveCsr(csrV1beta1API{csrs: fake.NewSimpleClientset().CertificatesV1beta1().CertificateSigningRequests()}, pendingCsr, 3)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("v1 csr approval", func() {
+	var (
+		dynamicClient *fakedynamic.FakeDynamicClient
+		api           csrV1API
+		approvals     int
+		conflicts     int
+	)
+	v1Csr := func(name string, conditions ...interface{}) *unstructured.Unstructured {
+		csr := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "certificates.k8s.io/v1",
+			"kind":       "CertificateSigningRequest",
+			"metadata":   map[string]interface{}{"name": name},
+			"spec": map[string]interface{}{
+				"signerName": "kubernetes.io/kubelet-serving",
+				"request":    base64.StdEncoding.EncodeToString([]byte("request")),
+				"username":   "system:node:node0",
+			},
+		}}
+		if len(conditions) > 0 {
+			Expect(unstructured.SetNestedSlice(csr.Object, conditions, "status", "conditions")).To(Succeed())
+		}
+		return csr
+	}
+	conditionsOf := func(name string) []interface{} {
+		csr, err := dynamicClient.Resource(csrV1Resource).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		conditions, _, err := unstructured.NestedSlice(csr.Object, "status", "conditions")
+		Expect(err).NotTo(HaveOccurred())
+		return conditions
+	}
+
+	BeforeEach(func() {
+		dynamicClient = fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), v1Csr("csr-0"),
+			v1Csr("csr-1", map[string]interface{}{"type": "Approved", "status": "True"}))
+		api = csrV1API{csrs: dynamicClient.Resource(csrV1Resource)}
+		approvals, conflicts = 0, 0
+		dynamicClient.PrependReactor("update", "certificatesigningrequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "approval" {
+				return false, nil, nil
+			}
+			approvals++
+			if conflicts > 0 {
+				conflicts--
+				return true, nil, apierrors.NewConflict(csrV1Resource.GroupResource(), "csr-0", fmt.Errorf("the object has been modified"))
+			}
+			return false, nil, nil
+		})
+	})
+
+	It("lists the v1 csrs as v1beta1 csrs", func() {
+		csrs, err := api.List(context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(csrs.Items).To(HaveLen(2))
+		for _, csr := range csrs.Items {
+			Expect(*csr.Spec.SignerName).To(Equal("kubernetes.io/kubelet-serving"))
+			Expect(csr.Spec.Request).To(Equal([]byte("request")))
+			if csr.Name == "csr-1" {
+				Expect(csr.Status.Conditions).To(HaveLen(1))
+				Expect(csr.Status.Conditions[0].Type).To(Equal(certificatesv1beta1.CertificateApproved))
+			}
+		}
+	})
+	It("approves the v1 csr with a true approved condition", func() {
+		csr, err := api.Get(context.TODO(), "csr-0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(approveCsr(api, csr, 3)).To(Succeed())
+		Expect(approvals).To(Equal(1))
+		conditions := conditionsOf("csr-0")
+		Expect(conditions).To(HaveLen(1))
+		Expect(conditions[0]).To(HaveKeyWithValue("type", "Approved"))
+		Expect(conditions[0]).To(HaveKeyWithValue("status", "True"))
+		Expect(conditions[0]).To(HaveKeyWithValue("reason", "NodeCSRApprove"))
+	})
+	It("refetches the v1 csr and approves it again after a conflict", func() {
+		csr, err := api.Get(context.TODO(), "csr-0")
+		Expect(err).NotTo(HaveOccurred())
+		conflicts = 1
+		Expect(approveCsr(api, csr, 3)).To(Succeed())
+		Expect(approvals).To(Equal(2))
+		Expect(conditionsOf("csr-0")).To(HaveLen(1))
+	})
+	It("doesn't approve again a v1 csr that was approved meanwhile", func() {
+		csr, err := api.Get(context.TODO(), "csr-1")
+		Expect(err).NotTo(HaveOccurred())
+		csr.Status.Conditions = nil
+		conflicts = 1
+		Expect(approveCsr(api, csr, 3)).To(Succeed())
+		Expect(approvals).To(Equal(1))
+		Expect(conditionsOf("csr-1")).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("etcd unpatch errors", func() {
+	etcdResource := schema.GroupResource{Group: "operator.openshift.io", Resource: "etcds"}
+	It("errors that won't be fixed by retrying are permanent", func() {
+		for _, err := range []error{
+			apierrors.NewNotFound(etcdResource, "cluster"),
+			apierrors.NewForbidden(etcdResource, "cluster", fmt.Errorf("dummy")),
+			apierrors.NewUnauthorized("dummy"),
+			apierrors.NewBadRequest("dummy"),
+			apierrors.NewInvalid(schema.GroupKind{Group: "operator.openshift.io", Kind: "Etcd"}, "cluster", nil),
+		} {
+			Expect(etcdUnpatchErrorResult(errors.Wrap(err, "Failed to unpatch etcd"))).To(Equal(EtcdUnpatchPermanentError), err.Error())
+		}
+	})
+	It("other errors are transient", func() {
+		for _, err := range []error{
+			apierrors.NewConflict(etcdResource, "cluster", fmt.Errorf("dummy")),
+			apierrors.NewServiceUnavailable("dummy"),
+			apierrors.NewTimeoutError("dummy", 1),
+			fmt.Errorf("connection refused"),
+		} {
+			Expect(etcdUnpatchErrorResult(err)).To(Equal(EtcdUnpatchTransientError), err.Error())
+		}
+	})
+})
+
+var _ = Describe("pod logs", func() {
+	It("options are passed to the pod log request", func() {
+		podLogOpts := PodLogsOptions{SinceSeconds: 300, TailLines: 100, Timeout: time.Second}.podLogOptions()
+		Expect(*podLogOpts.SinceSeconds).To(Equal(int64(300)))
+		Expect(*podLogOpts.TailLines).To(Equal(int64(100)))
+	})
+	It("zero options don't bound the pod log request", func() {
+		podLogOpts := PodLogsOptions{}.podLogOptions()
+		Expect(podLogOpts.SinceSeconds).To(BeNil())
+		Expect(podLogOpts.TailLines).To(BeNil())
+	})
+	It("reads the whole stream", func() {
+		logs, err := readPodLogs(context.Background(), ioutil.NopCloser(strings.NewReader("line1\nline2\n")))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(logs).To(Equal("line1\nline2\n"))
+	})
+	It("returns the logs that were read till the timeout", func() {
+		reader, writer := io.Pipe()
+		defer writer.Close()
+		go func() {
+			_, _ = writer.Write([]byte("line1\n"))
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		logs, err := readPodLogs(ctx, reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(logs).To(Equal("line1\n"))
+	})
+	It("fails on stream errors", func() {
+		reader, writer := io.Pipe()
+		_ = writer.CloseWithError(fmt.Errorf("stream error"))
+		_, err := readPodLogs(context.Background(), reader)
+		Expect(err).To(MatchError("stream error"))
+	})
+})
+
+var _ = Describe("etcd members", func() {
+	pod := func(name string, phase v1.PodPhase, ready v1.ConditionStatus) v1.Pod {
+		p := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: v1.PodSpec{NodeName: strings.TrimPrefix(name, "etcd-")}}
+		p.Status.Phase = phase
+		if ready != "" {
+			p.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: ready}}
+		}
+		return p
+	}
+	It("members are healthy once their pods are running and ready", func() {
+		Expect(etcdMembers([]v1.Pod{
+			pod("etcd-master-0", v1.PodRunning, v1.ConditionTrue),
+			pod("etcd-master-1", v1.PodRunning, v1.ConditionFalse),
+			pod("etcd-master-2", v1.PodPending, v1.ConditionTrue),
+			pod("etcd-master-3", v1.PodRunning, ""),
+		})).To(Equal([]EtcdMember{
+			{Name: "etcd-master-0", Node: "master-0", Healthy: true},
+			{Name: "etcd-master-1", Node: "master-1"},
+			{Name: "etcd-master-2", Node: "master-2"},
+			{Name: "etcd-master-3", Node: "master-3"},
+		}))
+	})
+})
+
+var _ = Describe("cordon node", func() {
+	It("marks the node unschedulable", func() {
+		nodes := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node0"}}).CoreV1().Nodes()
+		Expect(cordonNode(nodes, "node0")).To(Succeed())
+		node, err := nodes.Get(context.TODO(), "node0", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(node.Spec.Unschedulable).To(BeTrue())
+	})
+	It("fails on a missing node", func() {
+		nodes := fake.NewSimpleClientset().CoreV1().Nodes()
+		Expect(cordonNode(nodes, "node0")).To(MatchError(ContainSubstring("Failed to cordon node node0")))
+	})
+})
+
+var _ = Describe("uncordon node", func() {
+	It("marks the node schedulable", func() {
+		nodes := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node0"},
+			Spec: v1.NodeSpec{Unschedulable: true}}).CoreV1().Nodes()
+		Expect(uncordonNode(nodes, "node0")).To(Succeed())
+		node, err := nodes.Get(context.TODO(), "node0", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(node.Spec.Unschedulable).To(BeFalse())
+	})
+	It("fails on a missing node", func() {
+		nodes := fake.NewSimpleClientset().CoreV1().Nodes()
+		Expect(uncordonNode(nodes, "node0")).To(MatchError(ContainSubstring("Failed to uncordon node node0")))
+	})
+})
+
+var _ = Describe("annotate node", func() {
+	It("adds the annotations and keeps the others", func() {
+		nodes := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node0",
+			Annotations: map[string]string{"other": "value"}}}).CoreV1().Nodes()
+		Expect(annotateNode(nodes, "node0", map[string]string{"host-id": "id0"})).To(Succeed())
+		node, err := nodes.Get(context.TODO(), "node0", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(node.Annotations).To(Equal(map[string]string{"other": "value", "host-id": "id0"}))
+	})
+	It("fails on a missing node", func() {
+		nodes := fake.NewSimpleClientset().CoreV1().Nodes()
+		Expect(annotateNode(nodes, "node0", map[string]string{"host-id": "id0"})).To(MatchError(ContainSubstring("Failed to annotate node node0")))
+	})
+})
+
+var _ = Describe("BMH list errors", func() {
+	It("a missing BareMetalHost kind means the CRD is not installed", func() {
+		err := &meta.NoKindMatchError{GroupKind: schema.GroupKind{Group: "metal3.io", Kind: "BareMetalHost"}}
+		Expect(bmhListError(err)).To(Equal(ErrBMHCRDNotInstalled))
+	})
+	It("other errors are returned as is", func() {
+		err := apierrors.NewServiceUnavailable("dummy")
+		Expect(bmhListError(err)).To(Equal(err))
+	})
+})
+
+var _ = Describe("rest config selection", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "kubeconfig")
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("loads the kubeconfig at the given path", func() {
+		kubeconfig := filepath.Join(tmpDir, "kubeconfig")
+		Expect(ioutil.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://api.test.example.com:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: dummy
+`), 0600)).To(Succeed())
+		config, err := restConfig(kubeconfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Host).To(Equal("https://api.test.example.com:6443"))
+		Expect(config.BearerToken).To(Equal("dummy"))
+	})
+	It("fails on a missing kubeconfig", func() {
+		_, err := restConfig(filepath.Join(tmpDir, "missing"))
+		Expect(err).To(MatchError(ContainSubstring("loading kubeconfig")))
+	})
+	It("fails clearly without a kubeconfig path outside the cluster", func() {
+		host, hostSet := os.LookupEnv("KUBERNETES_SERVICE_HOST")
+		Expect(os.Unsetenv("KUBERNETES_SERVICE_HOST")).To(Succeed())
+		defer func() {
+			if hostSet {
+				os.Setenv("KUBERNETES_SERVICE_HOST", host)
+			}
+		}()
+		_, err := restConfig("")
+		Expect(err).To(MatchError(ContainSubstring("no kubeconfig path was given and the in-cluster config is not available")))
+	})
+})
+
+var _ = Describe("controller role", func() {
+	// the requests of the k8s client, a verb missing in the role is rejected as forbidden on a real cluster
+	required := []struct {
+		group    string
+		resource string
+		verbs    []string
+	}{
+		{"", "nodes", []string{"list", "patch"}},
+		{"", "pods", []string{"list"}},
+		{"", "pods/log", []string{"get"}},
+		{"", "configmaps", []string{"get"}},
+		{"", "events", []string{"create"}},
+		{"certificates.k8s.io", "certificatesigningrequests", []string{"get", "list"}},
+		{"certificates.k8s.io", "certificatesigningrequests/approval", []string{"update"}},
+		{"config.openshift.io", "clusteroperators", []string{"list"}},
+		{"config.openshift.io", "proxies", []string{"get"}},
+		{"operator.openshift.io", "etcds", []string{"get", "patch"}},
+		{"metal3.io", "baremetalhosts", []string{"list", "update"}},
+		{"metal3.io", "baremetalhosts/status", []string{"update"}},
+		{"metal3.io", "provisionings", []string{"get"}},
+	}
+	allows := func(role *rbacv1.ClusterRole, group string, resource string, verb string) bool {
+		for _, rule := range role.Rules {
+			if containsString(rule.APIGroups, group) && containsString(rule.Resources, resource) && containsString(rule.Verbs, verb) {
+				return true
+			}
+		}
+		return false
+	}
+
+	It("covers every request of the k8s client", func() {
+		f, err := os.Open("../../deploy/assisted-installer-controller/assisted-installer-controller-role.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		var role rbacv1.ClusterRole
+		Expect(yaml.NewYAMLOrJSONDecoder(f, 4096).Decode(&role)).To(Succeed())
+		for _, r := range required {
+			for _, verb := range r.verbs {
+				Expect(allows(&role, r.group, r.resource, verb)).To(BeTrue(),
+					"the role doesn't allow %s of %q resource %s", verb, r.group, r.resource)
+			}
+		}
+	})
+})
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
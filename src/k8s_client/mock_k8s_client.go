@@ -9,6 +9,7 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 	v1alpha1 "github.com/metal3-io/baremetal-operator/pkg/apis/metal3/v1alpha1"
+	v10 "github.com/openshift/api/config/v1"
 	ops "github.com/openshift/assisted-installer/src/ops"
 	v1beta1 "k8s.io/api/certificates/v1beta1"
 	v1 "k8s.io/api/core/v1"
@@ -67,11 +68,12 @@ func (mr *MockK8SClientMockRecorder) PatchEtcd() *gomock.Call {
 }
 
 // UnPatchEtcd mocks base method
-func (m *MockK8SClient) UnPatchEtcd() error {
+func (m *MockK8SClient) UnPatchEtcd() (EtcdUnpatchResult, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "UnPatchEtcd")
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(EtcdUnpatchResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // UnPatchEtcd indicates an expected call of UnPatchEtcd
@@ -80,6 +82,21 @@ func (mr *MockK8SClientMockRecorder) UnPatchEtcd() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnPatchEtcd", reflect.TypeOf((*MockK8SClient)(nil).UnPatchEtcd))
 }
 
+// IsEtcdPatched mocks base method
+func (m *MockK8SClient) IsEtcdPatched() (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsEtcdPatched")
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsEtcdPatched indicates an expected call of IsEtcdPatched
+func (mr *MockK8SClientMockRecorder) IsEtcdPatched() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsEtcdPatched", reflect.TypeOf((*MockK8SClient)(nil).IsEtcdPatched))
+}
+
 // ListNodes mocks base method
 func (m *MockK8SClient) ListNodes() (*v1.NodeList, error) {
 	m.ctrl.T.Helper()
@@ -139,6 +156,20 @@ func (mr *MockK8SClientMockRecorder) ListCsrs() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCsrs", reflect.TypeOf((*MockK8SClient)(nil).ListCsrs))
 }
 
+// CsrGroupVersion mocks base method
+func (m *MockK8SClient) CsrGroupVersion() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CsrGroupVersion")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// CsrGroupVersion indicates an expected call of CsrGroupVersion
+func (mr *MockK8SClientMockRecorder) CsrGroupVersion() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CsrGroupVersion", reflect.TypeOf((*MockK8SClient)(nil).CsrGroupVersion))
+}
+
 // GetConfigMap mocks base method
 func (m *MockK8SClient) GetConfigMap(namespace, name string) (*v1.ConfigMap, error) {
 	m.ctrl.T.Helper()
@@ -155,18 +186,18 @@ func (mr *MockK8SClientMockRecorder) GetConfigMap(namespace, name interface{}) *
 }
 
 // GetPodLogs mocks base method
-func (m *MockK8SClient) GetPodLogs(namespace, podName string, sinceSeconds int64) (string, error) {
+func (m *MockK8SClient) GetPodLogs(namespace, podName string, opts PodLogsOptions) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPodLogs", namespace, podName, sinceSeconds)
+	ret := m.ctrl.Call(m, "GetPodLogs", namespace, podName, opts)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPodLogs indicates an expected call of GetPodLogs
-func (mr *MockK8SClientMockRecorder) GetPodLogs(namespace, podName, sinceSeconds interface{}) *gomock.Call {
+func (mr *MockK8SClientMockRecorder) GetPodLogs(namespace, podName, opts interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPodLogs", reflect.TypeOf((*MockK8SClient)(nil).GetPodLogs), namespace, podName, sinceSeconds)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPodLogs", reflect.TypeOf((*MockK8SClient)(nil).GetPodLogs), namespace, podName, opts)
 }
 
 // GetPods mocks base method
@@ -255,3 +286,104 @@ func (mr *MockK8SClientMockRecorder) SetProxyEnvVars() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetProxyEnvVars", reflect.TypeOf((*MockK8SClient)(nil).SetProxyEnvVars))
 }
+
+// CreateEvent mocks base method
+func (m *MockK8SClient) CreateEvent(event *v1.Event) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateEvent", event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateEvent indicates an expected call of CreateEvent
+func (mr *MockK8SClientMockRecorder) CreateEvent(event interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateEvent", reflect.TypeOf((*MockK8SClient)(nil).CreateEvent), event)
+}
+
+// IsBootstrapComplete mocks base method
+func (m *MockK8SClient) IsBootstrapComplete() (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsBootstrapComplete")
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsBootstrapComplete indicates an expected call of IsBootstrapComplete
+func (mr *MockK8SClientMockRecorder) IsBootstrapComplete() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsBootstrapComplete", reflect.TypeOf((*MockK8SClient)(nil).IsBootstrapComplete))
+}
+
+// ListClusterOperators mocks base method
+func (m *MockK8SClient) ListClusterOperators() (*v10.ClusterOperatorList, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListClusterOperators")
+	ret0, _ := ret[0].(*v10.ClusterOperatorList)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListClusterOperators indicates an expected call of ListClusterOperators
+func (mr *MockK8SClientMockRecorder) ListClusterOperators() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListClusterOperators", reflect.TypeOf((*MockK8SClient)(nil).ListClusterOperators))
+}
+
+// ListEtcdMembers mocks base method
+func (m *MockK8SClient) ListEtcdMembers() ([]EtcdMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListEtcdMembers")
+	ret0, _ := ret[0].([]EtcdMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListEtcdMembers indicates an expected call of ListEtcdMembers
+func (mr *MockK8SClientMockRecorder) ListEtcdMembers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListEtcdMembers", reflect.TypeOf((*MockK8SClient)(nil).ListEtcdMembers))
+}
+
+// CordonNode mocks base method
+func (m *MockK8SClient) CordonNode(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CordonNode", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CordonNode indicates an expected call of CordonNode
+func (mr *MockK8SClientMockRecorder) CordonNode(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CordonNode", reflect.TypeOf((*MockK8SClient)(nil).CordonNode), name)
+}
+
+// AnnotateNode mocks base method
+func (m *MockK8SClient) AnnotateNode(name string, annotations map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AnnotateNode", name, annotations)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AnnotateNode indicates an expected call of AnnotateNode
+func (mr *MockK8SClientMockRecorder) AnnotateNode(name, annotations interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AnnotateNode", reflect.TypeOf((*MockK8SClient)(nil).AnnotateNode), name, annotations)
+}
+
+// UncordonNode mocks base method
+func (m *MockK8SClient) UncordonNode(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UncordonNode", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UncordonNode indicates an expected call of UncordonNode
+func (mr *MockK8SClientMockRecorder) UncordonNode(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UncordonNode", reflect.TypeOf((*MockK8SClient)(nil).UncordonNode), name)
+}
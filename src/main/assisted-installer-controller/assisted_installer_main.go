@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"sync"
-	"time"
+	"syscall"
 
 	"github.com/openshift/assisted-installer/src/k8s_client"
 	"golang.org/x/net/http/httpproxy"
@@ -34,8 +36,18 @@ func main() {
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+	if err = Options.ControllerConfig.LoadPullSecretToken(); err != nil {
+		log.Fatalf("Invalid assisted-installer-controller configuration: %v", err)
+	}
+	if err = Options.ControllerConfig.Validate(); err != nil {
+		log.Fatalf("Invalid assisted-installer-controller configuration: %v", err)
+	}
+
+	if Options.ControllerConfig.LogFormat == "json" {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	}
 
-	kc, err := k8s_client.NewK8SClient("", logger)
+	kc, err := k8s_client.NewControllerK8SClient(Options.ControllerConfig.KubeconfigPath, logger)
 	if err != nil {
 		log.Fatalf("Failed to create k8 client %v", err)
 	}
@@ -48,9 +60,18 @@ func main() {
 		log.Fatalf("Failed to set env vars for installer-controller pod %v", err)
 	}
 
+	proxyFunc := ProxyFromEnvVars
+	if Options.ControllerConfig.ProxyConfigured() {
+		logger.Infof("Using inventory proxy settings HTTP_PROXY: %s, HTTPS_PROXY: %s, NO_PROXY: %s",
+			Options.ControllerConfig.HTTPProxy, Options.ControllerConfig.HTTPSProxy, Options.ControllerConfig.NoProxy)
+		proxyFunc = inventory_client.ProxyFunc(Options.ControllerConfig.HTTPProxy, Options.ControllerConfig.HTTPSProxy,
+			Options.ControllerConfig.NoProxy)
+	}
+
 	client, err := inventory_client.CreateInventoryClient(Options.ControllerConfig.ClusterID,
 		Options.ControllerConfig.URL, Options.ControllerConfig.PullSecretToken, Options.ControllerConfig.SkipCertVerification,
-		Options.ControllerConfig.CACertPath, logger, ProxyFromEnvVars)
+		Options.ControllerConfig.CACertPath, Options.ControllerConfig.CACertReloadInterval,
+		Options.ControllerConfig.ClientCertPath, Options.ControllerConfig.ClientKeyPath, logger, proxyFunc)
 	if err != nil {
 		log.Fatalf("Failed to create inventory client %v", err)
 	}
@@ -62,23 +83,38 @@ func main() {
 		kc,
 	)
 
-	// While adding new routine don't miss to add wg.add(1)
-	// without adding it will panic
-	var wg sync.WaitGroup
-	done := make(chan bool)
-	go assistedController.ApproveCsrs(done, &wg)
-	wg.Add(1)
-	go assistedController.PostInstallConfigs(&wg)
-	wg.Add(1)
-	go assistedController.UpdateBMHs(&wg)
-	wg.Add(1)
-
-	assistedController.WaitAndUpdateNodesStatus()
-	logger.Infof("Sleeping for 10 minutes to give a chance to approve all crs")
-	time.Sleep(10 * time.Minute)
-	done <- true
-	logger.Infof("Waiting fo all go routines to finish")
-	wg.Wait()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cancelOnSignal(cancel, logger)
+	go pauseOnSignal(assistedController, logger)
+
+	if err = assistedController.Run(ctx); err != nil {
+		logger.WithError(err).Errorf("assisted-installer-controller didn't finish")
+	}
+}
+
+// cancelOnSignal cancels the controller context once SIGTERM or SIGINT is received,
+// letting all go routines return before the pod is killed
+func cancelOnSignal(cancel context.CancelFunc, logger *logrus.Logger) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-sigs
+	logger.Infof("Received signal %s, cancelling assisted-installer-controller", sig)
+	cancel()
+}
+
+// pauseOnSignal pauses the controller on SIGUSR1 and resumes it on SIGUSR2
+func pauseOnSignal(controller assistedinstallercontroller.Controller, logger *logrus.Logger) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2)
+	for sig := range sigs {
+		logger.Infof("Received signal %s", sig)
+		if sig == syscall.SIGUSR1 {
+			controller.Pause()
+		} else {
+			controller.Resume()
+		}
+	}
 }
 
 // ProxyFromEnvVars provides an alternative to http.ProxyFromEnvironment since it is being initialized only
@@ -23,7 +23,7 @@ func main() {
 
 	logger.Infof("Assisted installer started. Configuration is:\n %+v", config.GlobalConfig)
 	client, err := inventory_client.CreateInventoryClient(config.GlobalConfig.ClusterID, config.GlobalConfig.URL,
-		config.GlobalConfig.PullSecretToken, config.GlobalConfig.SkipCertVerification, config.GlobalConfig.CACertPath, logger, http.ProxyFromEnvironment)
+		config.GlobalConfig.PullSecretToken, config.GlobalConfig.SkipCertVerification, config.GlobalConfig.CACertPath, 0, "", "", logger, http.ProxyFromEnvironment)
 	if err != nil {
 		logger.Fatalf("Failed to create inventory client %e", err)
 	}
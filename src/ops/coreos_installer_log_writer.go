@@ -2,6 +2,7 @@ package ops
 
 import (
 	"bytes"
+	"context"
 	"regexp"
 	"strconv"
 	"strings"
@@ -56,7 +57,7 @@ func (l *CoreosInstallerLogWriter) reportProgress() {
 	}
 	if currentPercent >= l.lastProgress+MinProgressDelta {
 		// If the progress is more than 5% report it
-		if err := l.progressReporter.UpdateHostInstallProgress(l.hostID, models.HostStageWritingImageToDisk, match[2]); err == nil {
+		if err := l.progressReporter.UpdateHostInstallProgress(context.Background(), l.hostID, models.HostStageWritingImageToDisk, match[2]); err == nil {
 			l.lastProgress = currentPercent
 		}
 	}
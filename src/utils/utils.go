@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"os"
 	"path/filepath"
@@ -161,6 +162,14 @@ func Retry(attempts int, sleep time.Duration, log *logrus.Logger, f func() error
 	return fmt.Errorf("failed after %d attempts, last error: %s", attempts, err)
 }
 
+// Jitter returns the duration randomly spread by up to ±factor of it
+func Jitter(d time.Duration, factor float64) time.Duration {
+	if factor <= 0 {
+		return d
+	}
+	return d + time.Duration((rand.Float64()*2-1)*factor*float64(d))
+}
+
 func GetHostIpsFromInventory(inventory *models.Inventory) ([]string, error) {
 	var ips []string
 	for _, netInt := range inventory.Interfaces {
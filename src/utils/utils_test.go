@@ -130,4 +130,17 @@ var _ = Describe("Verify_utils", func() {
 
 		})
 	})
+	Context("Jitter", func() {
+		It("stays within the jitter bounds", func() {
+			d := 30 * time.Second
+			for i := 0; i < 1000; i++ {
+				jittered := Jitter(d, 0.2)
+				Expect(jittered).Should(BeNumerically(">=", 24*time.Second))
+				Expect(jittered).Should(BeNumerically("<=", 36*time.Second))
+			}
+		})
+		It("returns the duration as is without jitter factor", func() {
+			Expect(Jitter(30*time.Second, 0)).Should(Equal(30 * time.Second))
+		})
+	})
 })
@@ -0,0 +1,16 @@
+// Package version holds the build information that is set at link time, e.g.
+// go build -ldflags "-X github.com/openshift/assisted-installer/src/version.GitCommit=$(git rev-parse HEAD)"
+package version
+
+import "fmt"
+
+var (
+	Version   = "unknown"
+	GitCommit = "unknown"
+	BuildDate = "unknown"
+)
+
+// String describes the running build
+func String() string {
+	return fmt.Sprintf("version %s, commit %s, built at %s", Version, GitCommit, BuildDate)
+}